@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/kvizdos/typesend/internal/sentry"
+	"github.com/kvizdos/typesend/pkg/typesend_analytics"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/sirupsen/logrus"
+)
+
+// Serves analytics rollups as JSON from a Lambda function URL.
+func main() {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	sentry.InitializeSentry(logger, "typesend_analytics")
+
+	apiKey := os.Getenv("TYPESEND_ANALYTICS_API_KEY")
+	if apiKey == "" {
+		log.Fatalf("TYPESEND_ANALYTICS_API_KEY is required")
+	}
+
+	project := os.Getenv("TYPESEND_PROJECT")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         os.Getenv("AWS_REGION"),
+		EnvelopesTable: fmt.Sprintf("%s_typesend_envelopes", project),
+		TemplatesTable: fmt.Sprintf("%s_typesend_templates", project),
+		ForceClient:    &dynamodb.DynamoDB{},
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+
+	handler := &typesend_analytics.Handler{
+		Database: db,
+		APIKey:   apiKey,
+		Logger:   logger,
+	}
+	lambda.Start(handler.HandleFunctionURL)
+}
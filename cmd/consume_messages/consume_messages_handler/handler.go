@@ -12,8 +12,11 @@ import (
 	"github.com/kvizdos/typesend/internal/consume_messages"
 	"github.com/kvizdos/typesend/internal/providers"
 	"github.com/kvizdos/typesend/internal/sentry"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,6 +25,12 @@ type ConsumeMessageHandlerDependencies struct {
 	Logger   typesend_schemas.Logger
 	DB       typesend_db.TypeSendDatabase
 	Provider providers.TypeSendProvider
+	// Optional; required once envelopes are sent with a KeyProvider.
+	KeyProvider typesend_crypto.KeyProvider
+	// Optional; adds List-Unsubscribe headers to every email.
+	Unsubscribe *typesend_unsubscribe.Links
+	// Optional; tracks opens and clicks.
+	Tracker *typesend_tracking.Tracker
 }
 
 // ConsumeMessageHandler contains the config and dependency references.
@@ -84,9 +93,12 @@ func (cmh *ConsumeMessageHandler) Handle(ctx context.Context, sqsEvent events.SQ
 			"envelope-id": envelope.ID,
 		})
 		err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
-			Logger:   logger,
-			Database: cmh.Deps.DB,
-			Provider: cmh.Deps.Provider,
+			Logger:      logger,
+			Database:    cmh.Deps.DB,
+			Provider:    cmh.Deps.Provider,
+			KeyProvider: cmh.Deps.KeyProvider,
+			Unsubscribe: cmh.Deps.Unsubscribe,
+			Tracker:     cmh.Deps.Tracker,
 		}, envelope)
 
 		if err != nil {
@@ -6,16 +6,60 @@ import (
 
 	"github.com/kvizdos/typesend/cmd/consume_messages/consume_messages_handler"
 	"github.com/kvizdos/typesend/cmd/consume_messages/use_provider"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	typesend_crypto_kms "github.com/kvizdos/typesend/pkg/typesend_crypto/kms"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
 )
 
 func main() {
 	provider := use_provider.GetProvider()
+
+	// The KMS key envelopes were encrypted with, if any.
+	var keyProvider typesend_crypto.KeyProvider
+	if keyID := os.Getenv("TYPESEND_KMS_KEY_ID"); keyID != "" {
+		kmsProvider, err := typesend_crypto_kms.NewKMSKeyProvider(keyID, os.Getenv("AWS_REGION"))
+		if err != nil {
+			log.Fatalf("Failed to set up KMS: %v", err)
+		}
+		keyProvider = kmsProvider
+	}
+
+	// Where cmd/unsubscribe is served, signing with the same secrets.
+	var unsubscribe *typesend_unsubscribe.Links
+	if unsubscribeURL := os.Getenv("TYPESEND_UNSUBSCRIBE_URL"); unsubscribeURL != "" {
+		signer, err := typesend_unsubscribe.ParseSecrets(os.Getenv("TYPESEND_UNSUBSCRIBE_SECRETS"))
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_UNSUBSCRIBE_SECRETS: %v", err)
+		}
+		unsubscribe, err = typesend_unsubscribe.NewLinks(signer, unsubscribeURL, os.Getenv("TYPESEND_UNSUBSCRIBE_MAILTO"))
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_UNSUBSCRIBE_URL: %v", err)
+		}
+	}
+
+	// Where cmd/tracking is served, signing with the same secrets.
+	var tracker *typesend_tracking.Tracker
+	if trackingURL := os.Getenv("TYPESEND_TRACKING_URL"); trackingURL != "" {
+		signer, err := typesend_tracking.ParseSecrets(os.Getenv("TYPESEND_TRACKING_SECRETS"))
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_TRACKING_SECRETS: %v", err)
+		}
+		tracker, err = typesend_tracking.NewTracker(signer, trackingURL)
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_TRACKING_URL: %v", err)
+		}
+	}
+
 	handler := &consume_messages_handler.ConsumeMessageHandler{
 		AWSRegion: os.Getenv("AWS_REGION"),
 		Project:   os.Getenv("TYPESEND_PROJECT"),
 		Env:       os.Getenv("ENV"),
 		Deps: &consume_messages_handler.ConsumeMessageHandlerDependencies{
-			Provider: provider,
+			Provider:    provider,
+			KeyProvider: keyProvider,
+			Unsubscribe: unsubscribe,
+			Tracker:     tracker,
 		},
 	}
 	err := handler.Setup()
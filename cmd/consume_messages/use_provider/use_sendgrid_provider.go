@@ -8,7 +8,13 @@ import (
 	"github.com/sendgrid/sendgrid-go"
 )
 
+// GetProvider returns the provider named by TYPESEND_PROVIDER,
+// "ses" or "sendgrid" (the default).
 func GetProvider() providers.TypeSendProvider {
+	if os.Getenv("TYPESEND_PROVIDER") == "ses" {
+		return getSESProvider()
+	}
+
 	sendgridAPIKey := os.Getenv("TYPESEND_SENDGRID_KEY")
 	if sendgridAPIKey == "" {
 		panic("Missing TYPESEND_SENDGRID_KEY env")
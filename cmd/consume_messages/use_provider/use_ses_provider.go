@@ -0,0 +1,16 @@
+package use_provider
+
+import (
+	"os"
+
+	"github.com/kvizdos/typesend/internal/providers"
+	providers_ses "github.com/kvizdos/typesend/internal/providers/ses"
+)
+
+func getSESProvider() providers.TypeSendProvider {
+	provider, err := providers_ses.NewSESProvider(os.Getenv("AWS_REGION"), os.Getenv("TYPESEND_SES_CONFIGURATION_SET"))
+	if err != nil {
+		panic("Failed to set up SES: " + err.Error())
+	}
+	return provider
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/kvizdos/typesend/internal/dispatch_messages"
 	"github.com/kvizdos/typesend/internal/sentry"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 	"github.com/sirupsen/logrus"
 )
@@ -30,6 +31,8 @@ type DispatchMessagesDependencies struct {
 	Dispatcher      typequeue.TypeQueueDispatcher[*typesend_schemas.TypeSendEnvelope]
 	DB              typesend_db.TypeSendDatabase
 	ContextDeadline time.Time
+	// Optional; told how each dispatch run went.
+	Metrics typesend_metrics.DispatchMetricsProvider
 }
 
 // DispatchMessagesLambda contains the config and dependency references.
@@ -40,6 +43,14 @@ type DispatchMessagesLambda struct {
 	Env       string
 	TraceID   string
 
+	// Optional; see dispatch_messages.DispatchOpts.
+	RateLimits        []typesend_schemas.TypeSendRateLimit
+	ProviderName      string
+	PriorityQueues    map[typesend_schemas.TypeSendPriority]string
+	Retention         []typesend_schemas.TypeSendRetention
+	PurgeInterval     time.Duration
+	AggregateInterval time.Duration
+
 	// Dependencies are injected here. If nil, Setup will create them.
 	Deps *DispatchMessagesDependencies
 }
@@ -89,10 +100,7 @@ func (dml *DispatchMessagesLambda) Setup() error {
 			dml.Deps.Logger.Errorf("failed to connect to SSM: %s", err.Error())
 			return fmt.Errorf("failed to connect to SSM: %w", err)
 		}
-		dml.Deps.Dispatcher = &typequeue.Dispatcher[*typesend_schemas.TypeSendEnvelope]{
-			SQSClient:         sqsClient,
-			GetTargetQueueURL: ssmHelper.GetTargetURL,
-		}
+		dml.Deps.Dispatcher = dispatch_messages.NewSQSBatchDispatcher(sqsClient, ssmHelper.GetTargetURL)
 	}
 
 	// Connect to DynamoDB.
@@ -102,6 +110,8 @@ func (dml *DispatchMessagesLambda) Setup() error {
 		dynamo, err := typesend_db.NewDynamoDB(dynamoCtx, &typesend_db.DynamoConfig{
 			Region:         dml.AWSRegion,
 			EnvelopesTable: fmt.Sprintf("%s_typesend_envelopes", dml.Project),
+			TemplatesTable: fmt.Sprintf("%s_typesend_templates", dml.Project),
+			SchedulesTable: fmt.Sprintf("%s_typesend_schedules", dml.Project),
 			ForceClient:    &dynamodb.DynamoDB{},
 		})
 		if err != nil {
@@ -129,10 +139,17 @@ func (dml *DispatchMessagesLambda) HandleRequest(ctx context.Context) error {
 
 	// Dispatch messages.
 	err := dispatchMessagesReadyToSendFn(&dispatch_messages.DispatchOpts{
-		Context:    sendingCtx,
-		Database:   dml.Deps.DB,
-		Dispatcher: dml.Deps.Dispatcher,
-		Logger:     dml.Deps.Logger,
+		Context:           sendingCtx,
+		Database:          dml.Deps.DB,
+		Dispatcher:        dml.Deps.Dispatcher,
+		Logger:            dml.Deps.Logger,
+		RateLimits:        dml.RateLimits,
+		ProviderName:      dml.ProviderName,
+		PriorityQueues:    dml.PriorityQueues,
+		Retention:         dml.Retention,
+		PurgeInterval:     dml.PurgeInterval,
+		AggregateInterval: dml.AggregateInterval,
+		Metrics:           dml.Deps.Metrics,
 	})
 	if err != nil {
 		if err == context.DeadlineExceeded {
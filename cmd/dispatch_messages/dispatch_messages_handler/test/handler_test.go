@@ -34,6 +34,14 @@ func (s *stubbedDb) UpdateEnvelopeStatus(ctx context.Context, envelopeID string,
 	return nil
 }
 
+func (s *stubbedDb) UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error {
+	return make([]error, len(envelopeIDs))
+}
+
+func (s *stubbedDb) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	return make([]error, len(envelopeIDs))
+}
+
 func (s *stubbedDb) GetMessagesReadyToSend(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendEnvelope, error) {
 	ch := make(chan *typesend_schemas.TypeSendEnvelope)
 
@@ -47,6 +55,21 @@ func (s *stubbedDb) GetMessagesReadyToSend(ctx context.Context, timestamp time.T
 	return ch, nil
 }
 
+func (s *stubbedDb) GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	ch := make(chan *typesend_schemas.TypeSendEnvelope)
+
+	go func() {
+		defer close(ch)
+		for _, env := range s.MessagesReadyToSend {
+			if env.Priority.Effective() == priority.Effective() {
+				ch <- env
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
 func TestHandlerSuccess(t *testing.T) {
 	dispatcher := &typequeue_mocks.MockDispatcher[*typesend_schemas.TypeSendEnvelope]{
 		Messages: make(map[string][]*typesend_schemas.TypeSendEnvelope),
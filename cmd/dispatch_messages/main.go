@@ -3,18 +3,68 @@ package main
 import (
 	"log"
 	"os"
+	"time"
+	// Recipient time zones are resolved without relying on the
+	// Lambda runtime shipping a zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/kvizdos/typesend/cmd/dispatch_messages/dispatch_messages_handler"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
 
 func main() {
+	rateLimits, err := typesend_schemas.ParseRateLimits(os.Getenv("TYPESEND_RATE_LIMITS"))
+	if err != nil {
+		log.Fatalf("Failed to parse TYPESEND_RATE_LIMITS: %v", err)
+	}
+
+	retention, err := typesend_schemas.ParseRetention(os.Getenv("TYPESEND_RETENTION"))
+	if err != nil {
+		log.Fatalf("Failed to parse TYPESEND_RETENTION: %v", err)
+	}
+
+	// e.g. "1h"; unset leaves purging to the DynamoDB TTL.
+	var purgeInterval time.Duration
+	if raw := os.Getenv("TYPESEND_PURGE_INTERVAL"); raw != "" {
+		purgeInterval, err = time.ParseDuration(raw)
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_PURGE_INTERVAL: %v", err)
+		}
+	}
+
+	// e.g. "15m"; unset leaves analytics unaggregated.
+	var aggregateInterval time.Duration
+	if raw := os.Getenv("TYPESEND_AGGREGATE_INTERVAL"); raw != "" {
+		aggregateInterval, err = time.ParseDuration(raw)
+		if err != nil {
+			log.Fatalf("Failed to parse TYPESEND_AGGREGATE_INTERVAL: %v", err)
+		}
+	}
+
+	providerName := os.Getenv("TYPESEND_PROVIDER_NAME")
+	if providerName == "" {
+		providerName = "SendGrid"
+	}
+
+	// Lanes without a queue configured share the default email_queue.
+	priorityQueues := map[typesend_schemas.TypeSendPriority]string{
+		typesend_schemas.TypeSendPriority_HIGH: os.Getenv("TYPESEND_HIGH_PRIORITY_QUEUE"),
+		typesend_schemas.TypeSendPriority_LOW:  os.Getenv("TYPESEND_LOW_PRIORITY_QUEUE"),
+	}
+
 	handler := &dispatch_messages_handler.DispatchMessagesLambda{
-		AWSRegion: os.Getenv("AWS_REGION"),
-		Project:   os.Getenv("TYPESEND_PROJECT"),
-		Env:       os.Getenv("ENV"),
+		AWSRegion:         os.Getenv("AWS_REGION"),
+		Project:           os.Getenv("TYPESEND_PROJECT"),
+		Env:               os.Getenv("ENV"),
+		RateLimits:        rateLimits,
+		ProviderName:      providerName,
+		PriorityQueues:    priorityQueues,
+		Retention:         retention,
+		PurgeInterval:     purgeInterval,
+		AggregateInterval: aggregateInterval,
 	}
-	err := handler.Setup()
+	err = handler.Setup()
 	if err != nil {
 		log.Fatalf("Failed to set up handler: %v", err)
 	}
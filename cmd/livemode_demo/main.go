@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"os"
 	"time"
 
 	"github.com/kvizdos/typesend/cmd/livemode_demo/livemode_demo_variables"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
 	"github.com/kvizdos/typesend/pkg/typesend_livemode"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 	"github.com/sirupsen/logrus"
@@ -13,8 +16,24 @@ import (
 func main() {
 	logger := logrus.New()
 
-	// Create the LiveMode TypeSend
-	ts, db := typesend_livemode.StartTypeSendLive(context.Background(), logger, "demo-app")
+	// Create the LiveMode TypeSend, kept on disk when
+	// TYPESEND_LIVE_DB_PATH is set so restarts keep every envelope.
+	var ts *typesend.TypeSend
+	var db typesend_db.TypeSendDatabase
+	if path := os.Getenv("TYPESEND_LIVE_DB_PATH"); path != "" {
+		boltDB, err := typesend_db.NewBoltDB(context.Background(), &typesend_db.BoltConfig{
+			Path: path,
+		})
+		if err != nil {
+			logger.Panic(err)
+			return
+		}
+		defer boltDB.Close()
+
+		ts, db = typesend_livemode.StartTypeSendLiveWithDatabase(context.Background(), logger, "demo-app", boltDB), boltDB
+	} else {
+		ts, db = typesend_livemode.StartTypeSendLive(context.Background(), logger, "demo-app")
+	}
 
 	err := livemode_demo_variables.RegisterVariables(db)
 
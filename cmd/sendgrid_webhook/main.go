@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/kvizdos/typesend/internal/sentry"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	typesend_events_sendgrid "github.com/kvizdos/typesend/pkg/typesend_events/sendgrid"
+	"github.com/sirupsen/logrus"
+)
+
+// Serves SendGrid's Event Webhook as a Lambda function URL.
+func main() {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	sentry.InitializeSentry(logger, "typesend_sendgrid_webhook")
+
+	publicKey, err := typesend_events_sendgrid.ParsePublicKey(os.Getenv("TYPESEND_SENDGRID_WEBHOOK_KEY"))
+	if err != nil {
+		log.Fatalf("Failed to parse TYPESEND_SENDGRID_WEBHOOK_KEY: %v", err)
+	}
+
+	project := os.Getenv("TYPESEND_PROJECT")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         os.Getenv("AWS_REGION"),
+		EnvelopesTable: fmt.Sprintf("%s_typesend_envelopes", project),
+		TemplatesTable: fmt.Sprintf("%s_typesend_templates", project),
+		ForceClient:    &dynamodb.DynamoDB{},
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+
+	handler := &typesend_events_sendgrid.Handler{
+		Recorder: &typesend_events.Recorder{
+			Database: db,
+			Logger:   logger,
+		},
+		PublicKey: publicKey,
+		Logger:    logger,
+	}
+	lambda.Start(handler.HandleFunctionURL)
+}
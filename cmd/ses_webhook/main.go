@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/kvizdos/typesend/internal/sentry"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	typesend_events_ses "github.com/kvizdos/typesend/pkg/typesend_events/ses"
+	"github.com/sirupsen/logrus"
+)
+
+// Serves SES notifications, delivered by an SNS HTTPS
+// subscription, as a Lambda function URL.
+func main() {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	sentry.InitializeSentry(logger, "typesend_ses_webhook")
+
+	// Comma separated
+	topicARNs := strings.Split(os.Getenv("TYPESEND_SES_TOPIC_ARNS"), ",")
+	if os.Getenv("TYPESEND_SES_TOPIC_ARNS") == "" {
+		log.Fatalf("TYPESEND_SES_TOPIC_ARNS is required")
+	}
+
+	project := os.Getenv("TYPESEND_PROJECT")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         os.Getenv("AWS_REGION"),
+		EnvelopesTable: fmt.Sprintf("%s_typesend_envelopes", project),
+		TemplatesTable: fmt.Sprintf("%s_typesend_templates", project),
+		ForceClient:    &dynamodb.DynamoDB{},
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+
+	handler := &typesend_events_ses.Handler{
+		Recorder: &typesend_events.Recorder{
+			Database: db,
+			Logger:   logger,
+		},
+		TopicARNs: topicARNs,
+		Logger:    logger,
+	}
+	lambda.Start(handler.HandleFunctionURL)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/kvizdos/typesend/internal/sentry"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/sirupsen/logrus"
+)
+
+// Serves open and click tracking links as a Lambda function URL.
+func main() {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	sentry.InitializeSentry(logger, "typesend_tracking")
+
+	// Newest first, e.g. "<new>,<old>" while rotating.
+	signer, err := typesend_tracking.ParseSecrets(os.Getenv("TYPESEND_TRACKING_SECRETS"))
+	if err != nil {
+		log.Fatalf("Failed to parse TYPESEND_TRACKING_SECRETS: %v", err)
+	}
+
+	project := os.Getenv("TYPESEND_PROJECT")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         os.Getenv("AWS_REGION"),
+		EnvelopesTable: fmt.Sprintf("%s_typesend_envelopes", project),
+		TemplatesTable: fmt.Sprintf("%s_typesend_templates", project),
+		ForceClient:    &dynamodb.DynamoDB{},
+	})
+	if err != nil {
+		log.Fatalf("Failed to connect to DynamoDB: %v", err)
+	}
+
+	handler := &typesend_tracking.Handler{
+		Database: db,
+		Signer:   signer,
+		Logger:   logger,
+	}
+	lambda.Start(handler.HandleFunctionURL)
+}
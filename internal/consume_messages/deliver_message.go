@@ -7,14 +7,26 @@ import (
 
 	"github.com/kvizdos/typesend/internal"
 	"github.com/kvizdos/typesend/internal/providers"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
 )
 
 type DeliverMessageOptions struct {
 	Logger   typesend_schemas.Logger
 	Database typesend_db.TypeSendDatabase
 	Provider providers.TypeSendProvider
+
+	// Decrypts sealed envelopes; see TypeSend.KeyProvider.
+	KeyProvider typesend_crypto.KeyProvider
+	// Optional; adds List-Unsubscribe headers and the UnsubscribeURL
+	// and PreferencesURL variables to every email.
+	Unsubscribe *typesend_unsubscribe.Links
+	// Optional; tracks opens and clicks, for templates that allow it.
+	Tracker *typesend_tracking.Tracker
 }
 
 func DeliverMessage(opts *DeliverMessageOptions, queuedEnvelope *typesend_schemas.TypeSendEnvelope) error {
@@ -23,6 +35,7 @@ func DeliverMessage(opts *DeliverMessageOptions, queuedEnvelope *typesend_schema
 		- [x] Confirm the envelope hasn't been sent yet.
 		- [x] Confirm that the envelope is set to "DELIVERING" in Database
 			-- [x] If its not, just return `nil` here. It will be retried by the Scheduler.
+		- [x] Confirm the recipient isn't suppressed, or opted out of the category
 		- [x] Build the Template (e.g. fill variables)
 		- [x] Update Envelope status to "SENT"
 		- Send Email
@@ -65,12 +78,94 @@ func DeliverMessage(opts *DeliverMessageOptions, queuedEnvelope *typesend_schema
 		return fmt.Errorf("could not find associated template ID")
 	}
 
-	err = template.Fill(queuedEnvelope.Variables)
+	// Checked again here, as the recipient may have been
+	// erased since the envelope was sent or scheduled.
+	tombstone, err := erased(ctx, opts.Database, envelope, queuedEnvelope)
+	if err != nil {
+		return err
+	}
 
+	if tombstone != nil {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: envelope (%s) recipient was erased, skipping", envelope.ID)
+		typesend_events.Append(ctx, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_SUPPRESSED, "", map[string]string{
+			"reason": "erased",
+		}))
+		return opts.Database.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_SUPPRESSED)
+	}
+
+	// Likewise, they may have been suppressed since.
+	suppression, err := opts.Database.GetSuppression(ctx, envelope.AppID, envelope.TenantID, envelope.ToAddress)
 	if err != nil {
 		return err
 	}
 
+	if suppression != nil && suppression.Blocks(template.Transactional) {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: envelope (%s) recipient is suppressed (%s), skipping", envelope.ID, suppression.Reason)
+		typesend_events.Append(ctx, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_SUPPRESSED, "", map[string]string{
+			"reason": suppression.Reason.String(),
+		}))
+		return opts.Database.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_SUPPRESSED)
+	}
+
+	blocked, err := optedOut(ctx, opts.Database, envelope, template)
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: envelope (%s) recipient opted out of %s, skipping", envelope.ID, template.Category)
+		typesend_events.Append(ctx, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_SUPPRESSED, "", map[string]string{
+			"category": template.Category,
+		}))
+		return opts.Database.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_SUPPRESSED)
+	}
+
+	// Decrypted only here, just before the template is filled,
+	// so plaintext never goes back to the database or queue.
+	envelope, err = openEnvelope(ctx, opts.KeyProvider, envelope)
+	if err != nil {
+		return err
+	}
+	queuedEnvelope, err = openEnvelope(ctx, opts.KeyProvider, queuedEnvelope)
+	if err != nil {
+		return err
+	}
+
+	variables := queuedEnvelope.Variables
+	if len(envelope.DigestOf) > 0 {
+		variables, err = digestVariables(ctx, opts.Database, opts.KeyProvider, envelope)
+		if err != nil {
+			return err
+		}
+
+		if variables == nil {
+			internal.ProtectedWarnLogger(opts.Logger, "typesend: digest (%s) has no linked envelopes, skipping", envelope.ID)
+			typesend_events.Append(ctx, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_FAILED, "", map[string]string{
+				"error": "digest has no linked envelopes",
+			}))
+			return opts.Database.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_FAILED)
+		}
+	}
+
+	if opts.Unsubscribe != nil && template.WantsListUnsubscribe() {
+		variables, err = addUnsubscribe(opts.Unsubscribe, envelope, template, variables)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = template.Fill(variables)
+
+	if err != nil {
+		return err
+	}
+
+	if opts.Tracker != nil {
+		if err := track(opts, envelope, template); err != nil {
+			return err
+		}
+	}
+
 	err = opts.Database.UpdateEnvelopeStatus(context.Background(), envelope.ID, typesend_schemas.TypeSendStatus_SENT)
 
 	if err != nil {
@@ -82,14 +177,114 @@ func DeliverMessage(opts *DeliverMessageOptions, queuedEnvelope *typesend_schema
 		return fmt.Errorf("failed to update envelope status to DELIVERING: %w", err)
 	}
 
-	err = opts.Provider.Deliver(envelope, template)
+	messageID, err := opts.Provider.Deliver(envelope, template)
 
 	if err != nil {
 		opts.Database.UpdateEnvelopeStatus(context.Background(), envelope.ID, typesend_schemas.TypeSendStatus_FAILED)
 
 		internal.ProtectedErrorLogger(opts.Logger, "Failed to deliver envelope via %s (%s): %s", opts.Provider.GetProviderName(), envelope.ID, err.Error())
+		typesend_events.Append(ctx, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_FAILED, opts.Provider.GetProviderName(), map[string]string{
+			"error": err.Error(),
+		}))
 		return nil // Causes the scheduler to re-queue this message.
 	}
 
+	sent := typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_SENT, opts.Provider.GetProviderName(), nil)
+	sent.ProviderMessageID = messageID
+	typesend_events.Append(ctx, opts.Database, opts.Logger, sent)
 	return nil
 }
+
+// erased returns the tombstone of any of the envelopes addresses or
+// internal IDs, or nil when the recipient was never erased. The queued
+// copy is checked too, as erasing a DELIVERING envelope only replaces
+// the stored address with its pseudonym.
+func erased(ctx context.Context, db typesend_db.TypeSendDatabase, envelopes ...*typesend_schemas.TypeSendEnvelope) (*typesend_schemas.TypeSendTombstone, error) {
+	for _, envelope := range envelopes {
+		recipient := typesend_schemas.TypeSendRecipient{ToAddress: envelope.ToAddress, ToInternalID: envelope.ToInternalID}
+		for _, hash := range recipient.Hashes() {
+			tombstone, err := db.GetTombstone(ctx, hash)
+			if err != nil {
+				return nil, err
+			}
+			if tombstone != nil {
+				return tombstone, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// optedOut reports whether the recipient opted out of the templates
+// category. Categories are only looked up once an opt out is found.
+func optedOut(ctx context.Context, db typesend_db.TypeSendDatabase, envelope *typesend_schemas.TypeSendEnvelope, template *typesend_schemas.TypeSendTemplate) (bool, error) {
+	if template.Category == "" {
+		return false, nil
+	}
+
+	preferences, err := db.GetPreferences(ctx, envelope.AppID, envelope.TenantID, envelope.ToAddress)
+	if err != nil {
+		return false, err
+	}
+	if preferences == nil || !preferences.OptedOutOf(template.Category) {
+		return false, nil
+	}
+
+	categories, err := db.GetCategories(ctx, envelope.AppID)
+	if err != nil {
+		return false, err
+	}
+	return preferences.Blocks(template.Category, categories), nil
+}
+
+// addUnsubscribe sets the templates List-Unsubscribe headers, and
+// returns a copy of variables with the UnsubscribeURL and
+// PreferencesURL added.
+func addUnsubscribe(links *typesend_unsubscribe.Links, envelope *typesend_schemas.TypeSendEnvelope, template *typesend_schemas.TypeSendTemplate, variables map[string]interface{}) (map[string]interface{}, error) {
+	headers, err := links.Headers(envelope, template.Category)
+	if err != nil {
+		return nil, err
+	}
+	unsubscribeURL, err := links.URL(envelope, template.Category)
+	if err != nil {
+		return nil, err
+	}
+	preferencesURL, err := links.PreferencesURL(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	template.Headers = headers
+
+	withURLs := make(map[string]interface{}, len(variables)+2)
+	for key, value := range variables {
+		withURLs[key] = value
+	}
+	withURLs[typesend_unsubscribe.URLVariable] = unsubscribeURL
+	withURLs[typesend_unsubscribe.PreferencesURLVariable] = preferencesURL
+	return withURLs, nil
+}
+
+// track adds tracking to the filled template. Unsubscribe
+// links are left alone, so they work without the tracker.
+func track(opts *DeliverMessageOptions, envelope *typesend_schemas.TypeSendEnvelope, template *typesend_schemas.TypeSendTemplate) error {
+	var untracked []string
+	if opts.Unsubscribe != nil {
+		untracked = append(untracked, opts.Unsubscribe.BaseURL.String())
+	}
+	return opts.Tracker.Apply(envelope, template, untracked...)
+}
+
+// openEnvelope decrypts a copy of the envelope, as
+// some databases hand out the envelopes they store.
+func openEnvelope(ctx context.Context, keys typesend_crypto.KeyProvider, envelope *typesend_schemas.TypeSendEnvelope) (*typesend_schemas.TypeSendEnvelope, error) {
+	if envelope.Sealed == nil {
+		return envelope, nil
+	}
+
+	opened := *envelope
+	if err := typesend_crypto.OpenEnvelope(ctx, keys, &opened); err != nil {
+		return nil, err
+	}
+	return &opened, nil
+}
@@ -0,0 +1,46 @@
+package consume_messages
+
+import (
+	"context"
+
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// digestVariables builds the variables for a digest envelope: its own
+// Variables (those of the newest source), plus Digest, the Variables
+// of every source in the order they were sent. Sources that ended up
+// in another digest are left out. It returns nil if none remain.
+func digestVariables(ctx context.Context, db typesend_db.TypeSendDatabase, keys typesend_crypto.KeyProvider, digest *typesend_schemas.TypeSendEnvelope) (map[string]interface{}, error) {
+	sources := make([]map[string]interface{}, 0, len(digest.DigestOf))
+	for _, sourceID := range digest.DigestOf {
+		source, err := db.GetEnvelopeByID(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+
+		if source == nil || source.DigestID != digest.ID {
+			continue
+		}
+
+		source, err = openEnvelope(ctx, keys, source)
+		if err != nil {
+			return nil, err
+		}
+
+		sources = append(sources, source.Variables)
+	}
+
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	variables := make(map[string]interface{}, len(digest.Variables)+1)
+	for key, value := range digest.Variables {
+		variables[key] = value
+	}
+	variables["Digest"] = sources
+
+	return variables, nil
+}
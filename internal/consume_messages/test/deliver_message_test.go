@@ -11,8 +11,12 @@ import (
 	"github.com/kvizdos/typesend/internal/consume_messages"
 	providers_testing "github.com/kvizdos/typesend/internal/providers/tester"
 	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	typesend_crypto_local "github.com/kvizdos/typesend/pkg/typesend_crypto/local"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -315,3 +319,488 @@ func TestDeliverMessageProviderError(t *testing.T) {
 	}
 	assert.True(t, found, "Expected error log for provider error")
 }
+
+func TestDeliverMessageDigest(t *testing.T) {
+	testDb := &typesend_db.TestDatabase{}
+	if err := testDb.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	digest.Variables = map[string]interface{}{"Name": "Kenton"}
+
+	for _, event := range []string{"liked", "commented", "shared"} {
+		source := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_SENT, time.Now().UTC().Add(-time.Hour))
+		source.TemplateID = digest.TemplateID
+		source.Variables = map[string]interface{}{"Event": event}
+		source.DigestID = digest.ID
+		// Taken by another digest, so it must not be rendered here.
+		if event == "shared" {
+			source.DigestID = "another-digest"
+		}
+		assert.NoError(t, testDb.Insert(source))
+		digest.DigestOf = append(digest.DigestOf, source.ID)
+	}
+	assert.NoError(t, testDb.Insert(digest))
+
+	assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:   digest.TemplateID,
+		TenantID:     digest.TenantID,
+		Content:      "Hi {{ .Name }}:{{ range .Digest }} {{ .Event }}{{ end }}",
+		Subject:      "{{ len .Digest }} new events",
+		DigestWindow: time.Hour,
+	}))
+
+	provider := providers_testing.NewTestingProvider()
+
+	err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+		Logger:   &testutils.TestLogger{},
+		Database: testDb,
+		Provider: provider,
+	}, digest)
+	assert.NoError(t, err)
+
+	sentMsg := provider.GetMessageByEnvelopeID(digest.ID)
+	if !assert.NotNil(t, sentMsg) {
+		return
+	}
+	assert.Equal(t, "Hi Kenton: liked commented", sentMsg.Content)
+	assert.Equal(t, "2 new events", sentMsg.Subject)
+}
+
+func TestDeliverMessageDigestWithoutSources(t *testing.T) {
+	testDb := &typesend_db.TestDatabase{}
+	if err := testDb.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	digest := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	digest.DigestOf = []string{"missing"}
+	assert.NoError(t, testDb.Insert(digest))
+	assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID: digest.TemplateID,
+		TenantID:   digest.TenantID,
+		Content:    "{{ range .Digest }}{{ .Event }}{{ end }}",
+	}))
+
+	provider := providers_testing.NewTestingProvider()
+	logger := &testutils.TestLogger{}
+
+	err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+		Logger:   logger,
+		Database: testDb,
+		Provider: provider,
+	}, digest)
+	assert.NoError(t, err)
+	assert.Nil(t, provider.GetMessageByEnvelopeID(digest.ID), "empty digests should not be sent")
+	assert.NotEmpty(t, logger.WarnLogs)
+}
+
+func TestDeliverMessageSealed(t *testing.T) {
+	ctx := context.Background()
+	testDb := &typesend_db.TestDatabase{}
+	if err := testDb.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := typesend_crypto_local.NewLocalKeyProvider()
+	e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	e.Variables = map[string]interface{}{"Name": "Kenton"}
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, keys, e, false))
+	assert.NoError(t, testDb.Insert(e))
+	assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID: e.TemplateID,
+		TenantID:   e.TenantID,
+		Content:    "Hello {{ .Name }}",
+	}))
+
+	provider := providers_testing.NewTestingProvider()
+
+	err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+		Logger:      &testutils.TestLogger{},
+		Database:    testDb,
+		Provider:    provider,
+		KeyProvider: keys,
+	}, e)
+	assert.NoError(t, err)
+
+	sentMsg := provider.GetMessageByEnvelopeID(e.ID)
+	if assert.NotNil(t, sentMsg) {
+		assert.Equal(t, "Hello Kenton", sentMsg.Content)
+	}
+
+	stored, err := testDb.GetEnvelopeByID(ctx, e.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, stored.Sealed, "the stored envelope should stay sealed")
+	assert.Nil(t, stored.Variables)
+}
+
+func TestDeliverMessageSealedWithoutKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	testDb := &typesend_db.TestDatabase{}
+	if err := testDb.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, typesend_crypto_local.NewLocalKeyProvider(), e, false))
+	assert.NoError(t, testDb.Insert(e))
+	assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID: e.TemplateID,
+		TenantID:   e.TenantID,
+		Content:    "Hello world",
+	}))
+
+	provider := providers_testing.NewTestingProvider()
+
+	err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+		Logger:   &testutils.TestLogger{},
+		Database: testDb,
+		Provider: provider,
+	}, e)
+	assert.Error(t, err, "sealed envelopes should be retried, not sent without their variables")
+	assert.Nil(t, provider.GetMessageByEnvelopeID(e.ID))
+}
+
+func TestDeliverMessageSealedDigest(t *testing.T) {
+	ctx := context.Background()
+	testDb := &typesend_db.TestDatabase{}
+	if err := testDb.Connect(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := typesend_crypto_local.NewLocalKeyProvider()
+	digest := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	for _, event := range []string{"liked", "commented"} {
+		source := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_SENT, time.Now().UTC().Add(-time.Hour))
+		source.TenantID = digest.TenantID
+		source.TemplateID = digest.TemplateID
+		source.Variables = map[string]interface{}{"Event": event}
+		source.DigestID = digest.ID
+		assert.NoError(t, typesend_crypto.SealEnvelope(ctx, keys, source, false))
+		assert.NoError(t, testDb.Insert(source))
+		digest.DigestOf = append(digest.DigestOf, source.ID)
+	}
+	assert.NoError(t, testDb.Insert(digest))
+	assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:   digest.TemplateID,
+		TenantID:     digest.TenantID,
+		Content:      "{{ range .Digest }} {{ .Event }}{{ end }}",
+		DigestWindow: time.Hour,
+	}))
+
+	provider := providers_testing.NewTestingProvider()
+
+	err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+		Logger:      &testutils.TestLogger{},
+		Database:    testDb,
+		Provider:    provider,
+		KeyProvider: keys,
+	}, digest)
+	assert.NoError(t, err)
+
+	sentMsg := provider.GetMessageByEnvelopeID(digest.ID)
+	if assert.NotNil(t, sentMsg) {
+		assert.Equal(t, " liked commented", sentMsg.Content)
+	}
+}
+
+func TestDeliverMessageSuppressed(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		name          string
+		reason        typesend_schemas.TypeSendSuppressionReason
+		transactional bool
+		delivered     bool
+	}{
+		{"Unsubscribed", typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED, false, false},
+		{"UnsubscribedTransactional", typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED, true, true},
+		{"BouncedTransactional", typesend_schemas.TypeSendSuppressionReason_BOUNCED, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			if err := testDb.Connect(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			assert.NoError(t, testDb.Insert(e))
+			assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+				TemplateID:    e.TemplateID,
+				TenantID:      e.TenantID,
+				Content:       "Hello world",
+				Transactional: test.transactional,
+			}))
+			// Suppressed after the envelope was sent.
+			assert.NoError(t, testDb.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+				AppID:    e.AppID,
+				TenantID: e.TenantID,
+				Address:  e.ToAddress,
+				Reason:   test.reason,
+			}))
+
+			provider := providers_testing.NewTestingProvider()
+
+			err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:   &testutils.TestLogger{},
+				Database: testDb,
+				Provider: provider,
+			}, e)
+			assert.NoError(t, err)
+
+			stored, err := testDb.GetEnvelopeByID(ctx, e.ID)
+			assert.NoError(t, err)
+			if test.delivered {
+				assert.NotNil(t, provider.GetMessageByEnvelopeID(e.ID))
+				assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, stored.Status)
+			} else {
+				assert.Nil(t, provider.GetMessageByEnvelopeID(e.ID))
+				assert.Equal(t, typesend_schemas.TypeSendStatus_SUPPRESSED, stored.Status)
+			}
+		})
+	}
+}
+
+func TestDeliverMessageOptedOut(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		name      string
+		category  string
+		delivered bool
+	}{
+		{"OptedOut", "product-updates", false},
+		{"Mandatory", "security", true},
+		{"OtherCategory", "billing", true},
+		{"Uncategorized", "", true},
+		{"Unregistered", "retired", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			if err := testDb.Connect(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			assert.NoError(t, testDb.Insert(e))
+			assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+				TemplateID: e.TemplateID,
+				TenantID:   e.TenantID,
+				Content:    "Hello world",
+				Category:   test.category,
+			}))
+			assert.NoError(t, testDb.PutCategories(ctx, e.AppID, []*typesend_schemas.TypeSendCategory{
+				{ID: "product-updates", Name: "Product updates"},
+				{ID: "billing", Name: "Billing"},
+				{ID: "security", Name: "Security alerts", Mandatory: true},
+			}))
+			// Opted out after the envelope was sent.
+			assert.NoError(t, testDb.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+				AppID:    e.AppID,
+				TenantID: e.TenantID,
+				Address:  e.ToAddress,
+				OptedOut: []string{"product-updates", "security", "retired"},
+			}))
+
+			provider := providers_testing.NewTestingProvider()
+
+			err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:   &testutils.TestLogger{},
+				Database: testDb,
+				Provider: provider,
+			}, e)
+			assert.NoError(t, err)
+
+			stored, err := testDb.GetEnvelopeByID(ctx, e.ID)
+			assert.NoError(t, err)
+			if test.delivered {
+				assert.NotNil(t, provider.GetMessageByEnvelopeID(e.ID))
+				assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, stored.Status)
+			} else {
+				assert.Nil(t, provider.GetMessageByEnvelopeID(e.ID))
+				assert.Equal(t, typesend_schemas.TypeSendStatus_SUPPRESSED, stored.Status)
+			}
+		})
+	}
+}
+
+func TestDeliverMessageListUnsubscribe(t *testing.T) {
+	signer, err := typesend_unsubscribe.NewSigner([]byte(strings.Repeat("a", typesend_unsubscribe.MinSecretSize)))
+	assert.NoError(t, err)
+	links, err := typesend_unsubscribe.NewLinks(signer, "https://example.com/unsubscribe", "")
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		name          string
+		transactional bool
+		omit          bool
+		headers       bool
+	}{
+		{"Marketing", false, false, true},
+		{"MarketingCannotOmit", false, true, true},
+		{"Transactional", true, false, true},
+		{"TransactionalOmitted", true, true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			if err := testDb.Connect(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			e.Variables = map[string]interface{}{"Name": "Kenton"}
+			assert.NoError(t, testDb.Insert(e))
+			assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+				TemplateID:          e.TemplateID,
+				TenantID:            e.TenantID,
+				Content:             `{{ .Name }} <a href="{{ .UnsubscribeURL }}">unsubscribe</a> <a href="{{ .PreferencesURL }}">preferences</a>`,
+				Transactional:       test.transactional,
+				OmitListUnsubscribe: test.omit,
+			}))
+
+			provider := providers_testing.NewTestingProvider()
+
+			err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:      &testutils.TestLogger{},
+				Database:    testDb,
+				Provider:    provider,
+				Unsubscribe: links,
+			}, e)
+			assert.NoError(t, err)
+
+			sentMsg := provider.GetMessageByEnvelopeID(e.ID)
+			if !assert.NotNil(t, sentMsg) {
+				return
+			}
+
+			unsubscribeURL, _ := links.URL(e, "")
+			if test.headers {
+				assert.Contains(t, sentMsg.Headers[typesend_schemas.HeaderListUnsubscribe], unsubscribeURL)
+				assert.Equal(t, "List-Unsubscribe=One-Click", sentMsg.Headers[typesend_schemas.HeaderListUnsubscribePost])
+				assert.Contains(t, sentMsg.Content, "https://example.com/unsubscribe?token=")
+				assert.Contains(t, sentMsg.Content, "https://example.com/unsubscribe?preferences=1")
+			} else {
+				assert.Empty(t, sentMsg.Headers)
+				assert.NotContains(t, sentMsg.Content, "https://")
+			}
+			assert.NotContains(t, e.Variables, typesend_unsubscribe.URLVariable, "the stored variables should not be changed")
+		})
+	}
+}
+
+func TestDeliverMessageTracking(t *testing.T) {
+	unsubscribeSigner, err := typesend_unsubscribe.NewSigner([]byte(strings.Repeat("a", typesend_unsubscribe.MinSecretSize)))
+	assert.NoError(t, err)
+	links, err := typesend_unsubscribe.NewLinks(unsubscribeSigner, "https://example.com/unsubscribe", "")
+	assert.NoError(t, err)
+
+	trackingSigner, err := typesend_tracking.NewSigner([]byte(strings.Repeat("b", typesend_tracking.MinSecretSize)))
+	assert.NoError(t, err)
+	tracker, err := typesend_tracking.NewTracker(trackingSigner, "https://track.example.com/")
+	assert.NoError(t, err)
+
+	for _, test := range []struct {
+		name      string
+		sensitive bool
+		tracked   bool
+	}{
+		{"Tracked", false, true},
+		{"Sensitive", true, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			if err := testDb.Connect(nil); err != nil {
+				t.Fatal(err)
+			}
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			assert.NoError(t, testDb.Insert(e))
+			assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+				TemplateID: e.TemplateID,
+				TenantID:   e.TenantID,
+				Content:    `<body><a href="https://example.com/docs">docs</a> <a href="{{ .UnsubscribeURL }}">unsubscribe</a></body>`,
+				Sensitive:  test.sensitive,
+			}))
+
+			provider := providers_testing.NewTestingProvider()
+
+			err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:      &testutils.TestLogger{},
+				Database:    testDb,
+				Provider:    provider,
+				Unsubscribe: links,
+				Tracker:     tracker,
+			}, e)
+			assert.NoError(t, err)
+
+			sentMsg := provider.GetMessageByEnvelopeID(e.ID)
+			if !assert.NotNil(t, sentMsg) {
+				return
+			}
+
+			assert.Contains(t, sentMsg.Content, `href="https://example.com/unsubscribe?token=`, "unsubscribe links are never tracked")
+			if test.tracked {
+				assert.NotContains(t, sentMsg.Content, `href="https://example.com/docs"`)
+				assert.Contains(t, sentMsg.Content, `<a href="https://track.example.com/?token=`)
+				assert.Contains(t, sentMsg.Content, `<img src="https://track.example.com/?token=`)
+			} else {
+				assert.Contains(t, sentMsg.Content, `href="https://example.com/docs"`)
+				assert.NotContains(t, sentMsg.Content, "track.example.com")
+			}
+		})
+	}
+}
+
+func TestDeliverMessageErased(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		name string
+		// Erased while DELIVERING, so the stored copy holds a pseudonym.
+		inFlight bool
+	}{
+		{"SentAfterErasure", false},
+		{"ErasedInFlight", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			if err := testDb.Connect(nil); err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, testDb.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+				TemplateID:    "test-template",
+				TenantID:      "base",
+				Content:       "Hello world",
+				Transactional: true,
+			}))
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			e.TemplateID = "test-template"
+			e.TenantID = "base"
+			queued := *e
+
+			if test.inFlight {
+				assert.NoError(t, testDb.Insert(e))
+			}
+			_, err := testDb.EraseRecipient(ctx, typesend_schemas.TypeSendRecipient{ToAddress: e.ToAddress}, time.Now().UTC())
+			assert.NoError(t, err)
+			if !test.inFlight {
+				assert.NoError(t, testDb.Insert(e))
+			}
+
+			provider := providers_testing.NewTestingProvider()
+			err = consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:   &testutils.TestLogger{},
+				Database: testDb,
+				Provider: provider,
+			}, &queued)
+			assert.NoError(t, err)
+
+			assert.Nil(t, provider.GetMessageByEnvelopeID(e.ID), "erased recipients should never be delivered to, even transactionally")
+			stored, err := testDb.GetEnvelopeByID(ctx, e.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, typesend_schemas.TypeSendStatus_SUPPRESSED, stored.Status)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package consume_messages_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/consume_messages"
+	providers_testing "github.com/kvizdos/typesend/internal/providers/tester"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliverMessageTimeline(t *testing.T) {
+	ctx := context.Background()
+
+	for _, test := range []struct {
+		name       string
+		sendError  error
+		suppressed bool
+		event      typesend_schemas.TypeSendEventType
+		provider   string
+		details    map[string]string
+		// Whether the event should carry the providers message ID.
+		messageID bool
+	}{
+		{"Sent", nil, false, typesend_schemas.TypeSendEventType_SENT, "TestingProvider", nil, true},
+		{"Failed", errors.New("simulated provider error"), false, typesend_schemas.TypeSendEventType_FAILED, "TestingProvider", map[string]string{"error": "simulated provider error"}, false},
+		{"Suppressed", nil, true, typesend_schemas.TypeSendEventType_SUPPRESSED, "", map[string]string{"reason": "bounced"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testDb := &typesend_db.TestDatabase{}
+			assert.NoError(t, testDb.Connect(ctx))
+
+			e := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+			assert.NoError(t, testDb.Insert(e))
+			assert.NoError(t, testDb.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+				TemplateID: e.TemplateID,
+				TenantID:   e.TenantID,
+				Content:    "Hello world",
+			}))
+			if test.suppressed {
+				assert.NoError(t, testDb.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+					AppID:    e.AppID,
+					TenantID: e.TenantID,
+					Address:  e.ToAddress,
+					Reason:   typesend_schemas.TypeSendSuppressionReason_BOUNCED,
+				}))
+			}
+
+			provider := providers_testing.NewTestingProvider()
+			provider.SendError = test.sendError
+
+			assert.NoError(t, consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
+				Logger:   &testutils.TestLogger{},
+				Database: testDb,
+				Provider: provider,
+			}, e))
+
+			events, err := testDb.GetEnvelopeTimeline(ctx, e.ID)
+			assert.NoError(t, err)
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, test.event, events[0].Type)
+				assert.Equal(t, test.provider, events[0].Provider)
+				assert.Equal(t, test.details, events[0].Details)
+				assert.Equal(t, e.AppID, events[0].AppID)
+				if test.messageID {
+					assert.Equal(t, provider.MessageID(e.ID), events[0].ProviderMessageID)
+				} else {
+					assert.Empty(t, events[0].ProviderMessageID)
+				}
+			}
+		})
+	}
+}
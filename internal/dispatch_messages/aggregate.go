@@ -0,0 +1,36 @@
+package dispatch_messages
+
+import (
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_analytics"
+)
+
+// Rate limited to a single slot per AggregateInterval, so
+// overlapping dispatchers don't all aggregate at once.
+const aggregateRateLimitKey = "typesend#aggregate"
+
+// aggregateAnalytics recomputes todays rollups, and yesterdays to
+// catch its last events, at most once per AggregateInterval.
+func aggregateAnalytics(opts *DispatchOpts, now time.Time) {
+	if opts.AggregateInterval <= 0 {
+		return
+	}
+
+	ok, err := opts.Database.ConsumeRateLimit(opts.Context, aggregateRateLimitKey, now.Truncate(opts.AggregateInterval), opts.AggregateInterval, 1)
+	if err != nil {
+		internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to check aggregate interval: %s", err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+
+	aggregator := &typesend_analytics.Aggregator{Database: opts.Database, Logger: opts.Logger}
+	for _, day := range []time.Time{now.AddDate(0, 0, -1), now} {
+		if _, err := aggregator.AggregateDay(opts.Context, day); err != nil {
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to aggregate analytics: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package dispatch_messages
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	typequeue "github.com/kvizdos/typequeue/pkg"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// SQS caps SendMessageBatch at 10 entries.
+const MaxSQSBatchSize = 10
+
+// BatchDispatcher is implemented by dispatchers that can queue
+// several envelopes in a single call. The returned errors line
+// up with envelopes by index; nil means it was queued.
+type BatchDispatcher interface {
+	DispatchBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope, targetQueue string) []error
+}
+
+// SQSBatchAPI is the subset of the AWS SQS client used for batch sends.
+type SQSBatchAPI interface {
+	typequeue.SQSAPI
+	SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error)
+}
+
+// SQSBatchDispatcher wraps the typequeue Dispatcher, adding
+// SendMessageBatch support for the dispatcher.
+type SQSBatchDispatcher struct {
+	typequeue.Dispatcher[*typesend_schemas.TypeSendEnvelope]
+
+	BatchClient SQSBatchAPI
+}
+
+// NewSQSBatchDispatcher creates an SQSBatchDispatcher whose single
+// and batch sends share the same client and queue URL lookup.
+func NewSQSBatchDispatcher(client SQSBatchAPI, getTargetQueueURL func(string) (string, error)) *SQSBatchDispatcher {
+	return &SQSBatchDispatcher{
+		Dispatcher: typequeue.Dispatcher[*typesend_schemas.TypeSendEnvelope]{
+			SQSClient:         client,
+			GetTargetQueueURL: getTargetQueueURL,
+		},
+		BatchClient: client,
+	}
+}
+
+func (d *SQSBatchDispatcher) DispatchBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope, targetQueue string) []error {
+	errs := make([]error, len(envelopes))
+	fail := func(err error) []error {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	// Matches typequeue.Dispatcher so consumers see the same attributes.
+	traceID, ok := ctx.Value("trace-id").(string)
+	if !ok {
+		return fail(fmt.Errorf("typequeue: missing trace-id"))
+	}
+
+	queueURL := targetQueue
+	if d.GetTargetQueueURL != nil {
+		v, err := d.GetTargetQueueURL(targetQueue)
+		if err != nil {
+			return fail(fmt.Errorf("typequeue: failed to get target queue url: %v", err))
+		}
+		queueURL = v
+	}
+
+	for start := 0; start < len(envelopes); start += MaxSQSBatchSize {
+		end := min(start+MaxSQSBatchSize, len(envelopes))
+
+		// Entry IDs are the index within envelopes, so
+		// failures can be mapped straight back.
+		entries := make([]*sqs.SendMessageBatchRequestEntry, 0, end-start)
+		for i := start; i < end; i++ {
+			messageBody, err := json.Marshal(envelopes[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("typequeue: failed to marshal event: %v", err)
+				continue
+			}
+			entries = append(entries, &sqs.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(string(messageBody)),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"X-Trace-ID": {
+						StringValue: aws.String(traceID),
+						DataType:    aws.String("String"),
+					},
+				},
+			})
+		}
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		out, err := d.BatchClient.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, entry := range entries {
+				i, _ := strconv.Atoi(*entry.Id)
+				errs[i] = fmt.Errorf("typequeue: failed to dispatch batch to SQS: %v", err)
+			}
+			continue
+		}
+
+		for _, failed := range out.Failed {
+			i, err := strconv.Atoi(aws.StringValue(failed.Id))
+			if err != nil || i < start || i >= end {
+				continue
+			}
+			errs[i] = fmt.Errorf("typequeue: failed to dispatch event to SQS (%s): %s", aws.StringValue(failed.Code), aws.StringValue(failed.Message))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,164 @@
+package dispatch_messages
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Envelopes are only gathered into a digest with others
+// going to the same recipient, with the same template.
+type digestKey struct {
+	appID      string
+	tenantID   string
+	templateID string
+	toAddress  string
+}
+
+type digestGroup struct {
+	window    time.Duration
+	envelopes []*typesend_schemas.TypeSendEnvelope
+}
+
+// digester holds back envelopes whose template has a DigestWindow
+// while the ready lanes are drained, then turns each group whose
+// window has passed into a single digest envelope.
+type digester struct {
+	opts      *DispatchOpts
+	templates *templateCache
+	counters  *dispatchCounters
+
+	groups map[digestKey]*digestGroup
+}
+
+func newDigester(opts *DispatchOpts, templates *templateCache, counters *dispatchCounters) *digester {
+	return &digester{
+		opts:      opts,
+		templates: templates,
+		counters:  counters,
+		groups:    make(map[digestKey]*digestGroup),
+	}
+}
+
+// hold reports whether the envelope was taken for a digest,
+// in which case it must not be dispatched on its own.
+func (d *digester) hold(envelope *typesend_schemas.TypeSendEnvelope) bool {
+	// Digests themselves are dispatched like any other envelope.
+	if len(envelope.DigestOf) > 0 {
+		return false
+	}
+
+	template, err := d.templates.get(d.opts.Context, envelope)
+	if err != nil {
+		d.counters.failedSends.Add(1)
+		internal.ProtectedErrorLogger(d.opts.Logger, "typesend: failed to check digest window (%s): %s", envelope.ID, err.Error())
+		return true
+	}
+
+	if template == nil || template.DigestWindow <= 0 {
+		return false
+	}
+
+	key := digestKey{
+		appID:      envelope.AppID,
+		tenantID:   envelope.TenantID,
+		templateID: envelope.TemplateID,
+		toAddress:  envelope.ToAddress,
+	}
+
+	group, ok := d.groups[key]
+	if !ok {
+		group = &digestGroup{window: template.DigestWindow}
+		d.groups[key] = group
+	}
+	group.envelopes = append(group.envelopes, envelope)
+
+	return true
+}
+
+// flush creates a digest envelope for every group whose oldest envelope
+// has waited out the window, returning them by priority lane. Groups
+// still inside their window stay UNSENT for a later run.
+func (d *digester) flush(now time.Time) map[typesend_schemas.TypeSendPriority][]*typesend_schemas.TypeSendEnvelope {
+	digests := make(map[typesend_schemas.TypeSendPriority][]*typesend_schemas.TypeSendEnvelope)
+
+	for _, group := range d.groups {
+		sort.SliceStable(group.envelopes, func(i, j int) bool {
+			return group.envelopes[i].ScheduledFor.Before(group.envelopes[j].ScheduledFor)
+		})
+
+		if now.Before(group.envelopes[0].ScheduledFor.Add(group.window)) {
+			continue
+		}
+
+		digest := d.createDigest(now, group.envelopes)
+		if digest == nil {
+			continue
+		}
+
+		priority := digest.Priority.Effective()
+		digests[priority] = append(digests[priority], digest)
+	}
+
+	return digests
+}
+
+// createDigest inserts the digest before linking its sources, so a
+// failure part way through never leaves envelopes SENT without a digest.
+// Delivery only renders the sources that were actually linked.
+func (d *digester) createDigest(now time.Time, envelopes []*typesend_schemas.TypeSendEnvelope) *typesend_schemas.TypeSendEnvelope {
+	latest := envelopes[len(envelopes)-1]
+
+	sourceIDs := make([]string, len(envelopes))
+	for i, envelope := range envelopes {
+		sourceIDs[i] = envelope.ID
+	}
+
+	digest := &typesend_schemas.TypeSendEnvelope{
+		ID:             uuid.NewString(),
+		ScheduledFor:   now,
+		AppID:          latest.AppID,
+		TenantID:       latest.TenantID,
+		TemplateID:     latest.TemplateID,
+		ToAddress:      latest.ToAddress,
+		ToName:         latest.ToName,
+		ToInternalID:   latest.ToInternalID,
+		MessageGroupID: latest.MessageGroupID,
+		Variables:      latest.Variables,
+		Sealed:         latest.Sealed,
+		Priority:       latest.Priority,
+		TimeZone:       latest.TimeZone,
+		QuietHours:     latest.QuietHours,
+		Status:         typesend_schemas.TypeSendStatus_UNSENT,
+		DigestOf:       sourceIDs,
+	}
+	typesend_schemas.ApplyRetention(d.opts.Retention, digest)
+
+	if err := d.opts.Database.Insert(digest); err != nil {
+		d.counters.failedSends.Add(int64(len(envelopes)))
+		internal.ProtectedErrorLogger(d.opts.Logger, "typesend: failed to insert digest for %d envelopes: %s", len(envelopes), err.Error())
+		return nil
+	}
+
+	linked, err := d.opts.Database.LinkEnvelopesToDigest(d.opts.Context, digest.ID, sourceIDs)
+	if err != nil {
+		internal.ProtectedErrorLogger(d.opts.Logger, "typesend: failed to link envelopes to digest (%s): %s", digest.ID, err.Error())
+	}
+
+	if len(linked) == 0 {
+		// Every source was taken by an overlapping run.
+		d.opts.Database.UpdateEnvelopeStatus(d.opts.Context, digest.ID, typesend_schemas.TypeSendStatus_FAILED)
+		return nil
+	}
+
+	d.counters.digested.Add(int64(len(linked)))
+	typesend_events.Append(d.opts.Context, d.opts.Database, d.opts.Logger, typesend_events.NewEvent(digest, typesend_schemas.TypeSendEventType_QUEUED, "", map[string]string{
+		"digestOf": strconv.Itoa(len(linked)),
+	}))
+	return digest
+}
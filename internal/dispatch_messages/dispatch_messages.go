@@ -2,62 +2,343 @@ package dispatch_messages
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	typequeue "github.com/kvizdos/typequeue/pkg"
 	"github.com/kvizdos/typesend/internal"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
 
+const (
+	DefaultWorkers   = 4
+	DefaultBatchSize = MaxSQSBatchSize
+	DefaultQueue     = "email_queue"
+)
+
 type DispatchOpts struct {
 	Context    context.Context
 	Database   typesend_db.TypeSendDatabase
 	Dispatcher typequeue.TypeQueueDispatcher[*typesend_schemas.TypeSendEnvelope]
 	Logger     typesend_schemas.Logger
+
+	// Number of batches dispatched concurrently.
+	// Defaults to DefaultWorkers.
+	Workers int
+	// Envelopes per dispatch batch, up to MaxSQSBatchSize.
+	// Defaults to DefaultBatchSize.
+	BatchSize int
+
+	// Optional; envelopes over any limit stay UNSENT
+	// and are picked up again by a later run.
+	RateLimits []typesend_schemas.TypeSendRateLimit
+	// Name of the provider envelopes will be delivered
+	// through, used by provider scoped RateLimits.
+	ProviderName string
+
+	// Optional; routes each priority lane to its own queue target
+	// so critical mail can be consumed independently. Lanes
+	// without an entry are sent to DefaultQueue.
+	PriorityQueues map[typesend_schemas.TypeSendPriority]string
+
+	// Optional; applied to the envelopes the dispatcher creates
+	// itself, for schedule occurrences and digests.
+	Retention []typesend_schemas.TypeSendRetention
+	// Optional; how often PurgeExpiredData is run. However many
+	// dispatchers are running, it only runs once per interval.
+	// Zero leaves purging to the database (e.g. DynamoDB TTL).
+	PurgeInterval time.Duration
+	// Optional; how often the analytics rollups for today and
+	// yesterday are recomputed from the event log. However many
+	// dispatchers are running, it only runs once per interval.
+	// Zero leaves aggregation to typesend_analytics.Aggregator.
+	AggregateInterval time.Duration
+
+	// Optional; told how each run went.
+	Metrics typesend_metrics.DispatchMetricsProvider
+}
+
+func (opts *DispatchOpts) queueFor(priority typesend_schemas.TypeSendPriority) string {
+	if queue, ok := opts.PriorityQueues[priority.Effective()]; ok && queue != "" {
+		return queue
+	}
+	return DefaultQueue
+}
+
+// dispatchJob is a batch of envelopes bound for the same queue.
+type dispatchJob struct {
+	queue     string
+	envelopes []*typesend_schemas.TypeSendEnvelope
 }
 
+type dispatchCounters struct {
+	successSends  atomic.Int64
+	failedSends   atomic.Int64
+	failedUpdates atomic.Int64
+	skipped       atomic.Int64
+	rateLimited   atomic.Int64
+	digested      atomic.Int64
+	quietHours    atomic.Int64
+}
+
+// DispatchMessagesReadyToSend expands any recurring schedules that are
+// due, then queues every envelope that is due, draining the HIGH
+// priority lane first, then NORMAL, then LOW. Envelopes inside their
+// recipients quiet hours are deferred, and those for digest templates
+// are gathered and queued as digests once the lanes are drained.
+// Finally, expired data is purged if PurgeInterval is set, and
+// analytics are aggregated if AggregateInterval is set.
 func DispatchMessagesReadyToSend(opts *DispatchOpts) error {
-	envelopes, err := opts.Database.GetMessagesReadyToSend(opts.Context, time.Now().UTC())
+	now := time.Now().UTC()
 
+	expanded, err := expandSchedules(opts, now)
 	if err != nil {
 		return err
 	}
+	if expanded > 0 {
+		internal.ProtectedInfoLogger(opts.Logger, "typesend: expanded %d scheduled messages", expanded)
+	}
 
-	successSends := 0
-	failedSends := 0
-	failedUpdates := 0
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 || batchSize > MaxSQSBatchSize {
+		batchSize = DefaultBatchSize
+	}
+
+	counters := &dispatchCounters{}
+	templates := newTemplateCache(opts.Database)
+	limiter := newRateLimiter(opts.Database, templates, opts.RateLimits, opts.ProviderName, opts.Logger)
+	digests := newDigester(opts, templates, counters)
 
 	defer func() {
+		successSends := counters.successSends.Load()
+		failedSends := counters.failedSends.Load()
+		failedUpdates := counters.failedUpdates.Load()
 		if successSends > 0 || failedSends > 0 || failedUpdates > 0 {
 			internal.ProtectedInfoLogger(opts.Logger, "typesend: sent %d messages (failed %d to send, %d failed to update)", successSends, failedSends, failedUpdates)
 		}
+		if skipped := counters.skipped.Load(); skipped > 0 {
+			internal.ProtectedInfoLogger(opts.Logger, "typesend: skipped %d messages that were no longer UNSENT", skipped)
+		}
+		if quietHours := counters.quietHours.Load(); quietHours > 0 {
+			internal.ProtectedInfoLogger(opts.Logger, "typesend: deferred %d messages until after quiet hours", quietHours)
+		}
+		if digested := counters.digested.Load(); digested > 0 {
+			internal.ProtectedInfoLogger(opts.Logger, "typesend: gathered %d messages into digests", digested)
+		}
+		if rateLimited := counters.rateLimited.Load(); rateLimited > 0 {
+			internal.ProtectedInfoLogger(opts.Logger, "typesend: deferred %d rate limited messages to a later run", rateLimited)
+		}
+		reportDispatch(opts, counters, now)
 	}()
 
+	jobs := make(chan dispatchJob)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				dispatchBatch(opts, limiter, job, counters)
+			}
+		}()
+	}
+
+	hold := func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+		return deferQuietHours(opts, counters, now, envelope) || digests.hold(envelope)
+	}
+
+	err = dispatchLanes(opts, now, batchSize, hold, digests, jobs)
+	close(jobs)
+	wg.Wait()
+
+	if err == nil {
+		purgeExpiredData(opts, now)
+		aggregateAnalytics(opts, now)
+	}
+
+	return err
+}
+
+func reportDispatch(opts *DispatchOpts, counters *dispatchCounters, started time.Time) {
+	if opts.Metrics == nil {
+		return
+	}
+	err := opts.Metrics.DispatchEvent(&typesend_metrics.DispatchMetric{
+		Dispatched:    int(counters.successSends.Load()),
+		Failed:        int(counters.failedSends.Load()),
+		FailedUpdates: int(counters.failedUpdates.Load()),
+		RateLimited:   int(counters.rateLimited.Load()),
+		Digested:      int(counters.digested.Load()),
+		QuietHours:    int(counters.quietHours.Load()),
+		Duration:      time.Since(started),
+	})
+	if err != nil {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: failed to report dispatch metrics: %s", err.Error())
+	}
+}
+
+func dispatchLanes(opts *DispatchOpts, now time.Time, batchSize int, hold func(*typesend_schemas.TypeSendEnvelope) bool, digests *digester, jobs chan<- dispatchJob) error {
+	for _, priority := range typesend_schemas.TypeSendPriorities {
+		envelopes, err := opts.Database.GetMessagesReadyToSendByPriority(opts.Context, now, priority)
+		if err != nil {
+			return err
+		}
+
+		if err := collectBatches(opts.Context, envelopes, batchSize, opts.queueFor(priority), hold, jobs); err != nil {
+			return err
+		}
+	}
+
+	ready := digests.flush(now)
+	for _, priority := range typesend_schemas.TypeSendPriorities {
+		if len(ready[priority]) == 0 {
+			continue
+		}
+
+		if err := collectBatches(opts.Context, streamEnvelopes(ready[priority]), batchSize, opts.queueFor(priority), nil, jobs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func streamEnvelopes(envelopes []*typesend_schemas.TypeSendEnvelope) chan *typesend_schemas.TypeSendEnvelope {
+	ch := make(chan *typesend_schemas.TypeSendEnvelope, len(envelopes))
+	for _, envelope := range envelopes {
+		ch <- envelope
+	}
+	close(ch)
+	return ch
+}
+
+// collectBatches groups envelopes into batches and hands them to the
+// workers, flushing the final partial batch once envelopes is drained.
+// Envelopes that hold (optional) takes are left out of the batches.
+func collectBatches(ctx context.Context, envelopes chan *typesend_schemas.TypeSendEnvelope, batchSize int, queue string, hold func(*typesend_schemas.TypeSendEnvelope) bool, batches chan<- dispatchJob) error {
+	batch := make([]*typesend_schemas.TypeSendEnvelope, 0, batchSize)
+
 	for envelope := range envelopes {
 		select {
-		case <-opts.Context.Done():
+		case <-ctx.Done():
 			return context.DeadlineExceeded
 		default:
 		}
 
-		_, err := opts.Dispatcher.Dispatch(opts.Context, envelope, "email_queue")
-		if err != nil {
-			failedSends += 1
-			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to dispatch (%s): %s", envelope.ID, err.Error())
+		if hold != nil && hold(envelope) {
 			continue
 		}
 
-		err = opts.Database.UpdateEnvelopeStatus(opts.Context, envelope.ID, typesend_schemas.TypeSendStatus_DELIVERING)
+		batch = append(batch, envelope)
+		if len(batch) < batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return context.DeadlineExceeded
+		case batches <- dispatchJob{queue: queue, envelopes: batch}:
+		}
+		batch = make([]*typesend_schemas.TypeSendEnvelope, 0, batchSize)
+	}
+
+	if len(batch) > 0 {
+		// Checked up front, as select picks at random
+		// when both cases are ready.
+		if ctx.Err() != nil {
+			return context.DeadlineExceeded
+		}
+		batches <- dispatchJob{queue: queue, envelopes: batch}
+	}
 
+	return nil
+}
+
+func dispatchBatch(opts *DispatchOpts, limiter *rateLimiter, job dispatchJob, counters *dispatchCounters) {
+	allowed := make([]*typesend_schemas.TypeSendEnvelope, 0, len(job.envelopes))
+	slots := make([][]rateLimitSlot, 0, len(job.envelopes))
+	for _, envelope := range job.envelopes {
+		taken, ok, err := limiter.allow(opts.Context, envelope)
 		if err != nil {
-			failedUpdates += 1
-			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to update envelope status (%s): %s", envelope.ID, err.Error())
+			counters.failedSends.Add(1)
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to check rate limits (%s): %s", envelope.ID, err.Error())
 			continue
 		}
+		if !ok {
+			counters.rateLimited.Add(1)
+			continue
+		}
+		allowed = append(allowed, envelope)
+		slots = append(slots, taken)
+	}
+	batch := allowed
 
-		successSends += 1
+	if len(batch) == 0 {
+		return
 	}
 
-	return nil
+	var errs []error
+	if batchDispatcher, ok := opts.Dispatcher.(BatchDispatcher); ok {
+		errs = batchDispatcher.DispatchBatch(opts.Context, batch, job.queue)
+	} else {
+		errs = make([]error, len(batch))
+		for i, envelope := range batch {
+			_, errs[i] = opts.Dispatcher.Dispatch(opts.Context, envelope, job.queue)
+		}
+	}
+
+	dispatchedIDs := make([]string, 0, len(batch))
+	dispatchedEnvelopes := make([]*typesend_schemas.TypeSendEnvelope, 0, len(batch))
+	dispatchedSlots := make([][]rateLimitSlot, 0, len(batch))
+	for i, envelope := range batch {
+		if errs[i] != nil {
+			counters.failedSends.Add(1)
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to dispatch (%s): %s", envelope.ID, errs[i].Error())
+			// It stays UNSENT for the next run, which takes its slots again.
+			limiter.release(opts.Context, slots[i])
+			continue
+		}
+		dispatchedIDs = append(dispatchedIDs, envelope.ID)
+		dispatchedEnvelopes = append(dispatchedEnvelopes, envelope)
+		dispatchedSlots = append(dispatchedSlots, slots[i])
+	}
+
+	if len(dispatchedIDs) == 0 {
+		return
+	}
+
+	// Conditional, as a lane read may be stale: the envelope may have
+	// been linked to a digest or erased since, which the consumer
+	// checks for again before sending the queued copy.
+	updateErrs := opts.Database.ClaimEnvelopes(opts.Context, dispatchedIDs)
+	dispatched := make([]*typesend_schemas.TypeSendEvent, 0, len(dispatchedIDs))
+	for i, envelopeID := range dispatchedIDs {
+		if errors.Is(updateErrs[i], typesend_db.ErrNotUnsent) {
+			counters.skipped.Add(1)
+			limiter.release(opts.Context, dispatchedSlots[i])
+			continue
+		}
+		if updateErrs[i] != nil {
+			counters.failedUpdates.Add(1)
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to update envelope status (%s): %s", envelopeID, updateErrs[i].Error())
+			continue
+		}
+
+		counters.successSends.Add(1)
+		dispatched = append(dispatched, typesend_events.NewEvent(dispatchedEnvelopes[i], typesend_schemas.TypeSendEventType_DISPATCHED, "", map[string]string{
+			"queue": job.queue,
+		}))
+	}
+	typesend_events.Append(opts.Context, opts.Database, opts.Logger, dispatched...)
 }
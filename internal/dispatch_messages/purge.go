@@ -0,0 +1,35 @@
+package dispatch_messages
+
+import (
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+)
+
+// Rate limited to a single slot per PurgeInterval, so
+// overlapping dispatchers don't all purge at once.
+const purgeRateLimitKey = "typesend#purge"
+
+// purgeExpiredData enforces retention, at most once per PurgeInterval.
+func purgeExpiredData(opts *DispatchOpts, now time.Time) {
+	if opts.PurgeInterval <= 0 {
+		return
+	}
+
+	ok, err := opts.Database.ConsumeRateLimit(opts.Context, purgeRateLimitKey, now.Truncate(opts.PurgeInterval), opts.PurgeInterval, 1)
+	if err != nil {
+		internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to check purge interval: %s", err.Error())
+		return
+	}
+	if !ok {
+		return
+	}
+
+	result, err := opts.Database.PurgeExpiredData(opts.Context, now)
+	if err != nil {
+		internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to purge expired data: %s", err.Error())
+	}
+	if result.Stripped > 0 || result.Deleted > 0 {
+		internal.ProtectedInfoLogger(opts.Logger, "typesend: stripped %d and deleted %d expired messages", result.Stripped, result.Deleted)
+	}
+}
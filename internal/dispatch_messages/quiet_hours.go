@@ -0,0 +1,42 @@
+package dispatch_messages
+
+import (
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// deferQuietHours reports whether the envelope came due inside its
+// recipients quiet hours. If so, it is moved to when they end instead
+// of being dispatched, keeping the time it was first scheduled for.
+func deferQuietHours(opts *DispatchOpts, counters *dispatchCounters, now time.Time, envelope *typesend_schemas.TypeSendEnvelope) bool {
+	if envelope.QuietHours == nil {
+		return false
+	}
+
+	loc, err := typesend_schemas.LoadTimeZone(envelope.TimeZone)
+	if err != nil {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: ignoring quiet hours for envelope (%s): %s", envelope.ID, err.Error())
+		return false
+	}
+
+	allowedAt, err := envelope.QuietHours.NextAllowed(now, loc)
+	if err != nil {
+		internal.ProtectedWarnLogger(opts.Logger, "typesend: ignoring quiet hours for envelope (%s): %s", envelope.ID, err.Error())
+		return false
+	}
+
+	if !allowedAt.After(now) {
+		return false
+	}
+
+	if err := opts.Database.DeferEnvelope(opts.Context, envelope, allowedAt); err != nil {
+		counters.failedUpdates.Add(1)
+		internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to defer envelope for quiet hours (%s): %s", envelope.ID, err.Error())
+		return true
+	}
+
+	counters.quietHours.Add(1)
+	return true
+}
@@ -0,0 +1,110 @@
+package dispatch_messages
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// rateLimiter decides whether an envelope may be dispatched
+// this run, based on the configured TypeSendRateLimits.
+type rateLimiter struct {
+	db           typesend_db.TypeSendDatabase
+	templates    *templateCache
+	limits       []typesend_schemas.TypeSendRateLimit
+	providerName string
+	logger       typesend_schemas.Logger
+}
+
+func newRateLimiter(db typesend_db.TypeSendDatabase, templates *templateCache, limits []typesend_schemas.TypeSendRateLimit, providerName string, logger typesend_schemas.Logger) *rateLimiter {
+	return &rateLimiter{
+		db:           db,
+		templates:    templates,
+		limits:       limits,
+		providerName: providerName,
+		logger:       logger,
+	}
+}
+
+// rateLimitSlot is a slot allow took from a single window.
+type rateLimitSlot struct {
+	key         string
+	windowStart time.Time
+}
+
+// allow consumes a slot from every limit the envelope falls under,
+// returning the slots it took. Limits are checked in order, and the
+// slots already taken are given back when a later limit refuses.
+func (r *rateLimiter) allow(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope) ([]rateLimitSlot, bool, error) {
+	if len(r.limits) == 0 {
+		return nil, true, nil
+	}
+
+	template, err := r.templates.get(ctx, envelope)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if template != nil && template.Transactional {
+		return nil, true, nil
+	}
+
+	now := time.Now().UTC()
+	slots := make([]rateLimitSlot, 0, len(r.limits))
+	for _, limit := range r.limits {
+		value := r.scopeValue(limit.Scope, envelope)
+		if limit.Match != "" && limit.Match != value {
+			continue
+		}
+
+		// Tenants and templates are only unique within an app.
+		key := fmt.Sprintf("%s#%s#%s", limit.Scope, envelope.AppID, value)
+		if limit.Scope == typesend_schemas.TypeSendRateLimitScope_PROVIDER {
+			key = fmt.Sprintf("%s#%s", limit.Scope, value)
+		}
+
+		windowStart := now.Truncate(limit.Window)
+		ok, err := r.db.ConsumeRateLimit(ctx, key, windowStart, limit.Window, limit.Limit)
+		if err != nil {
+			r.release(ctx, slots)
+			return nil, false, err
+		}
+
+		if !ok {
+			r.release(ctx, slots)
+			return nil, false, nil
+		}
+		slots = append(slots, rateLimitSlot{key: key, windowStart: windowStart})
+	}
+
+	return slots, true, nil
+}
+
+// release gives back slots taken for an envelope that was not
+// dispatched. A slot that can't be released is only logged, leaving
+// that window slightly under its configured limit.
+func (r *rateLimiter) release(ctx context.Context, slots []rateLimitSlot) {
+	for _, slot := range slots {
+		if err := r.db.ReleaseRateLimit(ctx, slot.key, slot.windowStart); err != nil {
+			internal.ProtectedWarnLogger(r.logger, "typesend: failed to release rate limit (%s): %s", slot.key, err.Error())
+		}
+	}
+}
+
+func (r *rateLimiter) scopeValue(scope typesend_schemas.TypeSendRateLimitScope, envelope *typesend_schemas.TypeSendEnvelope) string {
+	switch scope {
+	case typesend_schemas.TypeSendRateLimitScope_APP:
+		return envelope.AppID
+	case typesend_schemas.TypeSendRateLimitScope_TENANT:
+		return envelope.TenantID
+	case typesend_schemas.TypeSendRateLimitScope_TEMPLATE:
+		return envelope.TemplateID
+	case typesend_schemas.TypeSendRateLimitScope_PROVIDER:
+		return r.providerName
+	}
+	return ""
+}
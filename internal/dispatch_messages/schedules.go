@@ -0,0 +1,66 @@
+package dispatch_messages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// How long an occurrences idempotency key is kept. Only needs to
+// outlive retries of the same run, not the whole recurrence.
+const scheduleIdempotencyWindow = 24 * time.Hour
+
+// scheduleIdempotencyKey is unique per occurrence, so a run that
+// inserted the envelope but failed to advance the schedule (or two
+// overlapping runs) cannot send the same occurrence twice.
+func scheduleIdempotencyKey(schedule *typesend_schemas.TypeSendSchedule, runAt time.Time) string {
+	return fmt.Sprintf("schedule:%s:%d", schedule.ID, runAt.Unix())
+}
+
+// expandSchedules inserts an envelope for every schedule that is due,
+// then advances it to its next occurrence. Occurrences missed while
+// the dispatcher was not running are collapsed into a single send.
+// It returns how many envelopes were created.
+func expandSchedules(opts *DispatchOpts, now time.Time) (int, error) {
+	schedules, err := opts.Database.GetSchedulesDue(opts.Context, now)
+	if err != nil {
+		return 0, err
+	}
+
+	expanded := 0
+	for schedule := range schedules {
+		runAt := schedule.NextRunAt
+		envelope := schedule.Envelope(uuid.NewString(), runAt)
+		typesend_schemas.ApplyRetention(opts.Retention, envelope)
+
+		ownerID, err := opts.Database.InsertIdempotent(opts.Context, envelope, scheduleIdempotencyKey(schedule, runAt), now.Add(scheduleIdempotencyWindow))
+		if err != nil {
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to expand schedule (%s): %s", schedule.ID, err.Error())
+			continue
+		}
+
+		next, err := schedule.Recurrence.Next(now)
+		if err != nil {
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to find next occurrence of schedule (%s): %s", schedule.ID, err.Error())
+			continue
+		}
+
+		if _, err := opts.Database.AdvanceSchedule(opts.Context, schedule.ID, runAt, next); err != nil {
+			internal.ProtectedErrorLogger(opts.Logger, "typesend: failed to advance schedule (%s): %s", schedule.ID, err.Error())
+			continue
+		}
+
+		if ownerID == envelope.ID {
+			expanded++
+			typesend_events.Append(opts.Context, opts.Database, opts.Logger, typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_QUEUED, "", map[string]string{
+				"schedule": schedule.ID,
+			}))
+		}
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,49 @@
+package dispatch_messages
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// templateCache holds the templates looked up during a single
+// dispatch run, so each is only fetched once per run.
+type templateCache struct {
+	db typesend_db.TypeSendDatabase
+
+	mu        sync.Mutex
+	templates map[string]*typesend_schemas.TypeSendTemplate
+}
+
+func newTemplateCache(db typesend_db.TypeSendDatabase) *templateCache {
+	return &templateCache{
+		db:        db,
+		templates: make(map[string]*typesend_schemas.TypeSendTemplate),
+	}
+}
+
+func (c *templateCache) get(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope) (*typesend_schemas.TypeSendTemplate, error) {
+	cacheKey := fmt.Sprintf("%s#%s", envelope.TemplateID, envelope.TenantID)
+
+	c.mu.Lock()
+	template, ok := c.templates[cacheKey]
+	c.mu.Unlock()
+
+	if ok {
+		return template, nil
+	}
+
+	template, err := c.db.GetTemplateByID(ctx, envelope.TemplateID, envelope.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.templates[cacheKey] = template
+	c.mu.Unlock()
+
+	return template, nil
+}
@@ -0,0 +1,73 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func appendSentEvent(t *testing.T, db *typesend_db.TestDatabase, id string) {
+	assert.NoError(t, db.AppendEvents(context.Background(), []*typesend_schemas.TypeSendEvent{{
+		EnvelopeID: id,
+		ID:         "sent",
+		AppID:      "app",
+		TenantID:   "tenant",
+		TemplateID: "welcome",
+		Type:       typesend_schemas.TypeSendEventType_SENT,
+		OccurredAt: time.Now().UTC(),
+	}}))
+}
+
+func sentToday(t *testing.T, db *typesend_db.TestDatabase) int64 {
+	now := time.Now().UTC()
+	rollups, err := db.GetRollups(context.Background(), typesend_schemas.TypeSendRollupQuery{AppID: "app", From: now.AddDate(0, 0, -1), To: now})
+	assert.NoError(t, err)
+	var sent int64
+	for _, rollup := range rollups {
+		sent += rollup.Sent
+	}
+	return sent
+}
+
+func TestDispatchMessagesAggregatesAnalytics(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+	appendSentEvent(t, db, "first")
+
+	opts := &dispatch_messages.DispatchOpts{
+		Context:           context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:          db,
+		Dispatcher:        &recordingBatchDispatcher{queued: make(map[string]string)},
+		Logger:            &testutils.TestLogger{},
+		AggregateInterval: time.Hour,
+	}
+
+	assert.NoError(t, dispatch_messages.DispatchMessagesReadyToSend(opts))
+	assert.Equal(t, int64(1), sentToday(t, db))
+
+	// Already aggregated within this interval.
+	appendSentEvent(t, db, "second")
+	assert.NoError(t, dispatch_messages.DispatchMessagesReadyToSend(opts))
+	assert.Equal(t, int64(1), sentToday(t, db), "aggregating should only run once per interval")
+}
+
+func TestDispatchMessagesWithoutAggregateInterval(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+	appendSentEvent(t, db, "first")
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+		Logger:     &testutils.TestLogger{},
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, sentToday(t, db))
+}
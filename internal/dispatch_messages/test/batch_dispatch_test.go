@@ -0,0 +1,189 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingBatchDispatcher is a concurrency safe BatchDispatcher
+// that fails any envelope whose ID is in failIDs.
+type recordingBatchDispatcher struct {
+	mu         sync.Mutex
+	batchSizes []int
+	queued     map[string]string
+	failIDs    map[string]bool
+}
+
+func (r *recordingBatchDispatcher) Dispatch(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, queueName string, delay ...int64) (*string, error) {
+	return nil, errors.New("single dispatch should not be used")
+}
+
+func (r *recordingBatchDispatcher) DispatchBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope, targetQueue string) []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.batchSizes = append(r.batchSizes, len(envelopes))
+	errs := make([]error, len(envelopes))
+	for i, envelope := range envelopes {
+		if r.failIDs[envelope.ID] {
+			errs[i] = errors.New("dispatch error")
+			continue
+		}
+		r.queued[envelope.ID] = targetQueue
+	}
+	return errs
+}
+
+func TestDispatchMessagesBatchedConcurrently(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 57)
+	for i := range envelopes {
+		envelopes[i] = testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+		db.Insert(envelopes[i])
+	}
+
+	dispatcher := &recordingBatchDispatcher{
+		queued: make(map[string]string),
+		failIDs: map[string]bool{
+			envelopes[3].ID:  true,
+			envelopes[40].ID: true,
+		},
+	}
+
+	logger := &testutils.TestLogger{}
+	ctx := context.WithValue(context.Background(), "trace-id", "demo-trace")
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    ctx,
+		Database:   db,
+		Dispatcher: dispatcher,
+		Logger:     logger,
+		Workers:    3,
+	})
+	assert.NoError(t, err)
+
+	total := 0
+	for _, size := range dispatcher.batchSizes {
+		assert.LessOrEqual(t, size, dispatch_messages.MaxSQSBatchSize, "batches should not exceed the SQS limit")
+		total += size
+	}
+	assert.Equal(t, len(envelopes), total, "every envelope should be dispatched once")
+	assert.Len(t, dispatcher.batchSizes, 6, "expected 57 envelopes to be sent in 6 batches")
+	assert.Len(t, dispatcher.queued, 55)
+
+	for _, envelope := range envelopes {
+		got, _ := db.GetEnvelopeByID(nil, envelope.ID)
+		if dispatcher.failIDs[envelope.ID] {
+			assert.Equal(t, typesend_schemas.TypeSendStatus_UNSENT, got.Status, "failed dispatches should stay UNSENT")
+			continue
+		}
+		assert.Equal(t, "email_queue", dispatcher.queued[envelope.ID])
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+	}
+
+	assert.Len(t, logger.InfoLogs, 1)
+	assert.Contains(t, *logger.InfoLogs[0], "sent 55 messages (failed 2 to send, 0 failed to update)")
+}
+
+// mockSQSBatchClient records SendMessageBatch calls and
+// fails the entries listed in failEntries.
+type mockSQSBatchClient struct {
+	mu          sync.Mutex
+	calls       []*sqs.SendMessageBatchInput
+	failEntries map[string]bool
+}
+
+func (m *mockSQSBatchClient) SendMessage(input *sqs.SendMessageInput) (*sqs.SendMessageOutput, error) {
+	return &sqs.SendMessageOutput{MessageId: aws.String("single")}, nil
+}
+
+func (m *mockSQSBatchClient) ReceiveMessage(input *sqs.ReceiveMessageInput) (*sqs.ReceiveMessageOutput, error) {
+	return &sqs.ReceiveMessageOutput{}, nil
+}
+
+func (m *mockSQSBatchClient) DeleteMessage(input *sqs.DeleteMessageInput) (*sqs.DeleteMessageOutput, error) {
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockSQSBatchClient) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, input)
+
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range input.Entries {
+		if m.failEntries[*entry.Id] {
+			out.Failed = append(out.Failed, &sqs.BatchResultErrorEntry{
+				Id:      entry.Id,
+				Code:    aws.String("InternalError"),
+				Message: aws.String("boom"),
+			})
+			continue
+		}
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return out, nil
+}
+
+func TestSQSBatchDispatcher(t *testing.T) {
+	client := &mockSQSBatchClient{
+		failEntries: map[string]bool{"12": true},
+	}
+	dispatcher := dispatch_messages.NewSQSBatchDispatcher(client, func(s string) (string, error) {
+		return fmt.Sprintf("https://sqs.local/%s", s), nil
+	})
+
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 23)
+	for i := range envelopes {
+		envelopes[i] = testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	}
+
+	ctx := context.WithValue(context.Background(), "trace-id", "demo-trace")
+	errs := dispatcher.DispatchBatch(ctx, envelopes, "email_queue")
+	assert.Len(t, errs, len(envelopes))
+
+	assert.Len(t, client.calls, 3, "23 envelopes should be sent in 3 batches")
+	for _, call := range client.calls {
+		assert.LessOrEqual(t, len(call.Entries), dispatch_messages.MaxSQSBatchSize)
+		assert.Equal(t, "https://sqs.local/email_queue", *call.QueueUrl)
+		for _, entry := range call.Entries {
+			assert.Equal(t, "demo-trace", *entry.MessageAttributes["X-Trace-ID"].StringValue)
+		}
+	}
+
+	for i, err := range errs {
+		if strconv.Itoa(i) == "12" {
+			assert.Error(t, err, "failed entries should map back to their envelope")
+			continue
+		}
+		assert.NoError(t, err)
+	}
+}
+
+func TestSQSBatchDispatcherMissingTraceID(t *testing.T) {
+	client := &mockSQSBatchClient{}
+	dispatcher := dispatch_messages.NewSQSBatchDispatcher(client, nil)
+
+	envelopes := []*typesend_schemas.TypeSendEnvelope{
+		testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC()),
+	}
+
+	errs := dispatcher.DispatchBatch(context.Background(), envelopes, "email_queue")
+	assert.Error(t, errs[0])
+	assert.Empty(t, client.calls)
+}
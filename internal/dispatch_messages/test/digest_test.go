@@ -0,0 +1,114 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertActivity(db *typesend_db.TestDatabase, toAddress string, age time.Duration) *typesend_schemas.TypeSendEnvelope {
+	envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-age))
+	envelope.TemplateID = "activity"
+	envelope.ToAddress = toAddress
+	envelope.Variables = map[string]interface{}{"Event": age.String()}
+	db.Insert(envelope)
+	return envelope
+}
+
+func TestDispatchMessagesDigests(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	db.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:   "activity",
+		TenantID:     "base",
+		DigestWindow: time.Hour,
+	})
+
+	// Window has passed for this recipient.
+	ready := []*typesend_schemas.TypeSendEnvelope{
+		insertActivity(db, "ready@example.com", 90*time.Minute),
+		insertActivity(db, "ready@example.com", 30*time.Minute),
+		insertActivity(db, "ready@example.com", time.Minute),
+	}
+	// Still inside the window.
+	waiting := insertActivity(db, "waiting@example.com", 10*time.Minute)
+	// Not a digest template.
+	other := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+	db.Insert(other)
+
+	dispatcher := &recordingBatchDispatcher{queued: make(map[string]string)}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: dispatcher,
+	})
+	assert.NoError(t, err)
+
+	var digest *typesend_schemas.TypeSendEnvelope
+	for _, envelope := range db.Items() {
+		if len(envelope.DigestOf) > 0 {
+			digest = envelope
+		}
+	}
+	if !assert.NotNil(t, digest, "a digest envelope should be created") {
+		return
+	}
+
+	assert.Equal(t, "ready@example.com", digest.ToAddress)
+	assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, digest.Status, "the digest should be dispatched")
+	assert.Equal(t, []string{ready[0].ID, ready[1].ID, ready[2].ID}, digest.DigestOf, "sources should be oldest first")
+	assert.Contains(t, dispatcher.queued, digest.ID)
+
+	for _, source := range ready {
+		assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, source.Status, "sources should be marked SENT")
+		assert.Equal(t, digest.ID, source.DigestID, "sources should link to their digest")
+		assert.NotContains(t, dispatcher.queued, source.ID, "sources should not be dispatched on their own")
+	}
+
+	assert.Equal(t, typesend_schemas.TypeSendStatus_UNSENT, waiting.Status, "envelopes inside the window should be held")
+	assert.NotContains(t, dispatcher.queued, waiting.ID)
+
+	assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, other.Status, "other templates should dispatch as normal")
+}
+
+func TestDispatchMessagesDigestOnlyOnce(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	db.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:   "activity",
+		TenantID:     "base",
+		DigestWindow: time.Hour,
+	})
+
+	insertActivity(db, "ready@example.com", 2*time.Hour)
+	insertActivity(db, "ready@example.com", time.Hour)
+
+	// The digest fails to dispatch, so it is retried by the next run.
+	opts := &dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &errorDispatcher{},
+	}
+	assert.NoError(t, dispatch_messages.DispatchMessagesReadyToSend(opts))
+
+	opts.Dispatcher = &recordingBatchDispatcher{queued: make(map[string]string)}
+	assert.NoError(t, dispatch_messages.DispatchMessagesReadyToSend(opts))
+
+	digests := 0
+	for _, envelope := range db.Items() {
+		if len(envelope.DigestOf) > 0 {
+			digests++
+			assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, envelope.Status)
+		}
+	}
+	assert.Equal(t, 1, digests, "a retried digest should not be gathered into another digest")
+}
@@ -23,6 +23,9 @@ func (f *failingDatabase) Connect(ctx context.Context) error { return nil }
 func (f *failingDatabase) GetMessagesReadyToSend(ctx context.Context, now time.Time) (chan *typesend_schemas.TypeSendEnvelope, error) {
 	return nil, errors.New("get messages error")
 }
+func (f *failingDatabase) GetMessagesReadyToSendByPriority(ctx context.Context, now time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	return nil, errors.New("get messages error")
+}
 func (f *failingDatabase) UpdateEnvelopeStatus(ctx context.Context, envelopeID string, status typesend_schemas.TypeSendStatus) error {
 	return nil
 }
@@ -44,6 +47,18 @@ func (db *updateFailingDatabase) UpdateEnvelopeStatus(ctx context.Context, envel
 	return errors.New("update status error")
 }
 
+func (db *updateFailingDatabase) UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, status typesend_schemas.TypeSendStatus) []error {
+	errs := make([]error, len(envelopeIDs))
+	for i := range errs {
+		errs[i] = errors.New("update status error")
+	}
+	return errs
+}
+
+func (db *updateFailingDatabase) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	return db.UpdateEnvelopeStatuses(ctx, envelopeIDs, typesend_schemas.TypeSendStatus_DELIVERING)
+}
+
 func TestDispatchMessagesSuccessful(t *testing.T) {
 	// Set up a test database with one envelope that is ready to send.
 	db := &typesend_db.TestDatabase{}
@@ -180,6 +195,47 @@ func TestDispatchMessagesUpdateStatusError(t *testing.T) {
 	assert.Len(t, testDispatcher.Messages["email_queue"], 1, "email_queue should have 1 item")
 }
 
+// linkingDatabase wraps a TestDatabase, linking every envelope to a
+// digest just before it is claimed, as an overlapping run might.
+type linkingDatabase struct {
+	*typesend_db.TestDatabase
+}
+
+func (db *linkingDatabase) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	db.LinkEnvelopesToDigest(ctx, "digest", envelopeIDs)
+	return db.TestDatabase.ClaimEnvelopes(ctx, envelopeIDs)
+}
+
+func TestDispatchMessagesSkipsStaleEnvelopes(t *testing.T) {
+	originalDB := &typesend_db.TestDatabase{}
+	originalDB.Connect(context.Background())
+	env := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+	originalDB.Insert(env)
+
+	metrics := &recordingDispatchMetrics{}
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo"),
+		Database: &linkingDatabase{TestDatabase: originalDB},
+		Dispatcher: &typequeue.MockDispatcher[*typesend_schemas.TypeSendEnvelope]{
+			Messages: make(map[string][]*typesend_schemas.TypeSendEnvelope),
+		},
+		Logger:  &testutils.TestLogger{},
+		Metrics: metrics,
+	})
+	assert.NoError(t, err)
+
+	got, _ := originalDB.GetEnvelopeByID(context.Background(), env.ID)
+	assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status, "a linked envelope must not move back to DELIVERING")
+	if assert.Len(t, metrics.runs, 1) {
+		assert.Zero(t, metrics.runs[0].Dispatched)
+		assert.Zero(t, metrics.runs[0].FailedUpdates, "skipped envelopes are not failed updates")
+	}
+
+	timeline, err := originalDB.GetEnvelopeTimeline(context.Background(), env.ID)
+	assert.NoError(t, err)
+	assert.Empty(t, timeline, "skipped envelopes are not DISPATCHED")
+}
+
 func TestDispatchMessagesNoMessages(t *testing.T) {
 	db := &typesend_db.TestDatabase{}
 	db.Connect(context.Background())
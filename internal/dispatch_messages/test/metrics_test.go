@@ -0,0 +1,54 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingDispatchMetrics struct {
+	runs []*typesend_metrics.DispatchMetric
+}
+
+func (r *recordingDispatchMetrics) DispatchEvent(metric *typesend_metrics.DispatchMetric) error {
+	r.runs = append(r.runs, metric)
+	return nil
+}
+
+func TestDispatchMessagesReportsMetrics(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 3)
+	for i := range envelopes {
+		envelopes[i] = testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+		db.Insert(envelopes[i])
+	}
+
+	metrics := &recordingDispatchMetrics{}
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued:  make(map[string]string),
+			failIDs: map[string]bool{envelopes[1].ID: true},
+		},
+		Logger:  &testutils.TestLogger{},
+		Metrics: metrics,
+	})
+	assert.NoError(t, err)
+
+	if assert.Len(t, metrics.runs, 1) {
+		assert.Equal(t, 2, metrics.runs[0].Dispatched)
+		assert.Equal(t, 1, metrics.runs[0].Failed)
+		assert.Zero(t, metrics.runs[0].FailedUpdates)
+		assert.Positive(t, metrics.runs[0].Duration)
+	}
+}
@@ -0,0 +1,80 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderingDispatcher records the order envelopes are queued in.
+type orderingDispatcher struct {
+	mu     sync.Mutex
+	order  []string
+	queues map[string]string
+}
+
+func (o *orderingDispatcher) Dispatch(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, queueName string, delay ...int64) (*string, error) {
+	return nil, errors.New("single dispatch should not be used")
+}
+
+func (o *orderingDispatcher) DispatchBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope, targetQueue string) []error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, envelope := range envelopes {
+		o.order = append(o.order, envelope.ID)
+		o.queues[envelope.ID] = targetQueue
+	}
+	return make([]error, len(envelopes))
+}
+
+func TestDispatchMessagesPriorityLanes(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	insert := func(id string, priority typesend_schemas.TypeSendPriority) {
+		envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+		envelope.ID = id
+		envelope.Priority = priority
+		db.Insert(envelope)
+	}
+
+	// Inserted lowest first to confirm lanes are not drained in insert order.
+	insert("low", typesend_schemas.TypeSendPriority_LOW)
+	insert("legacy", typesend_schemas.TypeSendPriority_DEFAULT)
+	insert("normal", typesend_schemas.TypeSendPriority_NORMAL)
+	insert("high", typesend_schemas.TypeSendPriority_HIGH)
+
+	dispatcher := &orderingDispatcher{queues: make(map[string]string)}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: dispatcher,
+		Workers:    1,
+		PriorityQueues: map[typesend_schemas.TypeSendPriority]string{
+			typesend_schemas.TypeSendPriority_HIGH: "critical_email_queue",
+			typesend_schemas.TypeSendPriority_LOW:  "bulk_email_queue",
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"high", "legacy", "normal", "low"}, dispatcher.order, "lanes should be drained highest first")
+
+	assert.Equal(t, "critical_email_queue", dispatcher.queues["high"])
+	assert.Equal(t, dispatch_messages.DefaultQueue, dispatcher.queues["normal"], "unconfigured lanes should use the default queue")
+	assert.Equal(t, dispatch_messages.DefaultQueue, dispatcher.queues["legacy"], "envelopes without a priority should be NORMAL")
+	assert.Equal(t, "bulk_email_queue", dispatcher.queues["low"])
+
+	for _, envelope := range db.Items() {
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, envelope.Status)
+	}
+}
@@ -0,0 +1,89 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// quietNow returns quiet hours that contain the current UTC time,
+// ending two hours from now.
+func quietNow() (typesend_schemas.TypeSendQuietHours, time.Time) {
+	now := time.Now().UTC()
+	start := now.Add(-time.Hour)
+	end := now.Add(2 * time.Hour).Truncate(time.Minute)
+	return typesend_schemas.TypeSendQuietHours{
+		Start: fmt.Sprintf("%02d:%02d", start.Hour(), start.Minute()),
+		End:   fmt.Sprintf("%02d:%02d", end.Hour(), end.Minute()),
+	}, end
+}
+
+func TestDispatchMessagesDefersQuietHours(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	quiet, end := quietNow()
+
+	originalTime := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	deferred := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, originalTime)
+	deferred.QuietHours = &quiet
+	db.Insert(deferred)
+
+	awake := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, originalTime)
+	db.Insert(awake)
+
+	dispatcher := &recordingBatchDispatcher{queued: make(map[string]string)}
+	logger := &testutils.TestLogger{}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: dispatcher,
+		Logger:     logger,
+	})
+	assert.NoError(t, err)
+
+	assert.NotContains(t, dispatcher.queued, deferred.ID, "envelopes in quiet hours should not be dispatched")
+	assert.Equal(t, typesend_schemas.TypeSendStatus_UNSENT, deferred.Status)
+	assert.True(t, end.Equal(deferred.ScheduledFor), "envelope should be deferred to the end of quiet hours")
+	assert.True(t, originalTime.Equal(deferred.OriginalScheduledFor), "original time should be recorded")
+
+	assert.Contains(t, dispatcher.queued, awake.ID, "envelopes without quiet hours should dispatch")
+
+	found := false
+	for _, log := range logger.InfoLogs {
+		if *log == "typesend: deferred 1 messages until after quiet hours" {
+			found = true
+		}
+	}
+	assert.True(t, found, "deferrals should be logged")
+}
+
+func TestDispatchMessagesQuietHoursKeepsOriginalTime(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	quiet, _ := quietNow()
+
+	firstScheduled := time.Now().UTC().Add(-24 * time.Hour).Truncate(time.Second)
+	envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+	envelope.QuietHours = &quiet
+	envelope.OriginalScheduledFor = firstScheduled
+	db.Insert(envelope)
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+	})
+	assert.NoError(t, err)
+
+	assert.True(t, firstScheduled.Equal(envelope.OriginalScheduledFor), "deferring again should keep the first original time")
+}
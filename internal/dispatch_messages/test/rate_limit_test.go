@@ -0,0 +1,204 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertTenantEnvelopes(db *typesend_db.TestDatabase, tenantID string, templateID string, count int) []*typesend_schemas.TypeSendEnvelope {
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, count)
+	for i := range envelopes {
+		envelopes[i] = testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+		envelopes[i].TenantID = tenantID
+		envelopes[i].TemplateID = templateID
+		db.Insert(envelopes[i])
+	}
+	return envelopes
+}
+
+func countStatus(db *typesend_db.TestDatabase, envelopes []*typesend_schemas.TypeSendEnvelope, status typesend_schemas.TypeSendStatus) int {
+	count := 0
+	for _, envelope := range envelopes {
+		got, _ := db.GetEnvelopeByID(nil, envelope.ID)
+		if got.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+func TestDispatchMessagesTenantRateLimit(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	noisy := insertTenantEnvelopes(db, "noisy-tenant", "campaign", 5)
+	quiet := insertTenantEnvelopes(db, "quiet-tenant", "campaign", 1)
+
+	opts := &dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued: make(map[string]string),
+		},
+		Logger: &testutils.TestLogger{},
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TENANT, Limit: 2, Window: time.Hour},
+		},
+	}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, countStatus(db, noisy, typesend_schemas.TypeSendStatus_DELIVERING), "noisy tenant should be capped")
+	assert.Equal(t, 3, countStatus(db, noisy, typesend_schemas.TypeSendStatus_UNSENT), "envelopes over the limit should stay UNSENT")
+	assert.Equal(t, 1, countStatus(db, quiet, typesend_schemas.TypeSendStatus_DELIVERING), "other tenants should be unaffected")
+
+	// A second run within the same window should not dispatch any more.
+	err = dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countStatus(db, noisy, typesend_schemas.TypeSendStatus_UNSENT))
+}
+
+func TestDispatchMessagesRateLimitMatch(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	digest := insertTenantEnvelopes(db, "base", "weekly-digest", 3)
+	other := insertTenantEnvelopes(db, "base", "welcome", 3)
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued: make(map[string]string),
+		},
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TEMPLATE, Match: "weekly-digest", Limit: 1, Window: time.Hour},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, countStatus(db, digest, typesend_schemas.TypeSendStatus_DELIVERING))
+	assert.Equal(t, 3, countStatus(db, other, typesend_schemas.TypeSendStatus_DELIVERING), "unmatched templates should not be limited")
+}
+
+func TestDispatchMessagesProviderRateLimitTransactionalExempt(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	db.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:    "password-reset",
+		TenantID:      "base",
+		Transactional: true,
+	})
+
+	resets := insertTenantEnvelopes(db, "base", "password-reset", 3)
+	marketing := insertTenantEnvelopes(db, "base", "marketing", 3)
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued: make(map[string]string),
+		},
+		ProviderName: "SendGrid",
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_PROVIDER, Limit: 1, Window: time.Hour},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, countStatus(db, resets, typesend_schemas.TypeSendStatus_DELIVERING), "transactional templates should be exempt")
+	assert.Equal(t, 1, countStatus(db, marketing, typesend_schemas.TypeSendStatus_DELIVERING))
+}
+
+func TestDispatchMessagesRateLimitReleasedOnDispatchFailure(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	envelopes := insertTenantEnvelopes(db, "base", "campaign", 3)
+
+	opts := &dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &errorDispatcher{},
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TENANT, Limit: 2, Window: time.Hour},
+		},
+	}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, countStatus(db, envelopes, typesend_schemas.TypeSendStatus_UNSENT))
+
+	// Failed dispatches gave their slots back, so the window is still open.
+	opts.Dispatcher = &recordingBatchDispatcher{queued: make(map[string]string)}
+	err = dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countStatus(db, envelopes, typesend_schemas.TypeSendStatus_DELIVERING))
+}
+
+func TestDispatchMessagesRateLimitReleasedOnLaterRefusal(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	capped := insertTenantEnvelopes(db, "base", "campaign", 3)
+
+	opts := &dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued: make(map[string]string),
+		},
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TENANT, Limit: 3, Window: time.Hour},
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TEMPLATE, Match: "campaign", Limit: 1, Window: time.Hour},
+		},
+	}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countStatus(db, capped, typesend_schemas.TypeSendStatus_DELIVERING))
+
+	// Envelopes refused by the template limit shouldn't have used
+	// up the tenant limit, leaving two slots for other templates.
+	other := insertTenantEnvelopes(db, "base", "welcome", 3)
+	err = dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, countStatus(db, other, typesend_schemas.TypeSendStatus_DELIVERING))
+}
+
+func TestDispatchMessagesRateLimitSkipsHeldDigests(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	db.InsertTemplate(nil, &typesend_schemas.TypeSendTemplate{
+		TemplateID:   "activity",
+		TenantID:     "base",
+		DigestWindow: time.Hour,
+	})
+	waiting := insertActivity(db, "waiting@example.com", 10*time.Minute)
+	campaign := insertTenantEnvelopes(db, "base", "campaign", 1)
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &recordingBatchDispatcher{
+			queued: make(map[string]string),
+		},
+		RateLimits: []typesend_schemas.TypeSendRateLimit{
+			{Scope: typesend_schemas.TypeSendRateLimitScope_TENANT, Limit: 1, Window: time.Hour},
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, typesend_schemas.TypeSendStatus_UNSENT, waiting.Status)
+	assert.Equal(t, 1, countStatus(db, campaign, typesend_schemas.TypeSendStatus_DELIVERING), "held envelopes should not take a slot")
+}
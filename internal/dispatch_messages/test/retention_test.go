@@ -0,0 +1,105 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertExpiredEnvelope(db *typesend_db.TestDatabase, contentExpiresAt time.Time, expiresAt time.Time) *typesend_schemas.TypeSendEnvelope {
+	envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_SENT, time.Now().UTC().Add(-48*time.Hour))
+	envelope.Variables = map[string]interface{}{"Name": "Test"}
+	envelope.ContentExpiresAt = contentExpiresAt.Unix()
+	envelope.ExpiresAt = expiresAt.Unix()
+	db.Insert(envelope)
+	return envelope
+}
+
+func TestDispatchMessagesPurgesExpiredData(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	now := time.Now().UTC()
+	stripped := insertExpiredEnvelope(db, now.Add(-time.Hour), now.Add(time.Hour))
+	deleted := insertExpiredEnvelope(db, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	logger := &testutils.TestLogger{}
+	opts := &dispatch_messages.DispatchOpts{
+		Context:       context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:      db,
+		Dispatcher:    &recordingBatchDispatcher{queued: make(map[string]string)},
+		Logger:        logger,
+		PurgeInterval: time.Hour,
+	}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+
+	got, _ := db.GetEnvelopeByID(context.Background(), stripped.ID)
+	if assert.NotNil(t, got, "the audit record should be kept") {
+		assert.Nil(t, got.Variables, "content past its retention should be stripped")
+	}
+	got, _ = db.GetEnvelopeByID(context.Background(), deleted.ID)
+	assert.Nil(t, got, "envelopes past their retention should be deleted")
+
+	assert.NotEmpty(t, logger.InfoLogs)
+	assert.Equal(t, "typesend: stripped 1 and deleted 1 expired messages", *logger.InfoLogs[len(logger.InfoLogs)-1])
+
+	// Already purged within this interval.
+	later := insertExpiredEnvelope(db, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	err = dispatch_messages.DispatchMessagesReadyToSend(opts)
+	assert.NoError(t, err)
+
+	got, _ = db.GetEnvelopeByID(context.Background(), later.ID)
+	assert.NotNil(t, got, "purging should only run once per interval")
+}
+
+func TestDispatchMessagesWithoutPurgeInterval(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	now := time.Now().UTC()
+	envelope := insertExpiredEnvelope(db, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+		Logger:     &testutils.TestLogger{},
+	})
+	assert.NoError(t, err)
+
+	got, _ := db.GetEnvelopeByID(context.Background(), envelope.ID)
+	assert.NotNil(t, got, "purging is left to the database without a PurgeInterval")
+}
+
+func TestDispatchMessagesScheduleRetention(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	runAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	insertDueSchedule(t, db, runAt)
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+		Logger:     &testutils.TestLogger{},
+		Retention: []typesend_schemas.TypeSendRetention{
+			{AppID: "demo", Content: 24 * time.Hour, Record: 48 * time.Hour},
+		},
+	})
+	assert.NoError(t, err)
+
+	items := db.Items()
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, runAt.Add(24*time.Hour).Unix(), items[0].ContentExpiresAt)
+		assert.Equal(t, runAt.Add(48*time.Hour).Unix(), items[0].ExpiresAt)
+	}
+}
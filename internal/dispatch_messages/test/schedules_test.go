@@ -0,0 +1,140 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func insertDueSchedule(t *testing.T, db *typesend_db.TestDatabase, runAt time.Time) *typesend_schemas.TypeSendSchedule {
+	schedule := &typesend_schemas.TypeSendSchedule{
+		ID:         "weekly-report",
+		AppID:      "demo",
+		TenantID:   "base",
+		TemplateID: "weekly-report-template",
+		ToAddress:  "test@example.com",
+		Variables:  testutils.DummyVariable{}.ToMap(),
+		Recurrence: typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * MON"},
+		State:      typesend_schemas.TypeSendScheduleState_ACTIVE,
+		NextRunAt:  runAt,
+	}
+	assert.NoError(t, db.InsertSchedule(context.Background(), schedule))
+	return schedule
+}
+
+func TestDispatchMessagesExpandsSchedules(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	runAt := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	insertDueSchedule(t, db, runAt)
+
+	dispatcher := &recordingBatchDispatcher{queued: make(map[string]string)}
+	logger := &testutils.TestLogger{}
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: dispatcher,
+		Logger:     logger,
+	})
+	assert.NoError(t, err)
+
+	items := db.Items()
+	assert.Len(t, items, 1, "one envelope should be expanded")
+	assert.Equal(t, "weekly-report", items[0].ScheduleID)
+	assert.Equal(t, "weekly-report-template", items[0].TemplateID)
+	assert.True(t, runAt.Equal(items[0].ScheduledFor))
+	assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, items[0].Status, "expanded envelopes should be dispatched in the same run")
+	assert.NotEmpty(t, logger.InfoLogs)
+	assert.Equal(t, "typesend: expanded 1 scheduled messages", *logger.InfoLogs[0])
+
+	schedule, _ := db.GetScheduleByID(context.Background(), "weekly-report")
+	assert.True(t, schedule.NextRunAt.After(time.Now().UTC()), "schedule should advance to its next occurrence")
+	assert.Equal(t, time.Monday, schedule.NextRunAt.Weekday())
+
+	// Nothing is due on the next run.
+	err = dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: dispatcher,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, db.Items(), 1)
+}
+
+func TestDispatchMessagesSkipsPausedSchedules(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	insertDueSchedule(t, db, time.Now().UTC().Add(-time.Minute))
+	assert.NoError(t, db.UpdateScheduleState(context.Background(), "weekly-report", typesend_schemas.TypeSendScheduleState_PAUSED, time.Time{}))
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+		Database:   db,
+		Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, db.Items())
+}
+
+// staleAdvanceDatabase fails to advance schedules, as if
+// the run crashed between inserting and advancing.
+type staleAdvanceDatabase struct {
+	*typesend_db.TestDatabase
+}
+
+func (db *staleAdvanceDatabase) AdvanceSchedule(ctx context.Context, scheduleID string, from time.Time, next time.Time) (bool, error) {
+	return false, nil
+}
+
+func TestDispatchMessagesScheduleExpandedOnce(t *testing.T) {
+	testDB := &typesend_db.TestDatabase{}
+	testDB.Connect(context.Background())
+
+	insertDueSchedule(t, testDB, time.Now().UTC().Add(-time.Minute).Truncate(time.Second))
+
+	db := &staleAdvanceDatabase{TestDatabase: testDB}
+
+	for i := 0; i < 3; i++ {
+		err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+			Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+			Database:   db,
+			Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+		})
+		assert.NoError(t, err)
+	}
+
+	assert.Len(t, testDB.Items(), 1, "retried runs should not expand the same occurrence again")
+}
+
+func TestDispatchMessagesConcurrentScheduleExpansion(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(context.Background())
+
+	insertDueSchedule(t, db, time.Now().UTC().Add(-time.Minute).Truncate(time.Second))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+				Context:    context.WithValue(context.Background(), "trace-id", "demo-trace"),
+				Database:   db,
+				Dispatcher: &recordingBatchDispatcher{queued: make(map[string]string)},
+			})
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, db.Items(), 1, "overlapping runs should expand an occurrence once")
+}
@@ -0,0 +1,39 @@
+package dispatch_messages_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	typequeue "github.com/kvizdos/typequeue/pkg/mocked"
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchRecordsDispatched(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	env := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-10*time.Second))
+	assert.NoError(t, db.Insert(env))
+
+	err := dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:  context.WithValue(ctx, "trace-id", "demo-trace"),
+		Database: db,
+		Dispatcher: &typequeue.MockDispatcher[*typesend_schemas.TypeSendEnvelope]{
+			Messages: make(map[string][]*typesend_schemas.TypeSendEnvelope),
+		},
+	})
+	assert.NoError(t, err)
+
+	events, err := db.GetEnvelopeTimeline(ctx, env.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_DISPATCHED, events[0].Type)
+		assert.Equal(t, map[string]string{"queue": "email_queue"}, events[0].Details)
+	}
+}
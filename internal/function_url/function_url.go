@@ -0,0 +1,85 @@
+package function_url
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Serve serves a Lambda function URL request with an http.Handler.
+func Serve(ctx context.Context, handler http.Handler, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return events.LambdaFunctionURLResponse{}, fmt.Errorf("typesend: failed to decode request body: %w", err)
+		}
+		body = decoded
+	}
+
+	target := request.RawPath
+	if request.RawQueryString != "" {
+		target += "?" + request.RawQueryString
+	}
+
+	r, err := http.NewRequestWithContext(ctx, request.RequestContext.HTTP.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return events.LambdaFunctionURLResponse{}, fmt.Errorf("typesend: failed to build request: %w", err)
+	}
+	for name, value := range request.Headers {
+		r.Header.Set(name, value)
+	}
+
+	w := &responseWriter{header: http.Header{}}
+	handler.ServeHTTP(w, r)
+
+	headers := make(map[string]string, len(w.header))
+	for name, values := range w.header {
+		headers[name] = strings.Join(values, ", ")
+	}
+
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	response := events.LambdaFunctionURLResponse{
+		StatusCode: status,
+		Headers:    headers,
+		Body:       w.body.String(),
+	}
+	// Bodies are returned as text, so anything
+	// else (such as an image) is base64 encoded.
+	if !utf8.Valid(w.body.Bytes()) {
+		response.Body = base64.StdEncoding.EncodeToString(w.body.Bytes())
+		response.IsBase64Encoded = true
+	}
+	return response, nil
+}
+
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
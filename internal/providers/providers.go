@@ -6,7 +6,9 @@ import (
 )
 
 type TypeSendProvider interface {
-	Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) error
+	// Deliver returns the ID the provider gave the message, if any,
+	// so its notifications can be tied back to the envelope.
+	Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) (string, error)
 	GetProviderName() string
 	SetMetricProvider(typesend_metrics.MetricsProvider)
 }
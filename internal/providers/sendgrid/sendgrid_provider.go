@@ -3,6 +3,7 @@ package providers_sendgrid
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/kvizdos/typesend/pkg/typesend_metrics"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
@@ -28,17 +29,10 @@ func (s *SendGridProvider) SetMetricProvider(to typesend_metrics.MetricsProvider
 	s.Metrics = to
 }
 
-func (s SendGridProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) error {
+func (s SendGridProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) (string, error) {
 	if s.Client == nil {
-		if s.Metrics != nil {
-			s.Metrics.DeliverEvent(&typesend_metrics.Metric{
-				AppName:    e.AppID,
-				TemplateID: e.TemplateID,
-				TenantID:   e.TenantID,
-				Success:    false,
-			})
-		}
-		return fmt.Errorf("requires client")
+		s.deliverEvent(e, false, 0)
+		return "", fmt.Errorf("requires client")
 	}
 
 	from := mail.NewEmail(filledTemplate.FromName, filledTemplate.FromAddress)
@@ -50,43 +44,53 @@ func (s SendGridProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTe
 	message.CustomArgs["X-Using-TypeSend"] = "true"
 	message.CustomArgs["X-TypeSend-App"] = e.AppID
 	message.CustomArgs["X-TypeSend-Tenant"] = e.TenantID
+	message.CustomArgs["X-TypeSend-Template"] = e.TemplateID
 	message.CustomArgs["X-TypeSend-Envelope"] = e.ID
+	for name, value := range filledTemplate.Headers {
+		message.SetHeader(name, value)
+	}
 
+	started := time.Now()
 	response, err := s.Client.Send(message)
+	latency := time.Since(started)
 	if err != nil {
-		if s.Metrics != nil {
-			s.Metrics.DeliverEvent(&typesend_metrics.Metric{
-				AppName:    e.AppID,
-				TemplateID: e.TemplateID,
-				TenantID:   e.TenantID,
-				Success:    false,
-			})
-		}
-		return err
+		s.deliverEvent(e, false, latency)
+		return "", err
 	}
 
 	if response.StatusCode != http.StatusAccepted {
-		if s.Metrics != nil {
-			s.Metrics.DeliverEvent(&typesend_metrics.Metric{
-				AppName:    e.AppID,
-				TemplateID: e.TemplateID,
-				TenantID:   e.TenantID,
-				Success:    false,
-			})
-		}
-		return fmt.Errorf("sendgrid status code not Accepted (%d): %s", response.StatusCode, response.Body)
+		s.deliverEvent(e, false, latency)
+		return "", fmt.Errorf("sendgrid status code not Accepted (%d): %s", response.StatusCode, response.Body)
 	}
 
-	if s.Metrics != nil {
-		s.Metrics.DeliverEvent(&typesend_metrics.Metric{
-			AppName:    e.AppID,
-			TemplateID: e.TemplateID,
-			TenantID:   e.TenantID,
-			Success:    true,
-		})
+	s.deliverEvent(e, true, latency)
+
+	return messageID(response), nil
+}
+
+// messageID returns the X-Message-Id SendGrid accepted the message
+// with. Its events report it as the prefix of sg_message_id.
+func messageID(response *rest.Response) string {
+	for name, values := range response.Headers {
+		if http.CanonicalHeaderKey(name) == "X-Message-Id" && len(values) > 0 {
+			return values[0]
+		}
 	}
+	return ""
+}
 
-	return nil
+func (s SendGridProvider) deliverEvent(e *typesend_schemas.TypeSendEnvelope, success bool, latency time.Duration) {
+	if s.Metrics == nil {
+		return
+	}
+	s.Metrics.DeliverEvent(&typesend_metrics.Metric{
+		AppName:    e.AppID,
+		TemplateID: e.TemplateID,
+		TenantID:   e.TenantID,
+		Success:    success,
+		Provider:   s.GetProviderName(),
+		Latency:    latency,
+	})
 }
 
 func NewSendGridProvider(apiKey string) *SendGridProvider {
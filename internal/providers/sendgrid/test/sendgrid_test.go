@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	providers_sendgrid "github.com/kvizdos/typesend/internal/providers/sendgrid"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
@@ -41,7 +42,7 @@ func TestDeliver_NilClient(t *testing.T) {
 		Subject:     "Test Subject",
 		Content:     "<p>Hello World</p>",
 	}
-	err := provider.Deliver(envelope, template)
+	_, err := provider.Deliver(envelope, template)
 	assert.Error(t, err, "expected error due to nil client")
 }
 
@@ -60,10 +61,11 @@ func TestDeliver_Success(t *testing.T) {
 	}
 
 	envelope := &typesend_schemas.TypeSendEnvelope{
-		ToName:    "Recipient",
-		ToAddress: "recipient@example.com",
-		AppID:     "TestApp",
-		TenantID:  "TestTenant",
+		ToName:     "Recipient",
+		ToAddress:  "recipient@example.com",
+		AppID:      "TestApp",
+		TenantID:   "TestTenant",
+		TemplateID: "TestTemplate",
 	}
 	template := &typesend_schemas.TypeSendTemplate{
 		FromName:    "Sender",
@@ -72,7 +74,7 @@ func TestDeliver_Success(t *testing.T) {
 		Content:     "<p>Hello World</p>",
 	}
 
-	err := provider.Deliver(envelope, template)
+	_, err := provider.Deliver(envelope, template)
 	assert.NoError(t, err, "expected no error during successful delivery")
 	assert.NotNil(t, mockClient.SentMessage, "expected a sent message to be set in mockClient")
 
@@ -80,6 +82,23 @@ func TestDeliver_Success(t *testing.T) {
 	assert.Equal(t, "true", mockClient.SentMessage.CustomArgs["X-Using-TypeSend"], "expected custom arg X-Using-TypeSend to be 'true'")
 	assert.Equal(t, "TestApp", mockClient.SentMessage.CustomArgs["X-TypeSend-App"], "expected custom arg X-TypeSend-App to be 'TestApp'")
 	assert.Equal(t, "TestTenant", mockClient.SentMessage.CustomArgs["X-TypeSend-Tenant"], "expected custom arg X-TypeSend-App to be 'TestTenant'")
+	assert.Equal(t, "TestTemplate", mockClient.SentMessage.CustomArgs["X-TypeSend-Template"], "expected custom arg X-TypeSend-Template to be 'TestTemplate'")
+}
+
+// Test that Deliver returns the ID SendGrid accepted the message with.
+func TestDeliver_MessageID(t *testing.T) {
+	provider := providers_sendgrid.SendGridProvider{
+		Client: &mockEmailClient{
+			Response: &rest.Response{
+				StatusCode: http.StatusAccepted,
+				Headers:    map[string][]string{"X-Message-Id": {"sg-message"}},
+			},
+		},
+	}
+
+	messageID, err := provider.Deliver(&typesend_schemas.TypeSendEnvelope{ToAddress: "recipient@example.com"}, &typesend_schemas.TypeSendTemplate{FromAddress: "sender@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sg-message", messageID)
 }
 
 // Test that Deliver propagates the error when Send fails.
@@ -104,7 +123,7 @@ func TestDeliver_SendError(t *testing.T) {
 		Content:     "<p>Hello World</p>",
 	}
 
-	err := provider.Deliver(envelope, template)
+	_, err := provider.Deliver(envelope, template)
 	assert.EqualError(t, err, "send error", "expected the send error to be returned")
 	assert.NotNil(t, mockClient.SentMessage, "expected a sent message attempt even if sending fails")
 }
@@ -136,7 +155,87 @@ func TestDeliver_NonAcceptedStatusCode(t *testing.T) {
 		Content:     "<p>Hello World</p>",
 	}
 
-	err := provider.Deliver(envelope, template)
+	_, err := provider.Deliver(envelope, template)
 	expectedErr := fmt.Sprintf("sendgrid status code not Accepted (%d): %s", nonAcceptedStatus, errorBody)
 	assert.EqualError(t, err, expectedErr, "expected error due to non-Accepted status code")
 }
+
+// Test that Deliver adds the filled templates headers.
+func TestDeliver_Headers(t *testing.T) {
+	mockClient := &mockEmailClient{
+		Response: &rest.Response{StatusCode: http.StatusAccepted},
+	}
+	provider := providers_sendgrid.SendGridProvider{
+		Client: mockClient,
+	}
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ToAddress: "recipient@example.com",
+	}
+	template := &typesend_schemas.TypeSendTemplate{
+		FromAddress: "sender@example.com",
+		Headers:     typesend_schemas.ListUnsubscribeHeaders("https://example.com/?token=abc", ""),
+	}
+
+	_, err := provider.Deliver(envelope, template)
+	assert.NoError(t, err)
+	if assert.NotNil(t, mockClient.SentMessage) {
+		assert.Equal(t, "<https://example.com/?token=abc>", mockClient.SentMessage.Headers["List-Unsubscribe"])
+		assert.Equal(t, "List-Unsubscribe=One-Click", mockClient.SentMessage.Headers["List-Unsubscribe-Post"])
+	}
+}
+
+type recordingMetrics struct {
+	Delivered []*typesend_metrics.Metric
+}
+
+func (r *recordingMetrics) SendEvent(metric *typesend_metrics.Metric) error {
+	return nil
+}
+
+func (r *recordingMetrics) DeliverEvent(metric *typesend_metrics.Metric) error {
+	r.Delivered = append(r.Delivered, metric)
+	return nil
+}
+
+// Test that Deliver reports which provider delivered, and how it went.
+func TestDeliver_Metrics(t *testing.T) {
+	metrics := &recordingMetrics{}
+	provider := providers_sendgrid.SendGridProvider{
+		Client: &mockEmailClient{
+			Response: &rest.Response{StatusCode: http.StatusAccepted},
+		},
+	}
+	provider.SetMetricProvider(metrics)
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ToName:     "Recipient",
+		ToAddress:  "recipient@example.com",
+		AppID:      "TestApp",
+		TenantID:   "TestTenant",
+		TemplateID: "TestTemplate",
+	}
+	template := &typesend_schemas.TypeSendTemplate{
+		FromName:    "Sender",
+		FromAddress: "sender@example.com",
+		Subject:     "Test Subject",
+		Content:     "<p>Hello World</p>",
+	}
+
+	_, err := provider.Deliver(envelope, template)
+	assert.NoError(t, err)
+	provider.Client = &mockEmailClient{Err: errors.New("send error")}
+	_, err = provider.Deliver(envelope, template)
+	assert.Error(t, err)
+
+	if assert.Len(t, metrics.Delivered, 2) {
+		assert.True(t, metrics.Delivered[0].Success)
+		assert.False(t, metrics.Delivered[1].Success)
+		for _, metric := range metrics.Delivered {
+			assert.Equal(t, "SendGrid", metric.Provider)
+			assert.Equal(t, "TestApp", metric.AppName)
+			assert.Equal(t, "TestTemplate", metric.TemplateID)
+			assert.Equal(t, "TestTenant", metric.TenantID)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package providers_ses
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+	"github.com/aws/aws-sdk-go/service/sesv2/sesv2iface"
+	typesend_events_ses "github.com/kvizdos/typesend/pkg/typesend_events/ses"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// SES only accepts tag values of these characters, up to 256 long.
+var tagValuePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// SESProvider delivers through Amazon SES. Each email is tagged, and
+// carries headers, that tie its notifications back to the envelope,
+// and the message ID SES returns is recorded on the SENT event for
+// those where neither make it through.
+type SESProvider struct {
+	Client sesv2iface.SESV2API
+	// Optional; required for SES to publish events through
+	// a configuration set's SNS destination.
+	ConfigurationSetName string
+	Metrics              typesend_metrics.MetricsProvider
+}
+
+func (s SESProvider) GetProviderName() string {
+	return typesend_events_ses.ProviderName
+}
+
+func (s *SESProvider) SetMetricProvider(to typesend_metrics.MetricsProvider) {
+	s.Metrics = to
+}
+
+func (s SESProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) (string, error) {
+	if s.Client == nil {
+		s.deliverEvent(e, false, 0)
+		return "", fmt.Errorf("requires client")
+	}
+
+	headers := []*sesv2.MessageHeader{
+		{Name: aws.String(typesend_events_ses.EnvelopeHeader), Value: aws.String(e.ID)},
+		{Name: aws.String(typesend_events_ses.AppHeader), Value: aws.String(e.AppID)},
+		{Name: aws.String(typesend_events_ses.TenantHeader), Value: aws.String(e.TenantID)},
+		{Name: aws.String(typesend_events_ses.TemplateHeader), Value: aws.String(e.TemplateID)},
+	}
+	for name, value := range filledTemplate.Headers {
+		headers = append(headers, &sesv2.MessageHeader{Name: aws.String(name), Value: aws.String(value)})
+	}
+
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String((&mail.Address{Name: filledTemplate.FromName, Address: filledTemplate.FromAddress}).String()),
+		Destination: &sesv2.Destination{
+			ToAddresses: []*string{aws.String((&mail.Address{Name: e.ToName, Address: e.ToAddress}).String())},
+		},
+		Content: &sesv2.EmailContent{
+			Simple: &sesv2.Message{
+				Subject: &sesv2.Content{Data: aws.String(filledTemplate.Subject), Charset: aws.String("UTF-8")},
+				Body: &sesv2.Body{
+					Html: &sesv2.Content{Data: aws.String(filledTemplate.Content), Charset: aws.String("UTF-8")},
+					Text: &sesv2.Content{Data: aws.String("Please view in HTML"), Charset: aws.String("UTF-8")},
+				},
+				Headers: headers,
+			},
+		},
+		EmailTags: tags(e),
+	}
+	if s.ConfigurationSetName != "" {
+		input.ConfigurationSetName = aws.String(s.ConfigurationSetName)
+	}
+
+	started := time.Now()
+	output, err := s.Client.SendEmailWithContext(context.Background(), input)
+	latency := time.Since(started)
+	if err != nil {
+		s.deliverEvent(e, false, latency)
+		return "", err
+	}
+
+	s.deliverEvent(e, true, latency)
+
+	return aws.StringValue(output.MessageId), nil
+}
+
+// tags returns the SES message tags for the values SES accepts.
+// Others are left to the headers and message ID.
+func tags(e *typesend_schemas.TypeSendEnvelope) []*sesv2.MessageTag {
+	var tags []*sesv2.MessageTag
+	for _, tag := range [][2]string{
+		{typesend_events_ses.EnvelopeTag, e.ID},
+		{typesend_events_ses.AppTag, e.AppID},
+		{typesend_events_ses.TenantTag, e.TenantID},
+		{typesend_events_ses.TemplateTag, e.TemplateID},
+	} {
+		if tagValuePattern.MatchString(tag[1]) {
+			tags = append(tags, &sesv2.MessageTag{Name: aws.String(tag[0]), Value: aws.String(tag[1])})
+		}
+	}
+	return tags
+}
+
+func (s SESProvider) deliverEvent(e *typesend_schemas.TypeSendEnvelope, success bool, latency time.Duration) {
+	if s.Metrics == nil {
+		return
+	}
+	s.Metrics.DeliverEvent(&typesend_metrics.Metric{
+		AppName:    e.AppID,
+		TemplateID: e.TemplateID,
+		TenantID:   e.TenantID,
+		Success:    success,
+		Provider:   s.GetProviderName(),
+		Latency:    latency,
+	})
+}
+
+func NewSESProvider(region string, configurationSetName string) (*SESProvider, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SESProvider{
+		Client:               sesv2.New(sess),
+		ConfigurationSetName: configurationSetName,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package providers_ses_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sesv2"
+	"github.com/aws/aws-sdk-go/service/sesv2/sesv2iface"
+	providers_ses "github.com/kvizdos/typesend/internal/providers/ses"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockSESClient implements the SendEmail call of SESV2API for testing.
+type mockSESClient struct {
+	sesv2iface.SESV2API
+	Input  *sesv2.SendEmailInput
+	Output *sesv2.SendEmailOutput
+	Err    error
+}
+
+func (m *mockSESClient) SendEmailWithContext(_ aws.Context, input *sesv2.SendEmailInput, _ ...request.Option) (*sesv2.SendEmailOutput, error) {
+	m.Input = input
+	return m.Output, m.Err
+}
+
+func newEnvelope() *typesend_schemas.TypeSendEnvelope {
+	return &typesend_schemas.TypeSendEnvelope{
+		ID:         "2f1c7a52-8a7e-4d43-a8f4-3c0d5e0f6b11",
+		ToName:     "Recipient",
+		ToAddress:  "recipient@example.com",
+		AppID:      "TestApp",
+		TenantID:   "tenant.example.com",
+		TemplateID: "TestTemplate",
+	}
+}
+
+func newTemplate() *typesend_schemas.TypeSendTemplate {
+	return &typesend_schemas.TypeSendTemplate{
+		FromName:    "Sender",
+		FromAddress: "sender@example.com",
+		Subject:     "Test Subject",
+		Content:     "<p>Hello World</p>",
+		Headers:     typesend_schemas.ListUnsubscribeHeaders("https://example.com/?token=abc", ""),
+	}
+}
+
+// Test that Deliver returns an error if the client is nil.
+func TestDeliver_NilClient(t *testing.T) {
+	provider := providers_ses.SESProvider{}
+	_, err := provider.Deliver(newEnvelope(), newTemplate())
+	assert.Error(t, err, "expected error due to nil client")
+}
+
+// Test that Deliver tags the email, sets its headers, and returns
+// the ID SES accepted it with.
+func TestDeliver_Success(t *testing.T) {
+	client := &mockSESClient{
+		Output: &sesv2.SendEmailOutput{MessageId: aws.String("0100018f-ses-message")},
+	}
+	provider := providers_ses.SESProvider{
+		Client:               client,
+		ConfigurationSetName: "typesend",
+	}
+
+	messageID, err := provider.Deliver(newEnvelope(), newTemplate())
+	assert.NoError(t, err)
+	assert.Equal(t, "0100018f-ses-message", messageID)
+	if !assert.NotNil(t, client.Input) {
+		return
+	}
+
+	assert.Equal(t, "typesend", aws.StringValue(client.Input.ConfigurationSetName))
+	assert.Equal(t, `"Sender" <sender@example.com>`, aws.StringValue(client.Input.FromEmailAddress))
+	assert.Equal(t, []string{`"Recipient" <recipient@example.com>`}, aws.StringValueSlice(client.Input.Destination.ToAddresses))
+	assert.Equal(t, "Test Subject", aws.StringValue(client.Input.Content.Simple.Subject.Data))
+	assert.Equal(t, "<p>Hello World</p>", aws.StringValue(client.Input.Content.Simple.Body.Html.Data))
+
+	tags := map[string]string{}
+	for _, tag := range client.Input.EmailTags {
+		tags[aws.StringValue(tag.Name)] = aws.StringValue(tag.Value)
+	}
+	assert.Equal(t, map[string]string{
+		"typesend-envelope": "2f1c7a52-8a7e-4d43-a8f4-3c0d5e0f6b11",
+		"typesend-app":      "TestApp",
+		"typesend-template": "TestTemplate",
+	}, tags, "values SES would reject should not be tagged")
+
+	headers := map[string]string{}
+	for _, header := range client.Input.Content.Simple.Headers {
+		headers[aws.StringValue(header.Name)] = aws.StringValue(header.Value)
+	}
+	assert.Equal(t, "2f1c7a52-8a7e-4d43-a8f4-3c0d5e0f6b11", headers["X-TypeSend-Envelope"])
+	assert.Equal(t, "tenant.example.com", headers["X-TypeSend-Tenant"], "the header should carry what the tags cannot")
+	assert.Equal(t, "<https://example.com/?token=abc>", headers["List-Unsubscribe"])
+}
+
+// Test that Deliver propagates the error when SendEmail fails.
+func TestDeliver_SendError(t *testing.T) {
+	provider := providers_ses.SESProvider{
+		Client: &mockSESClient{Err: errors.New("send error")},
+	}
+
+	messageID, err := provider.Deliver(newEnvelope(), newTemplate())
+	assert.EqualError(t, err, "send error")
+	assert.Empty(t, messageID)
+}
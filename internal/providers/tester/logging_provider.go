@@ -23,10 +23,13 @@ func (s *LoggingProvider) SetMetricProvider(to typesend_metrics.MetricsProvider)
 	s.Metrics = to
 }
 
-func (t *LoggingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) error {
+func (t *LoggingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) (string, error) {
 	t.Logger.Infof("--- EMAIL ---")
 	t.Logger.Infof("TO: %s (%s) ---", e.ToName, e.ToAddress)
 	t.Logger.Infof("SUBJECT: %s ---", filledTemplate.Subject)
+	for name, value := range filledTemplate.Headers {
+		t.Logger.Infof("%s: %s ---", name, value)
+	}
 	t.Logger.Infof("%s", filledTemplate.Content)
 	t.Logger.Infof("--- END EMAIL ---")
 	if t.Metrics != nil {
@@ -35,9 +38,10 @@ func (t *LoggingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTe
 			TemplateID: e.TemplateID,
 			TenantID:   e.TenantID,
 			Success:    true,
+			Provider:   t.GetProviderName(),
 		})
 	}
-	return nil
+	return "", nil
 }
 
 // GetProviderName returns a fixed provider name.
@@ -10,6 +10,7 @@ import (
 type TestMessage struct {
 	Subject string
 	Content string
+	Headers map[string]string
 }
 
 // TestingProvider implements TypeSendProvider for testing purposes.
@@ -32,10 +33,11 @@ func (s *TestingProvider) SetMetricProvider(_ typesend_metrics.MetricsProvider)
 }
 
 // Deliver stores the provided envelope internally.
-// It returns t.SendError if set, otherwise stores the envelope and returns nil.
-func (t *TestingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) error {
+// It returns t.SendError if set, otherwise stores the envelope and
+// returns its MessageID.
+func (t *TestingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTemplate *typesend_schemas.TypeSendTemplate) (string, error) {
 	if t.SendError != nil {
-		return t.SendError
+		return "", t.SendError
 	}
 
 	t.mu.Lock()
@@ -44,8 +46,14 @@ func (t *TestingProvider) Deliver(e *typesend_schemas.TypeSendEnvelope, filledTe
 	t.messages[e.ID] = &TestMessage{
 		Subject: filledTemplate.Subject,
 		Content: filledTemplate.Content,
+		Headers: filledTemplate.Headers,
 	}
-	return nil
+	return t.MessageID(e.ID), nil
+}
+
+// MessageID is the provider message ID Deliver returns for an envelope.
+func (t *TestingProvider) MessageID(envelopeID string) string {
+	return "testing-" + envelopeID
 }
 
 // GetProviderName returns a fixed provider name.
@@ -0,0 +1,98 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Secrets shorter than this are rejected.
+const MinSecretSize = 32
+
+// CheckSecrets requires at least one secret, each of at least
+// MinSecretSize bytes. name describes them in errors.
+func CheckSecrets(name string, secrets [][]byte) error {
+	if len(secrets) == 0 {
+		return fmt.Errorf("typesend: %s signer needs a secret", name)
+	}
+	for _, secret := range secrets {
+		if len(secret) < MinSecretSize {
+			return fmt.Errorf("typesend: %s secrets must be at least %d bytes", name, MinSecretSize)
+		}
+	}
+	return nil
+}
+
+// ParseSecrets reads a comma separated list of base64 secrets,
+// newest first.
+func ParseSecrets(name string, raw string) ([][]byte, error) {
+	var secrets [][]byte
+	for _, encoded := range strings.Split(raw, ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: invalid %s secret: %w", name, err)
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, nil
+}
+
+// Sign returns token as JSON, signed with HMAC-SHA256, as
+// "<payload>.<signature>". Both are URL safe base64, ready
+// to be put in a query string.
+func Sign(secret []byte, name string, token any) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", fmt.Errorf("typesend: failed to marshal %s: %w", name, err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac(secret, encoded)), nil
+}
+
+// Verify decodes what Sign signed into token, if any of the
+// secrets signed it. name describes the token in errors.
+func Verify(secrets [][]byte, name string, signed string, token any) error {
+	encoded, signature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return fmt.Errorf("typesend: malformed %s", name)
+	}
+
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("typesend: malformed %s: %w", name, err)
+	}
+
+	verified := false
+	for _, secret := range secrets {
+		if hmac.Equal(sum, mac(secret, encoded)) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return fmt.Errorf("typesend: invalid %s signature", name)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("typesend: malformed %s: %w", name, err)
+	}
+	if err := json.Unmarshal(payload, token); err != nil {
+		return fmt.Errorf("typesend: malformed %s: %w", name, err)
+	}
+	return nil
+}
+
+func mac(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
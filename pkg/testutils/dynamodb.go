@@ -72,7 +72,7 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 	dynamoClient := dynamodb.New(sess)
 
 	var setupWg sync.WaitGroup
-	setupWg.Add(2)
+	setupWg.Add(3)
 
 	go func() {
 		defer setupWg.Done()
@@ -91,6 +91,54 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 					AttributeName: aws.String("scheduledFor"),
 					AttributeType: aws.String("S"),
 				},
+				{
+					AttributeName: aws.String("to"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("toInternal"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("address"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("eventEnvelope"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("occurredAt"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("eventDay"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("providerMessageId"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("rollupApp"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("rollupKey"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("statusPriority"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("contentExpiresAt"),
+					AttributeType: aws.String("N"),
+				},
+				{
+					AttributeName: aws.String("expiresAt"),
+					AttributeType: aws.String("N"),
+				},
 			},
 			KeySchema: []*dynamodb.KeySchemaElement{
 				{
@@ -100,6 +148,54 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 			},
 			BillingMode: aws.String("PAY_PER_REQUEST"),
 			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				{
+					IndexName: aws.String("statusPriority-scheduledFor-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("statusPriority"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("scheduledFor"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("status-contentExpiresAt-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("status"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("contentExpiresAt"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("KEYS_ONLY"),
+					},
+				},
+				{
+					IndexName: aws.String("status-expiresAt-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("status"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("expiresAt"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("KEYS_ONLY"),
+					},
+				},
 				{
 					IndexName: aws.String("status-scheduledFor-index"),
 					KeySchema: []*dynamodb.KeySchemaElement{
@@ -116,6 +212,102 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 						ProjectionType: aws.String("ALL"),
 					},
 				},
+				{
+					IndexName: aws.String("to-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("to"),
+							KeyType:       aws.String("HASH"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("toInternal-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("toInternal"),
+							KeyType:       aws.String("HASH"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("address-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("address"),
+							KeyType:       aws.String("HASH"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("eventEnvelope-occurredAt-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("eventEnvelope"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("occurredAt"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("eventDay-occurredAt-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("eventDay"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("occurredAt"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("providerMessageId-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("providerMessageId"),
+							KeyType:       aws.String("HASH"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+				{
+					IndexName: aws.String("rollupApp-rollupKey-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("rollupApp"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("rollupKey"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
 			},
 		}, 5)
 		if err != nil {
@@ -154,10 +346,59 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 		}
 	}()
 
+	go func() {
+		defer setupWg.Done()
+		err = createTableWithRetry(dynamoClient, &dynamodb.CreateTableInput{
+			TableName: aws.String("test-typesend-schedules"),
+			AttributeDefinitions: []*dynamodb.AttributeDefinition{
+				{
+					AttributeName: aws.String("id"),
+					AttributeType: aws.String("S"),
+				},
+				{
+					AttributeName: aws.String("state"),
+					AttributeType: aws.String("N"),
+				},
+				{
+					AttributeName: aws.String("nextRunAt"),
+					AttributeType: aws.String("S"),
+				},
+			},
+			KeySchema: []*dynamodb.KeySchemaElement{
+				{
+					AttributeName: aws.String("id"),
+					KeyType:       aws.String("HASH"),
+				},
+			},
+			BillingMode: aws.String("PAY_PER_REQUEST"),
+			GlobalSecondaryIndexes: []*dynamodb.GlobalSecondaryIndex{
+				{
+					IndexName: aws.String("state-nextRunAt-index"),
+					KeySchema: []*dynamodb.KeySchemaElement{
+						{
+							AttributeName: aws.String("state"),
+							KeyType:       aws.String("HASH"),
+						},
+						{
+							AttributeName: aws.String("nextRunAt"),
+							KeyType:       aws.String("RANGE"),
+						},
+					},
+					Projection: &dynamodb.Projection{
+						ProjectionType: aws.String("ALL"),
+					},
+				},
+			},
+		}, 5)
+		if err != nil {
+			panic(fmt.Errorf("failed to create table: %w", err))
+		}
+	}()
+
 	setupWg.Wait()
 
 	var readyWg sync.WaitGroup
-	readyWg.Add(2)
+	readyWg.Add(3)
 	go func() {
 		defer readyWg.Done()
 		// Wait until the table exists.
@@ -177,6 +418,15 @@ func SetupDynamoDBLocalSession(t *testing.T, ctx context.Context) (*dynamodb.Dyn
 			panic(fmt.Sprintf("failed to wait for table creation: %s", err.Error()))
 		}
 	}()
+	go func() {
+		defer readyWg.Done()
+		err = dynamoClient.WaitUntilTableExists(&dynamodb.DescribeTableInput{
+			TableName: aws.String("test-typesend-schedules"),
+		})
+		if err != nil {
+			panic(fmt.Sprintf("failed to wait for table creation: %s", err.Error()))
+		}
+	}()
 	readyWg.Wait()
 	return dynamoClient, container, nil
 }
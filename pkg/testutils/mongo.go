@@ -0,0 +1,48 @@
+package testutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// SetupMongo spins up a standalone mongod container. It returns the
+// URI to connect with, the container (for cleanup), and any error.
+func SetupMongo(t *testing.T, ctx context.Context) (string, testcontainers.Container, error) {
+	req := testcontainers.ContainerRequest{
+		Image:        "mongo:7",
+		ExposedPorts: []string{"27017/tcp"},
+		WaitingFor: wait.ForAll(
+			wait.ForListeningPort("27017/tcp"),
+			wait.ForLog("Waiting for connections"),
+		).WithDeadline(60 * time.Second),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+		Logger: &TestLogger{
+			DoLog: true,
+			Test:  t,
+		},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start Mongo container: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		return "", container, fmt.Errorf("failed to get container host: %w", err)
+	}
+
+	port, err := container.MappedPort(ctx, "27017")
+	if err != nil {
+		return "", container, fmt.Errorf("failed to get container port: %w", err)
+	}
+
+	return fmt.Sprintf("mongodb://%s:%s", host, port.Port()), container, nil
+}
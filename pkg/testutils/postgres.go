@@ -0,0 +1,54 @@
+package testutils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// SetupPostgres spins up a PostgreSQL container. It returns a connection
+// string for the empty "typesend" database, the container (for cleanup), and any error.
+func SetupPostgres(t *testing.T, ctx context.Context) (string, testcontainers.Container, error) {
+	req := testcontainers.ContainerRequest{
+		Image:        "postgres:16-alpine",
+		ExposedPorts: []string{"5432/tcp"},
+		Env: map[string]string{
+			"POSTGRES_USER":     "typesend",
+			"POSTGRES_PASSWORD": "typesend",
+			"POSTGRES_DB":       "typesend",
+		},
+		// The server restarts once after running its init scripts.
+		WaitingFor: wait.ForAll(
+			wait.ForListeningPort("5432/tcp"),
+			wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		).WithDeadline(60 * time.Second),
+	}
+
+	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: req,
+		Started:          true,
+		Logger: &TestLogger{
+			DoLog: true,
+			Test:  t,
+		},
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to start Postgres container: %w", err)
+	}
+
+	host, err := container.Host(ctx)
+	if err != nil {
+		return "", container, fmt.Errorf("failed to get container host: %w", err)
+	}
+
+	port, err := container.MappedPort(ctx, "5432")
+	if err != nil {
+		return "", container, fmt.Errorf("failed to get container port: %w", err)
+	}
+
+	return fmt.Sprintf("postgres://typesend:typesend@%s:%s/typesend?sslmode=disable", host, port.Port()), container, nil
+}
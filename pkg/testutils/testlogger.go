@@ -56,7 +56,7 @@ func (l *TestLogger) Errorf(format string, v ...any) {
 }
 func (l *TestLogger) Infof(format string, v ...any) {
 	l.mutex.Lock()
-	if l.DebugLogs == nil {
+	if l.InfoLogs == nil {
 		l.InfoLogs = []*string{}
 	}
 	o := fmt.Sprintf(format, v...)
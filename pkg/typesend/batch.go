@@ -0,0 +1,160 @@
+package typesend
+
+import (
+	"context"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// BatchRecipient is a single message within a SendBatch call.
+type BatchRecipient struct {
+	To        typesend_schemas.TypeSendTo
+	Variables typesend_schemas.TypeSendVariableInterface
+}
+
+// BatchResult is the outcome for the BatchRecipient at the same index.
+// ID is set when Err is nil.
+type BatchResult struct {
+	ID  string
+	Err error
+}
+
+type sendMetricKey struct {
+	templateID string
+	tenantID   string
+	success    bool
+}
+
+// SendBatch sends to many recipients at once. Every recipient is
+// validated before anything is written, then envelopes are inserted
+// in batches. The returned results line up with recipients by index.
+//
+// Recipients carrying an IdempotencyKey are inserted one at a time
+// so the key can still be enforced.
+func (t *TypeSend) SendBatch(ctx context.Context, recipients []BatchRecipient, sendAt time.Time) []BatchResult {
+	results := make([]BatchResult, len(recipients))
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, len(recipients))
+
+	lookups := newSendLookups()
+
+	for i, recipient := range recipients {
+		envelope, err := t.buildEnvelope(recipient.To, recipient.Variables, sendAt)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if err := t.resolvePriority(ctx, envelope, lookups); err != nil {
+			results[i].Err = err
+			continue
+		}
+		envelopes[i] = envelope
+	}
+
+	// Every suppression and preference is read in one go,
+	// rather than once per recipient.
+	keys := make([]typesend_db.RecipientKey, 0, len(recipients))
+	keyIndexes := make([]int, 0, len(recipients))
+	for i, envelope := range envelopes {
+		if envelope != nil {
+			keys = append(keys, recipientKey(envelope))
+			keyIndexes = append(keyIndexes, i)
+		}
+	}
+
+	var states []typesend_db.RecipientState
+	if len(keys) > 0 {
+		var err error
+		states, err = t.Database.GetRecipientStates(ctx, keys)
+		if err != nil {
+			for _, i := range keyIndexes {
+				results[i].Err = err
+				envelopes[i] = nil
+			}
+		}
+	}
+
+	for j, i := range keyIndexes {
+		envelope := envelopes[i]
+		if envelope == nil {
+			continue
+		}
+		if err := t.checkRecipient(ctx, envelope, states[j], lookups); err != nil {
+			results[i].Err = err
+			envelopes[i] = nil
+			continue
+		}
+		if err := t.seal(ctx, envelope); err != nil {
+			results[i].Err = err
+			envelopes[i] = nil
+		}
+	}
+
+	inserted := make([]bool, len(recipients))
+
+	batch := make([]*typesend_schemas.TypeSendEnvelope, 0, len(recipients))
+	batchIndexes := make([]int, 0, len(recipients))
+
+	for i, envelope := range envelopes {
+		if envelope == nil {
+			continue
+		}
+
+		if recipients[i].To.IdempotencyKey == "" {
+			batch = append(batch, envelope)
+			batchIndexes = append(batchIndexes, i)
+			continue
+		}
+
+		ownerID, err := t.insertIdempotent(ctx, envelope, recipients[i].To.IdempotencyKey)
+		results[i] = BatchResult{ID: ownerID, Err: err}
+		inserted[i] = err == nil && ownerID == envelope.ID
+	}
+
+	if len(batch) > 0 {
+		errs := t.Database.InsertBatch(ctx, batch)
+		for j, i := range batchIndexes {
+			if errs[j] != nil {
+				results[i].Err = errs[j]
+				continue
+			}
+			results[i].ID = batch[j].ID
+			inserted[i] = true
+		}
+	}
+
+	queued := make([]*typesend_schemas.TypeSendEvent, 0, len(recipients))
+	for i, envelope := range envelopes {
+		if inserted[i] {
+			queued = append(queued, queuedEvent(envelope))
+		}
+	}
+	typesend_events.Append(ctx, t.Database, t.Logger, queued...)
+
+	if t.MetricProvider != nil {
+		// Like Send, only attempted inserts are counted; a repeat
+		// of an idempotency key inserts nothing and isn't counted.
+		counts := make(map[sendMetricKey]int)
+		for i, envelope := range envelopes {
+			if envelope == nil || (!inserted[i] && results[i].Err == nil) {
+				continue
+			}
+			counts[sendMetricKey{templateID: envelope.TemplateID, tenantID: envelope.TenantID, success: inserted[i]}] += 1
+		}
+
+		for key, count := range counts {
+			t.MetricProvider.SendEvent(&typesend_metrics.Metric{
+				AppName:    t.AppID,
+				TemplateID: key.templateID,
+				TenantID:   key.tenantID,
+				Success:    key.success,
+				Count:      count,
+			})
+		}
+	}
+
+	return results
+}
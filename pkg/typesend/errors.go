@@ -1,8 +1,50 @@
 package typesend
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
 
 var (
-	TypeSendError_INVALID_EMAIL = errors.New("typesend: invalid email format")
-	TypeSendError_UTC_MISMATCH  = errors.New("typesend: date must be in UTC")
+	TypeSendError_INVALID_EMAIL       = errors.New("typesend: invalid email format")
+	TypeSendError_UTC_MISMATCH        = errors.New("typesend: date must be in UTC")
+	TypeSendError_INVALID_PRIORITY    = errors.New("typesend: invalid priority")
+	TypeSendError_INVALID_TIMEZONE    = errors.New("typesend: invalid time zone")
+	TypeSendError_INVALID_QUIET_HOURS = errors.New("typesend: invalid quiet hours")
+	TypeSendError_SUPPRESSED          = errors.New("typesend: recipient is suppressed")
+	TypeSendError_OPTED_OUT           = errors.New("typesend: recipient opted out of the category")
+	TypeSendError_ERASED              = errors.New("typesend: recipient was erased")
+
+	TypeSendError_INVALID_RECURRENCE = errors.New("typesend: invalid recurrence")
+	TypeSendError_SCHEDULE_NOT_FOUND = errors.New("typesend: schedule not found")
 )
+
+// SuppressedError is returned when the recipient is suppressed.
+// It matches TypeSendError_SUPPRESSED with errors.Is.
+type SuppressedError struct {
+	Suppression *typesend_schemas.TypeSendSuppression
+}
+
+func (e *SuppressedError) Error() string {
+	return fmt.Sprintf("%s (%s)", TypeSendError_SUPPRESSED.Error(), e.Suppression.Reason)
+}
+
+func (e *SuppressedError) Unwrap() error {
+	return TypeSendError_SUPPRESSED
+}
+
+// OptedOutError is returned when the recipient opted out of the
+// templates category. It matches TypeSendError_OPTED_OUT with errors.Is.
+type OptedOutError struct {
+	Category string
+}
+
+func (e *OptedOutError) Error() string {
+	return fmt.Sprintf("%s (%s)", TypeSendError_OPTED_OUT.Error(), e.Category)
+}
+
+func (e *OptedOutError) Unwrap() error {
+	return TypeSendError_OPTED_OUT
+}
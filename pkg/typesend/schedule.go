@@ -0,0 +1,128 @@
+package typesend
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Schedule creates a recurring send to the recipient. Each occurrence
+// is expanded into its own envelope by the dispatcher once it is due.
+// The recipients IdempotencyKey is not used, as each occurrence is
+// already deduplicated.
+func (t *TypeSend) Schedule(ctx context.Context, to typesend_schemas.TypeSendTo, variables typesend_schemas.TypeSendVariableInterface, recurrence typesend_schemas.TypeSendRecurrence) (string, error) {
+	if err := recurrence.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %s", TypeSendError_INVALID_RECURRENCE, err.Error())
+	}
+
+	// Built like any other envelope, so the recipient is
+	// validated and defaulted the same way as in Send.
+	envelope, err := t.buildEnvelope(to, variables, time.Time{})
+	if err != nil {
+		return "", err
+	}
+
+	// Occurrences are checked again as they are delivered.
+	if err := t.prepareEnvelope(ctx, envelope); err != nil {
+		return "", err
+	}
+
+	// Each occurrence carries the same sealed Variables.
+	if err := t.seal(ctx, envelope); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	if recurrence.Start.IsZero() {
+		recurrence.Start = now
+	}
+
+	nextRunAt, err := recurrence.Next(now)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", TypeSendError_INVALID_RECURRENCE, err.Error())
+	}
+	if nextRunAt.IsZero() {
+		return "", fmt.Errorf("%w: no future occurrences", TypeSendError_INVALID_RECURRENCE)
+	}
+
+	schedule := &typesend_schemas.TypeSendSchedule{
+		ID:             envelope.ID,
+		AppID:          envelope.AppID,
+		TenantID:       envelope.TenantID,
+		TemplateID:     envelope.TemplateID,
+		ToAddress:      envelope.ToAddress,
+		ToName:         envelope.ToName,
+		ToInternalID:   envelope.ToInternalID,
+		MessageGroupID: envelope.MessageGroupID,
+		Variables:      envelope.Variables,
+		Sealed:         envelope.Sealed,
+		Priority:       envelope.Priority,
+		TimeZone:       envelope.TimeZone,
+		QuietHours:     envelope.QuietHours,
+		Recurrence:     recurrence,
+		State:          typesend_schemas.TypeSendScheduleState_ACTIVE,
+		NextRunAt:      nextRunAt,
+	}
+
+	if err := t.Database.InsertSchedule(ctx, schedule); err != nil {
+		return "", err
+	}
+
+	return schedule.ID, nil
+}
+
+// PauseSchedule stops a schedule from being expanded until it is resumed.
+func (t *TypeSend) PauseSchedule(ctx context.Context, scheduleID string) error {
+	if _, err := t.getSchedule(ctx, scheduleID); err != nil {
+		return err
+	}
+
+	return t.Database.UpdateScheduleState(ctx, scheduleID, typesend_schemas.TypeSendScheduleState_PAUSED, time.Time{})
+}
+
+// ResumeSchedule reactivates a paused schedule. Occurrences missed
+// while it was paused are skipped; it next runs at its first
+// occurrence after now.
+func (t *TypeSend) ResumeSchedule(ctx context.Context, scheduleID string) error {
+	schedule, err := t.getSchedule(ctx, scheduleID)
+	if err != nil {
+		return err
+	}
+
+	nextRunAt, err := schedule.Recurrence.Next(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	if nextRunAt.IsZero() {
+		return t.Database.UpdateScheduleState(ctx, scheduleID, typesend_schemas.TypeSendScheduleState_COMPLETED, time.Time{})
+	}
+
+	return t.Database.UpdateScheduleState(ctx, scheduleID, typesend_schemas.TypeSendScheduleState_ACTIVE, nextRunAt)
+}
+
+// DeleteSchedule removes a schedule. Envelopes already
+// expanded from it are still sent.
+func (t *TypeSend) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	if _, err := t.getSchedule(ctx, scheduleID); err != nil {
+		return err
+	}
+
+	return t.Database.DeleteSchedule(ctx, scheduleID)
+}
+
+// getSchedule only returns schedules belonging to this App.
+func (t *TypeSend) getSchedule(ctx context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	schedule, err := t.Database.GetScheduleByID(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if schedule == nil || schedule.AppID != t.AppID {
+		return nil, TypeSendError_SCHEDULE_NOT_FOUND
+	}
+
+	return schedule, nil
+}
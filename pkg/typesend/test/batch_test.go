@@ -0,0 +1,246 @@
+package typesend_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// recordingMetrics keeps every metric it receives.
+type recordingMetrics struct {
+	mu    sync.Mutex
+	sends []*typesend_metrics.Metric
+}
+
+func (r *recordingMetrics) SendEvent(metric *typesend_metrics.Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sends = append(r.sends, metric)
+	return nil
+}
+
+func (r *recordingMetrics) DeliverEvent(metric *typesend_metrics.Metric) error {
+	return nil
+}
+
+func TestStubbed_SendBatch(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	metrics := &recordingMetrics{}
+	ts := &typesend.TypeSend{
+		AppID:          "test-app",
+		Database:       db,
+		MetricProvider: metrics,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	recipients := []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "a@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "bademail"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "b@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "c@example.com", ToTenantID: "other-tenant"}, Variables: vars},
+	}
+
+	results := ts.SendBatch(ctx, recipients, time.Time{})
+	assert.Len(t, results, len(recipients), "expected one result per recipient")
+
+	assert.NoError(t, results[0].Err)
+	assert.NotEmpty(t, results[0].ID)
+	assert.ErrorIs(t, results[1].Err, typesend.TypeSendError_INVALID_EMAIL)
+	assert.Empty(t, results[1].ID)
+	assert.NoError(t, results[2].Err)
+	assert.NoError(t, results[3].Err)
+
+	assert.Len(t, db.Items(), 3, "only valid recipients should be inserted")
+
+	for i, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		envelope, err := db.GetEnvelopeByID(ctx, result.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, recipients[i].To.ToAddress, envelope.ToAddress, "result IDs should line up with recipients")
+	}
+
+	// One aggregated metric per template and tenant.
+	assert.Len(t, metrics.sends, 2, "expected aggregated send metrics")
+	total := 0
+	for _, metric := range metrics.sends {
+		total += metric.Total()
+		if metric.TenantID == "base" {
+			assert.Equal(t, 2, metric.Count)
+		}
+	}
+	assert.Equal(t, 3, total)
+}
+
+func TestStubbed_SendBatch_IdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	to := typesend_schemas.TypeSendTo{
+		ToAddress:      "a@example.com",
+		IdempotencyKey: "weekly-report-a",
+	}
+
+	originalID, err := ts.Send(to, testutils.DummyVariable{}, time.Time{})
+	assert.NoError(t, err)
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: to, Variables: testutils.DummyVariable{}},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "b@example.com"}, Variables: testutils.DummyVariable{}},
+	}, time.Time{})
+
+	assert.NoError(t, results[0].Err)
+	assert.Equal(t, originalID, results[0].ID, "repeat key should return the original envelope")
+	assert.NoError(t, results[1].Err)
+	assert.Len(t, db.Items(), 2)
+}
+
+// countingDatabase counts the reads SendBatch makes per recipient.
+type countingDatabase struct {
+	*typesend_db.TestDatabase
+	mu             sync.Mutex
+	templateReads  int
+	categoryReads  int
+	recipientReads int
+	singleReads    int
+}
+
+func (c *countingDatabase) GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
+	c.mu.Lock()
+	c.templateReads++
+	c.mu.Unlock()
+	return c.TestDatabase.GetTemplateByID(ctx, templateID, tenantID)
+}
+
+func (c *countingDatabase) GetCategories(ctx context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error) {
+	c.mu.Lock()
+	c.categoryReads++
+	c.mu.Unlock()
+	return c.TestDatabase.GetCategories(ctx, appID)
+}
+
+func (c *countingDatabase) GetRecipientStates(ctx context.Context, keys []typesend_db.RecipientKey) ([]typesend_db.RecipientState, error) {
+	c.mu.Lock()
+	c.recipientReads++
+	c.mu.Unlock()
+	return c.TestDatabase.GetRecipientStates(ctx, keys)
+}
+
+func (c *countingDatabase) GetSuppression(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error) {
+	c.mu.Lock()
+	c.singleReads++
+	c.mu.Unlock()
+	return c.TestDatabase.GetSuppression(ctx, appID, tenantID, address)
+}
+
+func (c *countingDatabase) GetPreferences(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error) {
+	c.mu.Lock()
+	c.singleReads++
+	c.mu.Unlock()
+	return c.TestDatabase.GetPreferences(ctx, appID, tenantID, address)
+}
+
+func TestStubbed_SendBatch_BatchesLookups(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDatabase{TestDatabase: &typesend_db.TestDatabase{}}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	assert.NoError(t, ts.RegisterCategories(ctx, &typesend_schemas.TypeSendCategory{ID: "newsletter", Name: "Newsletter"}))
+
+	templateID := uuid.NewString()
+	assert.NoError(t, db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+		TemplateID: templateID,
+		TenantID:   "base",
+		Category:   "newsletter",
+	}))
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: templateID,
+		},
+	}
+
+	recipients := make([]typesend.BatchRecipient, 0, 20)
+	for i := 0; i < 20; i++ {
+		address := fmt.Sprintf("user-%d@example.com", i)
+		assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+			AppID:    "test-app",
+			TenantID: "base",
+			Address:  address,
+			OptedOut: []string{"newsletter"},
+		}))
+		recipients = append(recipients, typesend.BatchRecipient{
+			To:        typesend_schemas.TypeSendTo{ToAddress: address},
+			Variables: vars,
+		})
+	}
+
+	results := ts.SendBatch(ctx, recipients, time.Time{})
+	for _, result := range results {
+		var optedOut *typesend.OptedOutError
+		assert.ErrorAs(t, result.Err, &optedOut)
+	}
+
+	assert.Equal(t, 1, db.recipientReads, "recipients should be looked up in one call")
+	assert.Equal(t, 0, db.singleReads, "recipients should not be looked up one at a time")
+	assert.Equal(t, 1, db.templateReads, "the template should be read once per batch")
+	assert.Equal(t, 1, db.categoryReads, "categories should be read once per batch")
+}
+
+func TestStubbed_SendBatch_FailureMetrics(t *testing.T) {
+	ctx := context.Background()
+	// Never connected, so every insert fails.
+	db := &typesend_db.TestDatabase{}
+
+	metrics := &recordingMetrics{}
+	ts := &typesend.TypeSend{
+		AppID:          "test-app",
+		Database:       db,
+		MetricProvider: metrics,
+	}
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "a@example.com"}, Variables: testutils.DummyVariable{}},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "b@example.com"}, Variables: testutils.DummyVariable{}},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "c@example.com", IdempotencyKey: "report-c"}, Variables: testutils.DummyVariable{}},
+	}, time.Time{})
+	for _, result := range results {
+		assert.Error(t, result.Err)
+	}
+
+	if assert.Len(t, metrics.sends, 1, "failures should be aggregated too") {
+		assert.False(t, metrics.sends[0].Success)
+		assert.Equal(t, 3, metrics.sends[0].Count)
+	}
+}
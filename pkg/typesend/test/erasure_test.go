@@ -0,0 +1,65 @@
+package typesend_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func TestStubbed_Send_Erased(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	// Erasure applies to transactional templates too.
+	templateID := uuid.NewString()
+	assert.NoError(t, db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+		TemplateID:    templateID,
+		TenantID:      "base",
+		Transactional: true,
+	}))
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: templateID,
+		},
+	}
+
+	_, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com", ToInternalID: "user-1"}, vars, time.Now().UTC())
+	assert.NoError(t, err)
+
+	_, err = db.EraseRecipient(ctx, typesend_schemas.TypeSendRecipient{ToAddress: "test@example.com", ToInternalID: "user-1"}, time.Now().UTC())
+	assert.NoError(t, err)
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "Test@Example.com"}, vars, time.Now().UTC())
+	assert.ErrorIs(t, err, typesend.TypeSendError_ERASED)
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "new@example.com", ToInternalID: "user-1"}, vars, time.Now().UTC())
+	assert.ErrorIs(t, err, typesend.TypeSendError_ERASED, "the erased internal ID is rejected at any address")
+
+	_, err = ts.Schedule(ctx, typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, typesend_schemas.TypeSendRecurrence{
+		Cron: "0 9 * * *",
+	})
+	assert.ErrorIs(t, err, typesend.TypeSendError_ERASED)
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "other@example.com"}, Variables: vars},
+	}, time.Time{})
+	assert.ErrorIs(t, results[0].Err, typesend.TypeSendError_ERASED)
+	assert.NoError(t, results[1].Err)
+
+	assert.Len(t, db.Items(), 2, "only the first send and the other recipient should be inserted")
+}
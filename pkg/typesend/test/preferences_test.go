@@ -0,0 +1,107 @@
+package typesend_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func TestStubbed_Send_OptedOut(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	assert.NoError(t, ts.RegisterCategories(ctx,
+		&typesend_schemas.TypeSendCategory{ID: "newsletter", Name: "Newsletter"},
+		&typesend_schemas.TypeSendCategory{ID: "security", Name: "Security alerts", Mandatory: true},
+	))
+	assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+		AppID:    "test-app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		OptedOut: []string{"newsletter", "security"},
+	}))
+
+	variablesFor := func(category string) testutils.DummyVariable {
+		templateID := uuid.NewString()
+		assert.NoError(t, db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+			TemplateID: templateID,
+			TenantID:   "base",
+			Category:   category,
+		}))
+		return testutils.DummyVariable{
+			TypeSendVariable: typesend_schemas.TypeSendVariable{
+				AssociatedTemplateID: templateID,
+			},
+		}
+	}
+
+	_, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "Test@Example.com"}, variablesFor("newsletter"), time.Now().UTC())
+	assert.ErrorIs(t, err, typesend.TypeSendError_OPTED_OUT)
+
+	var optedOut *typesend.OptedOutError
+	if assert.True(t, errors.As(err, &optedOut)) {
+		assert.Equal(t, "newsletter", optedOut.Category)
+	}
+	assert.Empty(t, db.Items(), "nothing should be inserted for an opted out recipient")
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, variablesFor("security"), time.Now().UTC())
+	assert.NoError(t, err, "mandatory categories always send")
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, variablesFor(""), time.Now().UTC())
+	assert.NoError(t, err, "uncategorized templates always send")
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com", ToTenantID: "other"}, variablesFor("newsletter"), time.Now().UTC())
+	assert.NoError(t, err, "preferences are scoped to the tenant")
+}
+
+func TestStubbed_SendBatch_OptedOut(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+		AppID:    "test-app",
+		TenantID: "base",
+		Address:  "b@example.com",
+		OptedOut: []string{"newsletter"},
+	}))
+
+	templateID := uuid.NewString()
+	assert.NoError(t, db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+		TemplateID: templateID,
+		TenantID:   "base",
+		Category:   "newsletter",
+	}))
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: templateID,
+		},
+	}
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "a@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "b@example.com"}, Variables: vars},
+	}, time.Now().UTC())
+
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, typesend.TypeSendError_OPTED_OUT)
+	assert.Len(t, db.Items(), 1)
+}
@@ -0,0 +1,137 @@
+package typesend_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func TestStubbed_Schedule(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	id, err := ts.Schedule(ctx, typesend_schemas.TypeSendTo{
+		ToAddress:    "test@example.com",
+		ToInternalID: "internal-123",
+	}, vars, typesend_schemas.TypeSendRecurrence{
+		Cron:     "0 9 * * MON",
+		TimeZone: "America/New_York",
+	})
+	assert.NoError(t, err)
+
+	schedule, err := db.GetScheduleByID(ctx, id)
+	assert.NoError(t, err)
+	assert.NotNil(t, schedule)
+
+	assert.Equal(t, "test-app", schedule.AppID)
+	assert.Equal(t, "base", schedule.TenantID, "tenant should default like Send")
+	assert.Equal(t, vars.GetTemplateID(), schedule.TemplateID)
+	assert.Equal(t, typesend_schemas.TypeSendScheduleState_ACTIVE, schedule.State)
+	assert.True(t, schedule.NextRunAt.After(time.Now().UTC()), "first run should be in the future")
+	assert.Equal(t, time.Monday, schedule.NextRunAt.In(mustLoadLocation(t, "America/New_York")).Weekday())
+	assert.Empty(t, db.Items(), "no envelopes should be sent until the schedule is due")
+}
+
+func TestStubbed_ScheduleInvalid(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	_, err = ts.Schedule(ctx, typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, typesend_schemas.TypeSendRecurrence{Cron: "whenever"})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_RECURRENCE)
+
+	_, err = ts.Schedule(ctx, typesend_schemas.TypeSendTo{ToAddress: "not-an-email"}, vars, typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * *"})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_EMAIL)
+
+	_, err = ts.Schedule(ctx, typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, typesend_schemas.TypeSendRecurrence{
+		RRule: "FREQ=DAILY;COUNT=1",
+		Start: time.Now().UTC().AddDate(0, 0, -7),
+	})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_RECURRENCE, "schedules that already finished should be rejected")
+}
+
+func TestStubbed_SchedulePauseResumeDelete(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	id, err := ts.Schedule(ctx, typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, typesend_schemas.TypeSendRecurrence{Cron: "*/5 * * * *"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ts.PauseSchedule(ctx, id))
+	schedule, _ := db.GetScheduleByID(ctx, id)
+	assert.Equal(t, typesend_schemas.TypeSendScheduleState_PAUSED, schedule.State)
+
+	// Simulate the pause lasting past several occurrences.
+	assert.NoError(t, db.UpdateScheduleState(ctx, id, typesend_schemas.TypeSendScheduleState_PAUSED, time.Now().UTC().Add(-time.Hour)))
+
+	assert.NoError(t, ts.ResumeSchedule(ctx, id))
+	schedule, _ = db.GetScheduleByID(ctx, id)
+	assert.Equal(t, typesend_schemas.TypeSendScheduleState_ACTIVE, schedule.State)
+	assert.True(t, schedule.NextRunAt.After(time.Now().UTC()), "missed occurrences should be skipped on resume")
+
+	other := &typesend.TypeSend{
+		AppID:    "other-app",
+		Database: db,
+	}
+	assert.ErrorIs(t, other.DeleteSchedule(ctx, id), typesend.TypeSendError_SCHEDULE_NOT_FOUND, "apps should not manage each others schedules")
+
+	assert.NoError(t, ts.DeleteSchedule(ctx, id))
+	schedule, _ = db.GetScheduleByID(ctx, id)
+	assert.Nil(t, schedule)
+
+	assert.ErrorIs(t, ts.PauseSchedule(ctx, id), typesend.TypeSendError_SCHEDULE_NOT_FOUND)
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
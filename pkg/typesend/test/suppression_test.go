@@ -0,0 +1,113 @@
+package typesend_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func suppress(t *testing.T, db typesend_db.TypeSendDatabase, address string, reason typesend_schemas.TypeSendSuppressionReason) {
+	assert.NoError(t, db.PutSuppression(context.Background(), &typesend_schemas.TypeSendSuppression{
+		AppID:    "test-app",
+		TenantID: "base",
+		Address:  address,
+		Reason:   reason,
+	}))
+}
+
+func TestStubbed_Send_Suppressed(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	suppress(t, db, "test@example.com", typesend_schemas.TypeSendSuppressionReason_COMPLAINED)
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	_, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "Test@Example.com"}, vars, time.Now().UTC())
+	assert.ErrorIs(t, err, typesend.TypeSendError_SUPPRESSED)
+
+	var suppressed *typesend.SuppressedError
+	if assert.True(t, errors.As(err, &suppressed)) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, suppressed.Suppression.Reason)
+	}
+	assert.Empty(t, db.Items(), "nothing should be inserted for a suppressed recipient")
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com", ToTenantID: "other"}, vars, time.Now().UTC())
+	assert.NoError(t, err, "suppressions are scoped to the tenant")
+}
+
+func TestStubbed_Send_SuppressedTransactional(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	suppress(t, db, "unsubscribed@example.com", typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED)
+	suppress(t, db, "bounced@example.com", typesend_schemas.TypeSendSuppressionReason_BOUNCED)
+
+	templateID := uuid.NewString()
+	assert.NoError(t, db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+		TemplateID:    templateID,
+		TenantID:      "base",
+		Transactional: true,
+	}))
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: templateID,
+		},
+	}
+
+	_, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "unsubscribed@example.com"}, vars, time.Now().UTC())
+	assert.NoError(t, err, "transactional mail should still reach unsubscribed recipients")
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "bounced@example.com"}, vars, time.Now().UTC())
+	assert.ErrorIs(t, err, typesend.TypeSendError_SUPPRESSED)
+}
+
+func TestStubbed_SendBatch_Suppressed(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+	suppress(t, db, "b@example.com", typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED)
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "a@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "b@example.com"}, Variables: vars},
+	}, time.Now().UTC())
+
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, typesend.TypeSendError_SUPPRESSED)
+	assert.Len(t, db.Items(), 1)
+}
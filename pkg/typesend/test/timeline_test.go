@@ -0,0 +1,81 @@
+package typesend_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func timelineTypes(t *testing.T, db typesend_db.TypeSendDatabase, envelopeID string) []typesend_schemas.TypeSendEventType {
+	events, err := db.GetEnvelopeTimeline(context.Background(), envelopeID)
+	assert.NoError(t, err)
+	types := make([]typesend_schemas.TypeSendEventType, len(events))
+	for i, event := range events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestSendRecordsQueued(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{AppID: "test-app", Database: db}
+	to := typesend_schemas.TypeSendTo{
+		ToAddress:      "test@example.com",
+		IdempotencyKey: "welcome",
+	}
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	sendAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	id, err := ts.Send(to, vars, sendAt)
+	assert.NoError(t, err)
+
+	events, err := db.GetEnvelopeTimeline(ctx, id)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_QUEUED, events[0].Type)
+		assert.Equal(t, "test-app", events[0].AppID)
+		assert.Equal(t, "base", events[0].TenantID)
+		assert.Equal(t, map[string]string{"scheduledFor": sendAt.Format(time.RFC3339)}, events[0].Details)
+	}
+
+	_, err = ts.Send(to, vars, sendAt)
+	assert.NoError(t, err)
+	assert.Len(t, timelineTypes(t, db, id), 1, "a repeat send queues nothing new")
+}
+
+func TestSendBatchRecordsQueued(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	ts := &typesend.TypeSend{AppID: "test-app", Database: db}
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	results := ts.SendBatch(ctx, []typesend.BatchRecipient{
+		{To: typesend_schemas.TypeSendTo{ToAddress: "one@example.com"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "not an address"}, Variables: vars},
+		{To: typesend_schemas.TypeSendTo{ToAddress: "two@example.com"}, Variables: vars},
+	}, time.Time{})
+
+	assert.Equal(t, []typesend_schemas.TypeSendEventType{typesend_schemas.TypeSendEventType_QUEUED}, timelineTypes(t, db, results[0].ID))
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, []typesend_schemas.TypeSendEventType{typesend_schemas.TypeSendEventType_QUEUED}, timelineTypes(t, db, results[2].ID))
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/kvizdos/typesend/pkg/testutils"
 	"github.com/kvizdos/typesend/pkg/typesend"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	typesend_crypto_local "github.com/kvizdos/typesend/pkg/typesend_crypto/local"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
@@ -142,3 +144,263 @@ func TestStubbed_Send_InvalidEmailFormat(t *testing.T) {
 	_, err = ts.Send(to, vars, sendAt)
 	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_EMAIL)
 }
+
+func TestStubbed_Send_IdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	to := typesend_schemas.TypeSendTo{
+		ToAddress:      "test@example.com",
+		ToInternalID:   "internal-123",
+		IdempotencyKey: "password-reset-123",
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	firstID, err := ts.Send(to, vars, time.Time{})
+	assert.NoError(t, err)
+
+	// A retried request should hand back the original envelope.
+	secondID, err := ts.Send(to, vars, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, firstID, secondID, "repeat send should return the original envelope ID")
+	assert.Len(t, db.Items(), 1, "repeat send should not insert a new envelope")
+
+	// The same key in another tenant is a different message.
+	to.ToTenantID = "other-tenant"
+	otherID, err := ts.Send(to, vars, time.Time{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstID, otherID)
+	assert.Len(t, db.Items(), 2)
+}
+
+func TestStubbed_Send_IdempotencyKeyExpired(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+		// Keys expire immediately.
+		IdempotencyWindow: -1 * time.Second,
+	}
+
+	to := typesend_schemas.TypeSendTo{
+		ToAddress:      "test@example.com",
+		IdempotencyKey: "password-reset-123",
+	}
+
+	firstID, err := ts.Send(to, testutils.DummyVariable{}, time.Time{})
+	assert.NoError(t, err)
+
+	secondID, err := ts.Send(to, testutils.DummyVariable{}, time.Time{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstID, secondID, "expired keys should allow a new envelope")
+	assert.Len(t, db.Items(), 2)
+}
+
+func TestStubbed_Send_PriorityFromTemplate(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	templateID := uuid.NewString()
+	db.InsertTemplate(ctx, &typesend_schemas.TypeSendTemplate{
+		TemplateID: templateID,
+		TenantID:   "base",
+		Priority:   typesend_schemas.TypeSendPriority_HIGH,
+	})
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: templateID,
+		},
+	}
+
+	id, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, time.Time{})
+	assert.NoError(t, err)
+	envelope, _ := db.GetEnvelopeByID(ctx, id)
+	assert.Equal(t, typesend_schemas.TypeSendPriority_HIGH, envelope.Priority, "priority should default from the template")
+
+	id, err = ts.Send(typesend_schemas.TypeSendTo{
+		ToAddress: "test@example.com",
+		Priority:  typesend_schemas.TypeSendPriority_LOW,
+	}, vars, time.Time{})
+	assert.NoError(t, err)
+	envelope, _ = db.GetEnvelopeByID(ctx, id)
+	assert.Equal(t, typesend_schemas.TypeSendPriority_LOW, envelope.Priority, "Send should override the template priority")
+}
+
+func TestStubbed_Send_PriorityWithoutTemplate(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	id, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, time.Time{})
+	assert.NoError(t, err)
+	envelope, _ := db.GetEnvelopeByID(ctx, id)
+	assert.Equal(t, typesend_schemas.TypeSendPriority_NORMAL, envelope.Priority.Effective())
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{
+		ToAddress: "test@example.com",
+		Priority:  typesend_schemas.TypeSendPriority(42),
+	}, vars, time.Time{})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_PRIORITY)
+}
+
+func TestStubbed_Send_QuietHours(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	to := typesend_schemas.TypeSendTo{
+		ToAddress:  "test@example.com",
+		TimeZone:   "Europe/Berlin",
+		QuietHours: typesend_schemas.TypeSendQuietHours{Start: "21:00", End: "08:00"},
+	}
+
+	id, err := ts.Send(to, vars, time.Time{})
+	assert.NoError(t, err)
+	envelope, _ := db.GetEnvelopeByID(ctx, id)
+	assert.Equal(t, "Europe/Berlin", envelope.TimeZone)
+	assert.Equal(t, &to.QuietHours, envelope.QuietHours)
+
+	// Urgent messages skip quiet hours entirely.
+	to.IgnoreQuietHours = true
+	id, err = ts.Send(to, vars, time.Time{})
+	assert.NoError(t, err)
+	envelope, _ = db.GetEnvelopeByID(ctx, id)
+	assert.Nil(t, envelope.QuietHours)
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{
+		ToAddress: "test@example.com",
+		TimeZone:  "Atlantis/Capital",
+	}, vars, time.Time{})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_TIMEZONE)
+
+	_, err = ts.Send(typesend_schemas.TypeSendTo{
+		ToAddress:  "test@example.com",
+		QuietHours: typesend_schemas.TypeSendQuietHours{Start: "late", End: "early"},
+	}, vars, time.Time{})
+	assert.ErrorIs(t, err, typesend.TypeSendError_INVALID_QUIET_HOURS)
+}
+
+func TestStubbed_Send_Retention(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	err := db.Connect(ctx)
+	assert.NoError(t, err)
+
+	ts := &typesend.TypeSend{
+		AppID:    "test-app",
+		Database: db,
+		Retention: []typesend_schemas.TypeSendRetention{
+			{Content: 24 * time.Hour, Record: 72 * time.Hour},
+			{TenantID: "short-lived", Record: time.Hour},
+		},
+	}
+
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	sendAt := time.Now().UTC().Add(time.Hour)
+	id, err := ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com"}, vars, sendAt)
+	assert.NoError(t, err)
+	envelope, _ := db.GetEnvelopeByID(ctx, id)
+	assert.Equal(t, sendAt.Add(24*time.Hour).Unix(), envelope.ContentExpiresAt, "retention should count from ScheduledFor")
+	assert.Equal(t, sendAt.Add(72*time.Hour).Unix(), envelope.ExpiresAt)
+
+	id, err = ts.Send(typesend_schemas.TypeSendTo{ToAddress: "test@example.com", ToTenantID: "short-lived"}, vars, sendAt)
+	assert.NoError(t, err)
+	envelope, _ = db.GetEnvelopeByID(ctx, id)
+	assert.Zero(t, envelope.ContentExpiresAt)
+	assert.Equal(t, sendAt.Add(time.Hour).Unix(), envelope.ExpiresAt, "the tenants own policy should win")
+}
+
+func TestStubbed_Send_Encrypted(t *testing.T) {
+	ctx := context.Background()
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(ctx))
+
+	keys := typesend_crypto_local.NewLocalKeyProvider()
+	ts := &typesend.TypeSend{
+		AppID:         "test-app",
+		Database:      db,
+		KeyProvider:   keys,
+		EncryptToName: true,
+	}
+
+	to := typesend_schemas.TypeSendTo{
+		ToAddress: "test@example.com",
+		ToName:    "Kenton Vizdos",
+	}
+	vars := testutils.DummyVariable{
+		TypeSendVariable: typesend_schemas.TypeSendVariable{
+			AssociatedTemplateID: uuid.NewString(),
+		},
+	}
+
+	_, err := ts.Send(to, vars, time.Now().UTC())
+	assert.NoError(t, err)
+
+	items := db.Items()
+	if !assert.Len(t, items, 1) {
+		return
+	}
+	envelope := items[0]
+	assert.NotNil(t, envelope.Sealed)
+	assert.Nil(t, envelope.Variables)
+	assert.Empty(t, envelope.ToName)
+	assert.Equal(t, to.ToAddress, envelope.ToAddress, "the address is needed to send, so is never sealed")
+
+	opened := *envelope
+	assert.NoError(t, typesend_crypto.OpenEnvelope(ctx, keys, &opened))
+	assert.Equal(t, to.ToName, opened.ToName)
+	assert.NotNil(t, opened.Variables)
+}
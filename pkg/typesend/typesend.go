@@ -1,11 +1,14 @@
 package typesend
 
 import (
+	"context"
 	"net/mail"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
 	"github.com/kvizdos/typesend/pkg/typesend_metrics"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
@@ -21,20 +24,83 @@ type TypeSend struct {
 	// Used in Live Mode for testing.
 	LiveMode_ForceNow bool
 	LiveMode_Logger   typesend_schemas.Logger
+
+	// How long an IdempotencyKey is remembered for.
+	// Defaults to DefaultIdempotencyWindow.
+	IdempotencyWindow time.Duration
+
+	// Optional; how long envelopes are kept once finished,
+	// per App and Tenant. Without a match they are kept forever.
+	Retention []typesend_schemas.TypeSendRetention
+
+	// Optional; encrypts Variables at rest. Only DeliverMessage
+	// decrypts them, so it needs the same provider.
+	KeyProvider typesend_crypto.KeyProvider
+	// Also encrypts ToName, when KeyProvider is set.
+	EncryptToName bool
+
+	// Optional
+	Logger typesend_schemas.Logger
 }
 
+const DefaultIdempotencyWindow = 24 * time.Hour
+
 func (t *TypeSend) Send(to typesend_schemas.TypeSendTo, variables typesend_schemas.TypeSendVariableInterface, sendAt time.Time) (string, error) {
-	if _, err := mail.ParseAddress(to.ToAddress); err != nil {
-		return "", TypeSendError_INVALID_EMAIL
+	envelope, err := t.buildEnvelope(to, variables, sendAt)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := t.prepareEnvelope(ctx, envelope); err != nil {
+		return "", err
+	}
+
+	if err := t.seal(ctx, envelope); err != nil {
+		return "", err
+	}
+
+	if to.IdempotencyKey != "" {
+		var ownerID string
+		ownerID, err = t.insertIdempotent(ctx, envelope, to.IdempotencyKey)
+		if err == nil && ownerID != envelope.ID {
+			// Already sent within the window; nothing new was inserted.
+			return ownerID, nil
+		}
+	} else {
+		err = t.Database.Insert(envelope)
+	}
+
+	if err == nil {
+		typesend_events.Append(ctx, t.Database, t.Logger, queuedEvent(envelope))
+	}
+
+	if t.MetricProvider != nil {
+		t.MetricProvider.SendEvent(&typesend_metrics.Metric{
+			AppName:    t.AppID,
+			TemplateID: envelope.TemplateID,
+			TenantID:   envelope.TenantID,
+			Success:    err == nil,
+		})
 	}
 
-	ID := uuid.NewString()
+	return envelope.ID, err
+}
+
+// buildEnvelope validates the recipient and fills in
+// defaults, returning an envelope ready to be inserted.
+func (t *TypeSend) buildEnvelope(to typesend_schemas.TypeSendTo, variables typesend_schemas.TypeSendVariableInterface, sendAt time.Time) (*typesend_schemas.TypeSendEnvelope, error) {
+	if _, err := mail.ParseAddress(to.ToAddress); err != nil {
+		return nil, TypeSendError_INVALID_EMAIL
+	}
 
 	if sendAt.IsZero() {
 		sendAt = time.Now().UTC()
 	} else {
 		if sendAt.Location() != time.UTC {
-			return "", TypeSendError_UTC_MISMATCH
+			return nil, TypeSendError_UTC_MISMATCH
 		}
 
 		if t.LiveMode_ForceNow {
@@ -51,7 +117,23 @@ func (t *TypeSend) Send(to typesend_schemas.TypeSendTo, variables typesend_schem
 		to.ToTenantID = "base"
 	}
 
-	err := t.Database.Insert(&typesend_schemas.TypeSendEnvelope{
+	if err := to.Priority.Validate(); err != nil {
+		return nil, TypeSendError_INVALID_PRIORITY
+	}
+
+	if _, err := typesend_schemas.LoadTimeZone(to.TimeZone); err != nil {
+		return nil, TypeSendError_INVALID_TIMEZONE
+	}
+
+	var quietHours *typesend_schemas.TypeSendQuietHours
+	if !to.QuietHours.IsZero() && !to.IgnoreQuietHours {
+		if err := to.QuietHours.Validate(); err != nil {
+			return nil, TypeSendError_INVALID_QUIET_HOURS
+		}
+		quietHours = &to.QuietHours
+	}
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
 		AppID:          t.AppID,
 		ScheduledFor:   sendAt,
 		ToAddress:      to.ToAddress,
@@ -61,17 +143,169 @@ func (t *TypeSend) Send(to typesend_schemas.TypeSendTo, variables typesend_schem
 		TenantID:       to.ToTenantID,
 		TemplateID:     variables.GetTemplateID(),
 		Variables:      variables.ToMap(),
-		ID:             ID,
+		ID:             uuid.NewString(),
 		Status:         typesend_schemas.TypeSendStatus_UNSENT,
+		Priority:       to.Priority,
+		TimeZone:       to.TimeZone,
+		QuietHours:     quietHours,
+	}
+	typesend_schemas.ApplyRetention(t.Retention, envelope)
+
+	return envelope, nil
+}
+
+// queuedEvent starts the envelopes timeline.
+func queuedEvent(envelope *typesend_schemas.TypeSendEnvelope) *typesend_schemas.TypeSendEvent {
+	return typesend_events.NewEvent(envelope, typesend_schemas.TypeSendEventType_QUEUED, "", map[string]string{
+		"scheduledFor": envelope.ScheduledFor.UTC().Format(time.RFC3339),
 	})
+}
 
-	if t.MetricProvider != nil {
-		t.MetricProvider.SendEvent(&typesend_metrics.Metric{
-			AppName:    t.AppID,
-			TemplateID: variables.GetTemplateID(),
-			TenantID:   to.ToTenantID,
-		})
+type templateKey struct {
+	templateID string
+	tenantID   string
+}
+
+// sendLookups saves repeat reads within a Send or SendBatch,
+// so each template and the Apps categories are read at most once.
+type sendLookups struct {
+	templates        map[templateKey]*typesend_schemas.TypeSendTemplate
+	categories       []*typesend_schemas.TypeSendCategory
+	loadedCategories bool
+}
+
+func newSendLookups() *sendLookups {
+	return &sendLookups{templates: make(map[templateKey]*typesend_schemas.TypeSendTemplate)}
+}
+
+func (t *TypeSend) template(ctx context.Context, lookups *sendLookups, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
+	key := templateKey{templateID: templateID, tenantID: tenantID}
+	if template, ok := lookups.templates[key]; ok {
+		return template, nil
+	}
+
+	template, err := t.Database.GetTemplateByID(ctx, templateID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	lookups.templates[key] = template
+	return template, nil
+}
+
+func (t *TypeSend) categories(ctx context.Context, lookups *sendLookups) ([]*typesend_schemas.TypeSendCategory, error) {
+	if lookups.loadedCategories {
+		return lookups.categories, nil
+	}
+
+	categories, err := t.Database.GetCategories(ctx, t.AppID)
+	if err != nil {
+		return nil, err
+	}
+	lookups.categories, lookups.loadedCategories = categories, true
+	return categories, nil
+}
+
+// resolvePriority fills in the envelopes Priority from its template
+// when the sender did not set one. Templates without a priority
+// leave it as DEFAULT, which the dispatcher treats as NORMAL.
+func (t *TypeSend) resolvePriority(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, lookups *sendLookups) error {
+	if envelope.Priority != typesend_schemas.TypeSendPriority_DEFAULT {
+		return nil
+	}
+
+	template, err := t.template(ctx, lookups, envelope.TemplateID, envelope.TenantID)
+	if err != nil {
+		return err
+	}
+
+	if template != nil {
+		envelope.Priority = template.Priority
+	}
+
+	return nil
+}
+
+// prepareEnvelope resolves the priority of a single envelope
+// and checks its recipient may be sent the template.
+func (t *TypeSend) prepareEnvelope(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope) error {
+	lookups := newSendLookups()
+	if err := t.resolvePriority(ctx, envelope, lookups); err != nil {
+		return err
+	}
+
+	states, err := t.Database.GetRecipientStates(ctx, []typesend_db.RecipientKey{recipientKey(envelope)})
+	if err != nil {
+		return err
+	}
+	return t.checkRecipient(ctx, envelope, states[0], lookups)
+}
+
+func recipientKey(envelope *typesend_schemas.TypeSendEnvelope) typesend_db.RecipientKey {
+	return typesend_db.RecipientKey{
+		AppID:        envelope.AppID,
+		TenantID:     envelope.TenantID,
+		Address:      envelope.ToAddress,
+		ToInternalID: envelope.ToInternalID,
+	}
+}
+
+// checkRecipient returns TypeSendError_ERASED when the recipient was
+// erased, a SuppressedError when they are suppressed, or an
+// OptedOutError when they opted out of the templates category.
+// The template is only looked up once a suppression or opt out is found.
+func (t *TypeSend) checkRecipient(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, state typesend_db.RecipientState, lookups *sendLookups) error {
+	// Erasure applies to every template, transactional or not.
+	if state.Tombstone != nil {
+		return TypeSendError_ERASED
+	}
+
+	suppression, preferences := state.Suppression, state.Preferences
+	if suppression == nil && (preferences == nil || len(preferences.OptedOut) == 0) {
+		return nil
+	}
+
+	template, err := t.template(ctx, lookups, envelope.TemplateID, envelope.TenantID)
+	if err != nil {
+		return err
+	}
+
+	if suppression != nil && suppression.Blocks(template != nil && template.Transactional) {
+		return &SuppressedError{Suppression: suppression}
+	}
+
+	if preferences == nil || template == nil || !preferences.OptedOutOf(template.Category) {
+		return nil
+	}
+	categories, err := t.categories(ctx, lookups)
+	if err != nil {
+		return err
+	}
+	if preferences.Blocks(template.Category, categories) {
+		return &OptedOutError{Category: template.Category}
+	}
+	return nil
+}
+
+// RegisterCategories replaces the Apps categories, which templates
+// refer to by ID and recipients manage in the preference center.
+func (t *TypeSend) RegisterCategories(ctx context.Context, categories ...*typesend_schemas.TypeSendCategory) error {
+	return t.Database.PutCategories(ctx, t.AppID, categories)
+}
+
+// seal encrypts the envelope when a KeyProvider is set. It runs
+// once everything else is resolved, as Variables are unreadable after.
+func (t *TypeSend) seal(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope) error {
+	if t.KeyProvider == nil {
+		return nil
+	}
+	return typesend_crypto.SealEnvelope(ctx, t.KeyProvider, envelope, t.EncryptToName)
+}
+
+func (t *TypeSend) insertIdempotent(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string) (string, error) {
+	window := t.IdempotencyWindow
+	if window == 0 {
+		window = DefaultIdempotencyWindow
 	}
 
-	return ID, err
+	return t.Database.InsertIdempotent(ctx, envelope, idempotencyKey, time.Now().UTC().Add(window))
 }
@@ -0,0 +1,141 @@
+package typesend_analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Aggregator rolls the event log up into a TypeSendRollup per App,
+// Tenant, Template and UTC day, so dashboards needn't scan events.
+type Aggregator struct {
+	Database typesend_db.TypeSendDatabase
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+type rollupID struct {
+	appID      string
+	tenantID   string
+	templateID string
+}
+
+// AggregateDay recomputes the rollups for the UTC day containing day
+// from its events, replacing those stored before. Running it again
+// is harmless, so a day can be aggregated as often as needed while
+// its events are still coming in. It returns the rollups it stored.
+func (a *Aggregator) AggregateDay(ctx context.Context, day time.Time) ([]*typesend_schemas.TypeSendRollup, error) {
+	day = typesend_schemas.RollupDay(day)
+	events, err := a.Database.GetEventsByDay(ctx, day)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to aggregate %s: %w", day.Format(time.DateOnly), err)
+	}
+
+	envelopes := make(map[string]*typesend_schemas.TypeSendEnvelope)
+	rollups := make(map[rollupID]*typesend_schemas.TypeSendRollup)
+	var order []*typesend_schemas.TypeSendRollup
+	opened := make(map[rollupID]map[string]bool)
+
+	for _, event := range events {
+		if !counted(event.Type) {
+			continue
+		}
+
+		id, ok := a.rollupID(ctx, event, envelopes)
+		if !ok {
+			continue
+		}
+		rollup, ok := rollups[id]
+		if !ok {
+			rollup = &typesend_schemas.TypeSendRollup{
+				AppID:      id.appID,
+				TenantID:   id.tenantID,
+				TemplateID: id.templateID,
+				Day:        day,
+			}
+			rollups[id] = rollup
+			order = append(order, rollup)
+		}
+
+		switch event.Type {
+		case typesend_schemas.TypeSendEventType_SENT:
+			rollup.Sent++
+		case typesend_schemas.TypeSendEventType_DELIVERED:
+			rollup.Delivered++
+		case typesend_schemas.TypeSendEventType_BOUNCED:
+			rollup.Bounced++
+		case typesend_schemas.TypeSendEventType_OPENED:
+			rollup.Opened++
+			if opened[id] == nil {
+				opened[id] = make(map[string]bool)
+			}
+			if !opened[id][event.EnvelopeID] {
+				opened[id][event.EnvelopeID] = true
+				rollup.UniqueOpens++
+			}
+		case typesend_schemas.TypeSendEventType_CLICKED:
+			rollup.Clicked++
+		case typesend_schemas.TypeSendEventType_COMPLAINED:
+			rollup.Complained++
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	for _, rollup := range order {
+		rollup.UpdatedAt = now
+	}
+	if err := a.Database.PutRollups(ctx, order); err != nil {
+		return nil, fmt.Errorf("typesend: failed to store rollups for %s: %w", day.Format(time.DateOnly), err)
+	}
+	return order, nil
+}
+
+func counted(eventType typesend_schemas.TypeSendEventType) bool {
+	switch eventType {
+	case typesend_schemas.TypeSendEventType_SENT, typesend_schemas.TypeSendEventType_DELIVERED,
+		typesend_schemas.TypeSendEventType_BOUNCED, typesend_schemas.TypeSendEventType_OPENED,
+		typesend_schemas.TypeSendEventType_CLICKED, typesend_schemas.TypeSendEventType_COMPLAINED:
+		return true
+	}
+	return false
+}
+
+// rollupID returns the rollup the event counts towards. Events from
+// before TemplateID was recorded, or from providers that couldn't
+// report it, are filled in from their envelope where it still exists.
+func (a *Aggregator) rollupID(ctx context.Context, event *typesend_schemas.TypeSendEvent, envelopes map[string]*typesend_schemas.TypeSendEnvelope) (rollupID, bool) {
+	id := rollupID{appID: event.AppID, tenantID: event.TenantID, templateID: event.TemplateID}
+	if id.appID != "" && id.tenantID != "" && id.templateID != "" {
+		return id, true
+	}
+
+	envelope, ok := envelopes[event.EnvelopeID]
+	if !ok {
+		found, err := a.Database.GetEnvelopeByID(ctx, event.EnvelopeID)
+		if err != nil {
+			internal.ProtectedWarnLogger(a.Logger, "typesend: failed to get envelope %s to aggregate its events: %s", event.EnvelopeID, err.Error())
+		}
+		envelope = found
+		envelopes[event.EnvelopeID] = envelope
+	}
+	if envelope != nil {
+		if id.appID == "" {
+			id.appID = envelope.AppID
+		}
+		if id.tenantID == "" {
+			id.tenantID = envelope.TenantID
+		}
+		if id.templateID == "" {
+			id.templateID = envelope.TemplateID
+		}
+	}
+	return id, id.appID != ""
+}
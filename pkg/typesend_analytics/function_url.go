@@ -0,0 +1,13 @@
+package typesend_analytics
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/internal/function_url"
+)
+
+// HandleFunctionURL serves a Lambda function URL request with the Handler.
+func (h *Handler) HandleFunctionURL(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return function_url.Serve(ctx, h, request)
+}
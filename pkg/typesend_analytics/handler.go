@@ -0,0 +1,105 @@
+package typesend_analytics
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// How many days a request without a "from" covers, ending at "to".
+const DefaultQueryDays = 30
+
+// Handler serves a Report as JSON for GET requests such as
+//
+//	/?app=<app>&tenant=<tenant>&template=<template>&from=2024-03-01&to=2024-03-31
+//
+// where only app is required. Days are UTC and inclusive; "to"
+// defaults to today and "from" to DefaultQueryDays before it.
+//
+// It is an http.Handler, so can be mounted in any mux; see
+// HandleFunctionURL to run it as a Lambda function URL.
+type Handler struct {
+	Database typesend_db.TypeSendDatabase
+	// Required as "Authorization: Bearer <APIKey>" on every
+	// request. When empty, every request is refused.
+	APIKey string
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query, err := parseQuery(r, time.Now())
+	if err == nil {
+		err = validateQuery(query)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := Query(r.Context(), h.Database, query)
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to serve analytics for %s: %s", query.AppID, err.Error())
+		http.Error(w, "failed to query analytics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.APIKey == "" {
+		return false
+	}
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(key), []byte(h.APIKey)) == 1
+}
+
+func parseQuery(r *http.Request, now time.Time) (typesend_schemas.TypeSendRollupQuery, error) {
+	values := r.URL.Query()
+	query := typesend_schemas.TypeSendRollupQuery{
+		AppID:      values.Get("app"),
+		TenantID:   values.Get("tenant"),
+		TemplateID: values.Get("template"),
+		To:         typesend_schemas.RollupDay(now),
+	}
+
+	if raw := values.Get("to"); raw != "" {
+		to, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return query, fmt.Errorf("typesend: to must be a date such as 2024-03-31")
+		}
+		query.To = to
+	}
+	query.From = query.To.AddDate(0, 0, -(DefaultQueryDays - 1))
+	if raw := values.Get("from"); raw != "" {
+		from, err := time.Parse(time.DateOnly, raw)
+		if err != nil {
+			return query, fmt.Errorf("typesend: from must be a date such as 2024-03-01")
+		}
+		query.From = from
+	}
+	return query, nil
+}
@@ -0,0 +1,83 @@
+package typesend_analytics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// The widest range Query accepts, so a request can't read
+// back years of rollups at once.
+const MaxQueryDays = 366
+
+// Totals sums the counts of many rollups.
+type Totals struct {
+	Sent      int64 `json:"sent"`
+	Delivered int64 `json:"delivered"`
+	Bounced   int64 `json:"bounced"`
+	Opened    int64 `json:"opened"`
+	// Summed per day, so an envelope opened on two
+	// days counts twice.
+	UniqueOpens int64 `json:"uniqueOpens"`
+	Clicked     int64 `json:"clicked"`
+	Complained  int64 `json:"complained"`
+}
+
+func (t *Totals) add(rollup *typesend_schemas.TypeSendRollup) {
+	t.Sent += rollup.Sent
+	t.Delivered += rollup.Delivered
+	t.Bounced += rollup.Bounced
+	t.Opened += rollup.Opened
+	t.UniqueOpens += rollup.UniqueOpens
+	t.Clicked += rollup.Clicked
+	t.Complained += rollup.Complained
+}
+
+// Report is what Query found: each matching rollup, ordered by
+// Day, then Tenant and Template, along with their Totals.
+type Report struct {
+	From    time.Time                          `json:"from"`
+	To      time.Time                          `json:"to"`
+	Rollups []*typesend_schemas.TypeSendRollup `json:"rollups"`
+	Totals  Totals                             `json:"totals"`
+}
+
+// Query reads back the rollups the Aggregator stored. Days that
+// haven't been aggregated yet, or had no events, are left out.
+func Query(ctx context.Context, db typesend_db.TypeSendDatabase, query typesend_schemas.TypeSendRollupQuery) (*Report, error) {
+	if err := validateQuery(query); err != nil {
+		return nil, err
+	}
+
+	rollups, err := db.GetRollups(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query rollups: %w", err)
+	}
+
+	report := &Report{
+		From:    typesend_schemas.RollupDay(query.From),
+		To:      typesend_schemas.RollupDay(query.To),
+		Rollups: rollups,
+	}
+	if report.Rollups == nil {
+		report.Rollups = []*typesend_schemas.TypeSendRollup{}
+	}
+	for _, rollup := range rollups {
+		report.Totals.add(rollup)
+	}
+	return report, nil
+}
+
+func validateQuery(query typesend_schemas.TypeSendRollupQuery) error {
+	if err := query.Validate(); err != nil {
+		return err
+	}
+	days := typesend_schemas.RollupDay(query.To).Sub(typesend_schemas.RollupDay(query.From)) / (24 * time.Hour)
+	if days >= MaxQueryDays {
+		return fmt.Errorf("typesend: analytics queries span at most %d days", MaxQueryDays)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package typesend_analytics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_analytics"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+var day = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func newEvent(envelopeID string, id string, eventType typesend_schemas.TypeSendEventType, occurredAt time.Time) *typesend_schemas.TypeSendEvent {
+	return &typesend_schemas.TypeSendEvent{
+		EnvelopeID: envelopeID,
+		ID:         id,
+		AppID:      "app",
+		TenantID:   "tenant",
+		TemplateID: "welcome",
+		Type:       eventType,
+		OccurredAt: occurredAt,
+	}
+}
+
+func TestAggregateDay(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	ctx := context.Background()
+
+	reset := newEvent("three", "sent", typesend_schemas.TypeSendEventType_SENT, day.Add(time.Hour))
+	reset.TemplateID = "reset"
+	assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+		newEvent("one", "queued", typesend_schemas.TypeSendEventType_QUEUED, day),
+		newEvent("one", "sent", typesend_schemas.TypeSendEventType_SENT, day.Add(time.Hour)),
+		newEvent("one", "delivered", typesend_schemas.TypeSendEventType_DELIVERED, day.Add(2*time.Hour)),
+		newEvent("one", "open-1", typesend_schemas.TypeSendEventType_OPENED, day.Add(3*time.Hour)),
+		newEvent("one", "open-2", typesend_schemas.TypeSendEventType_OPENED, day.Add(4*time.Hour)),
+		newEvent("one", "click", typesend_schemas.TypeSendEventType_CLICKED, day.Add(4*time.Hour)),
+		newEvent("two", "sent", typesend_schemas.TypeSendEventType_SENT, day.Add(time.Hour)),
+		newEvent("two", "bounced", typesend_schemas.TypeSendEventType_BOUNCED, day.Add(2*time.Hour)),
+		newEvent("two", "complained", typesend_schemas.TypeSendEventType_COMPLAINED, day.Add(3*time.Hour)),
+		newEvent("two", "open", typesend_schemas.TypeSendEventType_OPENED, day.Add(3*time.Hour)),
+		reset,
+		newEvent("one", "tomorrow", typesend_schemas.TypeSendEventType_OPENED, day.Add(25*time.Hour)),
+	}))
+
+	aggregator := &typesend_analytics.Aggregator{Database: db}
+	rollups, err := aggregator.AggregateDay(ctx, day.Add(12*time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, rollups, 2, "one rollup per template")
+
+	stored, err := db.GetRollups(ctx, typesend_schemas.TypeSendRollupQuery{AppID: "app", From: day, To: day})
+	assert.NoError(t, err)
+	if assert.Len(t, stored, 2) {
+		assert.Equal(t, "reset", stored[0].TemplateID)
+		assert.Equal(t, int64(1), stored[0].Sent)
+
+		welcome := stored[1]
+		assert.Equal(t, "tenant", welcome.TenantID)
+		assert.Equal(t, day, welcome.Day)
+		assert.Equal(t, int64(2), welcome.Sent)
+		assert.Equal(t, int64(1), welcome.Delivered)
+		assert.Equal(t, int64(1), welcome.Bounced)
+		assert.Equal(t, int64(3), welcome.Opened)
+		assert.Equal(t, int64(2), welcome.UniqueOpens, "an envelope opened twice is one unique open")
+		assert.Equal(t, int64(1), welcome.Clicked)
+		assert.Equal(t, int64(1), welcome.Complained)
+	}
+
+	// Aggregating again recomputes rather than adding up.
+	assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+		newEvent("three", "open", typesend_schemas.TypeSendEventType_OPENED, day.Add(5*time.Hour)),
+	}))
+	_, err = aggregator.AggregateDay(ctx, day)
+	assert.NoError(t, err)
+
+	stored, err = db.GetRollups(ctx, typesend_schemas.TypeSendRollupQuery{AppID: "app", TemplateID: "welcome", From: day, To: day})
+	assert.NoError(t, err)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, int64(2), stored[0].Sent)
+		assert.Equal(t, int64(4), stored[0].Opened)
+		assert.Equal(t, int64(3), stored[0].UniqueOpens)
+	}
+}
+
+func TestAggregateDayFillsInFromEnvelopes(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	ctx := context.Background()
+
+	assert.NoError(t, db.Insert(&typesend_schemas.TypeSendEnvelope{ID: "envelope", AppID: "app", TenantID: "tenant", TemplateID: "welcome"}))
+
+	// As a provider without custom args would report them.
+	known := newEvent("envelope", "delivered", typesend_schemas.TypeSendEventType_DELIVERED, day)
+	known.AppID, known.TenantID, known.TemplateID = "", "", ""
+	purged := newEvent("purged", "delivered", typesend_schemas.TypeSendEventType_DELIVERED, day)
+	purged.AppID, purged.TenantID, purged.TemplateID = "", "", ""
+	assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{known, purged}))
+
+	rollups, err := (&typesend_analytics.Aggregator{Database: db}).AggregateDay(ctx, day)
+	assert.NoError(t, err)
+	if assert.Len(t, rollups, 1, "events without an App or envelope can't be counted") {
+		assert.Equal(t, "app", rollups[0].AppID)
+		assert.Equal(t, "tenant", rollups[0].TenantID)
+		assert.Equal(t, "welcome", rollups[0].TemplateID)
+		assert.Equal(t, int64(1), rollups[0].Delivered)
+	}
+}
+
+func TestAggregateDayWithoutEvents(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+
+	rollups, err := (&typesend_analytics.Aggregator{Database: db}).AggregateDay(context.Background(), day)
+	assert.NoError(t, err)
+	assert.Nil(t, rollups)
+}
+
+func TestQuery(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	ctx := context.Background()
+
+	assert.NoError(t, db.PutRollups(ctx, []*typesend_schemas.TypeSendRollup{
+		{AppID: "app", TenantID: "tenant", TemplateID: "welcome", Day: day, Sent: 2, Opened: 3, UniqueOpens: 1},
+		{AppID: "app", TenantID: "tenant", TemplateID: "welcome", Day: day.AddDate(0, 0, 1), Sent: 5, Opened: 1, UniqueOpens: 1},
+		{AppID: "other", TenantID: "tenant", TemplateID: "welcome", Day: day, Sent: 100},
+	}))
+
+	report, err := typesend_analytics.Query(ctx, db, typesend_schemas.TypeSendRollupQuery{AppID: "app", From: day, To: day.AddDate(0, 0, 6)})
+	assert.NoError(t, err)
+	assert.Len(t, report.Rollups, 2)
+	assert.Equal(t, typesend_analytics.Totals{Sent: 7, Opened: 4, UniqueOpens: 2}, report.Totals)
+
+	report, err = typesend_analytics.Query(ctx, db, typesend_schemas.TypeSendRollupQuery{AppID: "missing", From: day, To: day})
+	assert.NoError(t, err)
+	assert.NotNil(t, report.Rollups, "an empty report still has a list of rollups")
+	assert.Empty(t, report.Rollups)
+
+	_, err = typesend_analytics.Query(ctx, db, typesend_schemas.TypeSendRollupQuery{AppID: "app", From: day, To: day.AddDate(0, 0, typesend_analytics.MaxQueryDays)})
+	assert.Error(t, err, "the range is capped")
+}
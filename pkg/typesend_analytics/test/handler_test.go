@@ -0,0 +1,116 @@
+package typesend_analytics_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/pkg/typesend_analytics"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+const apiKey = "test-api-key"
+
+func newHandler(t *testing.T) *typesend_analytics.Handler {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	assert.NoError(t, db.PutRollups(context.Background(), []*typesend_schemas.TypeSendRollup{
+		{AppID: "app", TenantID: "tenant", TemplateID: "welcome", Day: day, Sent: 2, Delivered: 1},
+		{AppID: "app", TenantID: "tenant", TemplateID: "reset", Day: day, Sent: 1},
+		{AppID: "app", TenantID: "other", TemplateID: "welcome", Day: day.AddDate(0, 0, 1), Sent: 4},
+	}))
+	return &typesend_analytics.Handler{Database: db, APIKey: apiKey}
+}
+
+func get(handler http.Handler, target string, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	if key != "" {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerServesReport(t *testing.T) {
+	handler := newHandler(t)
+
+	w := get(handler, "/?app=app&from=2024-03-01&to=2024-03-07", apiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var report typesend_analytics.Report
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, day, report.From)
+	assert.Equal(t, day.AddDate(0, 0, 6), report.To)
+	assert.Len(t, report.Rollups, 3)
+	assert.Equal(t, typesend_analytics.Totals{Sent: 7, Delivered: 1}, report.Totals)
+
+	w = get(handler, "/?app=app&tenant=tenant&template=welcome&from=2024-03-01&to=2024-03-07", apiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	if assert.Len(t, report.Rollups, 1) {
+		assert.Equal(t, int64(2), report.Rollups[0].Sent)
+	}
+}
+
+func TestHandlerDefaultsToRecentDays(t *testing.T) {
+	w := get(newHandler(t), "/?app=app", apiKey)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var report typesend_analytics.Report
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, typesend_analytics.DefaultQueryDays-1, int(report.To.Sub(report.From).Hours()/24))
+}
+
+func TestHandlerRequiresAPIKey(t *testing.T) {
+	handler := newHandler(t)
+
+	assert.Equal(t, http.StatusUnauthorized, get(handler, "/?app=app", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, get(handler, "/?app=app", "wrong").Code)
+
+	handler.APIKey = ""
+	assert.Equal(t, http.StatusUnauthorized, get(handler, "/?app=app", "").Code, "an unset key refuses every request")
+}
+
+func TestHandlerRejectsBadQueries(t *testing.T) {
+	handler := newHandler(t)
+
+	for _, target := range []string{
+		"/",
+		"/?app=app&from=yesterday",
+		"/?app=app&to=03/01/2024",
+		"/?app=app&from=2024-03-07&to=2024-03-01",
+		"/?app=app&from=2020-01-01&to=2024-01-01",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(handler, target, apiKey).Code, target)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/?app=app", nil)
+	r.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHandleFunctionURL(t *testing.T) {
+	response, err := newHandler(t).HandleFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath:        "/",
+		RawQueryString: "app=app&from=2024-03-01&to=2024-03-01",
+		Headers:        map[string]string{"authorization": "Bearer " + apiKey},
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodGet},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var report typesend_analytics.Report
+	assert.NoError(t, json.Unmarshal([]byte(response.Body), &report))
+	assert.Len(t, report.Rollups, 2)
+}
@@ -0,0 +1,14 @@
+package typesend_crypto
+
+import "context"
+
+// KeyProvider wraps the data keys content is sealed with. Keys are
+// rotated by having WrapKey use a new key, while UnwrapKey still
+// accepts data keys wrapped under the old ones.
+type KeyProvider interface {
+	// WrapKey encrypts a data key under the current key,
+	// returning the ID of the key it used.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped under keyID.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
@@ -0,0 +1,69 @@
+package typesend_crypto_kms
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// Bound to every wrapped data key, so KMS ciphertexts made
+// for anything else can't be passed off as one.
+var encryptionContext = map[string]*string{
+	"typesend": aws.String("data-key"),
+}
+
+// KMSKeyProvider wraps data keys with an AWS KMS key. Enabling
+// automatic rotation on the key needs nothing else; moving to a new
+// key only needs KeyID changed, as KMS still unwraps under the old one.
+type KMSKeyProvider struct {
+	// Key ID, ARN or alias new data keys are wrapped with.
+	KeyID string
+
+	client kmsiface.KMSAPI
+}
+
+// NewKMSKeyProvider creates a new instance of KMSKeyProvider.
+func NewKMSKeyProvider(keyID string, region string) (*KMSKeyProvider, error) {
+	sess, err := session.NewSession(&aws.Config{
+		Region: aws.String(region),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewKMSKeyProviderWithClient(keyID, kms.New(sess)), nil
+}
+
+// NewKMSKeyProviderWithClient uses an existing client, e.g. for tests.
+func NewKMSKeyProviderWithClient(keyID string, client kmsiface.KMSAPI) *KMSKeyProvider {
+	return &KMSKeyProvider{KeyID: keyID, client: client}
+}
+
+// WrapKey returns the ARN of the key KMS used, rather than KeyID,
+// so envelopes keep pointing at the right key if an alias moves.
+func (p *KMSKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	output, err := p.client.EncryptWithContext(ctx, &kms.EncryptInput{
+		KeyId:             aws.String(p.KeyID),
+		Plaintext:         dataKey,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("typesend: failed to wrap data key with KMS: %w", err)
+	}
+	return aws.StringValue(output.KeyId), output.CiphertextBlob, nil
+}
+
+func (p *KMSKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	output, err := p.client.DecryptWithContext(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(keyID),
+		CiphertextBlob:    wrapped,
+		EncryptionContext: encryptionContext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to unwrap data key with KMS: %w", err)
+	}
+	return output.Plaintext, nil
+}
@@ -0,0 +1,90 @@
+package typesend_crypto_local
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+)
+
+// LocalKeyProvider wraps data keys with AES-256 keys held in memory,
+// for tests and local development. Use the KMS provider in production.
+type LocalKeyProvider struct {
+	// Keys by ID. Keep retired keys until nothing is wrapped under them.
+	Keys map[string][]byte
+	// The key new data keys are wrapped with.
+	CurrentKeyID string
+}
+
+// NewLocalKeyProvider generates a single random key, for tests.
+func NewLocalKeyProvider() *LocalKeyProvider {
+	provider := &LocalKeyProvider{Keys: map[string][]byte{}}
+	provider.Rotate("local-1")
+	return provider
+}
+
+// ParseLocalKeys reads a JSON object of base64 keys by ID, such as
+// {"2024":"...","2025":"..."}, wrapping with the currentKeyID key.
+func ParseLocalKeys(raw string, currentKeyID string) (*LocalKeyProvider, error) {
+	var encoded map[string]string
+	if err := json.Unmarshal([]byte(raw), &encoded); err != nil {
+		return nil, fmt.Errorf("typesend: invalid local keys: %w", err)
+	}
+
+	provider := &LocalKeyProvider{Keys: map[string][]byte{}, CurrentKeyID: currentKeyID}
+	for keyID, value := range encoded {
+		key, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: invalid local key %s: %w", keyID, err)
+		}
+		if len(key) != typesend_crypto.KeySize {
+			return nil, fmt.Errorf("typesend: local key %s must be %d bytes", keyID, typesend_crypto.KeySize)
+		}
+		provider.Keys[keyID] = key
+	}
+
+	if _, ok := provider.Keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("typesend: current local key %s is missing", currentKeyID)
+	}
+	return provider, nil
+}
+
+// Rotate adds a random key under keyID and makes it current.
+// Not safe to call while the provider is in use.
+func (p *LocalKeyProvider) Rotate(keyID string) {
+	key := make([]byte, typesend_crypto.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	p.Keys[keyID] = key
+	p.CurrentKeyID = keyID
+}
+
+func (p *LocalKeyProvider) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	key, ok := p.Keys[p.CurrentKeyID]
+	if !ok {
+		return "", nil, fmt.Errorf("typesend: current local key %s is missing", p.CurrentKeyID)
+	}
+
+	nonce, ciphertext, err := typesend_crypto.EncryptGCM(key, dataKey, []byte(p.CurrentKeyID))
+	if err != nil {
+		return "", nil, err
+	}
+	return p.CurrentKeyID, append(nonce, ciphertext...), nil
+}
+
+func (p *LocalKeyProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("typesend: unknown local key %s", keyID)
+	}
+
+	// Standard GCM nonces are 12 bytes.
+	if len(wrapped) < 12 {
+		return nil, fmt.Errorf("typesend: invalid wrapped key")
+	}
+	return typesend_crypto.DecryptGCM(key, wrapped[:12], wrapped[12:], []byte(keyID))
+}
@@ -0,0 +1,189 @@
+package typesend_crypto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Data keys and the keys wrapping them are AES-256.
+const KeySize = 32
+
+// Seal encrypts plaintext under a fresh data key. aad is bound to
+// the ciphertext, and must be passed to Open unchanged.
+func Seal(ctx context.Context, provider KeyProvider, plaintext []byte, aad []byte) (*typesend_schemas.TypeSendSealed, error) {
+	dataKey := make([]byte, KeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("typesend: failed to generate data key: %w", err)
+	}
+
+	nonce, ciphertext, err := EncryptGCM(dataKey, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to wrap data key: %w", err)
+	}
+
+	return &typesend_schemas.TypeSendSealed{
+		KeyID:      keyID,
+		DataKey:    wrapped,
+		Nonce:      nonce,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Open decrypts what Seal sealed.
+func Open(ctx context.Context, provider KeyProvider, sealed *typesend_schemas.TypeSendSealed, aad []byte) ([]byte, error) {
+	dataKey, err := provider.UnwrapKey(ctx, sealed.KeyID, sealed.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to unwrap data key: %w", err)
+	}
+
+	return DecryptGCM(dataKey, sealed.Nonce, sealed.Ciphertext, aad)
+}
+
+// Rewrap moves sealed content onto the providers current key, without
+// decrypting the content itself. Run it over stored envelopes after a
+// rotation, before the old key is retired.
+func Rewrap(ctx context.Context, provider KeyProvider, sealed *typesend_schemas.TypeSendSealed) (*typesend_schemas.TypeSendSealed, error) {
+	dataKey, err := provider.UnwrapKey(ctx, sealed.KeyID, sealed.DataKey)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to unwrap data key: %w", err)
+	}
+
+	keyID, wrapped, err := provider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to wrap data key: %w", err)
+	}
+
+	return &typesend_schemas.TypeSendSealed{
+		KeyID:      keyID,
+		DataKey:    wrapped,
+		Nonce:      sealed.Nonce,
+		Ciphertext: sealed.Ciphertext,
+	}, nil
+}
+
+// EncryptGCM encrypts with AES-GCM under a random nonce.
+func EncryptGCM(key []byte, plaintext []byte, aad []byte) (nonce []byte, ciphertext []byte, err error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, fmt.Errorf("typesend: failed to generate nonce: %w", err)
+	}
+
+	return nonce, gcm.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// DecryptGCM reverses EncryptGCM.
+func DecryptGCM(key []byte, nonce []byte, ciphertext []byte, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("typesend: invalid nonce")
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("typesend: keys must be %d bytes", KeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealedContent is what an envelope seals.
+type sealedContent struct {
+	Variables map[string]interface{} `json:"variables"`
+	ToName    *string                `json:"to_name,omitempty"`
+}
+
+// envelopeAAD binds sealed content to its App and Tenant. It can't
+// include the envelope ID, as digests and schedule occurrences copy
+// the sealed content of another envelope.
+func envelopeAAD(appID string, tenantID string) []byte {
+	return []byte(appID + "\x00" + tenantID)
+}
+
+// SealEnvelope encrypts the envelopes Variables, and its ToName when
+// sealToName is set, into Sealed. Envelopes already sealed are left alone.
+func SealEnvelope(ctx context.Context, provider KeyProvider, envelope *typesend_schemas.TypeSendEnvelope, sealToName bool) error {
+	if envelope.Sealed != nil {
+		return nil
+	}
+
+	content := sealedContent{Variables: envelope.Variables}
+	if sealToName {
+		content.ToName = &envelope.ToName
+	}
+
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal envelope content: %w", err)
+	}
+
+	sealed, err := Seal(ctx, provider, plaintext, envelopeAAD(envelope.AppID, envelope.TenantID))
+	if err != nil {
+		return err
+	}
+
+	envelope.Sealed = sealed
+	envelope.Variables = nil
+	if sealToName {
+		envelope.ToName = ""
+	}
+	return nil
+}
+
+// OpenEnvelope restores what SealEnvelope sealed. Envelopes that
+// aren't sealed are left alone, so it is safe to call on any envelope.
+func OpenEnvelope(ctx context.Context, provider KeyProvider, envelope *typesend_schemas.TypeSendEnvelope) error {
+	if envelope.Sealed == nil {
+		return nil
+	}
+	if provider == nil {
+		return fmt.Errorf("typesend: envelope %s is sealed, but no KeyProvider is configured", envelope.ID)
+	}
+
+	plaintext, err := Open(ctx, provider, envelope.Sealed, envelopeAAD(envelope.AppID, envelope.TenantID))
+	if err != nil {
+		return err
+	}
+
+	var content sealedContent
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return fmt.Errorf("typesend: failed to unmarshal envelope content: %w", err)
+	}
+
+	envelope.Variables = content.Variables
+	if content.ToName != nil {
+		envelope.ToName = *content.ToName
+	}
+	envelope.Sealed = nil
+	return nil
+}
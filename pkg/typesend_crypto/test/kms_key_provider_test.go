@@ -0,0 +1,62 @@
+package typesend_crypto_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	typesend_crypto_kms "github.com/kvizdos/typesend/pkg/typesend_crypto/kms"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKMS "encrypts" by reversing the plaintext, and resolves
+// every key to a fixed ARN, as KMS does for aliases.
+type fakeKMS struct {
+	kmsiface.KMSAPI
+	decryptedWith []string
+}
+
+const fakeKeyARN = "arn:aws:kms:us-east-1:123456789012:key/test"
+
+func reverse(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i, b := range in {
+		out[len(in)-1-i] = b
+	}
+	return out
+}
+
+func (f *fakeKMS) EncryptWithContext(_ aws.Context, input *kms.EncryptInput, _ ...request.Option) (*kms.EncryptOutput, error) {
+	if aws.StringValue(input.EncryptionContext["typesend"]) != "data-key" {
+		return nil, errors.New("missing encryption context")
+	}
+	return &kms.EncryptOutput{KeyId: aws.String(fakeKeyARN), CiphertextBlob: reverse(input.Plaintext)}, nil
+}
+
+func (f *fakeKMS) DecryptWithContext(_ aws.Context, input *kms.DecryptInput, _ ...request.Option) (*kms.DecryptOutput, error) {
+	if aws.StringValue(input.EncryptionContext["typesend"]) != "data-key" {
+		return nil, errors.New("missing encryption context")
+	}
+	f.decryptedWith = append(f.decryptedWith, aws.StringValue(input.KeyId))
+	return &kms.DecryptOutput{KeyId: input.KeyId, Plaintext: reverse(input.CiphertextBlob)}, nil
+}
+
+func TestKMSKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeKMS{}
+	provider := typesend_crypto_kms.NewKMSKeyProviderWithClient("alias/typesend", client)
+
+	sealed, err := typesend_crypto.Seal(ctx, provider, []byte("secret"), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, fakeKeyARN, sealed.KeyID, "the resolved key should be stored, not the alias")
+
+	plaintext, err := typesend_crypto.Open(ctx, provider, sealed, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+	assert.Equal(t, []string{fakeKeyARN}, client.decryptedWith)
+}
@@ -0,0 +1,54 @@
+package typesend_crypto_test
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	typesend_crypto_local "github.com/kvizdos/typesend/pkg/typesend_crypto/local"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocalKeys(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+
+	provider, err := typesend_crypto_local.ParseLocalKeys(`{"2024":"`+key+`","2025":"`+key+`"}`, "2025")
+	assert.NoError(t, err)
+	assert.Len(t, provider.Keys, 2)
+	assert.Equal(t, "2025", provider.CurrentKeyID)
+
+	_, err = typesend_crypto_local.ParseLocalKeys(`{"2024":"`+key+`"}`, "2025")
+	assert.Error(t, err, "the current key must be present")
+
+	short := base64.StdEncoding.EncodeToString([]byte("short"))
+	_, err = typesend_crypto_local.ParseLocalKeys(`{"2025":"`+short+`"}`, "2025")
+	assert.Error(t, err)
+
+	_, err = typesend_crypto_local.ParseLocalKeys(`{"2025":"not base64!"}`, "2025")
+	assert.Error(t, err)
+
+	_, err = typesend_crypto_local.ParseLocalKeys(`not json`, "2025")
+	assert.Error(t, err)
+}
+
+func TestLocalKeyProviderWrapKey(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+	dataKey := []byte(strings.Repeat("k", 32))
+
+	keyID, wrapped, err := provider.WrapKey(ctx, dataKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "local-1", keyID)
+	assert.NotContains(t, string(wrapped), string(dataKey))
+
+	unwrapped, err := provider.UnwrapKey(ctx, keyID, wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, dataKey, unwrapped)
+
+	_, err = provider.UnwrapKey(ctx, "missing", wrapped)
+	assert.Error(t, err)
+
+	_, err = provider.UnwrapKey(ctx, keyID, wrapped[:4])
+	assert.Error(t, err)
+}
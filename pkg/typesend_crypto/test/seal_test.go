@@ -0,0 +1,126 @@
+package typesend_crypto_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_crypto"
+	typesend_crypto_local "github.com/kvizdos/typesend/pkg/typesend_crypto/local"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+
+	sealed, err := typesend_crypto.Seal(ctx, provider, []byte("secret"), []byte("aad"))
+	assert.NoError(t, err)
+	assert.Equal(t, "local-1", sealed.KeyID)
+	assert.NotContains(t, string(sealed.Ciphertext), "secret")
+
+	plaintext, err := typesend_crypto.Open(ctx, provider, sealed, []byte("aad"))
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = typesend_crypto.Open(ctx, provider, sealed, []byte("other"))
+	assert.Error(t, err, "a different aad should not open")
+
+	_, err = typesend_crypto.Open(ctx, typesend_crypto_local.NewLocalKeyProvider(), sealed, []byte("aad"))
+	assert.Error(t, err, "a different key should not open")
+}
+
+func TestSealEnvelope(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ID:        "id",
+		AppID:     "app",
+		TenantID:  "tenant",
+		ToName:    "Test",
+		Variables: map[string]interface{}{"Name": "Test"},
+	}
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, provider, envelope, false))
+	assert.NotNil(t, envelope.Sealed)
+	assert.Nil(t, envelope.Variables)
+	assert.Equal(t, "Test", envelope.ToName, "ToName should only be sealed when asked")
+
+	sealed := envelope.Sealed
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, provider, envelope, false))
+	assert.Same(t, sealed, envelope.Sealed, "sealed envelopes should be left alone")
+
+	assert.NoError(t, typesend_crypto.OpenEnvelope(ctx, provider, envelope))
+	assert.Nil(t, envelope.Sealed)
+	assert.Equal(t, "Test", envelope.Variables["Name"])
+	assert.Equal(t, "Test", envelope.ToName)
+}
+
+func TestSealEnvelopeToName(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		AppID:     "app",
+		ToName:    "Test",
+		Variables: map[string]interface{}{"Name": "Test"},
+	}
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, provider, envelope, true))
+	assert.Empty(t, envelope.ToName)
+
+	assert.NoError(t, typesend_crypto.OpenEnvelope(ctx, provider, envelope))
+	assert.Equal(t, "Test", envelope.ToName)
+}
+
+func TestOpenEnvelopeOtherTenant(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		AppID:     "app",
+		TenantID:  "tenant",
+		Variables: map[string]interface{}{"Name": "Test"},
+	}
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, provider, envelope, false))
+
+	moved := &typesend_schemas.TypeSendEnvelope{AppID: "app", TenantID: "other", Sealed: envelope.Sealed}
+	assert.Error(t, typesend_crypto.OpenEnvelope(ctx, provider, moved), "sealed content should not open under another tenant")
+}
+
+func TestOpenEnvelopeWithoutProvider(t *testing.T) {
+	ctx := context.Background()
+
+	plain := &typesend_schemas.TypeSendEnvelope{Variables: map[string]interface{}{"Name": "Test"}}
+	assert.NoError(t, typesend_crypto.OpenEnvelope(ctx, nil, plain), "envelopes that aren't sealed need no provider")
+
+	sealed := &typesend_schemas.TypeSendEnvelope{}
+	assert.NoError(t, typesend_crypto.SealEnvelope(ctx, typesend_crypto_local.NewLocalKeyProvider(), sealed, false))
+	assert.Error(t, typesend_crypto.OpenEnvelope(ctx, nil, sealed))
+}
+
+func TestRotation(t *testing.T) {
+	ctx := context.Background()
+	provider := typesend_crypto_local.NewLocalKeyProvider()
+
+	old, err := typesend_crypto.Seal(ctx, provider, []byte("secret"), nil)
+	assert.NoError(t, err)
+
+	provider.Rotate("local-2")
+
+	plaintext, err := typesend_crypto.Open(ctx, provider, old, nil)
+	assert.NoError(t, err, "content sealed under a retired key should still open")
+	assert.Equal(t, "secret", string(plaintext))
+
+	rewrapped, err := typesend_crypto.Rewrap(ctx, provider, old)
+	assert.NoError(t, err)
+	assert.Equal(t, "local-2", rewrapped.KeyID)
+	assert.Equal(t, old.Ciphertext, rewrapped.Ciphertext, "rewrapping should not touch the content")
+
+	delete(provider.Keys, "local-1")
+	plaintext, err = typesend_crypto.Open(ctx, provider, rewrapped, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(plaintext))
+
+	_, err = typesend_crypto.Open(ctx, provider, old, nil)
+	assert.Error(t, err)
+}
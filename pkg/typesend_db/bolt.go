@@ -0,0 +1,1513 @@
+package typesend_db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltEnvelopesBucket   = []byte("envelopes")
+	boltIdempotencyBucket = []byte("idempotency")
+	boltRateLimitsBucket  = []byte("ratelimits")
+	boltSchedulesBucket   = []byte("schedules")
+	boltTemplatesBucket   = []byte("templates")
+	boltTombstonesBucket  = []byte("tombstones")
+	// Keyed by suppressionKey.
+	boltSuppressionsBucket = []byte("suppressions")
+	// Keyed by categoriesKey.
+	boltCategoriesBucket = []byte("categories")
+	// Keyed by preferencesKey.
+	boltPreferencesBucket = []byte("preferences")
+	// Keyed by eventKey, so an envelopes events share a prefix.
+	boltEventsBucket = []byte("events")
+	// Keyed by eventDayKey, to find a days events.
+	boltEventDaysBucket = []byte("eventDays")
+	// Keyed by eventMessageKey, to find the events of a providers message.
+	boltEventMessagesBucket = []byte("eventMessages")
+	// Keyed by rollupKey, so an Apps rollups share a prefix.
+	boltRollupsBucket = []byte("rollups")
+)
+
+func NewBoltDB(ctx context.Context, conf *BoltConfig) (*BoltTypeSendDB, error) {
+	db := &BoltTypeSendDB{
+		Config:       conf,
+		liveModeChan: conf.LiveModeChan,
+	}
+
+	err := db.Connect(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type BoltConfig struct {
+	// File the database is kept in; created if missing.
+	// Only one process may have it open at a time.
+	Path string
+
+	// Optional; signalled without blocking on every insert.
+	LiveModeChan chan *typesend_schemas.TypeSendEnvelope
+}
+
+// BoltTypeSendDB is a file-backed implementation of TypeSendDatabase,
+// for single node deployments and live mode. Everything is kept in one
+// bbolt file, so envelopes and templates survive a restart.
+//
+// Queries such as GetMessagesReadyToSend scan every envelope, which is
+// fine for local development but not for large backlogs.
+type BoltTypeSendDB struct {
+	Config *BoltConfig
+
+	mu           sync.Mutex
+	liveModeChan chan *typesend_schemas.TypeSendEnvelope
+	db           *bolt.DB
+}
+
+func (db *BoltTypeSendDB) Connect(ctx context.Context) error {
+	if db.db != nil {
+		return nil
+	}
+
+	file, err := bolt.Open(db.Config.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to open %s: %w", db.Config.Path, err)
+	}
+
+	err = file.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{boltEnvelopesBucket, boltIdempotencyBucket, boltRateLimitsBucket, boltSchedulesBucket, boltTemplatesBucket, boltTombstonesBucket, boltSuppressionsBucket, boltCategoriesBucket, boltPreferencesBucket, boltEventsBucket, boltEventDaysBucket, boltEventMessagesBucket, boltRollupsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("typesend: failed to create buckets: %w", err)
+	}
+
+	db.db = file
+	return nil
+}
+
+// Close releases the file, so another process may open it.
+func (db *BoltTypeSendDB) Close() error {
+	if db.db == nil {
+		return nil
+	}
+	return db.db.Close()
+}
+
+// SetLiveModeChan implements LiveModeDatabase.
+func (db *BoltTypeSendDB) SetLiveModeChan(ch chan *typesend_schemas.TypeSendEnvelope) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.liveModeChan = ch
+}
+
+// notifyLiveMode is only a wake-up signal for the live mode
+// dispatcher. It must not block, as the dispatcher itself
+// inserts schedule occurrences.
+func (db *BoltTypeSendDB) notifyLiveMode(envelope *typesend_schemas.TypeSendEnvelope) {
+	db.mu.Lock()
+	ch := db.liveModeChan
+	db.mu.Unlock()
+
+	if ch == nil {
+		return
+	}
+	select {
+	case ch <- envelope:
+	default:
+	}
+}
+
+func putJSON(bucket *bolt.Bucket, key string, value any) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), encoded)
+}
+
+func getEnvelope(tx *bolt.Tx, envelopeID string) (*typesend_schemas.TypeSendEnvelope, error) {
+	raw := tx.Bucket(boltEnvelopesBucket).Get([]byte(envelopeID))
+	if raw == nil {
+		return nil, nil
+	}
+
+	var envelope typesend_schemas.TypeSendEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal envelope: %w", err)
+	}
+	return &envelope, nil
+}
+
+// updateEnvelope applies change to a stored envelope. A false from
+// change leaves the envelope as it was, and is returned as updated.
+func updateEnvelope(tx *bolt.Tx, envelopeID string, change func(*typesend_schemas.TypeSendEnvelope) bool) (bool, error) {
+	envelope, err := getEnvelope(tx, envelopeID)
+	if err != nil {
+		return false, err
+	}
+	if envelope == nil {
+		return false, fmt.Errorf("typesend: envelope with ID %s not found", envelopeID)
+	}
+
+	if !change(envelope) {
+		return false, nil
+	}
+
+	if err := putJSON(tx.Bucket(boltEnvelopesBucket), envelopeID, envelope); err != nil {
+		return false, fmt.Errorf("typesend: failed to marshal envelope: %w", err)
+	}
+	return true, nil
+}
+
+func (db *BoltTypeSendDB) Insert(envelope *typesend_schemas.TypeSendEnvelope) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: Insert requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltEnvelopesBucket), envelope.ID, envelope)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert envelope: %w", err)
+	}
+
+	db.notifyLiveMode(envelope)
+	return nil
+}
+
+func (db *BoltTypeSendDB) InsertIdempotent(_ context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string, expiresAt time.Time) (string, error) {
+	if db.db == nil {
+		return "", fmt.Errorf("typesend: InsertIdempotent requires a connection")
+	}
+
+	key := scopedIdempotencyKey(envelope, idempotencyKey)
+	ownerID := envelope.ID
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(boltIdempotencyBucket)
+
+		if raw := keys.Get([]byte(key)); raw != nil {
+			var existing idempotencyRecord
+			if err := json.Unmarshal(raw, &existing); err != nil {
+				return err
+			}
+			if existing.ExpiresAt > time.Now().UTC().Unix() {
+				ownerID = existing.EnvelopeID
+				return nil
+			}
+		}
+
+		err := putJSON(keys, key, &idempotencyRecord{
+			ID:         key,
+			EnvelopeID: envelope.ID,
+			ExpiresAt:  expiresAt.Unix(),
+		})
+		if err != nil {
+			return err
+		}
+		return putJSON(tx.Bucket(boltEnvelopesBucket), envelope.ID, envelope)
+	})
+	if err != nil {
+		return "", fmt.Errorf("typesend: failed to insert idempotent envelope: %w", err)
+	}
+
+	if ownerID == envelope.ID {
+		db.notifyLiveMode(envelope)
+	}
+	return ownerID, nil
+}
+
+// InsertBatch writes every envelope in a single transaction.
+func (db *BoltTypeSendDB) InsertBatch(_ context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) []error {
+	errs := make([]error, len(envelopes))
+
+	if db.db == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: InsertBatch requires a connection")
+		}
+		return errs
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEnvelopesBucket)
+		for i, envelope := range envelopes {
+			if err := putJSON(bucket, envelope.ID, envelope); err != nil {
+				errs[i] = fmt.Errorf("typesend: failed to marshal envelope: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: failed to insert envelope batch: %w", err)
+		}
+		return errs
+	}
+
+	for i, envelope := range envelopes {
+		if errs[i] == nil {
+			db.notifyLiveMode(envelope)
+		}
+	}
+	return errs
+}
+
+func (db *BoltTypeSendDB) GetEnvelopeByID(_ context.Context, envelopeID string) (*typesend_schemas.TypeSendEnvelope, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetEnvelopeByID requires a connection")
+	}
+
+	var envelope *typesend_schemas.TypeSendEnvelope
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		envelope, err = getEnvelope(tx, envelopeID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+func (db *BoltTypeSendDB) GetMessagesReadyToSend(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	return db.messagesReadyToSend(ctx, timestamp, func(*typesend_schemas.TypeSendEnvelope) bool {
+		return true
+	})
+}
+
+func (db *BoltTypeSendDB) GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	return db.messagesReadyToSend(ctx, timestamp, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+		return envelope.Priority.Effective() == priority.Effective()
+	})
+}
+
+func (db *BoltTypeSendDB) messagesReadyToSend(ctx context.Context, timestamp time.Time, include func(*typesend_schemas.TypeSendEnvelope) bool) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetMessagesReadyToSend requires a connection")
+	}
+
+	// Read up front, as the dispatcher updates statuses
+	// (which needs a write transaction) while streaming.
+	ready := make([]*typesend_schemas.TypeSendEnvelope, 0)
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltEnvelopesBucket).ForEach(func(_, raw []byte) error {
+			var envelope typesend_schemas.TypeSendEnvelope
+			if err := json.Unmarshal(raw, &envelope); err != nil {
+				return err
+			}
+			if envelope.Status == typesend_schemas.TypeSendStatus_UNSENT && !envelope.ScheduledFor.After(timestamp) && include(&envelope) {
+				ready = append(ready, &envelope)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to read envelopes: %w", err)
+	}
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].ScheduledFor.Before(ready[j].ScheduledFor)
+	})
+
+	ch := make(chan *typesend_schemas.TypeSendEnvelope)
+	go func() {
+		defer close(ch)
+		if ctx.Err() != nil {
+			return
+		}
+		for _, envelope := range ready {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- envelope:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (db *BoltTypeSendDB) UpdateEnvelopeStatus(_ context.Context, envelopeID string, toStatus typesend_schemas.TypeSendStatus) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: UpdateEnvelopeStatus requires a connection")
+	}
+
+	return db.db.Update(func(tx *bolt.Tx) error {
+		_, err := updateEnvelope(tx, envelopeID, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+			envelope.Status = toStatus
+			return true
+		})
+		return err
+	})
+}
+
+// UpdateEnvelopeStatuses updates every envelope in a single transaction.
+func (db *BoltTypeSendDB) UpdateEnvelopeStatuses(_ context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	if db.db == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: UpdateEnvelopeStatuses requires a connection")
+		}
+		return errs
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		for i, envelopeID := range envelopeIDs {
+			_, errs[i] = updateEnvelope(tx, envelopeID, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+				envelope.Status = toStatus
+				return true
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: failed to update envelope statuses: %w", err)
+		}
+	}
+	return errs
+}
+
+// ClaimEnvelopes claims every envelope in a single transaction.
+func (db *BoltTypeSendDB) ClaimEnvelopes(_ context.Context, envelopeIDs []string) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	if db.db == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: ClaimEnvelopes requires a connection")
+		}
+		return errs
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		for i, envelopeID := range envelopeIDs {
+			var claimed bool
+			claimed, errs[i] = updateEnvelope(tx, envelopeID, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+				if envelope.Status != typesend_schemas.TypeSendStatus_UNSENT {
+					return false
+				}
+				envelope.Status = typesend_schemas.TypeSendStatus_DELIVERING
+				return true
+			})
+			if !claimed && errs[i] == nil {
+				errs[i] = ErrNotUnsent
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: failed to claim envelopes: %w", err)
+		}
+	}
+	return errs
+}
+
+func (db *BoltTypeSendDB) DeferEnvelope(_ context.Context, envelope *typesend_schemas.TypeSendEnvelope, until time.Time) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: DeferEnvelope requires a connection")
+	}
+
+	deferred := *envelope
+	deferred.Defer(until)
+
+	return db.db.Update(func(tx *bolt.Tx) error {
+		ok, err := updateEnvelope(tx, envelope.ID, func(stored *typesend_schemas.TypeSendEnvelope) bool {
+			if stored.Status != typesend_schemas.TypeSendStatus_UNSENT {
+				return false
+			}
+			stored.OriginalScheduledFor = deferred.OriginalScheduledFor
+			stored.ScheduledFor = deferred.ScheduledFor
+			stored.ContentExpiresAt = deferred.ContentExpiresAt
+			stored.ExpiresAt = deferred.ExpiresAt
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("typesend: envelope with ID %s is no longer UNSENT", envelope.ID)
+		}
+		return nil
+	})
+}
+
+func (db *BoltTypeSendDB) LinkEnvelopesToDigest(_ context.Context, digestID string, envelopeIDs []string) ([]string, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: LinkEnvelopesToDigest requires a connection")
+	}
+
+	linked := make([]string, 0, len(envelopeIDs))
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		for _, envelopeID := range envelopeIDs {
+			ok, err := updateEnvelope(tx, envelopeID, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+				if envelope.Status != typesend_schemas.TypeSendStatus_UNSENT {
+					return false
+				}
+				envelope.Status = typesend_schemas.TypeSendStatus_SENT
+				envelope.DigestID = digestID
+				return true
+			})
+			if err != nil {
+				// Missing envelopes are skipped, as they can no longer be sent.
+				continue
+			}
+			if ok {
+				linked = append(linked, envelopeID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to link envelopes to digest: %w", err)
+	}
+	return linked, nil
+}
+
+// ConsumeRateLimit keeps a counter per window. Expired windows are
+// not cleaned up, as each is only a few bytes.
+// Rate limit windows are stored as the big-endian count,
+// followed by when the window expires in Unix seconds.
+func (db *BoltTypeSendDB) ConsumeRateLimit(_ context.Context, key string, windowStart time.Time, window time.Duration, limit int) (bool, error) {
+	if db.db == nil {
+		return false, fmt.Errorf("typesend: ConsumeRateLimit requires a connection")
+	}
+
+	allowed := false
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRateLimitsBucket)
+		windowKey := []byte(rateLimitWindowKey(key, windowStart))
+
+		var count uint64
+		if raw := bucket.Get(windowKey); raw != nil {
+			count = binary.BigEndian.Uint64(raw)
+		}
+		if count >= uint64(limit) {
+			return nil
+		}
+
+		allowed = true
+		value := binary.BigEndian.AppendUint64(nil, count+1)
+		value = binary.BigEndian.AppendUint64(value, uint64(windowStart.Add(window+rateLimitGracePeriod).Unix()))
+		return bucket.Put(windowKey, value)
+	})
+	if err != nil {
+		return false, fmt.Errorf("typesend: failed to consume rate limit: %w", err)
+	}
+	return allowed, nil
+}
+
+func (db *BoltTypeSendDB) ReleaseRateLimit(_ context.Context, key string, windowStart time.Time) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: ReleaseRateLimit requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRateLimitsBucket)
+		windowKey := []byte(rateLimitWindowKey(key, windowStart))
+
+		raw := bucket.Get(windowKey)
+		if raw == nil {
+			return nil
+		}
+		count := binary.BigEndian.Uint64(raw)
+		if count == 0 {
+			return nil
+		}
+
+		value := binary.BigEndian.AppendUint64(nil, count-1)
+		value = append(value, raw[8:]...)
+		return bucket.Put(windowKey, value)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to release rate limit: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredData runs in a single transaction. Keys are gathered
+// first, as bbolt buckets can't be changed while iterating them.
+func (db *BoltTypeSendDB) PurgeExpiredData(_ context.Context, now time.Time) (PurgeResult, error) {
+	if db.db == nil {
+		return PurgeResult{}, fmt.Errorf("typesend: PurgeExpiredData requires a connection")
+	}
+
+	var result PurgeResult
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		envelopes := tx.Bucket(boltEnvelopesBucket)
+		var expired []string
+		var stripped []*typesend_schemas.TypeSendEnvelope
+		err := envelopes.ForEach(func(key, raw []byte) error {
+			var envelope typesend_schemas.TypeSendEnvelope
+			if err := json.Unmarshal(raw, &envelope); err != nil {
+				return fmt.Errorf("typesend: failed to unmarshal envelope: %w", err)
+			}
+			if !purgeable(&envelope) {
+				return nil
+			}
+			if retentionExpired(envelope.ExpiresAt, now) {
+				expired = append(expired, envelope.ID)
+			} else if retentionExpired(envelope.ContentExpiresAt, now) {
+				envelope.StripContent()
+				stripped = append(stripped, &envelope)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, envelopeID := range expired {
+			if err := envelopes.Delete([]byte(envelopeID)); err != nil {
+				return err
+			}
+		}
+		for _, envelope := range stripped {
+			if err := putJSON(envelopes, envelope.ID, envelope); err != nil {
+				return err
+			}
+		}
+		result = PurgeResult{Stripped: len(stripped), Deleted: len(expired)}
+
+		var keys [][]byte
+		err = tx.Bucket(boltIdempotencyBucket).ForEach(func(key, raw []byte) error {
+			var record idempotencyRecord
+			if err := json.Unmarshal(raw, &record); err != nil {
+				return err
+			}
+			if record.ExpiresAt <= now.Unix() {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Bucket(boltIdempotencyBucket).Delete(key); err != nil {
+				return err
+			}
+		}
+
+		keys = nil
+		err = tx.Bucket(boltRateLimitsBucket).ForEach(func(key, raw []byte) error {
+			if len(raw) >= 16 && int64(binary.BigEndian.Uint64(raw[8:])) <= now.Unix() {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := tx.Bucket(boltRateLimitsBucket).Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("typesend: failed to purge expired data: %w", err)
+	}
+	return result, nil
+}
+
+func boltRecipientEnvelopes(tx *bolt.Tx, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendEnvelope, error) {
+	envelopes := []*typesend_schemas.TypeSendEnvelope{}
+	err := tx.Bucket(boltEnvelopesBucket).ForEach(func(_, raw []byte) error {
+		var envelope typesend_schemas.TypeSendEnvelope
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return fmt.Errorf("typesend: failed to unmarshal envelope: %w", err)
+		}
+		if recipient.Matches(envelope.ToAddress, envelope.ToInternalID) {
+			envelopes = append(envelopes, &envelope)
+		}
+		return nil
+	})
+	return envelopes, err
+}
+
+func boltRecipientSchedules(tx *bolt.Tx, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendSchedule, error) {
+	schedules := []*typesend_schemas.TypeSendSchedule{}
+	err := tx.Bucket(boltSchedulesBucket).ForEach(func(_, raw []byte) error {
+		var schedule typesend_schemas.TypeSendSchedule
+		if err := json.Unmarshal(raw, &schedule); err != nil {
+			return fmt.Errorf("typesend: failed to unmarshal schedule: %w", err)
+		}
+		if recipient.Matches(schedule.ToAddress, schedule.ToInternalID) {
+			schedules = append(schedules, &schedule)
+		}
+		return nil
+	})
+	return schedules, err
+}
+
+// boltAddressSuppressions scans for the suppressions of any of
+// the normalized addresses.
+func boltAddressSuppressions(tx *bolt.Tx, addresses []string) ([]*typesend_schemas.TypeSendSuppression, error) {
+	suppressions := []*typesend_schemas.TypeSendSuppression{}
+	err := tx.Bucket(boltSuppressionsBucket).ForEach(func(_, raw []byte) error {
+		var suppression typesend_schemas.TypeSendSuppression
+		if err := json.Unmarshal(raw, &suppression); err != nil {
+			return fmt.Errorf("typesend: failed to unmarshal suppression: %w", err)
+		}
+		if slices.Contains(addresses, suppression.Address) {
+			suppressions = append(suppressions, &suppression)
+		}
+		return nil
+	})
+	return suppressions, err
+}
+
+// boltAddressPreferences scans for the preferences of any of
+// the normalized addresses.
+func boltAddressPreferences(tx *bolt.Tx, addresses []string) ([]*typesend_schemas.TypeSendPreferences, error) {
+	found := []*typesend_schemas.TypeSendPreferences{}
+	err := tx.Bucket(boltPreferencesBucket).ForEach(func(_, raw []byte) error {
+		var preferences typesend_schemas.TypeSendPreferences
+		if err := json.Unmarshal(raw, &preferences); err != nil {
+			return fmt.Errorf("typesend: failed to unmarshal preferences: %w", err)
+		}
+		if slices.Contains(addresses, preferences.Address) {
+			found = append(found, loadedPreferences(&preferences))
+		}
+		return nil
+	})
+	return found, err
+}
+
+func getTombstone(tx *bolt.Tx, hash string) (*typesend_schemas.TypeSendTombstone, error) {
+	raw := tx.Bucket(boltTombstonesBucket).Get([]byte(hash))
+	if raw == nil {
+		return nil, nil
+	}
+
+	var tombstone typesend_schemas.TypeSendTombstone
+	if err := json.Unmarshal(raw, &tombstone); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal tombstone: %w", err)
+	}
+	return &tombstone, nil
+}
+
+func (db *BoltTypeSendDB) ExportRecipientData(_ context.Context, recipient typesend_schemas.TypeSendRecipient) (*typesend_schemas.TypeSendRecipientExport, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: ExportRecipientData requires a connection")
+	}
+
+	export := &typesend_schemas.TypeSendRecipientExport{
+		Recipient:  recipient,
+		ExportedAt: time.Now().UTC(),
+		Tombstones: []*typesend_schemas.TypeSendTombstone{},
+	}
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		if export.Envelopes, err = boltRecipientEnvelopes(tx, recipient); err != nil {
+			return err
+		}
+		if export.Schedules, err = boltRecipientSchedules(tx, recipient); err != nil {
+			return err
+		}
+		export.Events = []*typesend_schemas.TypeSendEvent{}
+		for _, envelope := range export.Envelopes {
+			events, err := boltEnvelopeEvents(tx, envelope.ID)
+			if err != nil {
+				return err
+			}
+			sortEvents(events)
+			export.Events = append(export.Events, events...)
+		}
+		addresses := matchedAddresses(recipient, export.Envelopes, export.Schedules)
+		if export.Suppressions, err = boltAddressSuppressions(tx, addresses); err != nil {
+			return err
+		}
+		if export.Preferences, err = boltAddressPreferences(tx, addresses); err != nil {
+			return err
+		}
+		for _, hash := range recipient.Hashes() {
+			tombstone, err := getTombstone(tx, hash)
+			if err != nil {
+				return err
+			}
+			if tombstone != nil {
+				export.Tombstones = append(export.Tombstones, tombstone)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to export recipient data: %w", err)
+	}
+	return export, nil
+}
+
+// EraseRecipient runs in a single transaction, so a
+// failure leaves nothing half erased.
+func (db *BoltTypeSendDB) EraseRecipient(_ context.Context, recipient typesend_schemas.TypeSendRecipient, erasedAt time.Time) (*typesend_schemas.TypeSendErasure, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: EraseRecipient requires a connection")
+	}
+
+	var erasure *typesend_schemas.TypeSendErasure
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		envelopes, err := boltRecipientEnvelopes(tx, recipient)
+		if err != nil {
+			return err
+		}
+		schedules, err := boltRecipientSchedules(tx, recipient)
+		if err != nil {
+			return err
+		}
+
+		// Found before the envelopes are erased in place.
+		addresses := matchedAddresses(recipient, envelopes, schedules)
+		suppressions, err := boltAddressSuppressions(tx, addresses)
+		if err != nil {
+			return err
+		}
+		preferences, err := boltAddressPreferences(tx, addresses)
+		if err != nil {
+			return err
+		}
+
+		erased := []string{recipient.ToAddress, recipient.ToInternalID}
+		erasedEvents := 0
+		for _, envelope := range envelopes {
+			erased = append(erased, envelope.ToAddress, envelope.ToInternalID)
+			envelope.Erase()
+			if err := putJSON(tx.Bucket(boltEnvelopesBucket), envelope.ID, envelope); err != nil {
+				return err
+			}
+
+			events, err := boltEnvelopeEvents(tx, envelope.ID)
+			if err != nil {
+				return err
+			}
+			for _, event := range events {
+				if len(event.Details) == 0 {
+					continue
+				}
+				event.Erase()
+				if err := putJSON(tx.Bucket(boltEventsBucket), eventKey(event.EnvelopeID, event.ID), event); err != nil {
+					return err
+				}
+				erasedEvents++
+			}
+		}
+		for _, schedule := range schedules {
+			erased = append(erased, schedule.ToAddress, schedule.ToInternalID)
+			if err := tx.Bucket(boltSchedulesBucket).Delete([]byte(schedule.ID)); err != nil {
+				return err
+			}
+		}
+
+		for _, suppression := range suppressions {
+			bucket := tx.Bucket(boltSuppressionsBucket)
+			if err := bucket.Delete([]byte(suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address))); err != nil {
+				return err
+			}
+			suppression.Erase()
+			if err := putJSON(bucket, suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address), suppression); err != nil {
+				return err
+			}
+		}
+
+		for _, found := range preferences {
+			if err := tx.Bucket(boltPreferencesBucket).Delete([]byte(preferencesKey(found.AppID, found.TenantID, found.Address))); err != nil {
+				return err
+			}
+		}
+
+		erasure = &typesend_schemas.TypeSendErasure{
+			Envelopes:    len(envelopes),
+			Events:       erasedEvents,
+			Schedules:    len(schedules),
+			Suppressions: len(suppressions),
+			Preferences:  len(preferences),
+			Tombstones:   typesend_schemas.NewTombstones(erasedAt, erased...),
+		}
+		for _, tombstone := range erasure.Tombstones {
+			if err := putJSON(tx.Bucket(boltTombstonesBucket), tombstone.Hash, tombstone); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to erase recipient: %w", err)
+	}
+	return erasure, nil
+}
+
+func (db *BoltTypeSendDB) GetTombstone(_ context.Context, hash string) (*typesend_schemas.TypeSendTombstone, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetTombstone requires a connection")
+	}
+
+	var tombstone *typesend_schemas.TypeSendTombstone
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		tombstone, err = getTombstone(tx, hash)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get tombstone: %w", err)
+	}
+	return tombstone, nil
+}
+
+func (db *BoltTypeSendDB) PutSuppression(_ context.Context, suppression *typesend_schemas.TypeSendSuppression) error {
+	stored, err := storedSuppression(suppression)
+	if err != nil {
+		return err
+	}
+	if db.db == nil {
+		return fmt.Errorf("typesend: PutSuppression requires a connection")
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltSuppressionsBucket), suppressionKey(stored.AppID, stored.TenantID, stored.Address), stored)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put suppression: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetSuppression(_ context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetSuppression requires a connection")
+	}
+
+	var suppression *typesend_schemas.TypeSendSuppression
+	err := db.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltSuppressionsBucket).Get([]byte(suppressionKey(appID, tenantID, address)))
+		if raw == nil {
+			return nil
+		}
+		suppression = &typesend_schemas.TypeSendSuppression{}
+		return json.Unmarshal(raw, suppression)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get suppression: %w", err)
+	}
+	return suppression, nil
+}
+
+func (db *BoltTypeSendDB) DeleteSuppression(_ context.Context, appID string, tenantID string, address string) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: DeleteSuppression requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSuppressionsBucket).Delete([]byte(suppressionKey(appID, tenantID, address)))
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete suppression: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) PutCategories(_ context.Context, appID string, categories []*typesend_schemas.TypeSendCategory) error {
+	stored, err := storedCategories(appID, categories)
+	if err != nil {
+		return err
+	}
+	if db.db == nil {
+		return fmt.Errorf("typesend: PutCategories requires a connection")
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltCategoriesBucket), categoriesKey(appID), stored)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put categories: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetCategories(_ context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetCategories requires a connection")
+	}
+
+	var stored []typesend_schemas.TypeSendCategory
+	err := db.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltCategoriesBucket).Get([]byte(categoriesKey(appID)))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &stored)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get categories: %w", err)
+	}
+	return loadedCategories(stored), nil
+}
+
+func (db *BoltTypeSendDB) PutPreferences(_ context.Context, preferences *typesend_schemas.TypeSendPreferences) error {
+	stored, err := storedPreferences(preferences)
+	if err != nil {
+		return err
+	}
+	if db.db == nil {
+		return fmt.Errorf("typesend: PutPreferences requires a connection")
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltPreferencesBucket), preferencesKey(stored.AppID, stored.TenantID, stored.Address), stored)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put preferences: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetPreferences(_ context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetPreferences requires a connection")
+	}
+
+	var preferences *typesend_schemas.TypeSendPreferences
+	err := db.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltPreferencesBucket).Get([]byte(preferencesKey(appID, tenantID, address)))
+		if raw == nil {
+			return nil
+		}
+		preferences = &typesend_schemas.TypeSendPreferences{}
+		return json.Unmarshal(raw, preferences)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get preferences: %w", err)
+	}
+	if preferences == nil {
+		return nil, nil
+	}
+	return loadedPreferences(preferences), nil
+}
+
+func (db *BoltTypeSendDB) GetRecipientStates(_ context.Context, keys []RecipientKey) ([]RecipientState, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetRecipientStates requires a connection")
+	}
+
+	suppressions := make(map[string]*typesend_schemas.TypeSendSuppression)
+	preferences := make(map[string]*typesend_schemas.TypeSendPreferences)
+	tombstones := make(map[string]*typesend_schemas.TypeSendTombstone)
+	err := db.db.View(func(tx *bolt.Tx) error {
+		for _, hash := range recipientHashes(keys) {
+			tombstone, err := getTombstone(tx, hash)
+			if err != nil {
+				return err
+			}
+			if tombstone != nil {
+				tombstones[hash] = tombstone
+			}
+		}
+
+		for _, key := range keys {
+			id := suppressionKey(key.AppID, key.TenantID, key.Address)
+			if raw := tx.Bucket(boltSuppressionsBucket).Get([]byte(id)); raw != nil {
+				var suppression typesend_schemas.TypeSendSuppression
+				if err := json.Unmarshal(raw, &suppression); err != nil {
+					return err
+				}
+				suppressions[id] = &suppression
+			}
+
+			id = preferencesKey(key.AppID, key.TenantID, key.Address)
+			if raw := tx.Bucket(boltPreferencesBucket).Get([]byte(id)); raw != nil {
+				var found typesend_schemas.TypeSendPreferences
+				if err := json.Unmarshal(raw, &found); err != nil {
+					return err
+				}
+				preferences[id] = &found
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get recipient states: %w", err)
+	}
+	return recipientStates(keys, suppressions, preferences, tombstones), nil
+}
+
+func (db *BoltTypeSendDB) AppendEvents(_ context.Context, events []*typesend_schemas.TypeSendEvent) error {
+	stored, err := storedEvents(events)
+	if err != nil {
+		return err
+	}
+	if db.db == nil {
+		return fmt.Errorf("typesend: AppendEvents requires a connection")
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEventsBucket)
+		days := tx.Bucket(boltEventDaysBucket)
+		for _, event := range stored {
+			key := eventKey(event.EnvelopeID, event.ID)
+			if bucket.Get([]byte(key)) != nil {
+				continue
+			}
+			if err := putJSON(bucket, key, event); err != nil {
+				return err
+			}
+			if err := days.Put([]byte(eventDayKey(event)), []byte(key)); err != nil {
+				return err
+			}
+			if event.ProviderMessageID == "" {
+				continue
+			}
+			if err := tx.Bucket(boltEventMessagesBucket).Put([]byte(eventMessageKey(event.Provider, event.ProviderMessageID)+key), []byte(key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to append events: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetEnvelopeTimeline(_ context.Context, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetEnvelopeTimeline requires a connection")
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		events, err = boltEnvelopeEvents(tx, envelopeID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// boltEnvelopeEvents returns the envelopes events in key order.
+func boltEnvelopeEvents(tx *bolt.Tx, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error) {
+	var events []*typesend_schemas.TypeSendEvent
+	prefix := []byte(eventKey(envelopeID, ""))
+	cursor := tx.Bucket(boltEventsBucket).Cursor()
+	for key, raw := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, raw = cursor.Next() {
+		event := &typesend_schemas.TypeSendEvent{}
+		if err := json.Unmarshal(raw, event); err != nil {
+			return nil, err
+		}
+		events = append(events, loadedEvent(event))
+	}
+	return events, nil
+}
+
+// eventMessageKey is the prefix every event of a providers
+// message shares, followed by the events eventKey.
+func eventMessageKey(provider string, messageID string) string {
+	return provider + "#" + messageID + "#"
+}
+
+func (db *BoltTypeSendDB) GetEventByProviderMessageID(_ context.Context, provider string, messageID string) (*typesend_schemas.TypeSendEvent, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetEventByProviderMessageID requires a connection")
+	}
+	if messageID == "" {
+		return nil, nil
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	err := db.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(eventMessageKey(provider, messageID))
+		bucket := tx.Bucket(boltEventsBucket)
+		cursor := tx.Bucket(boltEventMessagesBucket).Cursor()
+		for key, eventKey := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, eventKey = cursor.Next() {
+			raw := bucket.Get(eventKey)
+			if raw == nil {
+				continue
+			}
+			event := &typesend_schemas.TypeSendEvent{}
+			if err := json.Unmarshal(raw, event); err != nil {
+				return err
+			}
+			events = append(events, loadedEvent(event))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	sortEvents(events)
+	return events[0], nil
+}
+
+func eventDayKey(event *typesend_schemas.TypeSendEvent) string {
+	return event.OccurredAt.UTC().Format(rollupDayFormat) + "#" + eventKey(event.EnvelopeID, event.ID)
+}
+
+func (db *BoltTypeSendDB) GetEventsByDay(_ context.Context, day time.Time) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetEventsByDay requires a connection")
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	err := db.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEventsBucket)
+		prefix := []byte(typesend_schemas.RollupDay(day).Format(rollupDayFormat) + "#")
+		cursor := tx.Bucket(boltEventDaysBucket).Cursor()
+		for key, stored := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, stored = cursor.Next() {
+			raw := bucket.Get(stored)
+			if raw == nil {
+				continue
+			}
+			event := &typesend_schemas.TypeSendEvent{}
+			if err := json.Unmarshal(raw, event); err != nil {
+				return err
+			}
+			events = append(events, loadedEvent(event))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (db *BoltTypeSendDB) PutRollups(_ context.Context, rollups []*typesend_schemas.TypeSendRollup) error {
+	stored, err := storedRollups(rollups)
+	if err != nil {
+		return err
+	}
+	if db.db == nil {
+		return fmt.Errorf("typesend: PutRollups requires a connection")
+	}
+
+	err = db.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltRollupsBucket)
+		for _, rollup := range stored {
+			if err := putJSON(bucket, rollupKey(rollup), rollup); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put rollups: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetRollups(_ context.Context, query typesend_schemas.TypeSendRollupQuery) ([]*typesend_schemas.TypeSendRollup, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetRollups requires a connection")
+	}
+
+	var rollups []*typesend_schemas.TypeSendRollup
+	err := db.db.View(func(tx *bolt.Tx) error {
+		// Keys sort by day, so start at From and stop after To.
+		prefix := []byte(fmt.Sprintf("rollup#%s#", query.AppID))
+		start := append(bytes.Clone(prefix), typesend_schemas.RollupDay(query.From).Format(rollupDayFormat)...)
+		end := append(bytes.Clone(prefix), typesend_schemas.RollupDay(query.To).AddDate(0, 0, 1).Format(rollupDayFormat)...)
+
+		cursor := tx.Bucket(boltRollupsBucket).Cursor()
+		for key, raw := cursor.Seek(start); key != nil && bytes.Compare(key, end) < 0; key, raw = cursor.Next() {
+			rollup := &typesend_schemas.TypeSendRollup{}
+			if err := json.Unmarshal(raw, rollup); err != nil {
+				return err
+			}
+			if query.Matches(rollup) {
+				rollups = append(rollups, loadedRollup(rollup))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get rollups: %w", err)
+	}
+	sortRollups(rollups)
+	return rollups, nil
+}
+
+func getSchedule(tx *bolt.Tx, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	raw := tx.Bucket(boltSchedulesBucket).Get([]byte(scheduleID))
+	if raw == nil {
+		return nil, nil
+	}
+
+	var schedule typesend_schemas.TypeSendSchedule
+	if err := json.Unmarshal(raw, &schedule); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+func (db *BoltTypeSendDB) InsertSchedule(_ context.Context, schedule *typesend_schemas.TypeSendSchedule) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: InsertSchedule requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltSchedulesBucket), schedule.ID, schedule)
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetScheduleByID(_ context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetScheduleByID requires a connection")
+	}
+
+	var schedule *typesend_schemas.TypeSendSchedule
+	err := db.db.View(func(tx *bolt.Tx) error {
+		var err error
+		schedule, err = getSchedule(tx, scheduleID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func (db *BoltTypeSendDB) UpdateScheduleState(_ context.Context, scheduleID string, state typesend_schemas.TypeSendScheduleState, nextRunAt time.Time) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: UpdateScheduleState requires a connection")
+	}
+
+	return db.db.Update(func(tx *bolt.Tx) error {
+		schedule, err := getSchedule(tx, scheduleID)
+		if err != nil {
+			return err
+		}
+		if schedule == nil {
+			return fmt.Errorf("typesend: schedule with ID %s not found", scheduleID)
+		}
+
+		schedule.State = state
+		if !nextRunAt.IsZero() {
+			schedule.NextRunAt = nextRunAt
+		}
+		return putJSON(tx.Bucket(boltSchedulesBucket), scheduleID, schedule)
+	})
+}
+
+func (db *BoltTypeSendDB) DeleteSchedule(_ context.Context, scheduleID string) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: DeleteSchedule requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSchedulesBucket).Delete([]byte(scheduleID))
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *BoltTypeSendDB) GetSchedulesDue(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendSchedule, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetSchedulesDue requires a connection")
+	}
+
+	due := make([]*typesend_schemas.TypeSendSchedule, 0)
+	err := db.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltSchedulesBucket).ForEach(func(_, raw []byte) error {
+			var schedule typesend_schemas.TypeSendSchedule
+			if err := json.Unmarshal(raw, &schedule); err != nil {
+				return err
+			}
+			if schedule.State == typesend_schemas.TypeSendScheduleState_ACTIVE && !schedule.NextRunAt.After(timestamp) {
+				due = append(due, &schedule)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to read schedules: %w", err)
+	}
+
+	ch := make(chan *typesend_schemas.TypeSendSchedule)
+	go func() {
+		defer close(ch)
+		for _, schedule := range due {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- schedule:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (db *BoltTypeSendDB) AdvanceSchedule(_ context.Context, scheduleID string, from time.Time, next time.Time) (bool, error) {
+	if db.db == nil {
+		return false, fmt.Errorf("typesend: AdvanceSchedule requires a connection")
+	}
+
+	advanced := false
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		schedule, err := getSchedule(tx, scheduleID)
+		if err != nil {
+			return err
+		}
+		if schedule == nil || schedule.State != typesend_schemas.TypeSendScheduleState_ACTIVE || !schedule.NextRunAt.Equal(from) {
+			return nil
+		}
+
+		if next.IsZero() {
+			schedule.State = typesend_schemas.TypeSendScheduleState_COMPLETED
+		} else {
+			schedule.NextRunAt = next
+		}
+
+		advanced = true
+		return putJSON(tx.Bucket(boltSchedulesBucket), scheduleID, schedule)
+	})
+	if err != nil {
+		return false, fmt.Errorf("typesend: failed to advance schedule: %w", err)
+	}
+	return advanced, nil
+}
+
+// boltTemplate mirrors TypeSendTemplate with every field tagged,
+// as the template hides TenantID and Content from JSON.
+type boltTemplate struct {
+	TemplateID           string                            `json:"id"`
+	TenantID             string                            `json:"tenant"`
+	Content              string                            `json:"content"`
+	Subject              string                            `json:"subject"`
+	FromAddress          string                            `json:"from"`
+	FromName             string                            `json:"from_name"`
+	Transactional        bool                              `json:"transactional"`
+	OmitListUnsubscribe  bool                              `json:"omitListUnsubscribe"`
+	Category             string                            `json:"category,omitempty"`
+	Sensitive            bool                              `json:"sensitive"`
+	EnableTracking       bool                              `json:"enableTracking"`
+	DisableOpenTracking  bool                              `json:"disableOpenTracking"`
+	DisableClickTracking bool                              `json:"disableClickTracking"`
+	Priority             typesend_schemas.TypeSendPriority `json:"priority"`
+	DigestWindow         time.Duration                     `json:"digestWindow"`
+}
+
+func boltTemplateKey(templateID string, tenantID string) []byte {
+	return []byte(fmt.Sprintf("%s#%s", tenantID, templateID))
+}
+
+func (db *BoltTypeSendDB) GetTemplateByID(_ context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
+	if db.db == nil {
+		return nil, fmt.Errorf("typesend: GetTemplateByID requires a connection")
+	}
+
+	var stored *boltTemplate
+	err := db.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltTemplatesBucket)
+
+		raw := bucket.Get(boltTemplateKey(templateID, tenantID))
+		if raw == nil && tenantID != "base" {
+			raw = bucket.Get(boltTemplateKey(templateID, "base"))
+		}
+		if raw == nil {
+			return nil
+		}
+
+		stored = &boltTemplate{}
+		return json.Unmarshal(raw, stored)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get template: %w", err)
+	}
+
+	if stored == nil {
+		return nil, nil
+	}
+
+	return &typesend_schemas.TypeSendTemplate{
+		TemplateID:           stored.TemplateID,
+		TenantID:             stored.TenantID,
+		Content:              stored.Content,
+		Subject:              stored.Subject,
+		FromAddress:          stored.FromAddress,
+		FromName:             stored.FromName,
+		Transactional:        stored.Transactional,
+		OmitListUnsubscribe:  stored.OmitListUnsubscribe,
+		Category:             stored.Category,
+		Sensitive:            stored.Sensitive,
+		EnableTracking:       stored.EnableTracking,
+		DisableOpenTracking:  stored.DisableOpenTracking,
+		DisableClickTracking: stored.DisableClickTracking,
+		Priority:             stored.Priority,
+		DigestWindow:         stored.DigestWindow,
+	}, nil
+}
+
+// InsertTemplate replaces any existing template with the same ID and tenant.
+func (db *BoltTypeSendDB) InsertTemplate(_ context.Context, template *typesend_schemas.TypeSendTemplate) error {
+	if db.db == nil {
+		return fmt.Errorf("typesend: InsertTemplate requires a connection")
+	}
+
+	err := db.db.Update(func(tx *bolt.Tx) error {
+		return putJSON(tx.Bucket(boltTemplatesBucket), string(boltTemplateKey(template.TemplateID, template.TenantID)), &boltTemplate{
+			TemplateID:           template.TemplateID,
+			TenantID:             template.TenantID,
+			Content:              template.Content,
+			Subject:              template.Subject,
+			FromAddress:          template.FromAddress,
+			FromName:             template.FromName,
+			Transactional:        template.Transactional,
+			OmitListUnsubscribe:  template.OmitListUnsubscribe,
+			Category:             template.Category,
+			Sensitive:            template.Sensitive,
+			EnableTracking:       template.EnableTracking,
+			DisableOpenTracking:  template.DisableOpenTracking,
+			DisableClickTracking: template.DisableClickTracking,
+			Priority:             template.Priority,
+			DigestWindow:         template.DigestWindow,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert template: %w", err)
+	}
+	return nil
+}
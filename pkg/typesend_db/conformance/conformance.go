@@ -0,0 +1,1656 @@
+// Package conformance checks that a TypeSendDatabase implementation
+// behaves like every other one.
+//
+//	func TestMyDatabase_Conformance(t *testing.T) {
+//		conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+//			return newMyDatabase(t)
+//		})
+//	}
+//
+// Subtests only look at the envelopes, schedules, templates and keys
+// they created, so newDB may hand back databases sharing storage.
+package conformance
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// How many goroutines the concurrency subtests run at once.
+const concurrency = 20
+
+// How long a cancelled stream has to close its channel.
+const closeTimeout = 5 * time.Second
+
+// Run runs the suite. newDB returns a connected database and
+// registers any cleanup it needs with t.
+func Run(t *testing.T, newDB func(t *testing.T) typesend_db.TypeSendDatabase) {
+	// Truncated, as not every backend keeps nanoseconds.
+	now := time.Now().UTC().Truncate(time.Second)
+
+	t.Run("InsertAndGetEnvelopeByID", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelope := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		envelope.TenantID = "tenant"
+		envelope.ToName = "Test"
+		envelope.ReferenceID = "ref"
+		envelope.Variables = map[string]interface{}{"Name": "Test"}
+		envelope.Priority = typesend_schemas.TypeSendPriority_HIGH
+		envelope.ScheduleID = "schedule"
+		envelope.DigestOf = []string{"a", "b"}
+		envelope.TimeZone = "America/New_York"
+		envelope.QuietHours = &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"}
+		envelope.Sealed = newSealed()
+		envelope.OriginalScheduledFor = now.Add(-time.Hour)
+		envelope.ContentExpiresAt = now.Add(24 * time.Hour).Unix()
+		envelope.ExpiresAt = now.Add(48 * time.Hour).Unix()
+		assert.NoError(t, db.Insert(envelope))
+
+		got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+		assert.NoError(t, err)
+		if !assert.NotNil(t, got) {
+			return
+		}
+		assert.Equal(t, envelope.AppID, got.AppID)
+		assert.Equal(t, envelope.TenantID, got.TenantID)
+		assert.Equal(t, envelope.ToAddress, got.ToAddress)
+		assert.Equal(t, envelope.ToInternalID, got.ToInternalID)
+		assert.Equal(t, envelope.ToName, got.ToName)
+		assert.Equal(t, envelope.MessageGroupID, got.MessageGroupID)
+		assert.Equal(t, envelope.TemplateID, got.TemplateID)
+		assert.Equal(t, envelope.ReferenceID, got.ReferenceID)
+		assert.Equal(t, envelope.Status, got.Status)
+		assert.Equal(t, "Test", got.Variables["Name"])
+		assert.Equal(t, envelope.Priority, got.Priority)
+		assert.Equal(t, envelope.ScheduleID, got.ScheduleID)
+		assert.Equal(t, envelope.DigestOf, got.DigestOf)
+		assert.Equal(t, envelope.TimeZone, got.TimeZone)
+		assert.Equal(t, envelope.QuietHours, got.QuietHours)
+		assert.Equal(t, envelope.Sealed, got.Sealed)
+		assert.True(t, envelope.ScheduledFor.Equal(got.ScheduledFor))
+		assert.True(t, envelope.OriginalScheduledFor.Equal(got.OriginalScheduledFor))
+		assert.Equal(t, envelope.ContentExpiresAt, got.ContentExpiresAt)
+		assert.Equal(t, envelope.ExpiresAt, got.ExpiresAt)
+	})
+
+	t.Run("GetEnvelopeByIDNotFound", func(t *testing.T) {
+		db := newDB(t)
+
+		got, err := db.GetEnvelopeByID(context.Background(), uuid.NewString())
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetMessagesReadyToSend", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		ready := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+		due := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		future := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(time.Hour))
+		delivering := newEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, now.Add(-time.Minute))
+		sent := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now.Add(-time.Minute))
+		failed := newEnvelope(typesend_schemas.TypeSendStatus_FAILED, now.Add(-time.Minute))
+		envelopes := []*typesend_schemas.TypeSendEnvelope{ready, due, future, delivering, sent, failed}
+		for _, envelope := range envelopes {
+			assert.NoError(t, db.Insert(envelope))
+		}
+
+		ch, err := db.GetMessagesReadyToSend(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{ready.ID, due.ID}, readyIDs(ch, envelopes), "only UNSENT envelopes scheduled at or before the timestamp are ready")
+	})
+
+	t.Run("GetMessagesReadyToSendOrdering", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		// Inserted newest first, so insertion order can't pass for ordering.
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 5)
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Duration(i+1)*time.Minute))
+			assert.NoError(t, db.Insert(envelopes[i]))
+		}
+
+		expected := make([]string, 0, len(envelopes))
+		for i := len(envelopes) - 1; i >= 0; i-- {
+			expected = append(expected, envelopes[i].ID)
+		}
+
+		ch, err := db.GetMessagesReadyToSend(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, readyIDs(ch, envelopes), "the longest waiting envelopes should come first")
+	})
+
+	t.Run("GetMessagesReadyToSendByPriority", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		lanes := map[typesend_schemas.TypeSendPriority]*typesend_schemas.TypeSendEnvelope{}
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 0)
+		for _, priority := range []typesend_schemas.TypeSendPriority{
+			typesend_schemas.TypeSendPriority_DEFAULT,
+			typesend_schemas.TypeSendPriority_HIGH,
+			typesend_schemas.TypeSendPriority_NORMAL,
+			typesend_schemas.TypeSendPriority_LOW,
+		} {
+			scheduledFor := now.Add(-time.Minute)
+			if priority == typesend_schemas.TypeSendPriority_DEFAULT {
+				// The NORMAL lane is read in ScheduledFor order too.
+				scheduledFor = now.Add(-2 * time.Minute)
+			}
+			envelope := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, scheduledFor)
+			envelope.Priority = priority
+			assert.NoError(t, db.Insert(envelope))
+			lanes[priority] = envelope
+			envelopes = append(envelopes, envelope)
+		}
+
+		// Envelopes leave their lane once they are no longer UNSENT.
+		dispatched := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+		dispatched.Priority = typesend_schemas.TypeSendPriority_HIGH
+		digested := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+		assert.NoError(t, db.Insert(dispatched))
+		assert.NoError(t, db.Insert(digested))
+		envelopes = append(envelopes, dispatched, digested)
+		assert.NoError(t, db.UpdateEnvelopeStatus(ctx, dispatched.ID, typesend_schemas.TypeSendStatus_DELIVERING))
+		linked, err := db.LinkEnvelopesToDigest(ctx, uuid.NewString(), []string{digested.ID})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{digested.ID}, linked)
+
+		high, err := db.GetMessagesReadyToSendByPriority(ctx, now, typesend_schemas.TypeSendPriority_HIGH)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{lanes[typesend_schemas.TypeSendPriority_HIGH].ID}, readyIDs(high, envelopes))
+
+		normal, err := db.GetMessagesReadyToSendByPriority(ctx, now, typesend_schemas.TypeSendPriority_NORMAL)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{
+			lanes[typesend_schemas.TypeSendPriority_DEFAULT].ID,
+			lanes[typesend_schemas.TypeSendPriority_NORMAL].ID,
+		}, readyIDs(normal, envelopes), "DEFAULT envelopes belong to the NORMAL lane")
+
+		low, err := db.GetMessagesReadyToSendByPriority(ctx, now, typesend_schemas.TypeSendPriority_LOW)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{lanes[typesend_schemas.TypeSendPriority_LOW].ID}, readyIDs(low, envelopes))
+	})
+
+	t.Run("GetMessagesReadyToSendCancelled", func(t *testing.T) {
+		db := newDB(t)
+
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 5)
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+			assert.NoError(t, db.Insert(envelopes[i]))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Either refusing outright or streaming nothing is fine.
+		ch, err := db.GetMessagesReadyToSend(ctx, now)
+		if err == nil {
+			assert.Empty(t, readyIDs(ch, envelopes), "a cancelled context should not stream envelopes")
+		}
+	})
+
+	t.Run("GetMessagesReadyToSendCancelledMidStream", func(t *testing.T) {
+		db := newDB(t)
+
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 5)
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+			assert.NoError(t, db.Insert(envelopes[i]))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch, err := db.GetMessagesReadyToSend(ctx, now)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		select {
+		case _, ok := <-ch:
+			assert.True(t, ok, "ready envelopes should be streamed")
+		case <-time.After(closeTimeout):
+			t.Fatal("timed out waiting for the first envelope")
+		}
+
+		// The consumer walks away; the stream must notice and close.
+		cancel()
+		deadline := time.After(closeTimeout)
+		for {
+			select {
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+			case <-deadline:
+				t.Fatal("the channel should close once the context is cancelled")
+			}
+		}
+	})
+
+	t.Run("UpdateEnvelopeStatus", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelope := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		assert.NoError(t, db.Insert(envelope))
+
+		assert.NoError(t, db.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_DELIVERING))
+		got, _ := db.GetEnvelopeByID(ctx, envelope.ID)
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+
+		missing := uuid.NewString()
+		assert.Error(t, db.UpdateEnvelopeStatus(ctx, missing, typesend_schemas.TypeSendStatus_SENT), "missing envelopes should error")
+		got, err := db.GetEnvelopeByID(ctx, missing)
+		assert.NoError(t, err)
+		assert.Nil(t, got, "updating a missing envelope should not create it")
+	})
+
+	t.Run("UpdateEnvelopeStatuses", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		first := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		second := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		assert.NoError(t, db.Insert(first))
+		assert.NoError(t, db.Insert(second))
+
+		errs := db.UpdateEnvelopeStatuses(ctx, []string{first.ID, uuid.NewString(), second.ID}, typesend_schemas.TypeSendStatus_DELIVERING)
+		assert.Len(t, errs, 3)
+		assert.NoError(t, errs[0])
+		assert.Error(t, errs[1])
+		assert.NoError(t, errs[2])
+
+		for _, envelopeID := range []string{first.ID, second.ID} {
+			got, _ := db.GetEnvelopeByID(ctx, envelopeID)
+			assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+		}
+	})
+
+	t.Run("ClaimEnvelopes", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		unsent := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		delivering := newEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, now)
+		sent := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now)
+		failed := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		envelopes := []*typesend_schemas.TypeSendEnvelope{unsent, delivering, sent, failed}
+		for _, envelope := range envelopes {
+			assert.NoError(t, db.Insert(envelope))
+		}
+		// Failed after it was inserted, as erasure does.
+		assert.NoError(t, db.UpdateEnvelopeStatus(ctx, failed.ID, typesend_schemas.TypeSendStatus_FAILED))
+
+		errs := db.ClaimEnvelopes(ctx, []string{unsent.ID, delivering.ID, sent.ID, failed.ID, uuid.NewString()})
+		if assert.Len(t, errs, 5) {
+			assert.NoError(t, errs[0])
+			assert.ErrorIs(t, errs[1], typesend_db.ErrNotUnsent)
+			assert.ErrorIs(t, errs[2], typesend_db.ErrNotUnsent)
+			assert.ErrorIs(t, errs[3], typesend_db.ErrNotUnsent)
+			assert.Error(t, errs[4])
+			assert.NotErrorIs(t, errs[4], typesend_db.ErrNotUnsent, "unknown envelopes are not skipped")
+		}
+
+		for envelopeID, status := range map[string]typesend_schemas.TypeSendStatus{
+			unsent.ID:     typesend_schemas.TypeSendStatus_DELIVERING,
+			delivering.ID: typesend_schemas.TypeSendStatus_DELIVERING,
+			sent.ID:       typesend_schemas.TypeSendStatus_SENT,
+			failed.ID:     typesend_schemas.TypeSendStatus_FAILED,
+		} {
+			got, err := db.GetEnvelopeByID(ctx, envelopeID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, got) {
+				assert.Equal(t, status, got.Status, "only UNSENT envelopes should be claimed")
+			}
+		}
+
+		for _, priority := range typesend_schemas.TypeSendPriorities {
+			ready, err := db.GetMessagesReadyToSendByPriority(ctx, now, priority)
+			assert.NoError(t, err)
+			assert.Empty(t, readyIDs(ready, envelopes), "claimed envelopes must leave the %s lane", priority)
+		}
+	})
+
+	t.Run("InsertIdempotent", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		key := uuid.NewString()
+
+		original := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		id, err := db.InsertIdempotent(ctx, original, key, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, id)
+
+		repeat := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		id, err = db.InsertIdempotent(ctx, repeat, key, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, id, "a repeat should return the original envelope")
+
+		got, _ := db.GetEnvelopeByID(ctx, repeat.ID)
+		assert.Nil(t, got, "a repeat should not be inserted")
+
+		otherTenant := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		otherTenant.TenantID = uuid.NewString()
+		id, err = db.InsertIdempotent(ctx, otherTenant, key, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, otherTenant.ID, id, "keys should be scoped per tenant")
+	})
+
+	t.Run("InsertIdempotentExpired", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		key := uuid.NewString()
+
+		original := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		_, err := db.InsertIdempotent(ctx, original, key, now.Add(-time.Minute))
+		assert.NoError(t, err)
+
+		later := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		id, err := db.InsertIdempotent(ctx, later, key, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, later.ID, id, "an expired key should be claimable again")
+	})
+
+	t.Run("InsertBatch", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 30)
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		}
+
+		errs := db.InsertBatch(ctx, envelopes)
+		assert.Len(t, errs, len(envelopes))
+		for i, envelope := range envelopes {
+			assert.NoError(t, errs[i])
+			got, _ := db.GetEnvelopeByID(ctx, envelope.ID)
+			assert.NotNil(t, got)
+		}
+	})
+
+	t.Run("DeferEnvelope", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelope := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		envelope.ContentExpiresAt = now.Add(24 * time.Hour).Unix()
+		envelope.ExpiresAt = now.Add(30 * 24 * time.Hour).Unix()
+		assert.NoError(t, db.Insert(envelope))
+
+		until := now.Add(8 * time.Hour)
+		assert.NoError(t, db.DeferEnvelope(ctx, envelope, until))
+
+		got, _ := db.GetEnvelopeByID(ctx, envelope.ID)
+		assert.True(t, until.Equal(got.ScheduledFor))
+		assert.True(t, now.Equal(got.OriginalScheduledFor))
+		assert.Equal(t, until.Add(24*time.Hour).Unix(), got.ContentExpiresAt, "retention should run from the new time")
+		assert.Equal(t, until.Add(30*24*time.Hour).Unix(), got.ExpiresAt, "retention should run from the new time")
+
+		// Deferring again keeps the original time.
+		later := until.Add(time.Hour)
+		assert.NoError(t, db.DeferEnvelope(ctx, got, later))
+		got, _ = db.GetEnvelopeByID(ctx, envelope.ID)
+		assert.True(t, later.Equal(got.ScheduledFor))
+		assert.True(t, now.Equal(got.OriginalScheduledFor))
+		assert.Equal(t, later.Add(30*24*time.Hour).Unix(), got.ExpiresAt)
+
+		unretained := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		assert.NoError(t, db.Insert(unretained))
+		assert.NoError(t, db.DeferEnvelope(ctx, unretained, until))
+		got, _ = db.GetEnvelopeByID(ctx, unretained.ID)
+		assert.Zero(t, got.ExpiresAt, "envelopes without retention should still never expire")
+		assert.Zero(t, got.ContentExpiresAt)
+
+		ch, err := db.GetMessagesReadyToSend(ctx, now)
+		assert.NoError(t, err)
+		assert.Empty(t, readyIDs(ch, []*typesend_schemas.TypeSendEnvelope{envelope}), "a deferred envelope should wait until its new time")
+
+		sent := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now)
+		assert.NoError(t, db.Insert(sent))
+		assert.Error(t, db.DeferEnvelope(ctx, sent, until), "only UNSENT envelopes can be deferred")
+	})
+
+	t.Run("LinkEnvelopesToDigest", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		digestID := uuid.NewString()
+
+		unsent := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		delivering := newEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, now)
+		assert.NoError(t, db.Insert(unsent))
+		assert.NoError(t, db.Insert(delivering))
+
+		linked, err := db.LinkEnvelopesToDigest(ctx, digestID, []string{unsent.ID, delivering.ID, uuid.NewString()})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{unsent.ID}, linked)
+
+		got, _ := db.GetEnvelopeByID(ctx, unsent.ID)
+		assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status)
+		assert.Equal(t, digestID, got.DigestID)
+
+		got, _ = db.GetEnvelopeByID(ctx, delivering.ID)
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+		assert.Empty(t, got.DigestID)
+	})
+
+	t.Run("ConsumeRateLimit", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		key := "tenant#test#" + uuid.NewString()
+
+		window := now.Truncate(time.Minute)
+		for i := 0; i < 2; i++ {
+			ok, err := db.ConsumeRateLimit(ctx, key, window, time.Minute, 2)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+
+		ok, err := db.ConsumeRateLimit(ctx, key, window, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.False(t, ok, "the window should be full")
+
+		ok, err = db.ConsumeRateLimit(ctx, key, window.Add(time.Minute), time.Minute, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok, "the next window should start empty")
+
+		ok, err = db.ConsumeRateLimit(ctx, key+"#other", window, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok, "keys should be counted independently")
+
+		assert.NoError(t, db.ReleaseRateLimit(ctx, key, window))
+		ok, err = db.ConsumeRateLimit(ctx, key, window, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok, "a released slot should be taken again")
+		ok, err = db.ConsumeRateLimit(ctx, key, window, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.False(t, ok, "only the released slot should be free")
+
+		empty := key + "#empty"
+		assert.NoError(t, db.ReleaseRateLimit(ctx, empty, window), "releasing an unknown window should be harmless")
+		ok, err = db.ConsumeRateLimit(ctx, empty, window, time.Minute, 1)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, db.ReleaseRateLimit(ctx, empty, window))
+		assert.NoError(t, db.ReleaseRateLimit(ctx, empty, window), "counts should not go below zero")
+		ok, err = db.ConsumeRateLimit(ctx, empty, window, time.Minute, 1)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		ok, err = db.ConsumeRateLimit(ctx, empty, window, time.Minute, 1)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("PurgeExpiredData", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		expiring := func(status typesend_schemas.TypeSendStatus, contentExpiresAt time.Time, expiresAt time.Time) *typesend_schemas.TypeSendEnvelope {
+			envelope := newEnvelope(status, now.Add(-72*time.Hour))
+			envelope.ToName = "Test"
+			envelope.Variables = map[string]interface{}{"Name": "Test"}
+			envelope.DigestOf = []string{"a"}
+			envelope.QuietHours = &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"}
+			envelope.Sealed = newSealed()
+			if !contentExpiresAt.IsZero() {
+				envelope.ContentExpiresAt = contentExpiresAt.Unix()
+			}
+			if !expiresAt.IsZero() {
+				envelope.ExpiresAt = expiresAt.Unix()
+			}
+			assert.NoError(t, db.Insert(envelope))
+			return envelope
+		}
+
+		stripped := expiring(typesend_schemas.TypeSendStatus_SENT, now.Add(-time.Hour), now.Add(time.Hour))
+		deleted := expiring(typesend_schemas.TypeSendStatus_SENT, now.Add(-2*time.Hour), now.Add(-time.Hour))
+		failed := expiring(typesend_schemas.TypeSendStatus_FAILED, time.Time{}, now.Add(-time.Hour))
+		suppressed := expiring(typesend_schemas.TypeSendStatus_SUPPRESSED, time.Time{}, now.Add(-time.Hour))
+		unsent := expiring(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-2*time.Hour), now.Add(-time.Hour))
+		fresh := expiring(typesend_schemas.TypeSendStatus_SENT, now.Add(time.Hour), now.Add(2*time.Hour))
+		forever := expiring(typesend_schemas.TypeSendStatus_SENT, time.Time{}, time.Time{})
+
+		result, err := db.PurgeExpiredData(ctx, now)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, result.Stripped, 1)
+		assert.GreaterOrEqual(t, result.Deleted, 2)
+
+		got, err := db.GetEnvelopeByID(ctx, stripped.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got, "the audit record should outlive its content") {
+			assert.Nil(t, got.Variables)
+			assert.Empty(t, got.ToName)
+			assert.Empty(t, got.DigestOf)
+			assert.Nil(t, got.QuietHours)
+			assert.Nil(t, got.Sealed)
+			assert.Zero(t, got.ContentExpiresAt)
+			assert.Equal(t, stripped.ExpiresAt, got.ExpiresAt)
+			assert.Equal(t, stripped.ToAddress, got.ToAddress)
+			assert.Equal(t, stripped.TemplateID, got.TemplateID)
+			assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status)
+		}
+
+		for _, envelope := range []*typesend_schemas.TypeSendEnvelope{deleted, failed, suppressed} {
+			got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+			assert.NoError(t, err)
+			assert.Nil(t, got, "finished envelopes past their retention should be deleted")
+		}
+
+		for _, envelope := range []*typesend_schemas.TypeSendEnvelope{unsent, fresh, forever} {
+			got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, got) {
+				assert.Equal(t, "Test", got.Variables["Name"], "envelope %s should be left alone", envelope.ID)
+			}
+		}
+
+		// Purging an expired key must not stop it being claimed again.
+		key := uuid.NewString()
+		_, err = db.InsertIdempotent(ctx, newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now), key, now.Add(-time.Minute))
+		assert.NoError(t, err)
+		_, err = db.PurgeExpiredData(ctx, now)
+		assert.NoError(t, err)
+		later := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		id, err := db.InsertIdempotent(ctx, later, key, now.Add(time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, later.ID, id)
+	})
+
+	t.Run("Suppressions", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		appID := uuid.NewString()
+		missing, err := db.GetSuppression(ctx, appID, "tenant", "test@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+
+		assert.Error(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{AppID: appID, TenantID: "tenant", Address: "test@example.com"}), "a reason is required")
+
+		assert.NoError(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+			AppID:     appID,
+			TenantID:  "tenant",
+			Address:   " Test@Example.com ",
+			Reason:    typesend_schemas.TypeSendSuppressionReason_BOUNCED,
+			Note:      "550 mailbox unavailable",
+			CreatedAt: now,
+		}))
+
+		got, err := db.GetSuppression(ctx, appID, "tenant", "test@example.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, got, "addresses should be matched case insensitively") {
+			assert.Equal(t, appID, got.AppID)
+			assert.Equal(t, "tenant", got.TenantID)
+			assert.Equal(t, "test@example.com", got.Address)
+			assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, got.Reason)
+			assert.Equal(t, "550 mailbox unavailable", got.Note)
+			assert.True(t, now.Equal(got.CreatedAt))
+		}
+
+		other, err := db.GetSuppression(ctx, appID, "other", "test@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, other, "suppressions are scoped to the tenant")
+
+		assert.NoError(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+			AppID:    appID,
+			TenantID: "tenant",
+			Address:  "test@example.com",
+			Reason:   typesend_schemas.TypeSendSuppressionReason_COMPLAINED,
+		}))
+		got, err = db.GetSuppression(ctx, appID, "tenant", "TEST@example.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, got.Reason, "a later suppression should replace the earlier")
+			assert.Empty(t, got.Note)
+		}
+
+		assert.NoError(t, db.DeleteSuppression(ctx, appID, "tenant", "Test@example.com"))
+		got, err = db.GetSuppression(ctx, appID, "tenant", "test@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+		assert.NoError(t, db.DeleteSuppression(ctx, appID, "tenant", "test@example.com"), "lifting a missing suppression is not an error")
+	})
+
+	t.Run("Categories", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		appID := uuid.NewString()
+		missing, err := db.GetCategories(ctx, appID)
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+
+		assert.Error(t, db.PutCategories(ctx, appID, []*typesend_schemas.TypeSendCategory{{ID: "billing"}}), "a name is required")
+		assert.Error(t, db.PutCategories(ctx, appID, []*typesend_schemas.TypeSendCategory{
+			{ID: "billing", Name: "Billing"},
+			{ID: "billing", Name: "Invoices"},
+		}), "IDs must be unique")
+
+		categories := []*typesend_schemas.TypeSendCategory{
+			{ID: "security", Name: "Security alerts", Mandatory: true},
+			{ID: "product-updates", Name: "Product updates", Description: "New features, monthly"},
+			{ID: "billing", Name: "Billing"},
+		}
+		assert.NoError(t, db.PutCategories(ctx, appID, categories))
+
+		got, err := db.GetCategories(ctx, appID)
+		assert.NoError(t, err)
+		assert.Equal(t, categories, got, "categories should keep their order")
+
+		other, err := db.GetCategories(ctx, uuid.NewString())
+		assert.NoError(t, err)
+		assert.Nil(t, other, "categories are scoped to the app")
+
+		assert.NoError(t, db.PutCategories(ctx, appID, categories[1:2]))
+		got, err = db.GetCategories(ctx, appID)
+		assert.NoError(t, err)
+		assert.Equal(t, categories[1:2], got, "a later put should replace every category")
+	})
+
+	t.Run("Preferences", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		appID := uuid.NewString()
+		missing, err := db.GetPreferences(ctx, appID, "tenant", "test@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+
+		assert.Error(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{AppID: appID, TenantID: "tenant"}), "an address is required")
+
+		assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+			AppID:     appID,
+			TenantID:  "tenant",
+			Address:   " Test@Example.com ",
+			OptedOut:  []string{"product-updates", "billing", "product-updates"},
+			UpdatedAt: now,
+		}))
+
+		got, err := db.GetPreferences(ctx, appID, "tenant", "test@example.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, got, "addresses should be matched case insensitively") {
+			assert.Equal(t, appID, got.AppID)
+			assert.Equal(t, "tenant", got.TenantID)
+			assert.Equal(t, "test@example.com", got.Address)
+			assert.Equal(t, []string{"billing", "product-updates"}, got.OptedOut, "opt outs should be sorted and deduplicated")
+			assert.True(t, now.Equal(got.UpdatedAt))
+		}
+
+		other, err := db.GetPreferences(ctx, appID, "other", "test@example.com")
+		assert.NoError(t, err)
+		assert.Nil(t, other, "preferences are scoped to the tenant")
+
+		assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+			AppID:    appID,
+			TenantID: "tenant",
+			Address:  "test@example.com",
+		}))
+		got, err = db.GetPreferences(ctx, appID, "tenant", "TEST@example.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Nil(t, got.OptedOut, "later preferences should replace the earlier")
+			assert.False(t, got.UpdatedAt.IsZero())
+		}
+	})
+
+	t.Run("RecipientStates", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		appID := uuid.NewString()
+		assert.NoError(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+			AppID:     appID,
+			TenantID:  "tenant",
+			Address:   "suppressed@example.com",
+			Reason:    typesend_schemas.TypeSendSuppressionReason_BOUNCED,
+			CreatedAt: now,
+		}))
+		assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+			AppID:     appID,
+			TenantID:  "tenant",
+			Address:   "opted@example.com",
+			OptedOut:  []string{"billing"},
+			UpdatedAt: now,
+		}))
+
+		states, err := db.GetRecipientStates(ctx, []typesend_db.RecipientKey{
+			{AppID: appID, TenantID: "tenant", Address: " Suppressed@Example.com "},
+			{AppID: appID, TenantID: "tenant", Address: "opted@example.com"},
+			{AppID: appID, TenantID: "tenant", Address: "missing@example.com"},
+			{AppID: appID, TenantID: "other", Address: "suppressed@example.com"},
+			{AppID: appID, TenantID: "tenant", Address: "suppressed@example.com"},
+		})
+		assert.NoError(t, err)
+		if !assert.Len(t, states, 5, "states should line up with keys") {
+			return
+		}
+
+		if assert.NotNil(t, states[0].Suppression, "addresses should be matched case insensitively") {
+			assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, states[0].Suppression.Reason)
+			assert.True(t, now.Equal(states[0].Suppression.CreatedAt))
+		}
+		assert.Nil(t, states[0].Preferences)
+
+		assert.Nil(t, states[1].Suppression)
+		if assert.NotNil(t, states[1].Preferences) {
+			assert.Equal(t, []string{"billing"}, states[1].Preferences.OptedOut)
+		}
+
+		assert.Equal(t, typesend_db.RecipientState{}, states[2])
+		assert.Equal(t, typesend_db.RecipientState{}, states[3], "states are scoped to the tenant")
+		assert.NotNil(t, states[4].Suppression, "repeated keys should each get a state")
+
+		erasedAddress := uuid.NewString() + "@example.com"
+		erasedID := uuid.NewString()
+		_, err = db.EraseRecipient(ctx, typesend_schemas.TypeSendRecipient{ToAddress: erasedAddress, ToInternalID: erasedID}, now)
+		assert.NoError(t, err)
+
+		erased, err := db.GetRecipientStates(ctx, []typesend_db.RecipientKey{
+			{AppID: appID, TenantID: "tenant", Address: strings.ToUpper(erasedAddress)},
+			{AppID: appID, TenantID: "tenant", Address: "fresh@example.com", ToInternalID: erasedID},
+			{AppID: appID, TenantID: "tenant", Address: "fresh@example.com"},
+		})
+		assert.NoError(t, err)
+		if assert.Len(t, erased, 3) {
+			if assert.NotNil(t, erased[0].Tombstone, "erased addresses should be matched case insensitively") {
+				assert.True(t, now.Equal(erased[0].Tombstone.ErasedAt))
+			}
+			assert.NotNil(t, erased[1].Tombstone, "erased internal IDs should match at any address")
+			assert.Nil(t, erased[2].Tombstone)
+		}
+
+		empty, err := db.GetRecipientStates(ctx, nil)
+		assert.NoError(t, err)
+		assert.Empty(t, empty)
+	})
+
+	t.Run("Timeline", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelopeID := uuid.NewString()
+		missing, err := db.GetEnvelopeTimeline(ctx, envelopeID)
+		assert.NoError(t, err)
+		assert.Empty(t, missing)
+
+		assert.Error(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{{EnvelopeID: envelopeID, ID: "bad"}}), "a type is required")
+
+		delivered := &typesend_schemas.TypeSendEvent{
+			EnvelopeID:        envelopeID,
+			ID:                "delivered",
+			AppID:             "app",
+			TenantID:          "tenant",
+			TemplateID:        "template",
+			Type:              typesend_schemas.TypeSendEventType_DELIVERED,
+			Provider:          "SendGrid",
+			ProviderMessageID: "message",
+			OccurredAt:        now,
+			Details:           map[string]string{"response": "250 OK"},
+		}
+		opened := &typesend_schemas.TypeSendEvent{
+			EnvelopeID: envelopeID,
+			ID:         "opened",
+			Type:       typesend_schemas.TypeSendEventType_OPENED,
+			Provider:   "SendGrid",
+			OccurredAt: now.Add(time.Minute),
+		}
+		// Recorded by TypeSend itself, without a provider.
+		queued := &typesend_schemas.TypeSendEvent{
+			EnvelopeID: envelopeID,
+			ID:         "queued",
+			Type:       typesend_schemas.TypeSendEventType_QUEUED,
+			OccurredAt: now.Add(-time.Minute),
+		}
+		other := &typesend_schemas.TypeSendEvent{
+			EnvelopeID: uuid.NewString(),
+			ID:         "delivered",
+			Type:       typesend_schemas.TypeSendEventType_DELIVERED,
+			OccurredAt: now,
+		}
+		// Appended out of order, to check they are sorted.
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{opened, delivered, other, queued}))
+
+		retried := *delivered
+		retried.Details = map[string]string{"response": "changed"}
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{&retried}))
+
+		events, err := db.GetEnvelopeTimeline(ctx, envelopeID)
+		assert.NoError(t, err)
+		if assert.Len(t, events, 3, "a repeated event should be stored once") {
+			assert.Equal(t, "queued", events[0].ID)
+			assert.Equal(t, typesend_schemas.TypeSendEventType_QUEUED, events[0].Type)
+			assert.Empty(t, events[0].Provider)
+			events = events[1:]
+
+			assert.Equal(t, "delivered", events[0].ID)
+			assert.Equal(t, envelopeID, events[0].EnvelopeID)
+			assert.Equal(t, "app", events[0].AppID)
+			assert.Equal(t, "tenant", events[0].TenantID)
+			assert.Equal(t, "template", events[0].TemplateID)
+			assert.Equal(t, typesend_schemas.TypeSendEventType_DELIVERED, events[0].Type)
+			assert.Equal(t, "SendGrid", events[0].Provider)
+			assert.Equal(t, "message", events[0].ProviderMessageID)
+			assert.True(t, now.Equal(events[0].OccurredAt))
+			assert.Equal(t, map[string]string{"response": "250 OK"}, events[0].Details, "the first event should be kept")
+
+			assert.Equal(t, "opened", events[1].ID)
+			assert.Nil(t, events[1].Details)
+		}
+	})
+
+	t.Run("EventsByDay", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		// Other subtests and runs may store events on the same
+		// day, so only this subtests envelopes are looked at.
+		day := typesend_schemas.RollupDay(now)
+		envelopeID := uuid.NewString()
+		newEvent := func(id string, occurredAt time.Time) *typesend_schemas.TypeSendEvent {
+			return &typesend_schemas.TypeSendEvent{
+				EnvelopeID: envelopeID,
+				ID:         id,
+				AppID:      "app",
+				Type:       typesend_schemas.TypeSendEventType_OPENED,
+				OccurredAt: occurredAt,
+			}
+		}
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+			newEvent("late", day.Add(24*time.Hour-time.Second)),
+			newEvent("yesterday", day.Add(-time.Second)),
+			newEvent("start", day),
+			newEvent("tomorrow", day.Add(24*time.Hour)),
+		}))
+
+		events, err := db.GetEventsByDay(ctx, day.Add(12*time.Hour))
+		assert.NoError(t, err)
+		var ids []string
+		for _, event := range events {
+			if event.EnvelopeID == envelopeID {
+				ids = append(ids, event.ID)
+			}
+		}
+		assert.Equal(t, []string{"start", "late"}, ids, "only the days events should be returned, oldest first")
+	})
+
+	t.Run("EventByProviderMessageID", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelopeID := uuid.NewString()
+		messageID := uuid.NewString()
+		newEvent := func(envelopeID string, id string, provider string, messageID string, occurredAt time.Time) *typesend_schemas.TypeSendEvent {
+			return &typesend_schemas.TypeSendEvent{
+				EnvelopeID:        envelopeID,
+				ID:                id,
+				AppID:             "app",
+				TenantID:          "tenant",
+				TemplateID:        "template",
+				Type:              typesend_schemas.TypeSendEventType_SENT,
+				Provider:          provider,
+				ProviderMessageID: messageID,
+				OccurredAt:        occurredAt,
+			}
+		}
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+			newEvent(envelopeID, "delivered", "SES", messageID, now.Add(time.Minute)),
+			newEvent(envelopeID, "sent", "SES", messageID, now),
+			newEvent(uuid.NewString(), "other", "SendGrid", messageID, now.Add(-time.Minute)),
+			newEvent(uuid.NewString(), "untracked", "SES", "", now.Add(-time.Minute)),
+		}))
+
+		event, err := db.GetEventByProviderMessageID(ctx, "SES", messageID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, event) {
+			assert.Equal(t, envelopeID, event.EnvelopeID)
+			assert.Equal(t, "sent", event.ID, "the oldest event should be returned")
+			assert.Equal(t, "app", event.AppID)
+			assert.Equal(t, "tenant", event.TenantID)
+			assert.Equal(t, "template", event.TemplateID)
+		}
+
+		event, err = db.GetEventByProviderMessageID(ctx, "Postmark", messageID)
+		assert.NoError(t, err)
+		assert.Nil(t, event, "another providers message IDs should not match")
+
+		event, err = db.GetEventByProviderMessageID(ctx, "SES", uuid.NewString())
+		assert.NoError(t, err)
+		assert.Nil(t, event)
+
+		event, err = db.GetEventByProviderMessageID(ctx, "SES", "")
+		assert.NoError(t, err)
+		assert.Nil(t, event, "events without a message ID should never match")
+	})
+
+	t.Run("Rollups", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		appID := uuid.NewString()
+		day := typesend_schemas.RollupDay(now)
+		query := typesend_schemas.TypeSendRollupQuery{AppID: appID, From: day, To: day.AddDate(0, 0, 1)}
+
+		missing, err := db.GetRollups(ctx, query)
+		assert.NoError(t, err)
+		assert.Empty(t, missing)
+
+		_, err = db.GetRollups(ctx, typesend_schemas.TypeSendRollupQuery{AppID: appID})
+		assert.Error(t, err, "a range is required")
+		assert.Error(t, db.PutRollups(ctx, []*typesend_schemas.TypeSendRollup{{AppID: appID, Day: now.Add(time.Hour)}}), "the day must be midnight")
+
+		newRollup := func(tenantID string, templateID string, day time.Time, sent int64) *typesend_schemas.TypeSendRollup {
+			return &typesend_schemas.TypeSendRollup{AppID: appID, TenantID: tenantID, TemplateID: templateID, Day: day, Sent: sent}
+		}
+		first := newRollup("tenant", "welcome", day, 1)
+		first.Delivered = 2
+		first.Bounced = 3
+		first.Opened = 4
+		first.UniqueOpens = 5
+		first.Clicked = 6
+		first.Complained = 7
+		first.UpdatedAt = now
+		assert.NoError(t, db.PutRollups(ctx, []*typesend_schemas.TypeSendRollup{
+			newRollup("tenant", "welcome", day.AddDate(0, 0, 1), 1),
+			newRollup("tenant", "reset", day, 1),
+			newRollup("other", "welcome", day, 1),
+			newRollup("tenant", "welcome", day.AddDate(0, 0, 2), 1),
+			newRollup("tenant", "welcome", day.AddDate(0, 0, -1), 1),
+			first,
+		}))
+
+		rollups, err := db.GetRollups(ctx, query)
+		assert.NoError(t, err)
+		if assert.Len(t, rollups, 4, "only days in the range should be returned") {
+			assert.Equal(t, "other", rollups[0].TenantID, "the first day should come first, ordered by tenant and template")
+			assert.Equal(t, "reset", rollups[1].TemplateID)
+			assert.Equal(t, first, rollups[2])
+			assert.Equal(t, day.AddDate(0, 0, 1), rollups[3].Day)
+			assert.False(t, rollups[3].UpdatedAt.IsZero())
+		}
+
+		replaced := newRollup("tenant", "welcome", day, 10)
+		assert.NoError(t, db.PutRollups(ctx, []*typesend_schemas.TypeSendRollup{replaced}))
+
+		query.TenantID = "tenant"
+		query.TemplateID = "welcome"
+		rollups, err = db.GetRollups(ctx, query)
+		assert.NoError(t, err)
+		if assert.Len(t, rollups, 2) {
+			assert.Equal(t, int64(10), rollups[0].Sent, "a later rollup should replace the earlier")
+			assert.Zero(t, rollups[0].Delivered)
+			assert.Equal(t, day.AddDate(0, 0, 1), rollups[1].Day)
+		}
+	})
+
+	t.Run("ExportRecipientData", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		recipient := newRecipient()
+
+		byAddress := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now)
+		byAddress.ToAddress = recipient.ToAddress
+		byAddress.Variables = map[string]interface{}{"Name": "Test"}
+		byInternalID := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(time.Hour))
+		byInternalID.ToAddress = "other-" + recipient.ToAddress
+		byInternalID.ToInternalID = recipient.ToInternalID
+		other := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now)
+		for _, envelope := range []*typesend_schemas.TypeSendEnvelope{byAddress, byInternalID, other} {
+			assert.NoError(t, db.Insert(envelope))
+		}
+
+		schedule := newSchedule(now)
+		schedule.ToAddress = recipient.ToAddress
+		assert.NoError(t, db.InsertSchedule(ctx, schedule))
+
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+			{EnvelopeID: byAddress.ID, ID: "bounced", Type: typesend_schemas.TypeSendEventType_BOUNCED, OccurredAt: now, Details: map[string]string{"reason": "550 " + recipient.ToAddress}},
+			{EnvelopeID: byInternalID.ID, ID: "queued", Type: typesend_schemas.TypeSendEventType_QUEUED, OccurredAt: now},
+			{EnvelopeID: other.ID, ID: "queued", Type: typesend_schemas.TypeSendEventType_QUEUED, OccurredAt: now},
+		}))
+
+		appID := uuid.NewString()
+		for _, suppression := range []*typesend_schemas.TypeSendSuppression{
+			{AppID: appID, TenantID: "tenant", Address: strings.ToUpper(recipient.ToAddress), Reason: typesend_schemas.TypeSendSuppressionReason_BOUNCED, Note: "550 " + recipient.ToAddress, CreatedAt: now},
+			{AppID: appID, TenantID: "other", Address: byInternalID.ToAddress, Reason: typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED, CreatedAt: now},
+			{AppID: appID, TenantID: "tenant", Address: other.ToAddress, Reason: typesend_schemas.TypeSendSuppressionReason_MANUAL, CreatedAt: now},
+		} {
+			assert.NoError(t, db.PutSuppression(ctx, suppression))
+		}
+		for _, preferences := range []*typesend_schemas.TypeSendPreferences{
+			{AppID: appID, TenantID: "tenant", Address: recipient.ToAddress, OptedOut: []string{"billing"}, UpdatedAt: now},
+			{AppID: appID, TenantID: "tenant", Address: other.ToAddress, OptedOut: []string{"billing"}, UpdatedAt: now},
+		} {
+			assert.NoError(t, db.PutPreferences(ctx, preferences))
+		}
+
+		export, err := db.ExportRecipientData(ctx, recipient)
+		assert.NoError(t, err)
+		if !assert.NotNil(t, export) {
+			return
+		}
+		assert.Equal(t, recipient, export.Recipient)
+		assert.ElementsMatch(t, []string{byAddress.ID, byInternalID.ID}, envelopeIDs(export.Envelopes))
+		if assert.Len(t, export.Schedules, 1) {
+			assert.Equal(t, schedule.ID, export.Schedules[0].ID)
+		}
+		assert.Empty(t, export.Tombstones)
+
+		exported := map[string]string{}
+		for _, event := range export.Events {
+			exported[event.EnvelopeID] = event.ID
+			if event.ID == "bounced" {
+				assert.Equal(t, "550 "+recipient.ToAddress, event.Details["reason"], "events should be exported with their details")
+			}
+		}
+		assert.Equal(t, map[string]string{byAddress.ID: "bounced", byInternalID.ID: "queued"}, exported)
+
+		reasons := map[string]typesend_schemas.TypeSendSuppressionReason{}
+		for _, suppression := range export.Suppressions {
+			reasons[suppression.Address] = suppression.Reason
+		}
+		assert.Equal(t, map[string]typesend_schemas.TypeSendSuppressionReason{
+			recipient.ToAddress:    typesend_schemas.TypeSendSuppressionReason_BOUNCED,
+			byInternalID.ToAddress: typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED,
+		}, reasons, "suppressions for addresses matched by internal ID should be exported too")
+
+		if assert.Len(t, export.Preferences, 1) {
+			assert.Equal(t, recipient.ToAddress, export.Preferences[0].Address)
+			assert.Equal(t, []string{"billing"}, export.Preferences[0].OptedOut)
+		}
+
+		for _, envelope := range export.Envelopes {
+			if envelope.ID == byAddress.ID {
+				assert.Equal(t, "Test", envelope.Variables["Name"], "exports should hold everything")
+			}
+		}
+
+		export, err = db.ExportRecipientData(ctx, typesend_schemas.TypeSendRecipient{ToInternalID: recipient.ToInternalID})
+		assert.NoError(t, err)
+		if assert.NotNil(t, export) {
+			assert.Equal(t, []string{byInternalID.ID}, envelopeIDs(export.Envelopes))
+			assert.Empty(t, export.Schedules)
+		}
+
+		_, err = db.ExportRecipientData(ctx, typesend_schemas.TypeSendRecipient{})
+		assert.Error(t, err, "a recipient must be given")
+	})
+
+	t.Run("EraseRecipient", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		recipient := newRecipient()
+		otherAddress := "other-" + recipient.ToAddress
+
+		unsent := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(time.Hour))
+		unsent.ToAddress = recipient.ToAddress
+		unsent.ToInternalID = recipient.ToInternalID
+		unsent.ToName = "Test"
+		unsent.Variables = map[string]interface{}{"Name": "Test"}
+		unsent.TimeZone = "America/New_York"
+		unsent.QuietHours = &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"}
+		unsent.Sealed = newSealed()
+		unsent.ExpiresAt = now.Add(48 * time.Hour).Unix()
+		// Kept apart, as databases may erase the inserted envelopes in place.
+		unsentExpiresAt, unsentTemplateID := unsent.ExpiresAt, unsent.TemplateID
+		sent := newEnvelope(typesend_schemas.TypeSendStatus_SENT, now)
+		sent.ToAddress = otherAddress
+		sent.ToInternalID = recipient.ToInternalID
+		sent.Variables = map[string]interface{}{"Name": "Test"}
+		other := newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		other.Variables = map[string]interface{}{"Name": "Test"}
+		for _, envelope := range []*typesend_schemas.TypeSendEnvelope{unsent, sent, other} {
+			assert.NoError(t, db.Insert(envelope))
+		}
+
+		schedule := newSchedule(now)
+		schedule.ToAddress = recipient.ToAddress
+		assert.NoError(t, db.InsertSchedule(ctx, schedule))
+
+		assert.NoError(t, db.AppendEvents(ctx, []*typesend_schemas.TypeSendEvent{
+			{EnvelopeID: sent.ID, ID: "sent", Type: typesend_schemas.TypeSendEventType_SENT, OccurredAt: now},
+			{EnvelopeID: sent.ID, ID: "bounced", Type: typesend_schemas.TypeSendEventType_BOUNCED, OccurredAt: now.Add(time.Minute), Details: map[string]string{"reason": "550 " + otherAddress}},
+			{EnvelopeID: other.ID, ID: "bounced", Type: typesend_schemas.TypeSendEventType_BOUNCED, OccurredAt: now, Details: map[string]string{"reason": "kept"}},
+		}))
+
+		appID := uuid.NewString()
+		for _, suppression := range []*typesend_schemas.TypeSendSuppression{
+			{AppID: appID, TenantID: "tenant", Address: recipient.ToAddress, Reason: typesend_schemas.TypeSendSuppressionReason_BOUNCED, Note: "550 " + recipient.ToAddress, CreatedAt: now},
+			{AppID: appID, TenantID: "tenant", Address: otherAddress, Reason: typesend_schemas.TypeSendSuppressionReason_COMPLAINED, CreatedAt: now},
+			{AppID: appID, TenantID: "tenant", Address: other.ToAddress, Reason: typesend_schemas.TypeSendSuppressionReason_MANUAL, Note: "kept", CreatedAt: now},
+		} {
+			assert.NoError(t, db.PutSuppression(ctx, suppression))
+		}
+		for _, preferences := range []*typesend_schemas.TypeSendPreferences{
+			{AppID: appID, TenantID: "tenant", Address: recipient.ToAddress, OptedOut: []string{"billing"}, UpdatedAt: now},
+			{AppID: appID, TenantID: "other", Address: otherAddress, OptedOut: []string{"billing"}, UpdatedAt: now},
+			{AppID: appID, TenantID: "tenant", Address: other.ToAddress, OptedOut: []string{"billing"}, UpdatedAt: now},
+		} {
+			assert.NoError(t, db.PutPreferences(ctx, preferences))
+		}
+
+		erasure, err := db.EraseRecipient(ctx, recipient, now)
+		assert.NoError(t, err)
+		if !assert.NotNil(t, erasure) {
+			return
+		}
+		assert.Equal(t, 2, erasure.Envelopes)
+		assert.Equal(t, 1, erasure.Schedules)
+		assert.Equal(t, 2, erasure.Suppressions)
+		assert.Equal(t, 2, erasure.Preferences)
+		assert.Equal(t, 1, erasure.Events, "only events with details need erasing")
+		assert.Len(t, erasure.Tombstones, 3, "one per address and internal ID erased")
+
+		for address, reason := range map[string]typesend_schemas.TypeSendSuppressionReason{
+			recipient.ToAddress: typesend_schemas.TypeSendSuppressionReason_BOUNCED,
+			otherAddress:        typesend_schemas.TypeSendSuppressionReason_COMPLAINED,
+		} {
+			suppression, err := db.GetSuppression(ctx, appID, "tenant", address)
+			assert.NoError(t, err)
+			assert.Nil(t, suppression, "suppressions should no longer hold the address")
+
+			suppression, err = db.GetSuppression(ctx, appID, "tenant", typesend_schemas.ErasedAddress(address))
+			assert.NoError(t, err)
+			if assert.NotNil(t, suppression, "a pseudonymized suppression should replace it") {
+				assert.Equal(t, reason, suppression.Reason)
+				assert.Empty(t, suppression.Note)
+				assert.True(t, now.Equal(suppression.CreatedAt))
+			}
+		}
+
+		kept, err := db.GetSuppression(ctx, appID, "tenant", other.ToAddress)
+		assert.NoError(t, err)
+		if assert.NotNil(t, kept, "other recipients suppressions should be left alone") {
+			assert.Equal(t, "kept", kept.Note)
+		}
+
+		for _, preferences := range []struct{ tenantID, address string }{
+			{"tenant", recipient.ToAddress},
+			{"other", otherAddress},
+		} {
+			found, err := db.GetPreferences(ctx, appID, preferences.tenantID, preferences.address)
+			assert.NoError(t, err)
+			assert.Nil(t, found, "preferences for %s should be deleted", preferences.address)
+		}
+
+		keptPreferences, err := db.GetPreferences(ctx, appID, "tenant", other.ToAddress)
+		assert.NoError(t, err)
+		assert.NotNil(t, keptPreferences, "other recipients preferences should be left alone")
+
+		timeline, err := db.GetEnvelopeTimeline(ctx, sent.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, timeline, 2, "erased events are kept for analytics") {
+			assert.Equal(t, typesend_schemas.TypeSendEventType_BOUNCED, timeline[1].Type)
+			assert.Nil(t, timeline[1].Details, "event details may hold the address")
+		}
+
+		timeline, err = db.GetEnvelopeTimeline(ctx, other.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, timeline, 1) {
+			assert.Equal(t, "kept", timeline[0].Details["reason"], "other recipients events should be left alone")
+		}
+
+		got, err := db.GetEnvelopeByID(ctx, unsent.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got, "erased envelopes are kept for the audit trail") {
+			assert.Equal(t, typesend_schemas.ErasedAddress(recipient.ToAddress), got.ToAddress)
+			assert.NotEmpty(t, got.ToInternalID)
+			assert.NotEqual(t, recipient.ToInternalID, got.ToInternalID)
+			assert.Empty(t, got.ToName)
+			assert.Nil(t, got.Variables)
+			assert.Empty(t, got.TimeZone)
+			assert.Nil(t, got.QuietHours)
+			assert.Nil(t, got.Sealed)
+			assert.Equal(t, unsentExpiresAt, got.ExpiresAt)
+			assert.Equal(t, unsentTemplateID, got.TemplateID)
+			assert.Equal(t, typesend_schemas.TypeSendStatus_FAILED, got.Status, "erased envelopes must never be sent")
+		}
+
+		// Nor dispatched, which reads the lanes rather than the status.
+		ready, err := db.GetMessagesReadyToSend(ctx, now.Add(2*time.Hour))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{other.ID}, readyIDs(ready, []*typesend_schemas.TypeSendEnvelope{unsent, other}), "erased envelopes must leave the ready envelopes")
+		for _, priority := range typesend_schemas.TypeSendPriorities {
+			ready, err := db.GetMessagesReadyToSendByPriority(ctx, now.Add(2*time.Hour), priority)
+			assert.NoError(t, err)
+			assert.NotContains(t, readyIDs(ready, []*typesend_schemas.TypeSendEnvelope{unsent}), unsent.ID, "erased envelopes must leave the %s lane", priority)
+		}
+
+		got, err = db.GetEnvelopeByID(ctx, sent.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, typesend_schemas.ErasedAddress(otherAddress), got.ToAddress)
+			assert.Nil(t, got.Variables)
+			assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status)
+		}
+
+		got, err = db.GetEnvelopeByID(ctx, other.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, other.ToAddress, got.ToAddress, "other recipients should be left alone")
+			assert.Equal(t, "Test", got.Variables["Name"])
+			assert.Equal(t, typesend_schemas.TypeSendStatus_UNSENT, got.Status)
+		}
+
+		found, err := db.GetScheduleByID(ctx, schedule.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, found, "schedules to the recipient should be deleted")
+
+		for _, value := range []string{recipient.ToAddress, recipient.ToInternalID, otherAddress} {
+			tombstone, err := db.GetTombstone(ctx, typesend_schemas.HashRecipient(value))
+			assert.NoError(t, err)
+			if assert.NotNil(t, tombstone, "%s should leave a tombstone", value) {
+				assert.True(t, now.Equal(tombstone.ErasedAt))
+			}
+		}
+
+		tombstone, err := db.GetTombstone(ctx, typesend_schemas.HashRecipient(uuid.NewString()))
+		assert.NoError(t, err)
+		assert.Nil(t, tombstone)
+
+		export, err := db.ExportRecipientData(ctx, recipient)
+		assert.NoError(t, err)
+		if assert.NotNil(t, export) {
+			assert.Empty(t, export.Envelopes, "nothing should still point at the recipient")
+			assert.Empty(t, export.Schedules)
+			assert.Empty(t, export.Suppressions)
+			assert.Empty(t, export.Preferences)
+			assert.Len(t, export.Tombstones, 2)
+		}
+
+		erasure, err = db.EraseRecipient(ctx, recipient, now.Add(time.Hour))
+		assert.NoError(t, err)
+		if assert.NotNil(t, erasure) {
+			assert.Zero(t, erasure.Envelopes, "erasing twice should find nothing more")
+		}
+	})
+
+	t.Run("Schedules", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		due := newSchedule(now.Add(-time.Minute))
+		due.Variables = map[string]interface{}{"Name": "Test"}
+		due.QuietHours = &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"}
+		due.Sealed = newSealed()
+		future := newSchedule(now.Add(time.Hour))
+		paused := newSchedule(now.Add(-time.Minute))
+		paused.State = typesend_schemas.TypeSendScheduleState_PAUSED
+		schedules := []*typesend_schemas.TypeSendSchedule{due, future, paused}
+		for _, schedule := range schedules {
+			assert.NoError(t, db.InsertSchedule(ctx, schedule))
+		}
+
+		got, err := db.GetScheduleByID(ctx, due.ID)
+		assert.NoError(t, err)
+		if !assert.NotNil(t, got) {
+			return
+		}
+		assert.Equal(t, due.Recurrence.Cron, got.Recurrence.Cron)
+		assert.Equal(t, "Test", got.Variables["Name"])
+		assert.Equal(t, due.QuietHours, got.QuietHours)
+		assert.Equal(t, due.Sealed, got.Sealed)
+		assert.True(t, due.NextRunAt.Equal(got.NextRunAt))
+
+		missing, err := db.GetScheduleByID(ctx, uuid.NewString())
+		assert.NoError(t, err)
+		assert.Nil(t, missing)
+
+		ch, err := db.GetSchedulesDue(ctx, now)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{due.ID}, dueIDs(ch, schedules))
+
+		next := due.NextRunAt.Add(24 * time.Hour)
+		ok, err := db.AdvanceSchedule(ctx, due.ID, due.NextRunAt, next)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = db.AdvanceSchedule(ctx, due.ID, due.NextRunAt, next)
+		assert.NoError(t, err)
+		assert.False(t, ok, "a stale run should not advance the schedule again")
+
+		ok, err = db.AdvanceSchedule(ctx, due.ID, next, time.Time{})
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		got, _ = db.GetScheduleByID(ctx, due.ID)
+		assert.Equal(t, typesend_schemas.TypeSendScheduleState_COMPLETED, got.State)
+
+		assert.NoError(t, db.UpdateScheduleState(ctx, paused.ID, typesend_schemas.TypeSendScheduleState_ACTIVE, time.Time{}))
+		got, _ = db.GetScheduleByID(ctx, paused.ID)
+		assert.Equal(t, typesend_schemas.TypeSendScheduleState_ACTIVE, got.State)
+		assert.True(t, paused.NextRunAt.Equal(got.NextRunAt), "a zero nextRunAt should leave it unchanged")
+
+		assert.Error(t, db.UpdateScheduleState(ctx, uuid.NewString(), typesend_schemas.TypeSendScheduleState_PAUSED, time.Time{}))
+
+		assert.NoError(t, db.DeleteSchedule(ctx, future.ID))
+		got, err = db.GetScheduleByID(ctx, future.ID)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("GetTemplateByID", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		templateID := uuid.NewString()
+		tenantID := uuid.NewString()
+
+		base := newTemplate(templateID)
+		base.Transactional = true
+		base.OmitListUnsubscribe = true
+		base.Category = "product-updates"
+		base.Sensitive = true
+		base.EnableTracking = true
+		base.DisableOpenTracking = true
+		base.DisableClickTracking = true
+		base.Priority = typesend_schemas.TypeSendPriority_HIGH
+		base.DigestWindow = time.Hour
+		assert.NoError(t, db.InsertTemplate(ctx, base))
+
+		override := newTemplate(templateID)
+		override.TenantID = tenantID
+		override.Subject = "Tenant Subject"
+		assert.NoError(t, db.InsertTemplate(ctx, override))
+
+		got, err := db.GetTemplateByID(ctx, templateID, tenantID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, tenantID, got.TenantID)
+			assert.Equal(t, "Tenant Subject", got.Subject, "the tenant's own template should win")
+		}
+
+		got, err = db.GetTemplateByID(ctx, templateID, uuid.NewString())
+		assert.NoError(t, err)
+		if assert.NotNil(t, got) {
+			assert.Equal(t, "base", got.TenantID, "should fall back to the base tenant")
+			assert.Equal(t, base.Subject, got.Subject)
+			assert.Equal(t, base.Content, got.Content)
+			assert.Equal(t, base.FromAddress, got.FromAddress)
+			assert.Equal(t, base.FromName, got.FromName)
+			assert.True(t, got.Transactional)
+			assert.True(t, got.OmitListUnsubscribe)
+			assert.Equal(t, "product-updates", got.Category)
+			assert.True(t, got.Sensitive)
+			assert.True(t, got.EnableTracking)
+			assert.True(t, got.DisableOpenTracking)
+			assert.True(t, got.DisableClickTracking)
+			assert.Equal(t, typesend_schemas.TypeSendPriority_HIGH, got.Priority)
+			assert.Equal(t, time.Hour, got.DigestWindow)
+		}
+
+		got, err = db.GetTemplateByID(ctx, uuid.NewString(), tenantID)
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("ConcurrentInsertAndUpdate", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, concurrency)
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+		}
+
+		var wg sync.WaitGroup
+		for _, envelope := range envelopes {
+			wg.Add(1)
+			go func(envelope *typesend_schemas.TypeSendEnvelope) {
+				defer wg.Done()
+				assert.NoError(t, db.Insert(envelope))
+				_, err := db.GetEnvelopeByID(ctx, envelope.ID)
+				assert.NoError(t, err)
+				assert.NoError(t, db.UpdateEnvelopeStatus(ctx, envelope.ID, typesend_schemas.TypeSendStatus_SENT))
+			}(envelope)
+		}
+		wg.Wait()
+
+		for _, envelope := range envelopes {
+			got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+			assert.NoError(t, err)
+			if assert.NotNil(t, got, "concurrent inserts should not be lost") {
+				assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status, "concurrent updates should not be lost")
+			}
+		}
+	})
+
+	t.Run("ConcurrentInsertIdempotent", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		key := uuid.NewString()
+
+		var mu sync.Mutex
+		ids := make(map[string]bool)
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// A backend may refuse a conflicting write outright,
+				// but it must never accept two envelopes for one key.
+				id, err := db.InsertIdempotent(ctx, newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now), key, now.Add(time.Hour))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				ids[id] = true
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		assert.Len(t, ids, 1, "every caller should be handed the same envelope")
+	})
+
+	t.Run("ConcurrentConsumeRateLimit", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+		key := "tenant#test#" + uuid.NewString()
+		window := now.Truncate(time.Minute)
+		limit := concurrency / 4
+
+		var mu sync.Mutex
+		granted := 0
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := db.ConsumeRateLimit(ctx, key, window, time.Minute, limit)
+				assert.NoError(t, err)
+				if ok {
+					mu.Lock()
+					granted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, limit, granted, "exactly limit slots should be granted")
+	})
+
+	t.Run("ConcurrentLinkEnvelopesToDigest", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		envelopes := make([]*typesend_schemas.TypeSendEnvelope, 10)
+		envelopeIDs := make([]string, len(envelopes))
+		for i := range envelopes {
+			envelopes[i] = newEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now)
+			envelopeIDs[i] = envelopes[i].ID
+		}
+		for _, err := range db.InsertBatch(ctx, envelopes) {
+			assert.NoError(t, err)
+		}
+
+		var mu sync.Mutex
+		linkedTo := make(map[string][]string)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				digestID := uuid.NewString()
+				linked, err := db.LinkEnvelopesToDigest(ctx, digestID, envelopeIDs)
+				assert.NoError(t, err)
+				mu.Lock()
+				for _, envelopeID := range linked {
+					linkedTo[envelopeID] = append(linkedTo[envelopeID], digestID)
+				}
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		for _, envelopeID := range envelopeIDs {
+			if assert.Len(t, linkedTo[envelopeID], 1, "envelope %s should land in exactly one digest", envelopeID) {
+				got, _ := db.GetEnvelopeByID(ctx, envelopeID)
+				assert.Equal(t, linkedTo[envelopeID][0], got.DigestID)
+			}
+		}
+	})
+
+	t.Run("ConcurrentAdvanceSchedule", func(t *testing.T) {
+		db := newDB(t)
+		ctx := context.Background()
+
+		schedule := newSchedule(now.Add(-time.Minute))
+		assert.NoError(t, db.InsertSchedule(ctx, schedule))
+
+		var mu sync.Mutex
+		advanced := 0
+
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := db.AdvanceSchedule(ctx, schedule.ID, schedule.NextRunAt, schedule.NextRunAt.Add(24*time.Hour))
+				assert.NoError(t, err)
+				if ok {
+					mu.Lock()
+					advanced++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, advanced, "a run should only be claimed once")
+	})
+}
+
+func newEnvelope(status typesend_schemas.TypeSendStatus, scheduledFor time.Time) *typesend_schemas.TypeSendEnvelope {
+	return &typesend_schemas.TypeSendEnvelope{
+		ID:             uuid.NewString(),
+		AppID:          "test",
+		ToAddress:      "test@example.com",
+		ToInternalID:   "internal",
+		MessageGroupID: "group",
+		TemplateID:     uuid.NewString(),
+		ScheduledFor:   scheduledFor,
+		Status:         status,
+	}
+}
+
+// newRecipient is unique per call, as storage may be shared.
+func newRecipient() typesend_schemas.TypeSendRecipient {
+	id := uuid.NewString()
+	return typesend_schemas.TypeSendRecipient{
+		ToAddress:    "erase-" + id + "@example.com",
+		ToInternalID: "internal-" + id,
+	}
+}
+
+// newSealed only needs to round trip, so it isn't real ciphertext.
+func newSealed() *typesend_schemas.TypeSendSealed {
+	return &typesend_schemas.TypeSendSealed{
+		KeyID:      "key",
+		DataKey:    []byte("wrapped"),
+		Nonce:      []byte("nonce"),
+		Ciphertext: []byte("ciphertext"),
+	}
+}
+
+func newSchedule(nextRunAt time.Time) *typesend_schemas.TypeSendSchedule {
+	return &typesend_schemas.TypeSendSchedule{
+		ID:         uuid.NewString(),
+		AppID:      "test",
+		TenantID:   "base",
+		TemplateID: uuid.NewString(),
+		ToAddress:  "test@example.com",
+		Recurrence: typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * *"},
+		State:      typesend_schemas.TypeSendScheduleState_ACTIVE,
+		NextRunAt:  nextRunAt,
+	}
+}
+
+func newTemplate(templateID string) *typesend_schemas.TypeSendTemplate {
+	return &typesend_schemas.TypeSendTemplate{
+		TemplateID:  templateID,
+		TenantID:    "base",
+		Content:     "This is a test body.",
+		Subject:     "This is a test subject.",
+		FromAddress: "bob@example.com",
+		FromName:    "Bobby",
+	}
+}
+
+// readyIDs drains ch, keeping the IDs of envelopes in order.
+func readyIDs(ch chan *typesend_schemas.TypeSendEnvelope, envelopes []*typesend_schemas.TypeSendEnvelope) []string {
+	known := make(map[string]bool, len(envelopes))
+	for _, envelope := range envelopes {
+		known[envelope.ID] = true
+	}
+
+	ids := make([]string, 0)
+	for envelope := range ch {
+		if known[envelope.ID] {
+			ids = append(ids, envelope.ID)
+		}
+	}
+	return ids
+}
+
+// dueIDs drains ch, keeping the IDs of schedules in order.
+func dueIDs(ch chan *typesend_schemas.TypeSendSchedule, schedules []*typesend_schemas.TypeSendSchedule) []string {
+	known := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		known[schedule.ID] = true
+	}
+
+	ids := make([]string, 0)
+	for schedule := range ch {
+		if known[schedule.ID] {
+			ids = append(ids, schedule.ID)
+		}
+	}
+	return ids
+}
+
+func envelopeIDs(envelopes []*typesend_schemas.TypeSendEnvelope) []string {
+	ids := make([]string, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		ids = append(ids, envelope.ID)
+	}
+	return ids
+}
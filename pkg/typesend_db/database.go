@@ -2,18 +2,151 @@ package typesend_db
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
 
+// ErrNotUnsent is returned by ClaimEnvelopes for envelopes that
+// are no longer UNSENT, such as those erased or linked to a digest
+// since they were read.
+var ErrNotUnsent = errors.New("typesend: envelope is no longer UNSENT")
+
 type TypeSendDatabase interface {
 	Connect(ctx context.Context) error
 	Insert(envelope *typesend_schemas.TypeSendEnvelope) error
+	// InsertIdempotent inserts the envelope unless the idempotency key
+	// (scoped to the envelopes App and Tenant) has already been claimed
+	// and has not yet expired. It returns the ID of the envelope that
+	// owns the key, which is the original envelope on a repeat.
+	InsertIdempotent(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string, expiresAt time.Time) (string, error)
+	// InsertBatch inserts many envelopes at once. The returned errors
+	// line up with envelopes by index; nil means it was inserted.
+	InsertBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) []error
 	GetEnvelopeByID(ctx context.Context, envelopeID string) (*typesend_schemas.TypeSendEnvelope, error)
 	GetMessagesReadyToSend(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendEnvelope, error)
+	// GetMessagesReadyToSendByPriority is GetMessagesReadyToSend limited to
+	// a single priority lane. The NORMAL lane includes DEFAULT envelopes.
+	GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error)
 	UpdateEnvelopeStatus(ctx context.Context, envelopeID string, toStatus typesend_schemas.TypeSendStatus) error
+	// UpdateEnvelopeStatuses moves many envelopes to the same status. The
+	// returned errors line up with envelopeIDs by index; nil means success.
+	UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error
+	// ClaimEnvelopes moves each envelope that is still UNSENT to
+	// DELIVERING, leaving any other alone with ErrNotUnsent. The
+	// returned errors line up with envelopeIDs by index.
+	ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error
+
+	// DeferEnvelope applies TypeSendEnvelope.Defer to an UNSENT envelope,
+	// storing its new ScheduledFor, OriginalScheduledFor and expiry times.
+	DeferEnvelope(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, until time.Time) error
+
+	// LinkEnvelopesToDigest marks each UNSENT envelope as SENT as part of
+	// the digest envelope. Envelopes that are no longer UNSENT (e.g. taken
+	// by an overlapping run) are skipped. It returns the IDs it linked.
+	LinkEnvelopesToDigest(ctx context.Context, digestID string, envelopeIDs []string) ([]string, error)
+
+	// PurgeExpiredData enforces retention as of now. Finished (SENT,
+	// FAILED or SUPPRESSED) envelopes past their ContentExpiresAt are
+	// stripped down to an audit record, and those past their ExpiresAt
+	// are deleted, along with any expired idempotency keys and rate
+	// limit windows.
+	PurgeExpiredData(ctx context.Context, now time.Time) (PurgeResult, error)
+
+	// PutSuppression stores the suppression, replacing any
+	// earlier one for the same App, Tenant and Address.
+	PutSuppression(ctx context.Context, suppression *typesend_schemas.TypeSendSuppression) error
+	// GetSuppression returns the suppression for the address,
+	// or nil when it may be emailed.
+	GetSuppression(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error)
+	// DeleteSuppression lifts a suppression. Lifting one
+	// that doesn't exist is not an error.
+	DeleteSuppression(ctx context.Context, appID string, tenantID string, address string) error
+
+	// PutCategories replaces the Apps categories.
+	PutCategories(ctx context.Context, appID string, categories []*typesend_schemas.TypeSendCategory) error
+	// GetCategories returns the Apps categories in
+	// the order they were put, or nil when it has none.
+	GetCategories(ctx context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error)
+	// PutPreferences stores the preferences, replacing any
+	// earlier ones for the same App, Tenant and Address.
+	PutPreferences(ctx context.Context, preferences *typesend_schemas.TypeSendPreferences) error
+	// GetPreferences returns the preferences for the address,
+	// or nil when none were stored.
+	GetPreferences(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error)
+	// GetRecipientStates looks up the suppression, preferences and any
+	// tombstone of many recipients at once, so SendBatch needn't read
+	// them one at a time. The returned states line up with keys by index.
+	GetRecipientStates(ctx context.Context, keys []RecipientKey) ([]RecipientState, error)
+
+	// AppendEvents adds each event to its envelopes event log. Events
+	// with the same envelope and ID as one already stored are skipped,
+	// so providers retrying a webhook are harmless.
+	AppendEvents(ctx context.Context, events []*typesend_schemas.TypeSendEvent) error
+	// GetEnvelopeTimeline returns the envelopes event log, oldest first:
+	// from being queued, through dispatch and sending, to what the
+	// provider reported after. Nil when there are no events.
+	GetEnvelopeTimeline(ctx context.Context, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error)
+	// GetEventsByDay returns every event that occurred on the UTC day
+	// containing day, across all envelopes, oldest first.
+	GetEventsByDay(ctx context.Context, day time.Time) ([]*typesend_schemas.TypeSendEvent, error)
+	// GetEventByProviderMessageID returns the oldest event recorded with
+	// the providers message ID, such as the SENT event logged when it
+	// accepted the email, or nil when there is none. It ties provider
+	// notifications that lack TypeSend's tags back to their envelope.
+	GetEventByProviderMessageID(ctx context.Context, provider string, messageID string) (*typesend_schemas.TypeSendEvent, error)
+
+	// PutRollups stores each rollup, replacing any earlier one
+	// for the same App, Tenant, Template and Day.
+	PutRollups(ctx context.Context, rollups []*typesend_schemas.TypeSendRollup) error
+	// GetRollups returns the rollups the query matches, ordered by
+	// Day, then Tenant and Template. Nil when none match.
+	GetRollups(ctx context.Context, query typesend_schemas.TypeSendRollupQuery) ([]*typesend_schemas.TypeSendRollup, error)
+
+	// ExportRecipientData gathers every envelope and schedule sent to
+	// the recipient, the envelopes events, the suppressions and
+	// preferences held for their addresses, and the tombstones of any
+	// earlier erasure.
+	ExportRecipientData(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) (*typesend_schemas.TypeSendRecipientExport, error)
+	// EraseRecipient applies TypeSendEnvelope.Erase to every envelope
+	// sent to the recipient and TypeSendEvent.Erase to their events,
+	// deletes their schedules and preferences, replaces their
+	// suppressions with TypeSendSuppression.Erase copies, and stores a
+	// tombstone for each address and internal ID it erased.
+	EraseRecipient(ctx context.Context, recipient typesend_schemas.TypeSendRecipient, erasedAt time.Time) (*typesend_schemas.TypeSendErasure, error)
+	// GetTombstone returns the tombstone for a HashRecipient hash,
+	// or nil when that recipient was never erased.
+	GetTombstone(ctx context.Context, hash string) (*typesend_schemas.TypeSendTombstone, error)
+
+	// ConsumeRateLimit atomically takes one slot from the fixed window
+	// starting at windowStart. It returns false once limit is reached.
+	ConsumeRateLimit(ctx context.Context, key string, windowStart time.Time, window time.Duration, limit int) (bool, error)
+	// ReleaseRateLimit gives back a slot ConsumeRateLimit took from the
+	// window starting at windowStart, for a send that never went out.
+	// Releasing from an empty or unknown window is not an error.
+	ReleaseRateLimit(ctx context.Context, key string, windowStart time.Time) error
+
+	InsertSchedule(ctx context.Context, schedule *typesend_schemas.TypeSendSchedule) error
+	GetScheduleByID(ctx context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error)
+	// UpdateScheduleState moves a schedule to state. A zero nextRunAt
+	// leaves the schedules NextRunAt unchanged.
+	UpdateScheduleState(ctx context.Context, scheduleID string, state typesend_schemas.TypeSendScheduleState, nextRunAt time.Time) error
+	DeleteSchedule(ctx context.Context, scheduleID string) error
+	// GetSchedulesDue streams ACTIVE schedules whose NextRunAt has passed.
+	GetSchedulesDue(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendSchedule, error)
+	// AdvanceSchedule moves NextRunAt from `from` to `next`, only if the
+	// schedule is still ACTIVE and due at `from`. It returns false when
+	// another run already advanced it. A zero next marks it COMPLETED.
+	AdvanceSchedule(ctx context.Context, scheduleID string, from time.Time, next time.Time) (bool, error)
 
 	GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error)
 	InsertTemplate(context.Context, *typesend_schemas.TypeSendTemplate) error
 }
+
+// LiveModeDatabase is a TypeSendDatabase that can wake the live mode
+// dispatcher, by signalling ch (without blocking) on every insert.
+type LiveModeDatabase interface {
+	TypeSendDatabase
+	SetLiveModeChan(ch chan *typesend_schemas.TypeSendEnvelope)
+}
@@ -2,8 +2,12 @@ package typesend_db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -36,6 +40,7 @@ type DynamoConfig struct {
 	Region         string
 	EnvelopesTable string
 	TemplatesTable string
+	SchedulesTable string
 
 	ForceClient *dynamodb.DynamoDB
 }
@@ -59,12 +64,32 @@ func (db *DynamoTypeSendDB) Connect(ctx context.Context) error {
 	return nil
 }
 
+// dynamoReadyLane is the statusPriority of an UNSENT envelope.
+// DEFAULT shares the NORMAL lane, so each lane is a single partition
+// of the statusPriority-scheduledFor-index.
+func dynamoReadyLane(priority typesend_schemas.TypeSendPriority) string {
+	return fmt.Sprintf("%d#%d", typesend_schemas.TypeSendStatus_UNSENT, priority.Effective())
+}
+
+// marshalEnvelope adds statusPriority to UNSENT envelopes. It is
+// removed once they leave UNSENT, keeping the index to the backlog.
+func marshalEnvelope(envelope *typesend_schemas.TypeSendEnvelope) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Status == typesend_schemas.TypeSendStatus_UNSENT {
+		item["statusPriority"] = &dynamodb.AttributeValue{S: aws.String(dynamoReadyLane(envelope.Priority))}
+	}
+	return item, nil
+}
+
 func (db *DynamoTypeSendDB) Insert(envelope *typesend_schemas.TypeSendEnvelope) error {
 	if db.client == nil {
 		return fmt.Errorf("typesend: Insert requires a connection")
 	}
 	// Marshal the envelope struct into a DynamoDB attribute map.
-	item, err := dynamodbattribute.MarshalMap(envelope)
+	item, err := marshalEnvelope(envelope)
 	if err != nil {
 		return fmt.Errorf("typesend: failed to marshal envelope: %w", err)
 	}
@@ -84,6 +109,169 @@ func (db *DynamoTypeSendDB) Insert(envelope *typesend_schemas.TypeSendEnvelope)
 	return nil
 }
 
+// DynamoDB caps BatchWriteItem at 25 requests.
+const dynamoBatchWriteLimit = 25
+
+// How many times unprocessed items are retried before giving up.
+const dynamoBatchWriteRetries = 5
+
+func (db *DynamoTypeSendDB) InsertBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) []error {
+	errs := make([]error, len(envelopes))
+
+	if db.client == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: InsertBatch requires a connection")
+		}
+		return errs
+	}
+
+	// Unprocessed items come back without their index,
+	// so map them back through their envelope ID.
+	indexByID := make(map[string]int, len(envelopes))
+	requests := make([]*dynamodb.WriteRequest, 0, len(envelopes))
+
+	for i, envelope := range envelopes {
+		item, err := marshalEnvelope(envelope)
+		if err != nil {
+			errs[i] = fmt.Errorf("typesend: failed to marshal envelope: %w", err)
+			continue
+		}
+		indexByID[envelope.ID] = i
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		})
+	}
+
+	for start := 0; start < len(requests); start += dynamoBatchWriteLimit {
+		end := min(start+dynamoBatchWriteLimit, len(requests))
+
+		unprocessed, err := db.batchWriteWithRetry(ctx, requests[start:end])
+		for _, request := range unprocessed {
+			i, ok := indexByID[aws.StringValue(request.PutRequest.Item["id"].S)]
+			if !ok {
+				continue
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("typesend: failed to batch write item: %w", err)
+			} else {
+				errs[i] = fmt.Errorf("typesend: item was not processed after %d retries", dynamoBatchWriteRetries)
+			}
+		}
+	}
+
+	return errs
+}
+
+// batchWriteWithRetry writes a single chunk, retrying unprocessed items
+// with backoff. Whatever is still unprocessed at the end is returned.
+func (db *DynamoTypeSendDB) batchWriteWithRetry(ctx context.Context, requests []*dynamodb.WriteRequest) ([]*dynamodb.WriteRequest, error) {
+	pending := requests
+
+	for attempt := 0; attempt <= dynamoBatchWriteRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return pending, ctx.Err()
+			case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+			}
+		}
+
+		out, err := db.client.BatchWriteItemWithContext(ctx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]*dynamodb.WriteRequest{
+				db.Config.EnvelopesTable: pending,
+			},
+		})
+		if err != nil {
+			return pending, err
+		}
+
+		pending = out.UnprocessedItems[db.Config.EnvelopesTable]
+		if len(pending) == 0 {
+			return nil, nil
+		}
+	}
+
+	return pending, nil
+}
+
+func (db *DynamoTypeSendDB) InsertIdempotent(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string, expiresAt time.Time) (string, error) {
+	if db.client == nil {
+		return "", fmt.Errorf("typesend: InsertIdempotent requires a connection")
+	}
+
+	item, err := marshalEnvelope(envelope)
+	if err != nil {
+		return "", fmt.Errorf("typesend: failed to marshal envelope: %w", err)
+	}
+
+	key := scopedIdempotencyKey(envelope, idempotencyKey)
+	dedup, err := dynamodbattribute.MarshalMap(&idempotencyRecord{
+		ID:         key,
+		EnvelopeID: envelope.ID,
+		ExpiresAt:  expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("typesend: failed to marshal idempotency record: %w", err)
+	}
+
+	// The dedup item and the envelope are written together, so a
+	// claimed key always points at an envelope that exists.
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(db.Config.EnvelopesTable),
+					Item:                dedup,
+					ConditionExpression: aws.String("attribute_not_exists(id) OR expiresAt <= :now"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":now": {N: aws.String(fmt.Sprintf("%d", time.Now().UTC().Unix()))},
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String(db.Config.EnvelopesTable),
+					Item:                item,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+		},
+	}
+
+	_, err = db.client.TransactWriteItemsWithContext(ctx, input)
+	if err == nil {
+		return envelope.ID, nil
+	}
+
+	canceled, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok || len(canceled.CancellationReasons) == 0 || aws.StringValue(canceled.CancellationReasons[0].Code) != "ConditionalCheckFailed" {
+		return "", fmt.Errorf("typesend: failed to put idempotent item: %w", err)
+	}
+
+	// The key is already claimed; hand back the original envelope.
+	rawItem, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(db.Config.EnvelopesTable),
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(key)},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("typesend: failed to get idempotency record: %w", err)
+	}
+
+	if rawItem.Item == nil {
+		return "", fmt.Errorf("typesend: idempotency record for %s disappeared", idempotencyKey)
+	}
+
+	var existing idempotencyRecord
+	if err := dynamodbattribute.UnmarshalMap(rawItem.Item, &existing); err != nil {
+		return "", fmt.Errorf("typesend: failed to unmarshal idempotency record: %w", err)
+	}
+
+	return existing.EnvelopeID, nil
+}
+
 func (db *DynamoTypeSendDB) GetEnvelopeByID(ctx context.Context, envelopeID string) (*typesend_schemas.TypeSendEnvelope, error) {
 	if db.client == nil {
 		return nil, fmt.Errorf("typesend: GetEnvelopeByID requires a connection")
@@ -116,7 +304,38 @@ func (db *DynamoTypeSendDB) GetMessagesReadyToSend(ctx context.Context, timestam
 	if db.client == nil {
 		return nil, fmt.Errorf("typesend: GetMessagesReadyToSend requires a connection")
 	}
-	ch := make(chan *typesend_schemas.TypeSendEnvelope)
+	return db.queryMessagesReadyToSend(ctx, db.readyToSendQuery(timestamp)), nil
+}
+
+// GetMessagesReadyToSendByPriority queries the lanes partition of the
+// statusPriority-scheduledFor-index, so it only reads its own lane.
+// Envelopes inserted before that index existed have no statusPriority;
+// the NORMAL lane picks them up from the status-scheduledFor-index after
+// its own.
+func (db *DynamoTypeSendDB) GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetMessagesReadyToSendByPriority requires a connection")
+	}
+
+	inputs := []*dynamodb.QueryInput{{
+		TableName:              aws.String(db.Config.EnvelopesTable),
+		IndexName:              aws.String("statusPriority-scheduledFor-index"),
+		KeyConditionExpression: aws.String("statusPriority = :lane and scheduledFor <= :ts"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":lane": {S: aws.String(dynamoReadyLane(priority))},
+			":ts":   {S: aws.String(timestamp.Format(time.RFC3339))},
+		},
+	}}
+	if priority.Effective() == typesend_schemas.TypeSendPriority_NORMAL {
+		legacy := db.readyToSendQuery(timestamp)
+		legacy.FilterExpression = aws.String("attribute_not_exists(statusPriority)")
+		inputs = append(inputs, legacy)
+	}
+
+	return db.queryMessagesReadyToSend(ctx, inputs...), nil
+}
+
+func (db *DynamoTypeSendDB) readyToSendQuery(timestamp time.Time) *dynamodb.QueryInput {
 
 	// Format the timestamp to match how it was stored.
 	tsStr := timestamp.Format(time.RFC3339)
@@ -124,7 +343,7 @@ func (db *DynamoTypeSendDB) GetMessagesReadyToSend(ctx context.Context, timestam
 	// Build the query input for the "status-scheduledFor-index" index.
 	// Here we query for items where status = 0 (i.e. UNSENT)
 	// and scheduledFor is less than or equal to our timestamp.
-	input := &dynamodb.QueryInput{
+	return &dynamodb.QueryInput{
 		TableName:              aws.String(db.Config.EnvelopesTable),
 		IndexName:              aws.String("status-scheduledFor-index"),
 		KeyConditionExpression: aws.String("#status = :unsent and scheduledFor <= :ts"),
@@ -136,50 +355,64 @@ func (db *DynamoTypeSendDB) GetMessagesReadyToSend(ctx context.Context, timestam
 			":ts":     {S: aws.String(tsStr)},
 		},
 	}
+}
+
+// queryMessagesReadyToSend streams the results of each query in turn.
+func (db *DynamoTypeSendDB) queryMessagesReadyToSend(ctx context.Context, inputs ...*dynamodb.QueryInput) chan *typesend_schemas.TypeSendEnvelope {
+	ch := make(chan *typesend_schemas.TypeSendEnvelope)
 
 	go func() {
 		defer close(ch)
-		// QueryPagesWithContext iterates over the results page by page.
-		err := db.client.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
-			for _, item := range page.Items {
-				// Always check if the context has been canceled.
-				select {
-				case <-ctx.Done():
-					return false
-				default:
-				}
+		for _, input := range inputs {
+			if ctx.Err() != nil {
+				return
+			}
+			db.streamQuery(ctx, input, ch)
+		}
+	}()
 
-				var envelope typesend_schemas.TypeSendEnvelope
-				if err := dynamodbattribute.UnmarshalMap(item, &envelope); err != nil {
-					// Log the error and skip this item if unmarshaling fails.
-					// In production code, consider using a proper logging library.
-					if db.logger != nil {
-						db.logger.Errorf("typesend: failed to unmarshal item: %v", err)
-					} else {
-						log.Printf("typesend: failed to unmarshal item: %v", err)
-					}
-					continue
-				}
+	return ch
+}
 
-				// Attempt to send the envelope to the channel.
-				select {
-				case <-ctx.Done():
-					return false
-				case ch <- &envelope:
+func (db *DynamoTypeSendDB) streamQuery(ctx context.Context, input *dynamodb.QueryInput, ch chan<- *typesend_schemas.TypeSendEnvelope) {
+	// QueryPagesWithContext iterates over the results page by page.
+	err := db.client.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			// Always check if the context has been canceled.
+			select {
+			case <-ctx.Done():
+				return false
+			default:
+			}
+
+			var envelope typesend_schemas.TypeSendEnvelope
+			if err := dynamodbattribute.UnmarshalMap(item, &envelope); err != nil {
+				// Log the error and skip this item if unmarshaling fails.
+				// In production code, consider using a proper logging library.
+				if db.logger != nil {
+					db.logger.Errorf("typesend: failed to unmarshal item: %v", err)
+				} else {
+					log.Printf("typesend: failed to unmarshal item: %v", err)
 				}
+				continue
 			}
-			return !lastPage
-		})
-		if err != nil {
-			if db.logger != nil {
-				db.logger.Errorf("typesend: error during query: %v", err)
-			} else {
-				log.Printf("typesend: error during query: %v", err)
+
+			// Attempt to send the envelope to the channel.
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- &envelope:
 			}
 		}
-	}()
-
-	return ch, nil
+		return !lastPage
+	})
+	if err != nil {
+		if db.logger != nil {
+			db.logger.Errorf("typesend: error during query: %v", err)
+		} else {
+			log.Printf("typesend: error during query: %v", err)
+		}
+	}
 }
 
 func (db *DynamoTypeSendDB) UpdateEnvelopeStatus(ctx context.Context, envelopeID string, toStatus typesend_schemas.TypeSendStatus) error {
@@ -187,12 +420,22 @@ func (db *DynamoTypeSendDB) UpdateEnvelopeStatus(ctx context.Context, envelopeID
 		return fmt.Errorf("typesend: UpdateEnvelopeStatus requires a connection")
 	}
 
+	// Envelopes never move back to UNSENT, so leaving it
+	// only has to drop them from the priority lanes.
+	updateExpression := "SET #status = :newStatus"
+	if toStatus != typesend_schemas.TypeSendStatus_UNSENT {
+		updateExpression += " REMOVE statusPriority"
+	}
+
 	input := &dynamodb.UpdateItemInput{
 		TableName: aws.String(db.Config.EnvelopesTable),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {S: aws.String(envelopeID)},
 		},
-		UpdateExpression: aws.String("SET #status = :newStatus"),
+		// Without the condition, UpdateItem would create a stub
+		// envelope for an unknown ID.
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		UpdateExpression:    aws.String(updateExpression),
 		ExpressionAttributeNames: map[string]*string{
 			"#status": aws.String("status"),
 		},
@@ -203,11 +446,1558 @@ func (db *DynamoTypeSendDB) UpdateEnvelopeStatus(ctx context.Context, envelopeID
 
 	_, err := db.client.UpdateItemWithContext(ctx, input)
 	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return fmt.Errorf("typesend: envelope %s not found", envelopeID)
+		}
 		return fmt.Errorf("typesend: failed to update envelope status: %w", err)
 	}
 	return nil
 }
 
+// How many UpdateItem calls UpdateEnvelopeStatuses runs at once.
+const dynamoParallelUpdates = 10
+
+// UpdateEnvelopeStatuses fans out UpdateItem calls, as BatchWriteItem
+// only supports whole item puts and deletes.
+func (db *DynamoTypeSendDB) UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dynamoParallelUpdates)
+
+	for i, envelopeID := range envelopeIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, envelopeID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = db.UpdateEnvelopeStatus(ctx, envelopeID, toStatus)
+		}(i, envelopeID)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+// ClaimEnvelopes fans out conditional UpdateItem calls, as
+// UpdateEnvelopeStatuses does.
+func (db *DynamoTypeSendDB) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dynamoParallelUpdates)
+
+	for i, envelopeID := range envelopeIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, envelopeID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = db.claimEnvelope(ctx, envelopeID)
+		}(i, envelopeID)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+func (db *DynamoTypeSendDB) claimEnvelope(ctx context.Context, envelopeID string) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: ClaimEnvelopes requires a connection")
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(envelopeID)},
+		},
+		ConditionExpression: aws.String("#status = :unsent"),
+		UpdateExpression:    aws.String("SET #status = :delivering REMOVE statusPriority"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":unsent":     {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_UNSENT))},
+			":delivering": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_DELIVERING))},
+		},
+		// Tells a missing envelope apart from one that moved on.
+		ReturnValuesOnConditionCheckFailure: aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld),
+	})
+	if failed, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+		if len(failed.Item) == 0 {
+			return fmt.Errorf("typesend: envelope %s not found", envelopeID)
+		}
+		return ErrNotUnsent
+	}
+	if err != nil {
+		return fmt.Errorf("typesend: failed to claim envelope: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) DeferEnvelope(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, until time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeferEnvelope requires a connection")
+	}
+
+	deferred := *envelope
+	deferred.Defer(until)
+
+	original, err := dynamodbattribute.Marshal(deferred.OriginalScheduledFor)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal originalScheduledFor: %w", err)
+	}
+	scheduledFor, err := dynamodbattribute.Marshal(deferred.ScheduledFor)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal scheduledFor: %w", err)
+	}
+
+	update := "SET scheduledFor = :until, originalScheduledFor = :original"
+	values := map[string]*dynamodb.AttributeValue{
+		":until":    scheduledFor,
+		":original": original,
+		":unsent":   {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_UNSENT))},
+	}
+	// Zero expiry times are left unset, as a zero expiresAt
+	// would have the TTL delete the envelope straight away.
+	if deferred.ContentExpiresAt > 0 {
+		update += ", contentExpiresAt = :contentExpiresAt"
+		values[":contentExpiresAt"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(deferred.ContentExpiresAt, 10))}
+	}
+	if deferred.ExpiresAt > 0 {
+		update += ", expiresAt = :expiresAt"
+		values[":expiresAt"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(deferred.ExpiresAt, 10))}
+	}
+
+	_, err = db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(envelope.ID)},
+		},
+		UpdateExpression:    aws.String(update),
+		ConditionExpression: aws.String("#status = :unsent"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to defer envelope: %w", err)
+	}
+	return nil
+}
+
+// LinkEnvelopesToDigest conditions each update on the envelope still
+// being UNSENT, so an envelope is only ever part of one digest.
+func (db *DynamoTypeSendDB) LinkEnvelopesToDigest(ctx context.Context, digestID string, envelopeIDs []string) ([]string, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: LinkEnvelopesToDigest requires a connection")
+	}
+
+	linked := make([]bool, len(envelopeIDs))
+	errs := make([]error, len(envelopeIDs))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, dynamoParallelUpdates)
+
+	for i, envelopeID := range envelopeIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, envelopeID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+				TableName: aws.String(db.Config.EnvelopesTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(envelopeID)},
+				},
+				UpdateExpression:    aws.String("SET #status = :sent, digestId = :digest REMOVE statusPriority"),
+				ConditionExpression: aws.String("#status = :unsent"),
+				ExpressionAttributeNames: map[string]*string{
+					"#status": aws.String("status"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":sent":   {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_SENT))},
+					":unsent": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_UNSENT))},
+					":digest": {S: aws.String(digestID)},
+				},
+			})
+			if err != nil {
+				if _, ok := err.(*dynamodb.ConditionalCheckFailedException); !ok {
+					errs[i] = fmt.Errorf("typesend: failed to link envelope %s to digest: %w", envelopeID, err)
+				}
+				return
+			}
+			linked[i] = true
+		}(i, envelopeID)
+	}
+
+	wg.Wait()
+
+	linkedIDs := make([]string, 0, len(envelopeIDs))
+	for i, envelopeID := range envelopeIDs {
+		if linked[i] {
+			linkedIDs = append(linkedIDs, envelopeID)
+		}
+	}
+
+	return linkedIDs, errors.Join(errs...)
+}
+
+// PurgeExpiredData queries the status-contentExpiresAt-index and
+// status-expiresAt-index for each finished status, so it only reads
+// envelopes that are due. Both are sparse, as envelopes without
+// retention (and stripped envelopes, for the first) lack the key.
+// Deleting is normally left to the table's TTL on expiresAt, which
+// also removes idempotency keys and rate limit windows, but TTL can lag
+// by a day or two, so anything it hasn't reached yet is deleted here.
+func (db *DynamoTypeSendDB) PurgeExpiredData(ctx context.Context, now time.Time) (PurgeResult, error) {
+	if db.client == nil {
+		return PurgeResult{}, fmt.Errorf("typesend: PurgeExpiredData requires a connection")
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":now": {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+	}
+
+	type expiry struct {
+		ID               string `dynamodbav:"id"`
+		ContentExpiresAt int64  `dynamodbav:"contentExpiresAt"`
+		ExpiresAt        int64  `dynamodbav:"expiresAt"`
+	}
+	var expired []expiry
+	seen := map[string]bool{}
+
+	for _, status := range []typesend_schemas.TypeSendStatus{
+		typesend_schemas.TypeSendStatus_SENT,
+		typesend_schemas.TypeSendStatus_FAILED,
+		typesend_schemas.TypeSendStatus_SUPPRESSED,
+	} {
+		// Indexes only project their own keys, so expiresAt is queried
+		// first, and envelopes past both are deleted rather than stripped.
+		for _, attribute := range []string{"expiresAt", "contentExpiresAt"} {
+			err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(db.Config.EnvelopesTable),
+				IndexName:              aws.String("status-" + attribute + "-index"),
+				KeyConditionExpression: aws.String("#status = :status AND #expiry BETWEEN :one AND :now"),
+				ExpressionAttributeNames: map[string]*string{
+					"#status": aws.String("status"),
+					"#expiry": aws.String(attribute),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":status": {N: aws.String(fmt.Sprintf("%d", status))},
+					":one":    {N: aws.String("1")},
+					":now":    values[":now"],
+				},
+			}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+				for _, item := range page.Items {
+					var found expiry
+					if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+						if db.logger != nil {
+							db.logger.Errorf("typesend: failed to unmarshal expired item: %v", err)
+						} else {
+							log.Printf("typesend: failed to unmarshal expired item: %v", err)
+						}
+						continue
+					}
+					if !seen[found.ID] {
+						seen[found.ID] = true
+						expired = append(expired, found)
+					}
+				}
+				return true
+			})
+			if err != nil {
+				return PurgeResult{}, fmt.Errorf("typesend: failed to query for expired envelopes: %w", err)
+			}
+		}
+	}
+
+	var result PurgeResult
+	for _, found := range expired {
+		key := map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(found.ID)},
+		}
+
+		if retentionExpired(found.ExpiresAt, now) {
+			_, err := db.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+				TableName:                 aws.String(db.Config.EnvelopesTable),
+				Key:                       key,
+				ConditionExpression:       aws.String("expiresAt <= :now"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":now": values[":now"]},
+			})
+			if err == nil {
+				result.Deleted++
+			} else if _, ok := err.(*dynamodb.ConditionalCheckFailedException); !ok {
+				return result, fmt.Errorf("typesend: failed to delete expired envelope: %w", err)
+			}
+			continue
+		}
+
+		// Keep in step with TypeSendEnvelope.StripContent.
+		_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(db.Config.EnvelopesTable),
+			Key:                       key,
+			ConditionExpression:       aws.String("contentExpiresAt <= :now"),
+			UpdateExpression:          aws.String("REMOVE variables, to_name, sealed, digestOf, quietHours, contentExpiresAt"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{":now": values[":now"]},
+		})
+		if err == nil {
+			result.Stripped++
+		} else if _, ok := err.(*dynamodb.ConditionalCheckFailedException); !ok {
+			return result, fmt.Errorf("typesend: failed to strip expired envelope: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// ConsumeRateLimit keeps a counter item per window alongside the
+// envelopes, incremented only while it is below the limit.
+func (db *DynamoTypeSendDB) ConsumeRateLimit(ctx context.Context, key string, windowStart time.Time, window time.Duration, limit int) (bool, error) {
+	if db.client == nil {
+		return false, fmt.Errorf("typesend: ConsumeRateLimit requires a connection")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(rateLimitWindowKey(key, windowStart))},
+		},
+		UpdateExpression:    aws.String("ADD #count :one SET expiresAt = :expiresAt"),
+		ConditionExpression: aws.String("attribute_not_exists(#count) OR #count < :limit"),
+		ExpressionAttributeNames: map[string]*string{
+			"#count": aws.String("count"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":one":       {N: aws.String("1")},
+			":limit":     {N: aws.String(fmt.Sprintf("%d", limit))},
+			":expiresAt": {N: aws.String(fmt.Sprintf("%d", windowStart.Add(window+rateLimitGracePeriod).Unix()))},
+		},
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, input)
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return false, nil
+		}
+		return false, fmt.Errorf("typesend: failed to consume rate limit: %w", err)
+	}
+
+	return true, nil
+}
+
+func (db *DynamoTypeSendDB) ReleaseRateLimit(ctx context.Context, key string, windowStart time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: ReleaseRateLimit requires a connection")
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(rateLimitWindowKey(key, windowStart))},
+		},
+		UpdateExpression:    aws.String("ADD #count :minusOne"),
+		ConditionExpression: aws.String("#count > :zero"),
+		ExpressionAttributeNames: map[string]*string{
+			"#count": aws.String("count"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":minusOne": {N: aws.String("-1")},
+			":zero":     {N: aws.String("0")},
+		},
+	})
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return nil
+		}
+		return fmt.Errorf("typesend: failed to release rate limit: %w", err)
+	}
+	return nil
+}
+
+// Tombstones share the envelopes table, like idempotency keys.
+func dynamoTombstoneKey(hash string) string {
+	return "tombstone#" + hash
+}
+
+type dynamoTombstone struct {
+	ID       string    `dynamodbav:"id"`
+	Hash     string    `dynamodbav:"hash"`
+	ErasedAt time.Time `dynamodbav:"erasedAt"`
+}
+
+// recipientEnvelopes queries the to-index and toInternal-index GSIs.
+// Both are eventually consistent, so an envelope inserted moments
+// before may be missed.
+func (db *DynamoTypeSendDB) recipientEnvelopes(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendEnvelope, error) {
+	seen := map[string]bool{}
+	envelopes := []*typesend_schemas.TypeSendEnvelope{}
+
+	for _, index := range []struct {
+		name      string
+		attribute string
+		value     string
+	}{
+		{"to-index", "to", recipient.ToAddress},
+		{"toInternal-index", "toInternal", recipient.ToInternalID},
+	} {
+		if index.value == "" {
+			continue
+		}
+
+		var unmarshalErr error
+		err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(db.Config.EnvelopesTable),
+			IndexName:              aws.String(index.name),
+			KeyConditionExpression: aws.String("#recipient = :recipient"),
+			ExpressionAttributeNames: map[string]*string{
+				"#recipient": aws.String(index.attribute),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":recipient": {S: aws.String(index.value)},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				var envelope typesend_schemas.TypeSendEnvelope
+				if err := dynamodbattribute.UnmarshalMap(item, &envelope); err != nil {
+					unmarshalErr = err
+					return false
+				}
+				if seen[envelope.ID] {
+					continue
+				}
+				seen[envelope.ID] = true
+				envelopes = append(envelopes, &envelope)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to query %s: %w", index.name, err)
+		}
+		if unmarshalErr != nil {
+			return nil, fmt.Errorf("typesend: failed to unmarshal envelope: %w", unmarshalErr)
+		}
+	}
+
+	return envelopes, nil
+}
+
+// recipientSchedules scans the schedules table, which has no
+// recipient indexes as exports and erasures are rare.
+func (db *DynamoTypeSendDB) recipientSchedules(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendSchedule, error) {
+	filter := ""
+	values := map[string]*dynamodb.AttributeValue{}
+	if recipient.ToAddress != "" {
+		filter = "#to = :to"
+		values[":to"] = &dynamodb.AttributeValue{S: aws.String(recipient.ToAddress)}
+	}
+	if recipient.ToInternalID != "" {
+		if filter != "" {
+			filter += " OR "
+		}
+		filter += "toInternal = :toInternal"
+		values[":toInternal"] = &dynamodb.AttributeValue{S: aws.String(recipient.ToInternalID)}
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(db.Config.SchedulesTable),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	}
+	if recipient.ToAddress != "" {
+		input.ExpressionAttributeNames = map[string]*string{"#to": aws.String("to")}
+	}
+
+	schedules := []*typesend_schemas.TypeSendSchedule{}
+	var unmarshalErr error
+	err := db.client.ScanPagesWithContext(ctx, input, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var schedule typesend_schemas.TypeSendSchedule
+			if err := dynamodbattribute.UnmarshalMap(item, &schedule); err != nil {
+				unmarshalErr = err
+				return false
+			}
+			schedules = append(schedules, &schedule)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to scan schedules: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal schedule: %w", unmarshalErr)
+	}
+
+	return schedules, nil
+}
+
+// addressItems queries the address-index GSI for the suppressions
+// and preferences of each address.
+func (db *DynamoTypeSendDB) addressItems(ctx context.Context, addresses []string) ([]*typesend_schemas.TypeSendSuppression, []*typesend_schemas.TypeSendPreferences, error) {
+	suppressions := []*typesend_schemas.TypeSendSuppression{}
+	preferences := []*typesend_schemas.TypeSendPreferences{}
+	for _, address := range addresses {
+		var unmarshalErr error
+		err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(db.Config.EnvelopesTable),
+			IndexName:              aws.String("address-index"),
+			KeyConditionExpression: aws.String("address = :address"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":address": {S: aws.String(address)},
+			},
+		}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				if strings.HasPrefix(aws.StringValue(item["id"].S), "suppression#") {
+					var found dynamoSuppression
+					if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &found); unmarshalErr != nil {
+						return false
+					}
+					suppression := found.TypeSendSuppression
+					suppression.CreatedAt = suppression.CreatedAt.UTC()
+					suppressions = append(suppressions, &suppression)
+					continue
+				}
+
+				var found dynamoPreferences
+				if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &found); unmarshalErr != nil {
+					return false
+				}
+				preferences = append(preferences, loadedPreferences(&found.TypeSendPreferences))
+			}
+			return true
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("typesend: failed to query address-index: %w", err)
+		}
+		if unmarshalErr != nil {
+			return nil, nil, fmt.Errorf("typesend: failed to unmarshal address-index item: %w", unmarshalErr)
+		}
+	}
+	return suppressions, preferences, nil
+}
+
+func (db *DynamoTypeSendDB) ExportRecipientData(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) (*typesend_schemas.TypeSendRecipientExport, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: ExportRecipientData requires a connection")
+	}
+
+	export := &typesend_schemas.TypeSendRecipientExport{
+		Recipient:  recipient,
+		ExportedAt: time.Now().UTC(),
+		Tombstones: []*typesend_schemas.TypeSendTombstone{},
+	}
+
+	var err error
+	if export.Envelopes, err = db.recipientEnvelopes(ctx, recipient); err != nil {
+		return nil, err
+	}
+	if export.Schedules, err = db.recipientSchedules(ctx, recipient); err != nil {
+		return nil, err
+	}
+	export.Events = []*typesend_schemas.TypeSendEvent{}
+	for _, envelope := range export.Envelopes {
+		events, err := db.GetEnvelopeTimeline(ctx, envelope.ID)
+		if err != nil {
+			return nil, err
+		}
+		export.Events = append(export.Events, events...)
+	}
+	if export.Suppressions, export.Preferences, err = db.addressItems(ctx, matchedAddresses(recipient, export.Envelopes, export.Schedules)); err != nil {
+		return nil, err
+	}
+
+	for _, hash := range recipient.Hashes() {
+		tombstone, err := db.GetTombstone(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if tombstone != nil {
+			export.Tombstones = append(export.Tombstones, tombstone)
+		}
+	}
+
+	return export, nil
+}
+
+// EraseRecipient erases each envelope conditioned on the address it was
+// read with, so envelopes deleted in the meantime are skipped. UNSENT
+// envelopes are then FAILED in a separate update, so a dispatcher
+// sending one in between keeps its status.
+func (db *DynamoTypeSendDB) EraseRecipient(ctx context.Context, recipient typesend_schemas.TypeSendRecipient, erasedAt time.Time) (*typesend_schemas.TypeSendErasure, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: EraseRecipient requires a connection")
+	}
+
+	envelopes, err := db.recipientEnvelopes(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := db.recipientSchedules(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	// Found before the envelopes are erased in place.
+	suppressions, preferences, err := db.addressItems(ctx, matchedAddresses(recipient, envelopes, schedules))
+	if err != nil {
+		return nil, err
+	}
+
+	erasure := &typesend_schemas.TypeSendErasure{}
+	erased := []string{recipient.ToAddress, recipient.ToInternalID}
+
+	for _, envelope := range envelopes {
+		key := map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(envelope.ID)},
+		}
+		original := envelope.ToAddress
+		erased = append(erased, envelope.ToAddress, envelope.ToInternalID)
+		envelope.Erase()
+
+		// Keep in step with TypeSendEnvelope.Erase. An empty
+		// toInternal is stored as NULL, so is left alone.
+		update := "SET #to = :erasedTo"
+		values := map[string]*dynamodb.AttributeValue{
+			":to":       {S: aws.String(original)},
+			":erasedTo": {S: aws.String(envelope.ToAddress)},
+		}
+		if envelope.ToInternalID != "" {
+			update += ", toInternal = :erasedToInternal"
+			values[":erasedToInternal"] = &dynamodb.AttributeValue{S: aws.String(envelope.ToInternalID)}
+		}
+		update += " REMOVE variables, to_name, sealed, digestOf, quietHours, tz, contentExpiresAt"
+
+		_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(db.Config.EnvelopesTable),
+			Key:                 key,
+			ConditionExpression: aws.String("#to = :to"),
+			UpdateExpression:    aws.String(update),
+			ExpressionAttributeNames: map[string]*string{
+				"#to": aws.String("to"),
+			},
+			ExpressionAttributeValues: values,
+		})
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to erase envelope: %w", err)
+		}
+		erasure.Envelopes++
+
+		_, err = db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(db.Config.EnvelopesTable),
+			Key:                 key,
+			ConditionExpression: aws.String("#status = :unsent"),
+			// So it leaves the statusPriority-scheduledFor-index too.
+			UpdateExpression: aws.String("SET #status = :failed REMOVE statusPriority"),
+			ExpressionAttributeNames: map[string]*string{
+				"#status": aws.String("status"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":unsent": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_UNSENT))},
+				":failed": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendStatus_FAILED))},
+			},
+		})
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); err != nil && !ok {
+			return nil, fmt.Errorf("typesend: failed to fail erased envelope: %w", err)
+		}
+	}
+
+	for _, envelope := range envelopes {
+		if err := db.eraseEvents(ctx, envelope.ID, erasure); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, schedule := range schedules {
+		erased = append(erased, schedule.ToAddress, schedule.ToInternalID)
+		if err := db.DeleteSchedule(ctx, schedule.ID); err != nil {
+			return nil, err
+		}
+		erasure.Schedules++
+	}
+
+	// The pseudonymized copy is put before the original is deleted,
+	// so a failure part way leaves the suppression in place.
+	for _, suppression := range suppressions {
+		original := suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address)
+		suppression.Erase()
+		if err := db.PutSuppression(ctx, suppression); err != nil {
+			return nil, err
+		}
+		_, err := db.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(db.Config.EnvelopesTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(original)},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to erase suppression: %w", err)
+		}
+		erasure.Suppressions++
+	}
+
+	for _, found := range preferences {
+		_, err := db.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(db.Config.EnvelopesTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(preferencesKey(found.AppID, found.TenantID, found.Address))},
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to delete preferences: %w", err)
+		}
+		erasure.Preferences++
+	}
+
+	erasure.Tombstones = typesend_schemas.NewTombstones(erasedAt, erased...)
+	for _, tombstone := range erasure.Tombstones {
+		item, err := dynamodbattribute.MarshalMap(&dynamoTombstone{
+			ID:       dynamoTombstoneKey(tombstone.Hash),
+			Hash:     tombstone.Hash,
+			ErasedAt: tombstone.ErasedAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to marshal tombstone: %w", err)
+		}
+		_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(db.Config.EnvelopesTable),
+			Item:      item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to insert tombstone: %w", err)
+		}
+	}
+
+	return erasure, nil
+}
+
+func (db *DynamoTypeSendDB) GetTombstone(ctx context.Context, hash string) (*typesend_schemas.TypeSendTombstone, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetTombstone requires a connection")
+	}
+
+	output, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(dynamoTombstoneKey(hash))},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get tombstone: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var tombstone dynamoTombstone
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &tombstone); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal tombstone: %w", err)
+	}
+	return &typesend_schemas.TypeSendTombstone{Hash: tombstone.Hash, ErasedAt: tombstone.ErasedAt.UTC()}, nil
+}
+
+// Suppressions share the envelopes table too, keyed by suppressionKey.
+type dynamoSuppression struct {
+	ID string `dynamodbav:"id"`
+	typesend_schemas.TypeSendSuppression
+}
+
+func (db *DynamoTypeSendDB) PutSuppression(ctx context.Context, suppression *typesend_schemas.TypeSendSuppression) error {
+	stored, err := storedSuppression(suppression)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutSuppression requires a connection")
+	}
+
+	item, err := dynamodbattribute.MarshalMap(&dynamoSuppression{
+		ID:                  suppressionKey(stored.AppID, stored.TenantID, stored.Address),
+		TypeSendSuppression: *stored,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal suppression: %w", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put suppression: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetSuppression(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetSuppression requires a connection")
+	}
+
+	// Consistent, so a suppression applies from the moment it is put.
+	output, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(suppressionKey(appID, tenantID, address))},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get suppression: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var found dynamoSuppression
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &found); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal suppression: %w", err)
+	}
+	suppression := found.TypeSendSuppression
+	suppression.CreatedAt = suppression.CreatedAt.UTC()
+	return &suppression, nil
+}
+
+func (db *DynamoTypeSendDB) DeleteSuppression(ctx context.Context, appID string, tenantID string, address string) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeleteSuppression requires a connection")
+	}
+
+	_, err := db.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(suppressionKey(appID, tenantID, address))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete suppression: %w", err)
+	}
+	return nil
+}
+
+// An Apps categories share the envelopes table as a single item,
+// keyed by categoriesKey.
+type dynamoCategories struct {
+	ID         string                              `dynamodbav:"id"`
+	Categories []typesend_schemas.TypeSendCategory `dynamodbav:"categories"`
+}
+
+func (db *DynamoTypeSendDB) PutCategories(ctx context.Context, appID string, categories []*typesend_schemas.TypeSendCategory) error {
+	stored, err := storedCategories(appID, categories)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutCategories requires a connection")
+	}
+
+	item, err := dynamodbattribute.MarshalMap(&dynamoCategories{ID: categoriesKey(appID), Categories: stored})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal categories: %w", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put categories: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetCategories(ctx context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetCategories requires a connection")
+	}
+
+	output, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(categoriesKey(appID))},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get categories: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var found dynamoCategories
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &found); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal categories: %w", err)
+	}
+	return loadedCategories(found.Categories), nil
+}
+
+// Preferences share the envelopes table too, keyed by preferencesKey.
+type dynamoPreferences struct {
+	ID string `dynamodbav:"id"`
+	typesend_schemas.TypeSendPreferences
+}
+
+func (db *DynamoTypeSendDB) PutPreferences(ctx context.Context, preferences *typesend_schemas.TypeSendPreferences) error {
+	stored, err := storedPreferences(preferences)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutPreferences requires a connection")
+	}
+
+	item, err := dynamodbattribute.MarshalMap(&dynamoPreferences{
+		ID:                  preferencesKey(stored.AppID, stored.TenantID, stored.Address),
+		TypeSendPreferences: *stored,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal preferences: %w", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put preferences: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetPreferences(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetPreferences requires a connection")
+	}
+
+	// Consistent, so the preference center shows what was just saved.
+	output, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.Config.EnvelopesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(preferencesKey(appID, tenantID, address))},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get preferences: %w", err)
+	}
+	if output.Item == nil {
+		return nil, nil
+	}
+
+	var found dynamoPreferences
+	if err := dynamodbattribute.UnmarshalMap(output.Item, &found); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal preferences: %w", err)
+	}
+	preferences := found.TypeSendPreferences
+	return loadedPreferences(&preferences), nil
+}
+
+// DynamoDB caps BatchGetItem at 100 keys.
+const dynamoBatchGetLimit = 100
+
+// How many times unprocessed keys are retried before giving up.
+const dynamoBatchGetRetries = 5
+
+// GetRecipientStates reads every suppression, preferences and
+// tombstone item with consistent BatchGetItem calls.
+func (db *DynamoTypeSendDB) GetRecipientStates(ctx context.Context, keys []RecipientKey) ([]RecipientState, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetRecipientStates requires a connection")
+	}
+
+	unique := uniqueRecipientKeys(keys)
+	ids := make([]string, 0, 2*len(unique))
+	for _, key := range unique {
+		ids = append(ids,
+			suppressionKey(key.AppID, key.TenantID, key.Address),
+			preferencesKey(key.AppID, key.TenantID, key.Address))
+	}
+	for _, hash := range recipientHashes(keys) {
+		ids = append(ids, dynamoTombstoneKey(hash))
+	}
+
+	items, err := db.batchGetWithRetry(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get recipient states: %w", err)
+	}
+
+	suppressions := make(map[string]*typesend_schemas.TypeSendSuppression)
+	preferences := make(map[string]*typesend_schemas.TypeSendPreferences)
+	tombstones := make(map[string]*typesend_schemas.TypeSendTombstone)
+	for id, item := range items {
+		if strings.HasPrefix(id, "tombstone#") {
+			var found dynamoTombstone
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				return nil, fmt.Errorf("typesend: failed to unmarshal tombstone: %w", err)
+			}
+			tombstones[found.Hash] = &typesend_schemas.TypeSendTombstone{Hash: found.Hash, ErasedAt: found.ErasedAt}
+			continue
+		}
+		if strings.HasPrefix(id, "suppression#") {
+			var found dynamoSuppression
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				return nil, fmt.Errorf("typesend: failed to unmarshal suppression: %w", err)
+			}
+			suppressions[id] = &found.TypeSendSuppression
+			continue
+		}
+		var found dynamoPreferences
+		if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+			return nil, fmt.Errorf("typesend: failed to unmarshal preferences: %w", err)
+		}
+		preferences[id] = &found.TypeSendPreferences
+	}
+
+	return recipientStates(keys, suppressions, preferences, tombstones), nil
+}
+
+// batchGetWithRetry consistently reads items from the envelopes table
+// by ID, retrying unprocessed keys with backoff. The items found are
+// returned by ID.
+func (db *DynamoTypeSendDB) batchGetWithRetry(ctx context.Context, ids []string) (map[string]map[string]*dynamodb.AttributeValue, error) {
+	items := make(map[string]map[string]*dynamodb.AttributeValue, len(ids))
+
+	for start := 0; start < len(ids); start += dynamoBatchGetLimit {
+		pending := make([]map[string]*dynamodb.AttributeValue, 0, dynamoBatchGetLimit)
+		for _, id := range ids[start:min(start+dynamoBatchGetLimit, len(ids))] {
+			pending = append(pending, map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}})
+		}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > dynamoBatchGetRetries {
+				return nil, fmt.Errorf("%d keys were not processed after %d retries", len(pending), dynamoBatchGetRetries)
+			}
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(time.Duration(50<<attempt) * time.Millisecond):
+				}
+			}
+
+			out, err := db.client.BatchGetItemWithContext(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: map[string]*dynamodb.KeysAndAttributes{
+					db.Config.EnvelopesTable: {Keys: pending, ConsistentRead: aws.Bool(true)},
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			for _, item := range out.Responses[db.Config.EnvelopesTable] {
+				items[aws.StringValue(item["id"].S)] = item
+			}
+			pending = nil
+			if unprocessed, ok := out.UnprocessedKeys[db.Config.EnvelopesTable]; ok {
+				pending = unprocessed.Keys
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// Events share the envelopes table too, keyed by eventKey, and are
+// found with the sparse eventEnvelope-occurredAt-index, or by their
+// UTC day with the sparse eventDay-occurredAt-index.
+type dynamoEvent struct {
+	Key      string `dynamodbav:"id"`
+	EventDay string `dynamodbav:"eventDay"`
+	typesend_schemas.TypeSendEvent
+}
+
+func (db *DynamoTypeSendDB) AppendEvents(ctx context.Context, events []*typesend_schemas.TypeSendEvent) error {
+	stored, err := storedEvents(events)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: AppendEvents requires a connection")
+	}
+
+	for _, event := range stored {
+		item, err := dynamodbattribute.MarshalMap(&dynamoEvent{
+			Key:           eventKey(event.EnvelopeID, event.ID),
+			EventDay:      event.OccurredAt.Format(rollupDayFormat),
+			TypeSendEvent: *event,
+		})
+		if err != nil {
+			return fmt.Errorf("typesend: failed to marshal event: %w", err)
+		}
+
+		_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(db.Config.EnvelopesTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(id)"),
+		})
+		if err != nil {
+			if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+				continue
+			}
+			return fmt.Errorf("typesend: failed to append event: %w", err)
+		}
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetEnvelopeTimeline(ctx context.Context, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEnvelopeTimeline requires a connection")
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	var unmarshalErr error
+	err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.Config.EnvelopesTable),
+		IndexName:              aws.String("eventEnvelope-occurredAt-index"),
+		KeyConditionExpression: aws.String("eventEnvelope = :envelope"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":envelope": {S: aws.String(envelopeID)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var found dynamoEvent
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				unmarshalErr = err
+				return false
+			}
+			event := found.TypeSendEvent
+			events = append(events, loadedEvent(&event))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query eventEnvelope-occurredAt-index: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal event: %w", unmarshalErr)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// eraseEvents applies TypeSendEvent.Erase to the envelopes events,
+// counting those that had details in erasure.
+func (db *DynamoTypeSendDB) eraseEvents(ctx context.Context, envelopeID string, erasure *typesend_schemas.TypeSendErasure) error {
+	events, err := db.GetEnvelopeTimeline(ctx, envelopeID)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if len(event.Details) == 0 {
+			continue
+		}
+		_, err := db.client.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(db.Config.EnvelopesTable),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(eventKey(event.EnvelopeID, event.ID))},
+			},
+			ConditionExpression: aws.String("attribute_exists(id)"),
+			UpdateExpression:    aws.String("REMOVE details"),
+		})
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("typesend: failed to erase event: %w", err)
+		}
+		erasure.Events++
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetEventsByDay(ctx context.Context, day time.Time) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEventsByDay requires a connection")
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	var unmarshalErr error
+	err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.Config.EnvelopesTable),
+		IndexName:              aws.String("eventDay-occurredAt-index"),
+		KeyConditionExpression: aws.String("eventDay = :day"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":day": {S: aws.String(typesend_schemas.RollupDay(day).Format(rollupDayFormat))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var found dynamoEvent
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				unmarshalErr = err
+				return false
+			}
+			event := found.TypeSendEvent
+			events = append(events, loadedEvent(&event))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query eventDay-occurredAt-index: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal event: %w", unmarshalErr)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (db *DynamoTypeSendDB) GetEventByProviderMessageID(ctx context.Context, provider string, messageID string) (*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEventByProviderMessageID requires a connection")
+	}
+	if messageID == "" {
+		return nil, nil
+	}
+
+	var events []*typesend_schemas.TypeSendEvent
+	var unmarshalErr error
+	err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.Config.EnvelopesTable),
+		IndexName:              aws.String("providerMessageId-index"),
+		KeyConditionExpression: aws.String("providerMessageId = :messageId"),
+		FilterExpression:       aws.String("#provider = :provider"),
+		ExpressionAttributeNames: map[string]*string{
+			"#provider": aws.String("provider"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":messageId": {S: aws.String(messageID)},
+			":provider":  {S: aws.String(provider)},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var found dynamoEvent
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				unmarshalErr = err
+				return false
+			}
+			event := found.TypeSendEvent
+			events = append(events, loadedEvent(&event))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query providerMessageId-index: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal event: %w", unmarshalErr)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	sortEvents(events)
+	return events[0], nil
+}
+
+// Rollups share the envelopes table too, keyed by rollupKey, and
+// are found with the sparse rollupApp-rollupKey-index, where
+// rollupKey is the rollupSortKey.
+type dynamoRollup struct {
+	Key       string `dynamodbav:"id"`
+	RollupApp string `dynamodbav:"rollupApp"`
+	RollupKey string `dynamodbav:"rollupKey"`
+	typesend_schemas.TypeSendRollup
+}
+
+func (db *DynamoTypeSendDB) PutRollups(ctx context.Context, rollups []*typesend_schemas.TypeSendRollup) error {
+	stored, err := storedRollups(rollups)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutRollups requires a connection")
+	}
+
+	requests := make([]*dynamodb.WriteRequest, 0, len(stored))
+	for _, rollup := range stored {
+		item, err := dynamodbattribute.MarshalMap(&dynamoRollup{
+			Key:            rollupKey(rollup),
+			RollupApp:      rollup.AppID,
+			RollupKey:      rollupSortKey(rollup),
+			TypeSendRollup: *rollup,
+		})
+		if err != nil {
+			return fmt.Errorf("typesend: failed to marshal rollup: %w", err)
+		}
+		requests = append(requests, &dynamodb.WriteRequest{
+			PutRequest: &dynamodb.PutRequest{Item: item},
+		})
+	}
+
+	for start := 0; start < len(requests); start += dynamoBatchWriteLimit {
+		end := min(start+dynamoBatchWriteLimit, len(requests))
+
+		unprocessed, err := db.batchWriteWithRetry(ctx, requests[start:end])
+		if err != nil {
+			return fmt.Errorf("typesend: failed to put rollups: %w", err)
+		}
+		if len(unprocessed) > 0 {
+			return fmt.Errorf("typesend: %d rollups were not processed after %d retries", len(unprocessed), dynamoBatchWriteRetries)
+		}
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetRollups(ctx context.Context, query typesend_schemas.TypeSendRollupQuery) ([]*typesend_schemas.TypeSendRollup, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetRollups requires a connection")
+	}
+
+	// Keys start with the day, so this spans From through To,
+	// leaving Matches to drop the day after and other tenants.
+	var rollups []*typesend_schemas.TypeSendRollup
+	var unmarshalErr error
+	err := db.client.QueryPagesWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.Config.EnvelopesTable),
+		IndexName:              aws.String("rollupApp-rollupKey-index"),
+		KeyConditionExpression: aws.String("rollupApp = :app and rollupKey between :from and :to"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":app":  {S: aws.String(query.AppID)},
+			":from": {S: aws.String(typesend_schemas.RollupDay(query.From).Format(rollupDayFormat))},
+			":to":   {S: aws.String(typesend_schemas.RollupDay(query.To).AddDate(0, 0, 1).Format(rollupDayFormat))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			var found dynamoRollup
+			if err := dynamodbattribute.UnmarshalMap(item, &found); err != nil {
+				unmarshalErr = err
+				return false
+			}
+			rollup := found.TypeSendRollup
+			if query.Matches(&rollup) {
+				rollups = append(rollups, loadedRollup(&rollup))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query rollupApp-rollupKey-index: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal rollup: %w", unmarshalErr)
+	}
+	sortRollups(rollups)
+	return rollups, nil
+}
+
+func (db *DynamoTypeSendDB) InsertSchedule(ctx context.Context, schedule *typesend_schemas.TypeSendSchedule) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: InsertSchedule requires a connection")
+	}
+
+	item, err := dynamodbattribute.MarshalMap(schedule)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to marshal schedule: %w", err)
+	}
+
+	_, err = db.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(db.Config.SchedulesTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetScheduleByID(ctx context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetScheduleByID requires a connection")
+	}
+
+	out, err := db.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(db.Config.SchedulesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(scheduleID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get schedule: %w", err)
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+
+	var schedule *typesend_schemas.TypeSendSchedule
+	if err := dynamodbattribute.UnmarshalMap(out.Item, &schedule); err != nil {
+		return nil, fmt.Errorf("typesend: failed to unmarshal schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+func (db *DynamoTypeSendDB) UpdateScheduleState(ctx context.Context, scheduleID string, state typesend_schemas.TypeSendScheduleState, nextRunAt time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: UpdateScheduleState requires a connection")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.SchedulesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(scheduleID)},
+		},
+		UpdateExpression:    aws.String("SET #state = :state"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#state": aws.String("state"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":state": {N: aws.String(fmt.Sprintf("%d", state))},
+		},
+	}
+
+	if !nextRunAt.IsZero() {
+		next, err := dynamodbattribute.Marshal(nextRunAt)
+		if err != nil {
+			return fmt.Errorf("typesend: failed to marshal nextRunAt: %w", err)
+		}
+		input.UpdateExpression = aws.String("SET #state = :state, nextRunAt = :next")
+		input.ExpressionAttributeValues[":next"] = next
+	}
+
+	_, err := db.client.UpdateItemWithContext(ctx, input)
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return fmt.Errorf("typesend: schedule with ID %s not found", scheduleID)
+		}
+		return fmt.Errorf("typesend: failed to update schedule state: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeleteSchedule requires a connection")
+	}
+
+	_, err := db.client.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(db.Config.SchedulesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(scheduleID)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *DynamoTypeSendDB) GetSchedulesDue(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendSchedule, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetSchedulesDue requires a connection")
+	}
+	ch := make(chan *typesend_schemas.TypeSendSchedule)
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(db.Config.SchedulesTable),
+		IndexName:              aws.String("state-nextRunAt-index"),
+		KeyConditionExpression: aws.String("#state = :active and nextRunAt <= :ts"),
+		ExpressionAttributeNames: map[string]*string{
+			"#state": aws.String("state"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":active": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendScheduleState_ACTIVE))},
+			":ts":     {S: aws.String(timestamp.Format(time.RFC3339))},
+		},
+	}
+
+	go func() {
+		defer close(ch)
+		err := db.client.QueryPagesWithContext(ctx, input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+			for _, item := range page.Items {
+				var schedule typesend_schemas.TypeSendSchedule
+				if err := dynamodbattribute.UnmarshalMap(item, &schedule); err != nil {
+					if db.logger != nil {
+						db.logger.Errorf("typesend: failed to unmarshal schedule: %v", err)
+					} else {
+						log.Printf("typesend: failed to unmarshal schedule: %v", err)
+					}
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					return false
+				case ch <- &schedule:
+				}
+			}
+			return !lastPage
+		})
+		if err != nil {
+			if db.logger != nil {
+				db.logger.Errorf("typesend: error during schedule query: %v", err)
+			} else {
+				log.Printf("typesend: error during schedule query: %v", err)
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// AdvanceSchedule is conditioned on the NextRunAt the caller expanded,
+// so concurrent dispatch runs cannot both move the same schedule on.
+func (db *DynamoTypeSendDB) AdvanceSchedule(ctx context.Context, scheduleID string, from time.Time, next time.Time) (bool, error) {
+	if db.client == nil {
+		return false, fmt.Errorf("typesend: AdvanceSchedule requires a connection")
+	}
+
+	fromValue, err := dynamodbattribute.Marshal(from)
+	if err != nil {
+		return false, fmt.Errorf("typesend: failed to marshal nextRunAt: %w", err)
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(db.Config.SchedulesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(scheduleID)},
+		},
+		ConditionExpression: aws.String("#state = :active AND nextRunAt = :from"),
+		ExpressionAttributeNames: map[string]*string{
+			"#state": aws.String("state"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":active": {N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendScheduleState_ACTIVE))},
+			":from":   fromValue,
+		},
+	}
+
+	if next.IsZero() {
+		input.UpdateExpression = aws.String("SET #state = :completed")
+		input.ExpressionAttributeValues[":completed"] = &dynamodb.AttributeValue{N: aws.String(fmt.Sprintf("%d", typesend_schemas.TypeSendScheduleState_COMPLETED))}
+	} else {
+		nextValue, err := dynamodbattribute.Marshal(next)
+		if err != nil {
+			return false, fmt.Errorf("typesend: failed to marshal nextRunAt: %w", err)
+		}
+		input.UpdateExpression = aws.String("SET nextRunAt = :next")
+		input.ExpressionAttributeValues[":next"] = nextValue
+	}
+
+	_, err = db.client.UpdateItemWithContext(ctx, input)
+	if err != nil {
+		if _, ok := err.(*dynamodb.ConditionalCheckFailedException); ok {
+			return false, nil
+		}
+		return false, fmt.Errorf("typesend: failed to advance schedule: %w", err)
+	}
+
+	return true, nil
+}
+
 func (db *DynamoTypeSendDB) GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
 	if db.client == nil {
 		return nil, fmt.Errorf("typesend: GetTemplateByID requires a connection")
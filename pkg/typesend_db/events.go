@@ -0,0 +1,54 @@
+package typesend_db
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func eventKey(envelopeID string, eventID string) string {
+	return fmt.Sprintf("event#%s#%s", envelopeID, eventID)
+}
+
+// storedEvents validates every event before any is stored, returning
+// the copies to store with OccurredAt defaulted.
+func storedEvents(events []*typesend_schemas.TypeSendEvent) ([]*typesend_schemas.TypeSendEvent, error) {
+	stored := make([]*typesend_schemas.TypeSendEvent, len(events))
+	for i, event := range events {
+		if err := event.Validate(); err != nil {
+			return nil, err
+		}
+
+		copied := *event
+		copied.Details = maps.Clone(event.Details)
+		if copied.OccurredAt.IsZero() {
+			copied.OccurredAt = time.Now()
+		}
+		copied.OccurredAt = copied.OccurredAt.UTC()
+		stored[i] = &copied
+	}
+	return stored, nil
+}
+
+// sortEvents orders an event log oldest first, breaking ties by ID.
+func sortEvents(events []*typesend_schemas.TypeSendEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].OccurredAt.Equal(events[j].OccurredAt) {
+			return events[i].OccurredAt.Before(events[j].OccurredAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+// loadedEvent undoes the differences between backends, which
+// read back empty Details as either nil or empty.
+func loadedEvent(event *typesend_schemas.TypeSendEvent) *typesend_schemas.TypeSendEvent {
+	if len(event.Details) == 0 {
+		event.Details = nil
+	}
+	event.OccurredAt = event.OccurredAt.UTC()
+	return event
+}
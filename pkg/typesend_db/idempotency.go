@@ -0,0 +1,22 @@
+package typesend_db
+
+import (
+	"fmt"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// idempotencyRecord is the dedup item stored alongside envelopes
+// to reserve an idempotency key until it expires.
+type idempotencyRecord struct {
+	ID         string `dynamodbav:"id"`
+	EnvelopeID string `dynamodbav:"envelope"`
+	// Unix seconds
+	ExpiresAt int64 `dynamodbav:"expiresAt"`
+}
+
+// Idempotency keys are scoped to the App and Tenant
+// so two apps can never collide on the same key.
+func scopedIdempotencyKey(envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string) string {
+	return fmt.Sprintf("idempotency#%s#%s#%s", envelope.AppID, envelope.TenantID, idempotencyKey)
+}
@@ -0,0 +1,76 @@
+CREATE TABLE typesend_envelopes (
+    id                     TEXT PRIMARY KEY,
+    app                    TEXT NOT NULL,
+    tenant                 TEXT NOT NULL,
+    template_id            TEXT NOT NULL,
+    to_address             TEXT NOT NULL,
+    to_name                TEXT NOT NULL DEFAULT '',
+    to_internal            TEXT NOT NULL DEFAULT '',
+    message_group          TEXT NOT NULL DEFAULT '',
+    reference_id           TEXT NOT NULL DEFAULT '',
+    variables              JSONB,
+    status                 SMALLINT NOT NULL DEFAULT 0,
+    priority               SMALLINT NOT NULL DEFAULT 0,
+    scheduled_for          TIMESTAMPTZ NOT NULL,
+    original_scheduled_for TIMESTAMPTZ,
+    schedule_id            TEXT NOT NULL DEFAULT '',
+    digest_of              JSONB,
+    digest_id              TEXT NOT NULL DEFAULT '',
+    time_zone              TEXT NOT NULL DEFAULT '',
+    quiet_hours            JSONB,
+    -- Set while a dispatcher is working through the envelope,
+    -- so concurrent dispatchers skip it until the lease runs out.
+    claimed_until          TIMESTAMPTZ
+);
+
+CREATE INDEX typesend_envelopes_ready_idx
+    ON typesend_envelopes (scheduled_for)
+    WHERE status = 0;
+
+CREATE TABLE typesend_idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    envelope_id TEXT NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE typesend_rate_limits (
+    key        TEXT PRIMARY KEY,
+    count      INTEGER NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE typesend_schedules (
+    id            TEXT PRIMARY KEY,
+    app           TEXT NOT NULL,
+    tenant        TEXT NOT NULL,
+    template_id   TEXT NOT NULL,
+    to_address    TEXT NOT NULL,
+    to_name       TEXT NOT NULL DEFAULT '',
+    to_internal   TEXT NOT NULL DEFAULT '',
+    message_group TEXT NOT NULL DEFAULT '',
+    variables     JSONB,
+    priority      SMALLINT NOT NULL DEFAULT 0,
+    time_zone     TEXT NOT NULL DEFAULT '',
+    quiet_hours   JSONB,
+    recurrence    JSONB NOT NULL,
+    state         SMALLINT NOT NULL DEFAULT 0,
+    next_run_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX typesend_schedules_due_idx
+    ON typesend_schedules (next_run_at)
+    WHERE state = 0;
+
+CREATE TABLE typesend_templates (
+    id            TEXT NOT NULL,
+    tenant        TEXT NOT NULL,
+    content       TEXT NOT NULL,
+    subject       TEXT NOT NULL,
+    from_address  TEXT NOT NULL,
+    from_name     TEXT NOT NULL DEFAULT '',
+    transactional BOOLEAN NOT NULL DEFAULT FALSE,
+    priority      SMALLINT NOT NULL DEFAULT 0,
+    -- Nanoseconds, as time.Duration.
+    digest_window BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (id, tenant)
+);
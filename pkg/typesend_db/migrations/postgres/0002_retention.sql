@@ -0,0 +1,18 @@
+-- Unix seconds, 0 means never; see TypeSendEnvelope.
+ALTER TABLE typesend_envelopes
+    ADD COLUMN content_expires_at BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN expires_at         BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX typesend_envelopes_content_expires_idx
+    ON typesend_envelopes (content_expires_at)
+    WHERE content_expires_at > 0;
+
+CREATE INDEX typesend_envelopes_expires_idx
+    ON typesend_envelopes (expires_at)
+    WHERE expires_at > 0;
+
+CREATE INDEX typesend_idempotency_keys_expires_idx
+    ON typesend_idempotency_keys (expires_at);
+
+CREATE INDEX typesend_rate_limits_expires_idx
+    ON typesend_rate_limits (expires_at);
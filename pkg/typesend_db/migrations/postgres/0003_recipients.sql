@@ -0,0 +1,18 @@
+-- Finds everything sent to a recipient, for exports and erasures.
+CREATE INDEX typesend_envelopes_to_address_idx
+    ON typesend_envelopes (to_address);
+
+CREATE INDEX typesend_envelopes_to_internal_idx
+    ON typesend_envelopes (to_internal);
+
+CREATE INDEX typesend_schedules_to_address_idx
+    ON typesend_schedules (to_address);
+
+CREATE INDEX typesend_schedules_to_internal_idx
+    ON typesend_schedules (to_internal);
+
+-- One per erased address or internal ID; see TypeSendTombstone.
+CREATE TABLE typesend_tombstones (
+    hash      TEXT PRIMARY KEY,
+    erased_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,6 @@
+-- Encrypted Variables (and ToName); see TypeSendSealed.
+ALTER TABLE typesend_envelopes
+    ADD COLUMN sealed JSONB;
+
+ALTER TABLE typesend_schedules
+    ADD COLUMN sealed JSONB;
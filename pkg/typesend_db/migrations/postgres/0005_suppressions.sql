@@ -0,0 +1,10 @@
+-- Addresses that must not be emailed; see TypeSendSuppression.
+CREATE TABLE typesend_suppressions (
+    app        TEXT NOT NULL,
+    tenant     TEXT NOT NULL,
+    address    TEXT NOT NULL,
+    reason     INTEGER NOT NULL,
+    note       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (app, tenant, address)
+);
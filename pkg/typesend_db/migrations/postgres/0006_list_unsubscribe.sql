@@ -0,0 +1,3 @@
+-- See TypeSendTemplate.OmitListUnsubscribe.
+ALTER TABLE typesend_templates
+    ADD COLUMN omit_list_unsubscribe BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,24 @@
+-- See TypeSendTemplate.Category.
+ALTER TABLE typesend_templates
+    ADD COLUMN category TEXT NOT NULL DEFAULT '';
+
+-- See TypeSendCategory; position keeps the order they were put in.
+CREATE TABLE typesend_categories (
+    app         TEXT NOT NULL,
+    id          TEXT NOT NULL,
+    position    INTEGER NOT NULL,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    mandatory   BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (app, id)
+);
+
+-- See TypeSendPreferences.
+CREATE TABLE typesend_preferences (
+    app        TEXT NOT NULL,
+    tenant     TEXT NOT NULL,
+    address    TEXT NOT NULL,
+    opted_out  TEXT[] NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (app, tenant, address)
+);
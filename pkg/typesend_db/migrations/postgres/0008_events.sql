@@ -0,0 +1,13 @@
+-- Envelope event logs; see TypeSendEvent.
+CREATE TABLE typesend_events (
+    envelope_id         TEXT NOT NULL,
+    id                  TEXT NOT NULL,
+    app                 TEXT NOT NULL DEFAULT '',
+    tenant              TEXT NOT NULL DEFAULT '',
+    type                INTEGER NOT NULL,
+    provider            TEXT NOT NULL DEFAULT '',
+    provider_message_id TEXT NOT NULL DEFAULT '',
+    occurred_at         TIMESTAMPTZ NOT NULL,
+    details             JSONB,
+    PRIMARY KEY (envelope_id, id)
+);
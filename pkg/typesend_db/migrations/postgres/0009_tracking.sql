@@ -0,0 +1,5 @@
+-- See TypeSendTemplate.Sensitive and its tracking opt outs.
+ALTER TABLE typesend_templates
+    ADD COLUMN sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN disable_open_tracking BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN disable_click_tracking BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,21 @@
+-- See TypeSendEvent.TemplateID and TypeSendRollup.
+ALTER TABLE typesend_events ADD COLUMN template TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX typesend_events_occurred_at_idx
+    ON typesend_events (occurred_at);
+
+CREATE TABLE typesend_rollups (
+    app          TEXT NOT NULL,
+    tenant       TEXT NOT NULL DEFAULT '',
+    template     TEXT NOT NULL DEFAULT '',
+    day          DATE NOT NULL,
+    sent         BIGINT NOT NULL DEFAULT 0,
+    delivered    BIGINT NOT NULL DEFAULT 0,
+    bounced      BIGINT NOT NULL DEFAULT 0,
+    opened       BIGINT NOT NULL DEFAULT 0,
+    unique_opens BIGINT NOT NULL DEFAULT 0,
+    clicked      BIGINT NOT NULL DEFAULT 0,
+    complained   BIGINT NOT NULL DEFAULT 0,
+    updated_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (app, day, tenant, template)
+);
@@ -0,0 +1,4 @@
+-- Finds the suppressions held for a recipient, with any App or
+-- Tenant, for exports and erasures.
+CREATE INDEX typesend_suppressions_address_idx
+    ON typesend_suppressions (address);
@@ -0,0 +1,4 @@
+-- Finds the preferences held for a recipient, with any App or
+-- Tenant, for exports and erasures.
+CREATE INDEX typesend_preferences_address_idx
+    ON typesend_preferences (address);
@@ -0,0 +1,5 @@
+-- Ties provider notifications back to the event, and so the
+-- envelope, of the message they report on.
+CREATE INDEX typesend_events_provider_message_idx
+    ON typesend_events (provider, provider_message_id)
+    WHERE provider_message_id <> '';
@@ -0,0 +1,3 @@
+-- See TypeSendTemplate.EnableTracking.
+ALTER TABLE typesend_templates
+    ADD COLUMN enable_tracking BOOLEAN NOT NULL DEFAULT FALSE;
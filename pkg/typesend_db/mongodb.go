@@ -0,0 +1,1803 @@
+package typesend_db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// How long envelopes handed out by GetMessagesReadyToSend are
+// hidden from other dispatchers. Envelopes that are not moved
+// out of UNSENT (e.g. rate limited) become ready again after it.
+const DefaultMongoClaimLease = time.Minute
+
+func NewMongoDB(ctx context.Context, conf *MongoConfig) (*MongoTypeSendDB, error) {
+	db := &MongoTypeSendDB{
+		Config: conf,
+	}
+
+	if conf.ForceClient != nil {
+		db.client = conf.ForceClient
+	} else if err := db.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := db.EnsureIndexes(ctx); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+type MongoConfig struct {
+	// e.g. "mongodb://localhost:27017"
+	URI      string
+	Database string
+
+	// Optional; defaults to DefaultMongoClaimLease.
+	ClaimLease time.Duration
+
+	ForceClient *mongo.Client
+}
+
+type MongoTypeSendDB struct {
+	Config *MongoConfig
+	logger typesend_schemas.Logger
+	client *mongo.Client
+}
+
+func (db *MongoTypeSendDB) Connect(ctx context.Context) error {
+	client, err := mongo.Connect(options.Client().ApplyURI(db.Config.URI))
+	if err != nil {
+		return fmt.Errorf("typesend: failed to connect to mongo: %w", err)
+	}
+
+	if err := client.Ping(ctx, nil); err != nil {
+		return fmt.Errorf("typesend: failed to ping mongo: %w", err)
+	}
+
+	db.client = client
+	return nil
+}
+
+func (db *MongoTypeSendDB) collection(name string) *mongo.Collection {
+	return db.client.Database(db.Config.Database).Collection(name)
+}
+
+func (db *MongoTypeSendDB) envelopes() *mongo.Collection {
+	return db.collection("envelopes")
+}
+
+func (db *MongoTypeSendDB) templates() *mongo.Collection {
+	return db.collection("templates")
+}
+
+func (db *MongoTypeSendDB) schedules() *mongo.Collection {
+	return db.collection("schedules")
+}
+
+func (db *MongoTypeSendDB) idempotencyKeys() *mongo.Collection {
+	return db.collection("idempotency_keys")
+}
+
+func (db *MongoTypeSendDB) rateLimits() *mongo.Collection {
+	return db.collection("rate_limits")
+}
+
+func (db *MongoTypeSendDB) tombstones() *mongo.Collection {
+	return db.collection("tombstones")
+}
+
+func (db *MongoTypeSendDB) suppressions() *mongo.Collection {
+	return db.collection("suppressions")
+}
+
+func (db *MongoTypeSendDB) categories() *mongo.Collection {
+	return db.collection("categories")
+}
+
+func (db *MongoTypeSendDB) preferences() *mongo.Collection {
+	return db.collection("preferences")
+}
+
+func (db *MongoTypeSendDB) events() *mongo.Collection {
+	return db.collection("events")
+}
+
+func (db *MongoTypeSendDB) rollups() *mongo.Collection {
+	return db.collection("rollups")
+}
+
+// EnsureIndexes creates the indexes matching the DynamoDB GSIs, plus
+// TTL indexes that expire idempotency keys and rate limit windows.
+// It is safe to call on every start.
+func (db *MongoTypeSendDB) EnsureIndexes(ctx context.Context) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: EnsureIndexes requires a connection")
+	}
+
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		db.envelopes(): {
+			// status-scheduledFor-index
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "scheduledFor", Value: 1}}},
+			// Plain Unix seconds rather than TTL indexes, as only
+			// finished envelopes may be purged.
+			{Keys: bson.D{{Key: "contentExpiresAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetSparse(true)},
+			// to-index and toInternal-index
+			{Keys: bson.D{{Key: "to", Value: 1}}},
+			{Keys: bson.D{{Key: "toInternal", Value: 1}}},
+		},
+		db.schedules(): {
+			// state-nextRunAt-index
+			{Keys: bson.D{{Key: "state", Value: 1}, {Key: "nextRunAt", Value: 1}}},
+			{Keys: bson.D{{Key: "to", Value: 1}}},
+			{Keys: bson.D{{Key: "toInternal", Value: 1}}},
+		},
+		db.suppressions(): {
+			// address-index
+			{Keys: bson.D{{Key: "address", Value: 1}}},
+		},
+		db.preferences(): {
+			{Keys: bson.D{{Key: "address", Value: 1}}},
+		},
+		db.templates(): {
+			{Keys: bson.D{{Key: "id", Value: 1}, {Key: "tenant", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		db.events(): {
+			// envelope-occurredAt-index
+			{Keys: bson.D{{Key: "eventEnvelope", Value: 1}, {Key: "occurredAt", Value: 1}}},
+			// eventDay-occurredAt-index
+			{Keys: bson.D{{Key: "occurredAt", Value: 1}}},
+			// providerMessageId-index
+			{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "providerMessageId", Value: 1}}},
+		},
+		db.rollups(): {
+			// rollupApp-rollupKey-index
+			{Keys: bson.D{{Key: "app", Value: 1}, {Key: "day", Value: 1}}},
+		},
+		db.idempotencyKeys(): {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		db.rateLimits(): {
+			{Keys: bson.D{{Key: "expiresAt", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("typesend: failed to create %s indexes: %w", collection.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+func (db *MongoTypeSendDB) claimLease() time.Duration {
+	if db.Config.ClaimLease > 0 {
+		return db.Config.ClaimLease
+	}
+	return DefaultMongoClaimLease
+}
+
+func (db *MongoTypeSendDB) logError(format string, args ...interface{}) {
+	if db.logger != nil {
+		db.logger.Errorf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// mongoEnvelope is how envelopes are stored, using the same
+// attribute names as DynamoDB so the two can be queried alike.
+type mongoEnvelope struct {
+	ID                   string                               `bson:"_id"`
+	AppID                string                               `bson:"app"`
+	TenantID             string                               `bson:"tenant"`
+	TemplateID           string                               `bson:"tid"`
+	ToAddress            string                               `bson:"to"`
+	ToName               string                               `bson:"to_name"`
+	ToInternalID         string                               `bson:"toInternal"`
+	MessageGroupID       string                               `bson:"group"`
+	ReferenceID          string                               `bson:"ref"`
+	Variables            map[string]interface{}               `bson:"variables"`
+	Status               typesend_schemas.TypeSendStatus      `bson:"status"`
+	Priority             typesend_schemas.TypeSendPriority    `bson:"priority"`
+	ScheduledFor         time.Time                            `bson:"scheduledFor"`
+	OriginalScheduledFor time.Time                            `bson:"originalScheduledFor,omitempty"`
+	ScheduleID           string                               `bson:"schedule,omitempty"`
+	DigestOf             []string                             `bson:"digestOf,omitempty"`
+	DigestID             string                               `bson:"digestId,omitempty"`
+	TimeZone             string                               `bson:"tz,omitempty"`
+	QuietHours           *typesend_schemas.TypeSendQuietHours `bson:"quietHours,omitempty"`
+	ContentExpiresAt     int64                                `bson:"contentExpiresAt,omitempty"`
+	ExpiresAt            int64                                `bson:"expiresAt,omitempty"`
+	Sealed               *typesend_schemas.TypeSendSealed     `bson:"sealed,omitempty"`
+}
+
+func toMongoEnvelope(envelope *typesend_schemas.TypeSendEnvelope) *mongoEnvelope {
+	return &mongoEnvelope{
+		ID:                   envelope.ID,
+		AppID:                envelope.AppID,
+		TenantID:             envelope.TenantID,
+		TemplateID:           envelope.TemplateID,
+		ToAddress:            envelope.ToAddress,
+		ToName:               envelope.ToName,
+		ToInternalID:         envelope.ToInternalID,
+		MessageGroupID:       envelope.MessageGroupID,
+		ReferenceID:          envelope.ReferenceID,
+		Variables:            envelope.Variables,
+		Status:               envelope.Status,
+		Priority:             envelope.Priority,
+		ScheduledFor:         envelope.ScheduledFor,
+		OriginalScheduledFor: envelope.OriginalScheduledFor,
+		ScheduleID:           envelope.ScheduleID,
+		DigestOf:             envelope.DigestOf,
+		DigestID:             envelope.DigestID,
+		TimeZone:             envelope.TimeZone,
+		QuietHours:           envelope.QuietHours,
+		ContentExpiresAt:     envelope.ContentExpiresAt,
+		ExpiresAt:            envelope.ExpiresAt,
+		Sealed:               envelope.Sealed,
+	}
+}
+
+func (m *mongoEnvelope) envelope() *typesend_schemas.TypeSendEnvelope {
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ID:             m.ID,
+		AppID:          m.AppID,
+		TenantID:       m.TenantID,
+		TemplateID:     m.TemplateID,
+		ToAddress:      m.ToAddress,
+		ToName:         m.ToName,
+		ToInternalID:   m.ToInternalID,
+		MessageGroupID: m.MessageGroupID,
+		ReferenceID:    m.ReferenceID,
+		Variables:      plainMongoMap(m.Variables),
+		Status:         m.Status,
+		Priority:       m.Priority,
+		ScheduledFor:   m.ScheduledFor.UTC(),
+		ScheduleID:     m.ScheduleID,
+		DigestOf:       m.DigestOf,
+		DigestID:       m.DigestID,
+		TimeZone:       m.TimeZone,
+		QuietHours:     m.QuietHours,
+
+		ContentExpiresAt: m.ContentExpiresAt,
+		ExpiresAt:        m.ExpiresAt,
+		Sealed:           m.Sealed,
+	}
+	if !m.OriginalScheduledFor.IsZero() {
+		envelope.OriginalScheduledFor = m.OriginalScheduledFor.UTC()
+	}
+	return envelope
+}
+
+// plainMongoMap converts the bson.D and bson.A values the driver
+// decodes nested documents into back to plain maps and slices,
+// so Variables look the same as from any other database.
+func plainMongoMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	plain := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		plain[key] = plainMongoValue(value)
+	}
+	return plain
+}
+
+func plainMongoValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		plain := make(map[string]interface{}, len(v))
+		for _, element := range v {
+			plain[element.Key] = plainMongoValue(element.Value)
+		}
+		return plain
+	case bson.M:
+		return plainMongoMap(v)
+	case bson.A:
+		plain := make([]interface{}, len(v))
+		for i, element := range v {
+			plain[i] = plainMongoValue(element)
+		}
+		return plain
+	}
+	return value
+}
+
+func (db *MongoTypeSendDB) Insert(envelope *typesend_schemas.TypeSendEnvelope) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: Insert requires a connection")
+	}
+
+	_, err := db.envelopes().InsertOne(context.Background(), toMongoEnvelope(envelope))
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert envelope: %w", err)
+	}
+
+	return nil
+}
+
+// InsertBatch uses an unordered InsertMany, so one
+// failed envelope does not stop the rest.
+func (db *MongoTypeSendDB) InsertBatch(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) []error {
+	errs := make([]error, len(envelopes))
+
+	if db.client == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: InsertBatch requires a connection")
+		}
+		return errs
+	}
+
+	if len(envelopes) == 0 {
+		return errs
+	}
+
+	documents := make([]*mongoEnvelope, len(envelopes))
+	for i, envelope := range envelopes {
+		documents[i] = toMongoEnvelope(envelope)
+	}
+
+	_, err := db.envelopes().InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err == nil {
+		return errs
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			errs[writeErr.Index] = fmt.Errorf("typesend: failed to insert envelope: %w", writeErr)
+		}
+		return errs
+	}
+
+	for i := range errs {
+		errs[i] = fmt.Errorf("typesend: failed to insert envelope batch: %w", err)
+	}
+	return errs
+}
+
+type mongoIdempotencyRecord struct {
+	ID         string    `bson:"_id"`
+	EnvelopeID string    `bson:"envelope"`
+	ExpiresAt  time.Time `bson:"expiresAt"`
+}
+
+// InsertIdempotent claims the key before inserting the envelope.
+// Without a replica set the two writes cannot share a transaction,
+// so the key is released again if the envelope insert fails.
+func (db *MongoTypeSendDB) InsertIdempotent(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string, expiresAt time.Time) (string, error) {
+	if db.client == nil {
+		return "", fmt.Errorf("typesend: InsertIdempotent requires a connection")
+	}
+
+	key := scopedIdempotencyKey(envelope, idempotencyKey)
+
+	claimed, ownerID, err := db.claimIdempotencyKey(ctx, key, envelope.ID, expiresAt)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return ownerID, nil
+	}
+
+	if _, err := db.envelopes().InsertOne(ctx, toMongoEnvelope(envelope)); err != nil {
+		_, _ = db.idempotencyKeys().DeleteOne(ctx, bson.M{"_id": key, "envelope": envelope.ID})
+		return "", fmt.Errorf("typesend: failed to insert envelope: %w", err)
+	}
+
+	return envelope.ID, nil
+}
+
+// claimIdempotencyKey takes the key for envelopeID unless it is held
+// and unexpired, in which case it returns the envelope holding it.
+func (db *MongoTypeSendDB) claimIdempotencyKey(ctx context.Context, key string, envelopeID string, expiresAt time.Time) (bool, string, error) {
+	_, err := db.idempotencyKeys().InsertOne(ctx, &mongoIdempotencyRecord{
+		ID:         key,
+		EnvelopeID: envelopeID,
+		ExpiresAt:  expiresAt,
+	})
+	if err == nil {
+		return true, envelopeID, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, "", fmt.Errorf("typesend: failed to claim idempotency key: %w", err)
+	}
+
+	// TTL indexes only sweep every minute or so,
+	// so an expired key may still be present.
+	result, err := db.idempotencyKeys().UpdateOne(ctx,
+		bson.M{"_id": key, "expiresAt": bson.M{"$lte": time.Now().UTC()}},
+		bson.M{"$set": bson.M{"envelope": envelopeID, "expiresAt": expiresAt}},
+	)
+	if err != nil {
+		return false, "", fmt.Errorf("typesend: failed to claim idempotency key: %w", err)
+	}
+	if result.MatchedCount == 1 {
+		return true, envelopeID, nil
+	}
+
+	var existing mongoIdempotencyRecord
+	if err := db.idempotencyKeys().FindOne(ctx, bson.M{"_id": key}).Decode(&existing); err != nil {
+		return false, "", fmt.Errorf("typesend: failed to get idempotency record: %w", err)
+	}
+	return false, existing.EnvelopeID, nil
+}
+
+func (db *MongoTypeSendDB) GetEnvelopeByID(ctx context.Context, envelopeID string) (*typesend_schemas.TypeSendEnvelope, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEnvelopeByID requires a connection")
+	}
+
+	var document mongoEnvelope
+	err := db.envelopes().FindOne(ctx, bson.M{"_id": envelopeID}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get envelope: %w", err)
+	}
+	return document.envelope(), nil
+}
+
+// GetMessagesReadyToSend claims ready envelopes one at a time with
+// findOneAndUpdate, leasing each for ClaimLease. Dispatchers running
+// at the same time are handed disjoint sets of envelopes.
+func (db *MongoTypeSendDB) GetMessagesReadyToSend(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetMessagesReadyToSend requires a connection")
+	}
+	return db.claimMessagesReadyToSend(ctx, timestamp, nil), nil
+}
+
+// GetMessagesReadyToSendByPriority treats envelopes written
+// without a priority as NORMAL.
+func (db *MongoTypeSendDB) GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetMessagesReadyToSendByPriority requires a connection")
+	}
+
+	if priority.Effective() == typesend_schemas.TypeSendPriority_NORMAL {
+		return db.claimMessagesReadyToSend(ctx, timestamp, bson.M{"$in": bson.A{
+			typesend_schemas.TypeSendPriority_NORMAL,
+			typesend_schemas.TypeSendPriority_DEFAULT,
+			nil,
+		}}), nil
+	}
+
+	return db.claimMessagesReadyToSend(ctx, timestamp, priority.Effective()), nil
+}
+
+// claimMessagesReadyToSend streams claimed envelopes. A non-nil
+// priority is added to the filter as is.
+func (db *MongoTypeSendDB) claimMessagesReadyToSend(ctx context.Context, timestamp time.Time, priority interface{}) chan *typesend_schemas.TypeSendEnvelope {
+	ch := make(chan *typesend_schemas.TypeSendEnvelope)
+
+	go func() {
+		defer close(ch)
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "scheduledFor", Value: 1}}).
+			SetReturnDocument(options.After)
+
+		for {
+			now := time.Now().UTC()
+			filter := bson.M{
+				"status":       typesend_schemas.TypeSendStatus_UNSENT,
+				"scheduledFor": bson.M{"$lte": timestamp},
+				"$or": bson.A{
+					bson.M{"claimedUntil": nil},
+					bson.M{"claimedUntil": bson.M{"$lte": now}},
+				},
+			}
+			if priority != nil {
+				filter["priority"] = priority
+			}
+
+			var document mongoEnvelope
+			err := db.envelopes().FindOneAndUpdate(ctx, filter,
+				bson.M{"$set": bson.M{"claimedUntil": now.Add(db.claimLease())}},
+				opts,
+			).Decode(&document)
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					db.logError("typesend: error during claim: %v", err)
+				}
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- document.envelope():
+			}
+		}
+	}()
+
+	return ch
+}
+
+func (db *MongoTypeSendDB) UpdateEnvelopeStatus(ctx context.Context, envelopeID string, toStatus typesend_schemas.TypeSendStatus) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: UpdateEnvelopeStatus requires a connection")
+	}
+
+	result, err := db.envelopes().UpdateOne(ctx, bson.M{"_id": envelopeID}, bson.M{"$set": bson.M{"status": toStatus}})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to update envelope status: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("typesend: envelope with ID %s not found", envelopeID)
+	}
+	return nil
+}
+
+// UpdateEnvelopeStatuses updates every envelope with one UpdateMany,
+// only looking up which IDs exist when some were not matched.
+func (db *MongoTypeSendDB) UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	if db.client == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: UpdateEnvelopeStatuses requires a connection")
+		}
+		return errs
+	}
+
+	result, err := db.envelopes().UpdateMany(ctx, bson.M{"_id": bson.M{"$in": envelopeIDs}}, bson.M{"$set": bson.M{"status": toStatus}})
+	if err != nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: failed to update envelope statuses: %w", err)
+		}
+		return errs
+	}
+	if result.MatchedCount == int64(len(envelopeIDs)) {
+		return errs
+	}
+
+	existing, err := db.existingEnvelopeIDs(ctx, bson.M{"_id": bson.M{"$in": envelopeIDs}})
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	for i, envelopeID := range envelopeIDs {
+		if !existing[envelopeID] {
+			errs[i] = fmt.Errorf("typesend: envelope with ID %s not found", envelopeID)
+		}
+	}
+	return errs
+}
+
+// ClaimEnvelopes claims each envelope with its own conditional
+// UpdateOne, only looking up which IDs exist when some were missed.
+func (db *MongoTypeSendDB) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	errs := make([]error, len(envelopeIDs))
+
+	if db.client == nil {
+		for i := range errs {
+			errs[i] = fmt.Errorf("typesend: ClaimEnvelopes requires a connection")
+		}
+		return errs
+	}
+
+	var missed []string
+	for i, envelopeID := range envelopeIDs {
+		result, err := db.envelopes().UpdateOne(ctx,
+			bson.M{"_id": envelopeID, "status": typesend_schemas.TypeSendStatus_UNSENT},
+			bson.M{"$set": bson.M{"status": typesend_schemas.TypeSendStatus_DELIVERING}},
+		)
+		if err != nil {
+			errs[i] = fmt.Errorf("typesend: failed to claim envelope: %w", err)
+			continue
+		}
+		if result.MatchedCount == 0 {
+			missed = append(missed, envelopeID)
+		}
+	}
+	if len(missed) == 0 {
+		return errs
+	}
+
+	existing, err := db.existingEnvelopeIDs(ctx, bson.M{"_id": bson.M{"$in": missed}})
+	for i, envelopeID := range envelopeIDs {
+		if errs[i] != nil || !slices.Contains(missed, envelopeID) {
+			continue
+		}
+		switch {
+		case err != nil:
+			errs[i] = err
+		case existing[envelopeID]:
+			errs[i] = ErrNotUnsent
+		default:
+			errs[i] = fmt.Errorf("typesend: envelope with ID %s not found", envelopeID)
+		}
+	}
+	return errs
+}
+
+func (db *MongoTypeSendDB) existingEnvelopeIDs(ctx context.Context, filter bson.M) (map[string]bool, error) {
+	cursor, err := db.envelopes().Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to find envelopes: %w", err)
+	}
+
+	var documents []struct {
+		ID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to find envelopes: %w", err)
+	}
+
+	existing := make(map[string]bool, len(documents))
+	for _, document := range documents {
+		existing[document.ID] = true
+	}
+	return existing, nil
+}
+
+func (db *MongoTypeSendDB) DeferEnvelope(ctx context.Context, envelope *typesend_schemas.TypeSendEnvelope, until time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeferEnvelope requires a connection")
+	}
+
+	deferred := *envelope
+	deferred.Defer(until)
+
+	set := bson.M{"scheduledFor": deferred.ScheduledFor, "originalScheduledFor": deferred.OriginalScheduledFor}
+	// Zero expiry times are left unset, as Insert omits them.
+	if deferred.ContentExpiresAt > 0 {
+		set["contentExpiresAt"] = deferred.ContentExpiresAt
+	}
+	if deferred.ExpiresAt > 0 {
+		set["expiresAt"] = deferred.ExpiresAt
+	}
+
+	result, err := db.envelopes().UpdateOne(ctx,
+		bson.M{"_id": envelope.ID, "status": typesend_schemas.TypeSendStatus_UNSENT},
+		bson.M{
+			"$set":   set,
+			"$unset": bson.M{"claimedUntil": ""},
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to defer envelope: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("typesend: envelope with ID %s not found or no longer UNSENT", envelope.ID)
+	}
+	return nil
+}
+
+// LinkEnvelopesToDigest only updates envelopes that are still
+// UNSENT, so an envelope is only ever part of one digest.
+func (db *MongoTypeSendDB) LinkEnvelopesToDigest(ctx context.Context, digestID string, envelopeIDs []string) ([]string, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: LinkEnvelopesToDigest requires a connection")
+	}
+
+	linked := make([]string, 0, len(envelopeIDs))
+	for _, envelopeID := range envelopeIDs {
+		result, err := db.envelopes().UpdateOne(ctx,
+			bson.M{"_id": envelopeID, "status": typesend_schemas.TypeSendStatus_UNSENT},
+			bson.M{"$set": bson.M{"status": typesend_schemas.TypeSendStatus_SENT, "digestId": digestID}},
+		)
+		if err != nil {
+			return linked, fmt.Errorf("typesend: failed to link envelope %s to digest: %w", envelopeID, err)
+		}
+		if result.MatchedCount == 1 {
+			linked = append(linked, envelopeID)
+		}
+	}
+	return linked, nil
+}
+
+// PurgeExpiredData strips and deletes envelopes. Idempotency keys and
+// rate limit windows are also removed by their TTL indexes, but the
+// TTL monitor only runs every minute or so.
+func (db *MongoTypeSendDB) PurgeExpiredData(ctx context.Context, now time.Time) (PurgeResult, error) {
+	if db.client == nil {
+		return PurgeResult{}, fmt.Errorf("typesend: PurgeExpiredData requires a connection")
+	}
+
+	finished := bson.M{"$in": bson.A{
+		typesend_schemas.TypeSendStatus_SENT,
+		typesend_schemas.TypeSendStatus_FAILED,
+		typesend_schemas.TypeSendStatus_SUPPRESSED,
+	}}
+
+	deleted, err := db.envelopes().DeleteMany(ctx, bson.M{
+		"expiresAt": bson.M{"$gt": 0, "$lte": now.Unix()},
+		"status":    finished,
+	})
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("typesend: failed to delete expired envelopes: %w", err)
+	}
+
+	// Keep in step with TypeSendEnvelope.StripContent.
+	stripped, err := db.envelopes().UpdateMany(ctx,
+		bson.M{
+			"contentExpiresAt": bson.M{"$gt": 0, "$lte": now.Unix()},
+			"status":           finished,
+		},
+		bson.M{
+			"$set":   bson.M{"variables": nil, "to_name": ""},
+			"$unset": bson.M{"sealed": "", "digestOf": "", "quietHours": "", "contentExpiresAt": ""},
+		},
+	)
+	if err != nil {
+		return PurgeResult{}, fmt.Errorf("typesend: failed to strip expired envelopes: %w", err)
+	}
+
+	result := PurgeResult{Stripped: int(stripped.ModifiedCount), Deleted: int(deleted.DeletedCount)}
+
+	for _, collection := range []*mongo.Collection{db.idempotencyKeys(), db.rateLimits()} {
+		if _, err := collection.DeleteMany(ctx, bson.M{"expiresAt": bson.M{"$lte": now}}); err != nil {
+			return result, fmt.Errorf("typesend: failed to delete expired %s: %w", collection.Name(), err)
+		}
+	}
+
+	return result, nil
+}
+
+// ConsumeRateLimit upserts a counter per window, only incrementing it
+// while it is below the limit. Once the window is full the upsert
+// collides with the existing counter instead.
+func (db *MongoTypeSendDB) ConsumeRateLimit(ctx context.Context, key string, windowStart time.Time, window time.Duration, limit int) (bool, error) {
+	if db.client == nil {
+		return false, fmt.Errorf("typesend: ConsumeRateLimit requires a connection")
+	}
+
+	_, err := db.rateLimits().UpdateOne(ctx,
+		bson.M{"_id": rateLimitWindowKey(key, windowStart), "count": bson.M{"$lt": limit}},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$setOnInsert": bson.M{"expiresAt": windowStart.Add(window + rateLimitGracePeriod)},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("typesend: failed to consume rate limit: %w", err)
+	}
+
+	return true, nil
+}
+
+func (db *MongoTypeSendDB) ReleaseRateLimit(ctx context.Context, key string, windowStart time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: ReleaseRateLimit requires a connection")
+	}
+
+	_, err := db.rateLimits().UpdateOne(ctx,
+		bson.M{"_id": rateLimitWindowKey(key, windowStart), "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to release rate limit: %w", err)
+	}
+	return nil
+}
+
+// mongoRecipientFilter matches TypeSendRecipient.Matches.
+func mongoRecipientFilter(recipient typesend_schemas.TypeSendRecipient) bson.M {
+	or := bson.A{}
+	if recipient.ToAddress != "" {
+		or = append(or, bson.M{"to": recipient.ToAddress})
+	}
+	if recipient.ToInternalID != "" {
+		or = append(or, bson.M{"toInternal": recipient.ToInternalID})
+	}
+	return bson.M{"$or": or}
+}
+
+type mongoTombstone struct {
+	Hash     string    `bson:"_id"`
+	ErasedAt time.Time `bson:"erasedAt"`
+}
+
+func (m *mongoTombstone) tombstone() *typesend_schemas.TypeSendTombstone {
+	return &typesend_schemas.TypeSendTombstone{Hash: m.Hash, ErasedAt: m.ErasedAt.UTC()}
+}
+
+func (db *MongoTypeSendDB) recipientEnvelopes(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendEnvelope, error) {
+	cursor, err := db.envelopes().Find(ctx, mongoRecipientFilter(recipient),
+		options.Find().SetSort(bson.D{{Key: "scheduledFor", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query recipient envelopes: %w", err)
+	}
+
+	var documents []mongoEnvelope
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode recipient envelopes: %w", err)
+	}
+
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 0, len(documents))
+	for i := range documents {
+		envelopes = append(envelopes, documents[i].envelope())
+	}
+	return envelopes, nil
+}
+
+func (db *MongoTypeSendDB) recipientSchedules(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) ([]*typesend_schemas.TypeSendSchedule, error) {
+	cursor, err := db.schedules().Find(ctx, mongoRecipientFilter(recipient))
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query recipient schedules: %w", err)
+	}
+
+	var documents []mongoSchedule
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode recipient schedules: %w", err)
+	}
+
+	schedules := make([]*typesend_schemas.TypeSendSchedule, 0, len(documents))
+	for i := range documents {
+		schedules = append(schedules, documents[i].schedule())
+	}
+	return schedules, nil
+}
+
+func (db *MongoTypeSendDB) ExportRecipientData(ctx context.Context, recipient typesend_schemas.TypeSendRecipient) (*typesend_schemas.TypeSendRecipientExport, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: ExportRecipientData requires a connection")
+	}
+
+	export := &typesend_schemas.TypeSendRecipientExport{
+		Recipient:  recipient,
+		ExportedAt: time.Now().UTC(),
+	}
+
+	var err error
+	if export.Envelopes, err = db.recipientEnvelopes(ctx, recipient); err != nil {
+		return nil, err
+	}
+	if export.Schedules, err = db.recipientSchedules(ctx, recipient); err != nil {
+		return nil, err
+	}
+
+	if export.Events, err = db.envelopeEvents(ctx, export.Envelopes); err != nil {
+		return nil, err
+	}
+
+	addresses := matchedAddresses(recipient, export.Envelopes, export.Schedules)
+	if export.Suppressions, err = db.addressSuppressions(ctx, addresses); err != nil {
+		return nil, err
+	}
+	if export.Preferences, err = db.addressPreferences(ctx, addresses); err != nil {
+		return nil, err
+	}
+
+	cursor, err := db.tombstones().Find(ctx, bson.M{"_id": bson.M{"$in": recipient.Hashes()}})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query tombstones: %w", err)
+	}
+	var documents []mongoTombstone
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode tombstones: %w", err)
+	}
+	export.Tombstones = make([]*typesend_schemas.TypeSendTombstone, 0, len(documents))
+	for i := range documents {
+		export.Tombstones = append(export.Tombstones, documents[i].tombstone())
+	}
+
+	return export, nil
+}
+
+// EraseRecipient erases each envelope conditioned on the recipient it
+// was read with. UNSENT envelopes are then FAILED in a separate update,
+// so a dispatcher sending one in between keeps its status.
+func (db *MongoTypeSendDB) EraseRecipient(ctx context.Context, recipient typesend_schemas.TypeSendRecipient, erasedAt time.Time) (*typesend_schemas.TypeSendErasure, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: EraseRecipient requires a connection")
+	}
+
+	envelopes, err := db.recipientEnvelopes(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := db.recipientSchedules(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+
+	// Found before the envelopes are erased in place.
+	addresses := matchedAddresses(recipient, envelopes, schedules)
+	suppressions, err := db.addressSuppressions(ctx, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	erasure := &typesend_schemas.TypeSendErasure{}
+	erased := []string{recipient.ToAddress, recipient.ToInternalID}
+	for _, envelope := range envelopes {
+		filter := bson.M{"_id": envelope.ID, "to": envelope.ToAddress, "toInternal": envelope.ToInternalID}
+		erased = append(erased, envelope.ToAddress, envelope.ToInternalID)
+		envelope.Erase()
+
+		// Keep in step with TypeSendEnvelope.Erase.
+		result, err := db.envelopes().UpdateOne(ctx, filter, bson.M{
+			"$set":   bson.M{"to": envelope.ToAddress, "toInternal": envelope.ToInternalID, "variables": nil, "to_name": ""},
+			"$unset": bson.M{"sealed": "", "digestOf": "", "quietHours": "", "tz": "", "contentExpiresAt": ""},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to erase envelope: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			// Deleted since it was read.
+			continue
+		}
+		erasure.Envelopes++
+
+		_, err = db.envelopes().UpdateOne(ctx,
+			bson.M{"_id": envelope.ID, "status": typesend_schemas.TypeSendStatus_UNSENT},
+			bson.M{"$set": bson.M{"status": typesend_schemas.TypeSendStatus_FAILED}},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to fail erased envelope: %w", err)
+		}
+	}
+
+	envelopeIDs := make(bson.A, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		envelopeIDs = append(envelopeIDs, envelope.ID)
+	}
+	// Keep in step with TypeSendEvent.Erase. Empty details are
+	// omitted when stored, so only events with some are matched.
+	events, err := db.events().UpdateMany(ctx,
+		bson.M{"eventEnvelope": bson.M{"$in": envelopeIDs}, "details": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"details": ""}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to erase recipient events: %w", err)
+	}
+	erasure.Events = int(events.ModifiedCount)
+
+	scheduleIDs := make(bson.A, 0, len(schedules))
+	for _, schedule := range schedules {
+		erased = append(erased, schedule.ToAddress, schedule.ToInternalID)
+		scheduleIDs = append(scheduleIDs, schedule.ID)
+	}
+	if len(scheduleIDs) > 0 {
+		if _, err := db.schedules().DeleteMany(ctx, bson.M{"_id": bson.M{"$in": scheduleIDs}}); err != nil {
+			return nil, fmt.Errorf("typesend: failed to delete recipient schedules: %w", err)
+		}
+	}
+
+	erasure.Schedules = len(schedules)
+
+	// The pseudonymized copy is put before the original is deleted,
+	// so a failure part way leaves the suppression in place.
+	for _, suppression := range suppressions {
+		key := suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address)
+		suppression.Erase()
+		erasedKey := suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address)
+		_, err := db.suppressions().ReplaceOne(ctx,
+			bson.M{"_id": erasedKey},
+			&mongoSuppression{ID: erasedKey, TypeSendSuppression: *suppression},
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to erase suppression: %w", err)
+		}
+		if _, err := db.suppressions().DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+			return nil, fmt.Errorf("typesend: failed to erase suppression: %w", err)
+		}
+		erasure.Suppressions++
+	}
+
+	deleted, err := db.preferences().DeleteMany(ctx, bson.M{"address": bson.M{"$in": addresses}})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to delete recipient preferences: %w", err)
+	}
+	erasure.Preferences = int(deleted.DeletedCount)
+
+	erasure.Tombstones = typesend_schemas.NewTombstones(erasedAt, erased...)
+	for _, tombstone := range erasure.Tombstones {
+		_, err := db.tombstones().ReplaceOne(ctx,
+			bson.M{"_id": tombstone.Hash},
+			&mongoTombstone{Hash: tombstone.Hash, ErasedAt: tombstone.ErasedAt},
+			options.Replace().SetUpsert(true),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to insert tombstone: %w", err)
+		}
+	}
+
+	return erasure, nil
+}
+
+func (db *MongoTypeSendDB) GetTombstone(ctx context.Context, hash string) (*typesend_schemas.TypeSendTombstone, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetTombstone requires a connection")
+	}
+
+	var document mongoTombstone
+	err := db.tombstones().FindOne(ctx, bson.M{"_id": hash}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get tombstone: %w", err)
+	}
+	return document.tombstone(), nil
+}
+
+// Keyed by suppressionKey.
+type mongoSuppression struct {
+	ID                                   string `bson:"_id"`
+	typesend_schemas.TypeSendSuppression `bson:",inline"`
+}
+
+// addressSuppressions returns the suppressions for any of the
+// normalized addresses, through the address index.
+func (db *MongoTypeSendDB) addressSuppressions(ctx context.Context, addresses []string) ([]*typesend_schemas.TypeSendSuppression, error) {
+	cursor, err := db.suppressions().Find(ctx, bson.M{"address": bson.M{"$in": addresses}})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query recipient suppressions: %w", err)
+	}
+	var documents []mongoSuppression
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode suppressions: %w", err)
+	}
+
+	suppressions := make([]*typesend_schemas.TypeSendSuppression, 0, len(documents))
+	for i := range documents {
+		suppression := documents[i].TypeSendSuppression
+		suppression.CreatedAt = suppression.CreatedAt.UTC()
+		suppressions = append(suppressions, &suppression)
+	}
+	return suppressions, nil
+}
+
+func (db *MongoTypeSendDB) PutSuppression(ctx context.Context, suppression *typesend_schemas.TypeSendSuppression) error {
+	stored, err := storedSuppression(suppression)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutSuppression requires a connection")
+	}
+
+	key := suppressionKey(stored.AppID, stored.TenantID, stored.Address)
+	_, err = db.suppressions().ReplaceOne(ctx,
+		bson.M{"_id": key},
+		&mongoSuppression{ID: key, TypeSendSuppression: *stored},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put suppression: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetSuppression(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetSuppression requires a connection")
+	}
+
+	var document mongoSuppression
+	err := db.suppressions().FindOne(ctx, bson.M{"_id": suppressionKey(appID, tenantID, address)}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get suppression: %w", err)
+	}
+
+	suppression := document.TypeSendSuppression
+	suppression.CreatedAt = suppression.CreatedAt.UTC()
+	return &suppression, nil
+}
+
+func (db *MongoTypeSendDB) DeleteSuppression(ctx context.Context, appID string, tenantID string, address string) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeleteSuppression requires a connection")
+	}
+
+	_, err := db.suppressions().DeleteOne(ctx, bson.M{"_id": suppressionKey(appID, tenantID, address)})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete suppression: %w", err)
+	}
+	return nil
+}
+
+// One per App, keyed by categoriesKey.
+type mongoCategories struct {
+	ID         string                              `bson:"_id"`
+	Categories []typesend_schemas.TypeSendCategory `bson:"categories"`
+}
+
+func (db *MongoTypeSendDB) PutCategories(ctx context.Context, appID string, categories []*typesend_schemas.TypeSendCategory) error {
+	stored, err := storedCategories(appID, categories)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutCategories requires a connection")
+	}
+
+	key := categoriesKey(appID)
+	_, err = db.categories().ReplaceOne(ctx,
+		bson.M{"_id": key},
+		&mongoCategories{ID: key, Categories: stored},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put categories: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetCategories(ctx context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetCategories requires a connection")
+	}
+
+	var document mongoCategories
+	err := db.categories().FindOne(ctx, bson.M{"_id": categoriesKey(appID)}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get categories: %w", err)
+	}
+	return loadedCategories(document.Categories), nil
+}
+
+// Keyed by preferencesKey.
+type mongoPreferences struct {
+	ID                                   string `bson:"_id"`
+	typesend_schemas.TypeSendPreferences `bson:",inline"`
+}
+
+// addressPreferences returns the preferences for any of the
+// normalized addresses.
+func (db *MongoTypeSendDB) addressPreferences(ctx context.Context, addresses []string) ([]*typesend_schemas.TypeSendPreferences, error) {
+	cursor, err := db.preferences().Find(ctx, bson.M{"address": bson.M{"$in": addresses}})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query recipient preferences: %w", err)
+	}
+	var documents []mongoPreferences
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode preferences: %w", err)
+	}
+
+	found := make([]*typesend_schemas.TypeSendPreferences, 0, len(documents))
+	for i := range documents {
+		found = append(found, loadedPreferences(&documents[i].TypeSendPreferences))
+	}
+	return found, nil
+}
+
+func (db *MongoTypeSendDB) PutPreferences(ctx context.Context, preferences *typesend_schemas.TypeSendPreferences) error {
+	stored, err := storedPreferences(preferences)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutPreferences requires a connection")
+	}
+
+	key := preferencesKey(stored.AppID, stored.TenantID, stored.Address)
+	_, err = db.preferences().ReplaceOne(ctx,
+		bson.M{"_id": key},
+		&mongoPreferences{ID: key, TypeSendPreferences: *stored},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to put preferences: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetPreferences(ctx context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetPreferences requires a connection")
+	}
+
+	var document mongoPreferences
+	err := db.preferences().FindOne(ctx, bson.M{"_id": preferencesKey(appID, tenantID, address)}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get preferences: %w", err)
+	}
+
+	preferences := document.TypeSendPreferences
+	return loadedPreferences(&preferences), nil
+}
+
+// How many recipients GetRecipientStates looks up per query,
+// keeping each $in well within the document size limit.
+const mongoRecipientStatesBatchSize = 1000
+
+func (db *MongoTypeSendDB) GetRecipientStates(ctx context.Context, keys []RecipientKey) ([]RecipientState, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetRecipientStates requires a connection")
+	}
+
+	suppressions := make(map[string]*typesend_schemas.TypeSendSuppression)
+	preferences := make(map[string]*typesend_schemas.TypeSendPreferences)
+	unique := uniqueRecipientKeys(keys)
+	for start := 0; start < len(unique); start += mongoRecipientStatesBatchSize {
+		chunk := unique[start:min(start+mongoRecipientStatesBatchSize, len(unique))]
+
+		suppressionIDs := make(bson.A, len(chunk))
+		preferencesIDs := make(bson.A, len(chunk))
+		for i, key := range chunk {
+			suppressionIDs[i] = suppressionKey(key.AppID, key.TenantID, key.Address)
+			preferencesIDs[i] = preferencesKey(key.AppID, key.TenantID, key.Address)
+		}
+
+		cursor, err := db.suppressions().Find(ctx, bson.M{"_id": bson.M{"$in": suppressionIDs}})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to query suppressions: %w", err)
+		}
+		var foundSuppressions []mongoSuppression
+		if err := cursor.All(ctx, &foundSuppressions); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode suppressions: %w", err)
+		}
+		for i := range foundSuppressions {
+			suppressions[foundSuppressions[i].ID] = &foundSuppressions[i].TypeSendSuppression
+		}
+
+		cursor, err = db.preferences().Find(ctx, bson.M{"_id": bson.M{"$in": preferencesIDs}})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to query preferences: %w", err)
+		}
+		var foundPreferences []mongoPreferences
+		if err := cursor.All(ctx, &foundPreferences); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode preferences: %w", err)
+		}
+		for i := range foundPreferences {
+			preferences[foundPreferences[i].ID] = &foundPreferences[i].TypeSendPreferences
+		}
+	}
+
+	tombstones := make(map[string]*typesend_schemas.TypeSendTombstone)
+	hashes := recipientHashes(keys)
+	for start := 0; start < len(hashes); start += mongoRecipientStatesBatchSize {
+		cursor, err := db.tombstones().Find(ctx, bson.M{"_id": bson.M{"$in": hashes[start:min(start+mongoRecipientStatesBatchSize, len(hashes))]}})
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to query tombstones: %w", err)
+		}
+		var documents []mongoTombstone
+		if err := cursor.All(ctx, &documents); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode tombstones: %w", err)
+		}
+		for i := range documents {
+			tombstones[documents[i].Hash] = documents[i].tombstone()
+		}
+	}
+
+	return recipientStates(keys, suppressions, preferences, tombstones), nil
+}
+
+// mongoEvent is how events are stored, keyed by eventKey
+// and using the same attribute names as DynamoDB.
+type mongoEvent struct {
+	EnvelopeID        string                             `bson:"eventEnvelope"`
+	ID                string                             `bson:"eventId"`
+	AppID             string                             `bson:"app"`
+	TenantID          string                             `bson:"tenant"`
+	TemplateID        string                             `bson:"template,omitempty"`
+	Type              typesend_schemas.TypeSendEventType `bson:"type"`
+	Provider          string                             `bson:"provider"`
+	ProviderMessageID string                             `bson:"providerMessageId,omitempty"`
+	OccurredAt        time.Time                          `bson:"occurredAt"`
+	Details           map[string]string                  `bson:"details,omitempty"`
+}
+
+func (db *MongoTypeSendDB) AppendEvents(ctx context.Context, events []*typesend_schemas.TypeSendEvent) error {
+	stored, err := storedEvents(events)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: AppendEvents requires a connection")
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+
+	// $setOnInsert leaves events already stored untouched.
+	models := make([]mongo.WriteModel, len(stored))
+	for i, event := range stored {
+		models[i] = mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": eventKey(event.EnvelopeID, event.ID)}).
+			SetUpdate(bson.M{"$setOnInsert": mongoEvent(*event)}).
+			SetUpsert(true)
+	}
+
+	if _, err := db.events().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("typesend: failed to append events: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetEnvelopeTimeline(ctx context.Context, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEnvelopeTimeline requires a connection")
+	}
+
+	cursor, err := db.events().Find(ctx, bson.M{"eventEnvelope": envelopeID})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []*typesend_schemas.TypeSendEvent
+	for cursor.Next(ctx) {
+		var document mongoEvent
+		if err := cursor.Decode(&document); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode event: %w", err)
+		}
+		event := typesend_schemas.TypeSendEvent(document)
+		events = append(events, loadedEvent(&event))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// envelopeEvents returns the events of every envelope,
+// grouped by envelope and oldest first.
+func (db *MongoTypeSendDB) envelopeEvents(ctx context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) ([]*typesend_schemas.TypeSendEvent, error) {
+	envelopeIDs := make(bson.A, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		envelopeIDs = append(envelopeIDs, envelope.ID)
+	}
+
+	cursor, err := db.events().Find(ctx, bson.M{"eventEnvelope": bson.M{"$in": envelopeIDs}},
+		options.Find().SetSort(bson.D{{Key: "eventEnvelope", Value: 1}, {Key: "occurredAt", Value: 1}, {Key: "eventId", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query recipient events: %w", err)
+	}
+	var documents []mongoEvent
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, fmt.Errorf("typesend: failed to decode events: %w", err)
+	}
+
+	events := make([]*typesend_schemas.TypeSendEvent, 0, len(documents))
+	for i := range documents {
+		event := typesend_schemas.TypeSendEvent(documents[i])
+		events = append(events, loadedEvent(&event))
+	}
+	return events, nil
+}
+
+func (db *MongoTypeSendDB) GetEventsByDay(ctx context.Context, day time.Time) ([]*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEventsByDay requires a connection")
+	}
+
+	start, end := eventDayBounds(day)
+	cursor, err := db.events().Find(ctx, bson.M{"occurredAt": bson.M{"$gte": start, "$lt": end}})
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var events []*typesend_schemas.TypeSendEvent
+	for cursor.Next(ctx) {
+		var document mongoEvent
+		if err := cursor.Decode(&document); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode event: %w", err)
+		}
+		event := typesend_schemas.TypeSendEvent(document)
+		events = append(events, loadedEvent(&event))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("typesend: failed to get events: %w", err)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (db *MongoTypeSendDB) GetEventByProviderMessageID(ctx context.Context, provider string, messageID string) (*typesend_schemas.TypeSendEvent, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetEventByProviderMessageID requires a connection")
+	}
+	if messageID == "" {
+		return nil, nil
+	}
+
+	var document mongoEvent
+	err := db.events().FindOne(ctx, bson.M{"provider": provider, "providerMessageId": messageID},
+		options.FindOne().SetSort(bson.D{{Key: "occurredAt", Value: 1}, {Key: "eventId", Value: 1}})).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get event: %w", err)
+	}
+
+	event := typesend_schemas.TypeSendEvent(document)
+	return loadedEvent(&event), nil
+}
+
+// mongoRollup is how rollups are stored, keyed by rollupKey
+// and using the same attribute names as DynamoDB.
+type mongoRollup struct {
+	AppID       string    `bson:"app"`
+	TenantID    string    `bson:"tenant"`
+	TemplateID  string    `bson:"template"`
+	Day         time.Time `bson:"day"`
+	Sent        int64     `bson:"sent"`
+	Delivered   int64     `bson:"delivered"`
+	Bounced     int64     `bson:"bounced"`
+	Opened      int64     `bson:"opened"`
+	UniqueOpens int64     `bson:"uniqueOpens"`
+	Clicked     int64     `bson:"clicked"`
+	Complained  int64     `bson:"complained"`
+	UpdatedAt   time.Time `bson:"updatedAt"`
+}
+
+func (db *MongoTypeSendDB) PutRollups(ctx context.Context, rollups []*typesend_schemas.TypeSendRollup) error {
+	stored, err := storedRollups(rollups)
+	if err != nil {
+		return err
+	}
+	if db.client == nil {
+		return fmt.Errorf("typesend: PutRollups requires a connection")
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+
+	models := make([]mongo.WriteModel, len(stored))
+	for i, rollup := range stored {
+		models[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"_id": rollupKey(rollup)}).
+			SetReplacement(mongoRollup(*rollup)).
+			SetUpsert(true)
+	}
+
+	if _, err := db.rollups().BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("typesend: failed to put rollups: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetRollups(ctx context.Context, query typesend_schemas.TypeSendRollupQuery) ([]*typesend_schemas.TypeSendRollup, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetRollups requires a connection")
+	}
+
+	filter := bson.M{
+		"app": query.AppID,
+		"day": bson.M{"$gte": typesend_schemas.RollupDay(query.From), "$lte": typesend_schemas.RollupDay(query.To)},
+	}
+	if query.TenantID != "" {
+		filter["tenant"] = query.TenantID
+	}
+	if query.TemplateID != "" {
+		filter["template"] = query.TemplateID
+	}
+
+	cursor, err := db.rollups().Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get rollups: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rollups []*typesend_schemas.TypeSendRollup
+	for cursor.Next(ctx) {
+		var document mongoRollup
+		if err := cursor.Decode(&document); err != nil {
+			return nil, fmt.Errorf("typesend: failed to decode rollup: %w", err)
+		}
+		rollup := typesend_schemas.TypeSendRollup(document)
+		rollups = append(rollups, loadedRollup(&rollup))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("typesend: failed to get rollups: %w", err)
+	}
+	sortRollups(rollups)
+	return rollups, nil
+}
+
+type mongoSchedule struct {
+	ID             string                                 `bson:"_id"`
+	AppID          string                                 `bson:"app"`
+	TenantID       string                                 `bson:"tenant"`
+	TemplateID     string                                 `bson:"tid"`
+	ToAddress      string                                 `bson:"to"`
+	ToName         string                                 `bson:"to_name"`
+	ToInternalID   string                                 `bson:"toInternal"`
+	MessageGroupID string                                 `bson:"group"`
+	Variables      map[string]interface{}                 `bson:"variables"`
+	Sealed         *typesend_schemas.TypeSendSealed       `bson:"sealed,omitempty"`
+	Priority       typesend_schemas.TypeSendPriority      `bson:"priority"`
+	TimeZone       string                                 `bson:"tz,omitempty"`
+	QuietHours     *typesend_schemas.TypeSendQuietHours   `bson:"quietHours,omitempty"`
+	Recurrence     typesend_schemas.TypeSendRecurrence    `bson:"recurrence"`
+	State          typesend_schemas.TypeSendScheduleState `bson:"state"`
+	NextRunAt      time.Time                              `bson:"nextRunAt"`
+}
+
+func toMongoSchedule(schedule *typesend_schemas.TypeSendSchedule) *mongoSchedule {
+	return &mongoSchedule{
+		ID:             schedule.ID,
+		AppID:          schedule.AppID,
+		TenantID:       schedule.TenantID,
+		TemplateID:     schedule.TemplateID,
+		ToAddress:      schedule.ToAddress,
+		ToName:         schedule.ToName,
+		ToInternalID:   schedule.ToInternalID,
+		MessageGroupID: schedule.MessageGroupID,
+		Variables:      schedule.Variables,
+		Sealed:         schedule.Sealed,
+		Priority:       schedule.Priority,
+		TimeZone:       schedule.TimeZone,
+		QuietHours:     schedule.QuietHours,
+		Recurrence:     schedule.Recurrence,
+		State:          schedule.State,
+		NextRunAt:      schedule.NextRunAt,
+	}
+}
+
+func (m *mongoSchedule) schedule() *typesend_schemas.TypeSendSchedule {
+	recurrence := m.Recurrence
+	recurrence.Start = recurrence.Start.UTC()
+
+	return &typesend_schemas.TypeSendSchedule{
+		ID:             m.ID,
+		AppID:          m.AppID,
+		TenantID:       m.TenantID,
+		TemplateID:     m.TemplateID,
+		ToAddress:      m.ToAddress,
+		ToName:         m.ToName,
+		ToInternalID:   m.ToInternalID,
+		MessageGroupID: m.MessageGroupID,
+		Variables:      plainMongoMap(m.Variables),
+		Sealed:         m.Sealed,
+		Priority:       m.Priority,
+		TimeZone:       m.TimeZone,
+		QuietHours:     m.QuietHours,
+		Recurrence:     recurrence,
+		State:          m.State,
+		NextRunAt:      m.NextRunAt.UTC(),
+	}
+}
+
+func (db *MongoTypeSendDB) InsertSchedule(ctx context.Context, schedule *typesend_schemas.TypeSendSchedule) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: InsertSchedule requires a connection")
+	}
+
+	_, err := db.schedules().InsertOne(ctx, toMongoSchedule(schedule))
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetScheduleByID(ctx context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetScheduleByID requires a connection")
+	}
+
+	var document mongoSchedule
+	err := db.schedules().FindOne(ctx, bson.M{"_id": scheduleID}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get schedule: %w", err)
+	}
+	return document.schedule(), nil
+}
+
+func (db *MongoTypeSendDB) UpdateScheduleState(ctx context.Context, scheduleID string, state typesend_schemas.TypeSendScheduleState, nextRunAt time.Time) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: UpdateScheduleState requires a connection")
+	}
+
+	set := bson.M{"state": state}
+	if !nextRunAt.IsZero() {
+		set["nextRunAt"] = nextRunAt
+	}
+
+	result, err := db.schedules().UpdateOne(ctx, bson.M{"_id": scheduleID}, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to update schedule state: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("typesend: schedule with ID %s not found", scheduleID)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) DeleteSchedule(ctx context.Context, scheduleID string) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: DeleteSchedule requires a connection")
+	}
+
+	_, err := db.schedules().DeleteOne(ctx, bson.M{"_id": scheduleID})
+	if err != nil {
+		return fmt.Errorf("typesend: failed to delete schedule: %w", err)
+	}
+	return nil
+}
+
+func (db *MongoTypeSendDB) GetSchedulesDue(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendSchedule, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetSchedulesDue requires a connection")
+	}
+
+	cursor, err := db.schedules().Find(ctx,
+		bson.M{"state": typesend_schemas.TypeSendScheduleState_ACTIVE, "nextRunAt": bson.M{"$lte": timestamp}},
+		options.Find().SetSort(bson.D{{Key: "nextRunAt", Value: 1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to query schedules: %w", err)
+	}
+
+	ch := make(chan *typesend_schemas.TypeSendSchedule)
+	go func() {
+		defer close(ch)
+		defer cursor.Close(context.Background())
+
+		for cursor.Next(ctx) {
+			var document mongoSchedule
+			if err := cursor.Decode(&document); err != nil {
+				db.logError("typesend: failed to decode schedule: %v", err)
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- document.schedule():
+			}
+		}
+		if err := cursor.Err(); err != nil && ctx.Err() == nil {
+			db.logError("typesend: error during schedule query: %v", err)
+		}
+	}()
+
+	return ch, nil
+}
+
+// AdvanceSchedule is conditioned on the NextRunAt the caller expanded,
+// so concurrent dispatch runs cannot both move the same schedule on.
+func (db *MongoTypeSendDB) AdvanceSchedule(ctx context.Context, scheduleID string, from time.Time, next time.Time) (bool, error) {
+	if db.client == nil {
+		return false, fmt.Errorf("typesend: AdvanceSchedule requires a connection")
+	}
+
+	set := bson.M{"nextRunAt": next}
+	if next.IsZero() {
+		set = bson.M{"state": typesend_schemas.TypeSendScheduleState_COMPLETED}
+	}
+
+	result, err := db.schedules().UpdateOne(ctx,
+		bson.M{"_id": scheduleID, "state": typesend_schemas.TypeSendScheduleState_ACTIVE, "nextRunAt": from},
+		bson.M{"$set": set},
+	)
+	if err != nil {
+		return false, fmt.Errorf("typesend: failed to advance schedule: %w", err)
+	}
+
+	return result.MatchedCount == 1, nil
+}
+
+// mongoTemplate mirrors TypeSendTemplate, which
+// hides TenantID and Content from other encodings.
+type mongoTemplate struct {
+	TemplateID           string                            `bson:"id"`
+	TenantID             string                            `bson:"tenant"`
+	Content              string                            `bson:"content"`
+	Subject              string                            `bson:"subject"`
+	FromAddress          string                            `bson:"from"`
+	FromName             string                            `bson:"from_name"`
+	Transactional        bool                              `bson:"transactional"`
+	OmitListUnsubscribe  bool                              `bson:"omitListUnsubscribe"`
+	Category             string                            `bson:"category,omitempty"`
+	Sensitive            bool                              `bson:"sensitive"`
+	EnableTracking       bool                              `bson:"enableTracking"`
+	DisableOpenTracking  bool                              `bson:"disableOpenTracking"`
+	DisableClickTracking bool                              `bson:"disableClickTracking"`
+	Priority             typesend_schemas.TypeSendPriority `bson:"priority"`
+	DigestWindow         time.Duration                     `bson:"digestWindow"`
+}
+
+// GetTemplateByID prefers the tenants own template,
+// falling back to the "base" tenant.
+func (db *MongoTypeSendDB) GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
+	if db.client == nil {
+		return nil, fmt.Errorf("typesend: GetTemplateByID requires a connection")
+	}
+
+	var document mongoTemplate
+	err := db.templates().FindOne(ctx, bson.M{"id": templateID, "tenant": tenantID}).Decode(&document)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if tenantID != "base" {
+			return db.GetTemplateByID(ctx, templateID, "base")
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to get template: %w", err)
+	}
+
+	return &typesend_schemas.TypeSendTemplate{
+		TemplateID:           document.TemplateID,
+		TenantID:             document.TenantID,
+		Content:              document.Content,
+		Subject:              document.Subject,
+		FromAddress:          document.FromAddress,
+		FromName:             document.FromName,
+		Transactional:        document.Transactional,
+		OmitListUnsubscribe:  document.OmitListUnsubscribe,
+		Category:             document.Category,
+		Sensitive:            document.Sensitive,
+		EnableTracking:       document.EnableTracking,
+		DisableOpenTracking:  document.DisableOpenTracking,
+		DisableClickTracking: document.DisableClickTracking,
+		Priority:             document.Priority,
+		DigestWindow:         document.DigestWindow,
+	}, nil
+}
+
+// InsertTemplate replaces any existing template with the same ID and tenant.
+func (db *MongoTypeSendDB) InsertTemplate(ctx context.Context, template *typesend_schemas.TypeSendTemplate) error {
+	if db.client == nil {
+		return fmt.Errorf("typesend: InsertTemplate requires a connection")
+	}
+
+	_, err := db.templates().ReplaceOne(ctx,
+		bson.M{"id": template.TemplateID, "tenant": template.TenantID},
+		&mongoTemplate{
+			TemplateID:           template.TemplateID,
+			TenantID:             template.TenantID,
+			Content:              template.Content,
+			Subject:              template.Subject,
+			FromAddress:          template.FromAddress,
+			FromName:             template.FromName,
+			Transactional:        template.Transactional,
+			OmitListUnsubscribe:  template.OmitListUnsubscribe,
+			Category:             template.Category,
+			Sensitive:            template.Sensitive,
+			EnableTracking:       template.EnableTracking,
+			DisableOpenTracking:  template.DisableOpenTracking,
+			DisableClickTracking: template.DisableClickTracking,
+			Priority:             template.Priority,
+			DigestWindow:         template.DigestWindow,
+		},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to insert template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package typesend_db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// Held while migrating, so dispatchers starting
+// together do not apply the same migration twice.
+const postgresMigrationLockID = 7365626
+
+type postgresMigration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadPostgresMigrations reads the embedded migrations in version
+// order. Files are named <version>_<description>.sql.
+func loadPostgresMigrations() ([]postgresMigration, error) {
+	entries, err := fs.ReadDir(postgresMigrations, "migrations/postgres")
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to read migrations: %w", err)
+	}
+
+	migrations := make([]postgresMigration, 0, len(entries))
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(entry.Name(), "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("typesend: migration %s has no version prefix", entry.Name())
+		}
+
+		contents, err := fs.ReadFile(postgresMigrations, "migrations/postgres/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("typesend: failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migrations = append(migrations, postgresMigration{
+			version: version,
+			name:    entry.Name(),
+			sql:     string(contents),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies any migrations that have not yet run,
+// each in its own transaction. It is safe to call on every start.
+func (db *PostgresTypeSendDB) Migrate(ctx context.Context) error {
+	if db.pool == nil {
+		return fmt.Errorf("typesend: Migrate requires a connection")
+	}
+
+	migrations, err := loadPostgresMigrations()
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", postgresMigrationLockID); err != nil {
+		return fmt.Errorf("typesend: failed to lock migrations: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", postgresMigrationLockID)
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS typesend_schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)`)
+	if err != nil {
+		return fmt.Errorf("typesend: failed to create migrations table: %w", err)
+	}
+
+	for _, migration := range migrations {
+		var applied bool
+		err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM typesend_schema_migrations WHERE version = $1)", migration.version).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("typesend: failed to check migration %s: %w", migration.name, err)
+		}
+		if applied {
+			continue
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("typesend: failed to begin migration %s: %w", migration.name, err)
+		}
+
+		if _, err := tx.Exec(ctx, migration.sql); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("typesend: failed to apply migration %s: %w", migration.name, err)
+		}
+
+		if _, err := tx.Exec(ctx, "INSERT INTO typesend_schema_migrations (version) VALUES ($1)", migration.version); err != nil {
+			tx.Rollback(ctx)
+			return fmt.Errorf("typesend: failed to record migration %s: %w", migration.name, err)
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("typesend: failed to commit migration %s: %w", migration.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package typesend_db
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func categoriesKey(appID string) string {
+	return fmt.Sprintf("categories#%s", appID)
+}
+
+func preferencesKey(appID string, tenantID string, address string) string {
+	return fmt.Sprintf("preferences#%s#%s#%s", appID, tenantID, typesend_schemas.NormalizeAddress(address))
+}
+
+// storedCategories validates the categories, returning copies to store.
+func storedCategories(appID string, categories []*typesend_schemas.TypeSendCategory) ([]typesend_schemas.TypeSendCategory, error) {
+	if appID == "" {
+		return nil, fmt.Errorf("typesend: categories need an AppID")
+	}
+
+	stored := make([]typesend_schemas.TypeSendCategory, 0, len(categories))
+	seen := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		if err := category.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[category.ID] {
+			return nil, fmt.Errorf("typesend: duplicate category %q", category.ID)
+		}
+		seen[category.ID] = true
+		stored = append(stored, *category)
+	}
+	return stored, nil
+}
+
+func loadedCategories(stored []typesend_schemas.TypeSendCategory) []*typesend_schemas.TypeSendCategory {
+	if len(stored) == 0 {
+		return nil
+	}
+	categories := make([]*typesend_schemas.TypeSendCategory, len(stored))
+	for i := range stored {
+		category := stored[i]
+		categories[i] = &category
+	}
+	return categories
+}
+
+// storedPreferences validates the preferences, returning the copy to
+// store: its Address normalized, OptedOut sorted and deduplicated,
+// and UpdatedAt defaulted.
+func storedPreferences(preferences *typesend_schemas.TypeSendPreferences) (*typesend_schemas.TypeSendPreferences, error) {
+	stored := *preferences
+	stored.Address = typesend_schemas.NormalizeAddress(stored.Address)
+	if err := stored.Validate(); err != nil {
+		return nil, err
+	}
+
+	stored.OptedOut = slices.Clone(stored.OptedOut)
+	slices.Sort(stored.OptedOut)
+	stored.OptedOut = slices.Compact(stored.OptedOut)
+	if len(stored.OptedOut) == 0 {
+		stored.OptedOut = nil
+	}
+
+	if stored.UpdatedAt.IsZero() {
+		stored.UpdatedAt = time.Now()
+	}
+	stored.UpdatedAt = stored.UpdatedAt.UTC()
+	return &stored, nil
+}
+
+// loadedPreferences undoes the differences between backends, which
+// read back an empty OptedOut as either nil or empty.
+func loadedPreferences(preferences *typesend_schemas.TypeSendPreferences) *typesend_schemas.TypeSendPreferences {
+	if len(preferences.OptedOut) == 0 {
+		preferences.OptedOut = nil
+	}
+	preferences.UpdatedAt = preferences.UpdatedAt.UTC()
+	return preferences
+}
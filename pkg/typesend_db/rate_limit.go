@@ -0,0 +1,14 @@
+package typesend_db
+
+import (
+	"fmt"
+	"time"
+)
+
+// Rate limit windows are kept around a little past their end
+// so late dispatchers never see a fresh (empty) counter.
+const rateLimitGracePeriod = time.Hour
+
+func rateLimitWindowKey(key string, windowStart time.Time) string {
+	return fmt.Sprintf("ratelimit#%s#%d", key, windowStart.Unix())
+}
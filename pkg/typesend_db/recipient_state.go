@@ -0,0 +1,120 @@
+package typesend_db
+
+import (
+	"slices"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// RecipientKey is an address scoped to an App and Tenant,
+// as suppressions and preferences are.
+type RecipientKey struct {
+	AppID    string
+	TenantID string
+	Address  string
+	// Optional; its tombstone is checked along with the addresses.
+	ToInternalID string
+}
+
+func (k RecipientKey) hashes() []string {
+	return typesend_schemas.TypeSendRecipient{ToAddress: k.Address, ToInternalID: k.ToInternalID}.Hashes()
+}
+
+// RecipientState is what GetRecipientStates found for a RecipientKey.
+type RecipientState struct {
+	// Nil when the address may be emailed.
+	Suppression *typesend_schemas.TypeSendSuppression
+	// Nil when none were stored.
+	Preferences *typesend_schemas.TypeSendPreferences
+	// Nil unless the address or internal ID was erased.
+	Tombstone *typesend_schemas.TypeSendTombstone
+}
+
+// uniqueRecipientKeys drops repeated keys, as some backends
+// refuse to look up the same item twice in one request.
+func uniqueRecipientKeys(keys []RecipientKey) []RecipientKey {
+	seen := make(map[string]bool, len(keys))
+	unique := make([]RecipientKey, 0, len(keys))
+	for _, key := range keys {
+		id := suppressionKey(key.AppID, key.TenantID, key.Address)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, key)
+	}
+	return unique
+}
+
+// recipientHashes returns the distinct HashRecipient of every
+// address and internal ID in keys, to look their tombstones up by.
+func recipientHashes(keys []RecipientKey) []string {
+	seen := make(map[string]bool, len(keys))
+	hashes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, hash := range key.hashes() {
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// recipientStates lines found suppressions and preferences, keyed by
+// suppressionKey and preferencesKey, and tombstones, keyed by hash,
+// up with keys.
+func recipientStates(keys []RecipientKey, suppressions map[string]*typesend_schemas.TypeSendSuppression, preferences map[string]*typesend_schemas.TypeSendPreferences, tombstones map[string]*typesend_schemas.TypeSendTombstone) []RecipientState {
+	states := make([]RecipientState, len(keys))
+	for i, key := range keys {
+		for _, hash := range key.hashes() {
+			if tombstone, ok := tombstones[hash]; ok {
+				found := *tombstone
+				found.ErasedAt = found.ErasedAt.UTC()
+				states[i].Tombstone = &found
+				break
+			}
+		}
+		if suppression, ok := suppressions[suppressionKey(key.AppID, key.TenantID, key.Address)]; ok {
+			found := *suppression
+			found.CreatedAt = found.CreatedAt.UTC()
+			states[i].Suppression = &found
+		}
+		if stored, ok := preferences[preferencesKey(key.AppID, key.TenantID, key.Address)]; ok {
+			found := *stored
+			found.OptedOut = slices.Clone(stored.OptedOut)
+			states[i].Preferences = loadedPreferences(&found)
+		}
+	}
+	return states
+}
+
+// recipientAddresses returns the distinct, non-empty addresses
+// normalized, for finding the suppressions held for a recipient.
+func recipientAddresses(addresses ...string) []string {
+	seen := make(map[string]bool, len(addresses))
+	unique := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		address = typesend_schemas.NormalizeAddress(address)
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+		unique = append(unique, address)
+	}
+	return unique
+}
+
+// matchedAddresses returns the recipientAddresses of the recipient,
+// and of the envelopes and schedules found for them.
+func matchedAddresses(recipient typesend_schemas.TypeSendRecipient, envelopes []*typesend_schemas.TypeSendEnvelope, schedules []*typesend_schemas.TypeSendSchedule) []string {
+	addresses := []string{recipient.ToAddress}
+	for _, envelope := range envelopes {
+		addresses = append(addresses, envelope.ToAddress)
+	}
+	for _, schedule := range schedules {
+		addresses = append(addresses, schedule.ToAddress)
+	}
+	return recipientAddresses(addresses...)
+}
@@ -0,0 +1,29 @@
+package typesend_db
+
+import (
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// PurgeResult counts the envelopes a PurgeExpiredData call touched.
+type PurgeResult struct {
+	// Envelopes stripped down to an audit record.
+	Stripped int
+	// Envelopes deleted outright.
+	Deleted int
+}
+
+// Only finished envelopes are purged, so a policy shorter than
+// a delivery delay can never strip an envelope still to be sent.
+func purgeable(envelope *typesend_schemas.TypeSendEnvelope) bool {
+	switch envelope.Status {
+	case typesend_schemas.TypeSendStatus_SENT, typesend_schemas.TypeSendStatus_FAILED, typesend_schemas.TypeSendStatus_SUPPRESSED:
+		return true
+	}
+	return false
+}
+
+func retentionExpired(expiresAt int64, now time.Time) bool {
+	return expiresAt > 0 && expiresAt <= now.Unix()
+}
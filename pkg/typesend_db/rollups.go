@@ -0,0 +1,69 @@
+package typesend_db
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// How days are written in keys, so they sort in order.
+const rollupDayFormat = "2006-01-02"
+
+func rollupKey(rollup *typesend_schemas.TypeSendRollup) string {
+	return fmt.Sprintf("rollup#%s#%s", rollup.AppID, rollupSortKey(rollup))
+}
+
+// rollupSortKey orders an Apps rollups by Day, then Tenant and Template.
+func rollupSortKey(rollup *typesend_schemas.TypeSendRollup) string {
+	return fmt.Sprintf("%s#%s#%s", rollup.Day.Format(rollupDayFormat), rollup.TenantID, rollup.TemplateID)
+}
+
+// eventDayBounds returns the first instant of the UTC day
+// containing day, and the first instant of the day after.
+func eventDayBounds(day time.Time) (time.Time, time.Time) {
+	start := typesend_schemas.RollupDay(day)
+	return start, start.Add(24 * time.Hour)
+}
+
+// storedRollups validates every rollup before any is stored, returning
+// the copies to store with UpdatedAt defaulted. Where two share a key
+// only the later is kept, as it would have replaced the earlier.
+func storedRollups(rollups []*typesend_schemas.TypeSendRollup) ([]*typesend_schemas.TypeSendRollup, error) {
+	stored := make([]*typesend_schemas.TypeSendRollup, 0, len(rollups))
+	indexes := make(map[string]int, len(rollups))
+	for _, rollup := range rollups {
+		if err := rollup.Validate(); err != nil {
+			return nil, err
+		}
+
+		copied := *rollup
+		copied.Day = rollup.Day.UTC()
+		if copied.UpdatedAt.IsZero() {
+			copied.UpdatedAt = time.Now()
+		}
+		copied.UpdatedAt = copied.UpdatedAt.UTC()
+
+		key := rollupKey(&copied)
+		if i, ok := indexes[key]; ok {
+			stored[i] = &copied
+			continue
+		}
+		indexes[key] = len(stored)
+		stored = append(stored, &copied)
+	}
+	return stored, nil
+}
+
+func sortRollups(rollups []*typesend_schemas.TypeSendRollup) {
+	sort.Slice(rollups, func(i, j int) bool {
+		return rollupSortKey(rollups[i]) < rollupSortKey(rollups[j])
+	})
+}
+
+func loadedRollup(rollup *typesend_schemas.TypeSendRollup) *typesend_schemas.TypeSendRollup {
+	rollup.Day = rollup.Day.UTC()
+	rollup.UpdatedAt = rollup.UpdatedAt.UTC()
+	return rollup
+}
@@ -0,0 +1,27 @@
+package typesend_db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+func suppressionKey(appID string, tenantID string, address string) string {
+	return fmt.Sprintf("suppression#%s#%s#%s", appID, tenantID, typesend_schemas.NormalizeAddress(address))
+}
+
+// storedSuppression validates the suppression, returning the
+// copy to store: its Address normalized, and CreatedAt defaulted.
+func storedSuppression(suppression *typesend_schemas.TypeSendSuppression) (*typesend_schemas.TypeSendSuppression, error) {
+	stored := *suppression
+	stored.Address = typesend_schemas.NormalizeAddress(stored.Address)
+	if err := stored.Validate(); err != nil {
+		return nil, err
+	}
+	if stored.CreatedAt.IsZero() {
+		stored.CreatedAt = time.Now()
+	}
+	stored.CreatedAt = stored.CreatedAt.UTC()
+	return &stored, nil
+}
@@ -0,0 +1,77 @@
+package typesend_db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_db/conformance"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBoltDB(t *testing.T, path string) *typesend_db.BoltTypeSendDB {
+	db, err := typesend_db.NewBoltDB(context.Background(), &typesend_db.BoltConfig{
+		Path: path,
+	})
+	if err != nil {
+		t.Fatalf("NewBoltDB should succeed: %s", err)
+	}
+	return db
+}
+
+func TestBoltDatabase_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+		db := newBoltDB(t, filepath.Join(t.TempDir(), "typesend.db"))
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
+
+func TestBoltDatabase_SurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "typesend.db")
+
+	db := newBoltDB(t, path)
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	assert.NoError(t, db.Insert(envelope))
+	assert.NoError(t, db.InsertTemplate(ctx, createTestTemplate("welcome")))
+	assert.NoError(t, db.Close())
+
+	db = newBoltDB(t, path)
+	defer db.Close()
+
+	got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+	assert.NoError(t, err)
+	assert.NotNil(t, got, "envelopes should survive a restart")
+
+	template, err := db.GetTemplateByID(ctx, "welcome", "base")
+	assert.NoError(t, err)
+	if assert.NotNil(t, template, "templates should survive a restart") {
+		assert.Equal(t, "This is a test body.", template.Content)
+	}
+}
+
+func TestBoltDatabase_LiveModeChan(t *testing.T) {
+	db := newBoltDB(t, filepath.Join(t.TempDir(), "typesend.db"))
+	defer db.Close()
+
+	ch := make(chan *typesend_schemas.TypeSendEnvelope, 1)
+	db.SetLiveModeChan(ch)
+
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	assert.NoError(t, db.Insert(envelope))
+
+	select {
+	case got := <-ch:
+		assert.Equal(t, envelope.ID, got.ID)
+	default:
+		t.Fatal("an insert should signal LiveModeChan")
+	}
+
+	// A full channel must not block inserts.
+	assert.NoError(t, db.Insert(createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())))
+	assert.NoError(t, db.Insert(createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())))
+}
@@ -9,12 +9,41 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
+	typequeue "github.com/kvizdos/typequeue/pkg/mocked"
+	"github.com/kvizdos/typesend/internal/dispatch_messages"
 	"github.com/kvizdos/typesend/pkg/testutils"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_db/conformance"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 	"github.com/stretchr/testify/assert"
 )
 
+func TestIntegration_DynamoConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	// Every subtest shares the same tables.
+	conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+		db, err := typesend_db.NewDynamoDB(context.Background(), &typesend_db.DynamoConfig{
+			Region:         "us-west-2",
+			EnvelopesTable: "test-typesend-envelopes",
+			TemplatesTable: "test-typesend-templates",
+			SchedulesTable: "test-typesend-schedules",
+			ForceClient:    client,
+		})
+		if err != nil {
+			t.Fatalf("NewDynamoDB should succeed: %s", err)
+		}
+		return db
+	})
+}
+
 func TestIntegration_Insert(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping integration test")
@@ -292,3 +321,334 @@ func TestIntegration_UpdateEnvelopeStatus(t *testing.T) {
 	// Verify that the status has been updated to SENT.
 	assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, updatedEnvelope.Status, "Envelope status should be updated to SENT")
 }
+
+func TestIntegration_InsertIdempotent(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	id, err := db.InsertIdempotent(ctx, envelope, "key-1", expiresAt)
+	assert.NoError(t, err, "InsertIdempotent should succeed")
+	assert.Equal(t, envelope.ID, id)
+
+	duplicate := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	id, err = db.InsertIdempotent(ctx, duplicate, "key-1", expiresAt)
+	assert.NoError(t, err, "InsertIdempotent should succeed on a repeat")
+	assert.Equal(t, envelope.ID, id, "repeat should return the original envelope ID")
+
+	gotDuplicate, err := db.GetEnvelopeByID(ctx, duplicate.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, gotDuplicate, "duplicate envelope should not have been written")
+
+	// Another tenant has its own key space.
+	otherTenant := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	otherTenant.TenantID = "other-tenant"
+	id, err = db.InsertIdempotent(ctx, otherTenant, "key-1", expiresAt)
+	assert.NoError(t, err)
+	assert.Equal(t, otherTenant.ID, id)
+}
+
+func TestIntegration_InsertBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	// Spans several 25 item chunks.
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 60)
+	for i := range envelopes {
+		envelopes[i] = testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	}
+
+	errs := db.InsertBatch(ctx, envelopes)
+	assert.Len(t, errs, len(envelopes))
+	for _, err := range errs {
+		assert.NoError(t, err, "InsertBatch should write every envelope")
+	}
+
+	for _, envelope := range envelopes {
+		got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+		assert.NoError(t, err)
+		assert.NotNil(t, got, "envelope should have been written")
+	}
+}
+
+func TestIntegration_UpdateEnvelopeStatuses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	ids := make([]string, 15)
+	for i := range ids {
+		envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+		assert.NoError(t, db.Insert(envelope))
+		ids[i] = envelope.ID
+	}
+
+	errs := db.UpdateEnvelopeStatuses(ctx, ids, typesend_schemas.TypeSendStatus_DELIVERING)
+	assert.Len(t, errs, len(ids))
+	for i, id := range ids {
+		assert.NoError(t, errs[i])
+		got, err := db.GetEnvelopeByID(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+	}
+}
+
+func TestIntegration_ConsumeRateLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	window := time.Now().UTC().Truncate(time.Minute)
+	for i := 0; i < 3; i++ {
+		ok, err := db.ConsumeRateLimit(ctx, "tenant#demo#a", window, time.Minute, 3)
+		assert.NoError(t, err)
+		assert.True(t, ok, "slots under the limit should be granted")
+	}
+
+	ok, err := db.ConsumeRateLimit(ctx, "tenant#demo#a", window, time.Minute, 3)
+	assert.NoError(t, err)
+	assert.False(t, ok, "slots over the limit should be refused")
+
+	ok, err = db.ConsumeRateLimit(ctx, "tenant#demo#a", window.Add(time.Minute), time.Minute, 3)
+	assert.NoError(t, err)
+	assert.True(t, ok, "a new window should start fresh")
+}
+
+func TestIntegration_GetMessagesReadyToSendByPriority(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	now := time.Now().UTC()
+	byPriority := make(map[typesend_schemas.TypeSendPriority]string)
+	for _, priority := range []typesend_schemas.TypeSendPriority{
+		typesend_schemas.TypeSendPriority_DEFAULT,
+		typesend_schemas.TypeSendPriority_HIGH,
+		typesend_schemas.TypeSendPriority_NORMAL,
+		typesend_schemas.TypeSendPriority_LOW,
+	} {
+		envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+		envelope.Priority = priority
+		assert.NoError(t, db.Insert(envelope))
+		byPriority[priority] = envelope.ID
+	}
+
+	collect := func(priority typesend_schemas.TypeSendPriority) []string {
+		ch, err := db.GetMessagesReadyToSendByPriority(ctx, now, priority)
+		assert.NoError(t, err)
+		ids := []string{}
+		for envelope := range ch {
+			ids = append(ids, envelope.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{byPriority[typesend_schemas.TypeSendPriority_HIGH]}, collect(typesend_schemas.TypeSendPriority_HIGH))
+	assert.ElementsMatch(t, []string{
+		byPriority[typesend_schemas.TypeSendPriority_DEFAULT],
+		byPriority[typesend_schemas.TypeSendPriority_NORMAL],
+	}, collect(typesend_schemas.TypeSendPriority_NORMAL), "NORMAL should include envelopes without a priority")
+	assert.Equal(t, []string{byPriority[typesend_schemas.TypeSendPriority_LOW]}, collect(typesend_schemas.TypeSendPriority_LOW))
+}
+
+func TestIntegration_DispatchesEnvelopesWithoutLane(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		TemplatesTable: "test-typesend-templates",
+		SchedulesTable: "test-typesend-schedules",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	// Written the way envelopes were before statusPriority existed.
+	legacy := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC().Add(-time.Minute))
+	legacy.Priority = typesend_schemas.TypeSendPriority_HIGH
+	item, err := dynamodbattribute.MarshalMap(legacy)
+	assert.NoError(t, err)
+	_, err = client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("test-typesend-envelopes"),
+		Item:      item,
+	})
+	assert.NoError(t, err)
+
+	testDispatcher := &typequeue.MockDispatcher[*typesend_schemas.TypeSendEnvelope]{
+		Messages: make(map[string][]*typesend_schemas.TypeSendEnvelope),
+	}
+	err = dispatch_messages.DispatchMessagesReadyToSend(&dispatch_messages.DispatchOpts{
+		Context:    ctx,
+		Database:   db,
+		Dispatcher: testDispatcher,
+	})
+	assert.NoError(t, err)
+
+	if assert.Len(t, testDispatcher.Messages["email_queue"], 1, "envelopes without a lane should be dispatched as NORMAL") {
+		assert.Equal(t, legacy.ID, testDispatcher.Messages["email_queue"][0].ID)
+	}
+
+	got, err := db.GetEnvelopeByID(ctx, legacy.ID)
+	assert.NoError(t, err)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, typesend_schemas.TypeSendStatus_DELIVERING, got.Status)
+	}
+}
+
+func TestIntegration_LinkEnvelopesToDigest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	unsent := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	delivering := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	assert.NoError(t, db.Insert(unsent))
+	assert.NoError(t, db.Insert(delivering))
+
+	linked, err := db.LinkEnvelopesToDigest(ctx, "digest-id", []string{unsent.ID, delivering.ID})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unsent.ID}, linked, "only UNSENT envelopes should be linked")
+
+	got, err := db.GetEnvelopeByID(ctx, unsent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status)
+	assert.Equal(t, "digest-id", got.DigestID)
+
+	linked, err = db.LinkEnvelopesToDigest(ctx, "other-digest", []string{unsent.ID})
+	assert.NoError(t, err)
+	assert.Empty(t, linked, "an envelope should only be linked to one digest")
+}
+
+func TestIntegration_DeferEnvelope(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	original := time.Now().UTC().Add(-time.Minute).Truncate(time.Second)
+	until := original.Add(8 * time.Hour)
+
+	envelope := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, original)
+	assert.NoError(t, db.Insert(envelope))
+
+	assert.NoError(t, db.DeferEnvelope(ctx, envelope, until))
+
+	got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+	assert.NoError(t, err)
+	assert.True(t, until.Equal(got.ScheduledFor))
+	assert.True(t, original.Equal(got.OriginalScheduledFor))
+
+	delivering := testutils.CreateTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, original)
+	assert.NoError(t, db.Insert(delivering))
+	assert.Error(t, db.DeferEnvelope(ctx, delivering, until), "only UNSENT envelopes can be deferred")
+}
@@ -0,0 +1,73 @@
+package typesend_db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegration_Schedules(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	client, container, err := testutils.SetupDynamoDBLocalSession(t, context.Background())
+	if ok := assert.NoError(t, err, "DynamoDB Setup Should Not Return Error"); !ok {
+		return
+	}
+	defer testutils.KillContainer(container)
+
+	db, err := typesend_db.NewDynamoDB(ctx, &typesend_db.DynamoConfig{
+		Region:         "us-west-2",
+		EnvelopesTable: "test-typesend-envelopes",
+		SchedulesTable: "test-typesend-schedules",
+		ForceClient:    client,
+	})
+	assert.NoError(t, err, "NewDynamoDB should succeed")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	due := createTestSchedule(now.Add(-time.Minute))
+	future := createTestSchedule(now.Add(time.Hour))
+	assert.NoError(t, db.InsertSchedule(ctx, due))
+	assert.NoError(t, db.InsertSchedule(ctx, future))
+
+	got, err := db.GetScheduleByID(ctx, due.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, due.TemplateID, got.TemplateID)
+	assert.True(t, due.NextRunAt.Equal(got.NextRunAt))
+
+	ch, err := db.GetSchedulesDue(ctx, now)
+	assert.NoError(t, err)
+	var found []string
+	for schedule := range ch {
+		found = append(found, schedule.ID)
+	}
+	assert.Equal(t, []string{due.ID}, found)
+
+	next := due.NextRunAt.Add(24 * time.Hour)
+	ok, err := db.AdvanceSchedule(ctx, due.ID, due.NextRunAt, next)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = db.AdvanceSchedule(ctx, due.ID, due.NextRunAt, next)
+	assert.NoError(t, err)
+	assert.False(t, ok, "a stale run should not advance the schedule again")
+
+	assert.NoError(t, db.UpdateScheduleState(ctx, due.ID, typesend_schemas.TypeSendScheduleState_PAUSED, time.Time{}))
+	ok, err = db.AdvanceSchedule(ctx, due.ID, next, next.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, ok, "paused schedules should not be advanced")
+
+	assert.Error(t, db.UpdateScheduleState(ctx, "missing", typesend_schemas.TypeSendScheduleState_PAUSED, time.Time{}))
+
+	assert.NoError(t, db.DeleteSchedule(ctx, due.ID))
+	got, err = db.GetScheduleByID(ctx, due.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
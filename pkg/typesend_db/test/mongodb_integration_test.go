@@ -0,0 +1,149 @@
+package typesend_db_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_db/conformance"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// setupMongo returns a connected client to a fresh mongod, and a
+// function creating a database on it with its own (empty) collections.
+func setupMongo(t *testing.T) func(t *testing.T) *typesend_db.MongoTypeSendDB {
+	ctx := context.Background()
+
+	uri, container, err := testutils.SetupMongo(t, ctx)
+	if err != nil {
+		t.Fatalf("Mongo Setup Should Not Return Error: %s", err)
+	}
+	t.Cleanup(func() { testutils.KillContainer(container) })
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect to mongo: %s", err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return func(t *testing.T) *typesend_db.MongoTypeSendDB {
+		db, err := typesend_db.NewMongoDB(ctx, &typesend_db.MongoConfig{
+			Database:    "typesend_" + uuid.NewString()[:8],
+			ForceClient: client,
+		})
+		if err != nil {
+			t.Fatalf("NewMongoDB should succeed: %s", err)
+		}
+		return db
+	}
+}
+
+func TestIntegration_MongoConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	newDB := setupMongo(t)
+
+	conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+		return newDB(t)
+	})
+}
+
+func TestIntegration_MongoClaimsAreDisjoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	db := setupMongo(t)(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 100)
+	for i := range envelopes {
+		envelopes[i] = createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+	}
+	for _, err := range db.InsertBatch(ctx, envelopes) {
+		assert.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch, err := db.GetMessagesReadyToSend(ctx, now)
+			assert.NoError(t, err)
+			for _, envelopeID := range collectIDs(ch) {
+				mu.Lock()
+				seen[envelopeID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, len(envelopes), "every ready envelope should be claimed")
+	for envelopeID, count := range seen {
+		assert.Equal(t, 1, count, "envelope %s was handed to more than one dispatcher", envelopeID)
+	}
+}
+
+func TestIntegration_MongoClaimLeaseExpires(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	db := setupMongo(t)(t)
+	db.Config.ClaimLease = time.Second
+
+	now := time.Now().UTC().Truncate(time.Second)
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+	assert.NoError(t, db.Insert(envelope))
+
+	ch, err := db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{envelope.ID}, collectIDs(ch))
+
+	ch, err = db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Empty(t, collectIDs(ch), "a claimed envelope should be hidden from other dispatchers")
+
+	time.Sleep(1500 * time.Millisecond)
+
+	ch, err = db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{envelope.ID}, collectIDs(ch), "an envelope left UNSENT should be ready again once its lease expires")
+}
+
+func TestIntegration_MongoNestedVariables(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	db := setupMongo(t)(t)
+
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	envelope.Variables = map[string]interface{}{
+		"User":  map[string]interface{}{"Name": "Test"},
+		"Items": []interface{}{"a", "b"},
+	}
+	assert.NoError(t, db.Insert(envelope))
+
+	got, err := db.GetEnvelopeByID(ctx, envelope.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"Name": "Test"}, got.Variables["User"], "nested documents should come back as plain maps")
+	assert.Equal(t, []interface{}{"a", "b"}, got.Variables["Items"])
+}
@@ -0,0 +1,148 @@
+package typesend_db_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/kvizdos/typesend/pkg/testutils"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_db/conformance"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPostgres returns a migrated database, and a function
+// that empties it between tests.
+func setupPostgres(t *testing.T) (*typesend_db.PostgresTypeSendDB, func(t *testing.T)) {
+	ctx := context.Background()
+
+	connString, container, err := testutils.SetupPostgres(t, ctx)
+	if err != nil {
+		t.Fatalf("Postgres Setup Should Not Return Error: %s", err)
+	}
+	t.Cleanup(func() { testutils.KillContainer(container) })
+
+	pool, err := pgxpool.New(ctx, connString)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %s", err)
+	}
+	t.Cleanup(pool.Close)
+
+	db, err := typesend_db.NewPostgresDB(ctx, &typesend_db.PostgresConfig{
+		ForcePool: pool,
+	})
+	if err != nil {
+		t.Fatalf("NewPostgresDB should succeed: %s", err)
+	}
+
+	reset := func(t *testing.T) {
+		_, err := pool.Exec(ctx, "TRUNCATE typesend_envelopes, typesend_idempotency_keys, typesend_rate_limits, typesend_schedules, typesend_templates")
+		assert.NoError(t, err, "TRUNCATE should succeed")
+	}
+
+	return db, reset
+}
+
+func TestIntegration_PostgresConformance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db, reset := setupPostgres(t)
+
+	conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+		reset(t)
+		return db
+	})
+}
+
+func TestIntegration_PostgresMigrateIsRepeatable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	db, _ := setupPostgres(t)
+
+	assert.NoError(t, db.Migrate(context.Background()), "migrating an up to date database should do nothing")
+}
+
+func TestIntegration_PostgresClaimsAreDisjoint(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	db, _ := setupPostgres(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	envelopes := make([]*typesend_schemas.TypeSendEnvelope, 250)
+	for i := range envelopes {
+		envelopes[i] = createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+	}
+	for _, err := range db.InsertBatch(ctx, envelopes) {
+		assert.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch, err := db.GetMessagesReadyToSend(ctx, now)
+			assert.NoError(t, err)
+			for _, envelopeID := range collectIDs(ch) {
+				mu.Lock()
+				seen[envelopeID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, len(envelopes), "every ready envelope should be claimed")
+	for envelopeID, count := range seen {
+		assert.Equal(t, 1, count, "envelope %s was handed to more than one dispatcher", envelopeID)
+	}
+}
+
+func TestIntegration_PostgresClaimLeaseExpires(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+	ctx := context.Background()
+
+	db, _ := setupPostgres(t)
+	db.Config.ClaimLease = time.Second
+
+	now := time.Now().UTC().Truncate(time.Second)
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+	assert.NoError(t, db.Insert(envelope))
+
+	ch, err := db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{envelope.ID}, collectIDs(ch))
+
+	ch, err = db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Empty(t, collectIDs(ch), "a claimed envelope should be hidden from other dispatchers")
+
+	time.Sleep(1500 * time.Millisecond)
+
+	ch, err = db.GetMessagesReadyToSend(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{envelope.ID}, collectIDs(ch), "an envelope left UNSENT should be ready again once its lease expires")
+}
+
+func collectIDs(ch chan *typesend_schemas.TypeSendEnvelope) []string {
+	ids := make([]string, 0)
+	for envelope := range ch {
+		ids = append(ids, envelope.ID)
+	}
+	return ids
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_db/conformance"
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,6 +27,14 @@ func createTestEnvelope(status typesend_schemas.TypeSendStatus, scheduledFor tim
 	}
 }
 
+func TestTestDatabase_Conformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) typesend_db.TypeSendDatabase {
+		db := &typesend_db.TestDatabase{}
+		_ = db.Connect(context.Background())
+		return db
+	})
+}
+
 func TestTestDatabase_Connect(t *testing.T) {
 	db := &typesend_db.TestDatabase{}
 	err := db.Connect(context.Background())
@@ -177,3 +186,132 @@ func TestTestDatabase_GetEnvelopeByIDNotFound(t *testing.T) {
 	assert.NoError(t, err, "GetEnvelopeByID should not return an error")
 	assert.Nil(t, gotEnvelope, "Expected nil when envelope is not found")
 }
+
+func TestTestDatabase_InsertIdempotent(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	expiresAt := time.Now().UTC().Add(time.Hour)
+
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	id, err := db.InsertIdempotent(context.Background(), envelope, "key-1", expiresAt)
+	assert.NoError(t, err, "InsertIdempotent should not return an error")
+	assert.Equal(t, envelope.ID, id, "first insert should own the key")
+
+	duplicate := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	id, err = db.InsertIdempotent(context.Background(), duplicate, "key-1", expiresAt)
+	assert.NoError(t, err, "InsertIdempotent should not return an error on a repeat")
+	assert.Equal(t, envelope.ID, id, "repeat insert should return the original envelope ID")
+
+	assert.Len(t, db.Items(), 1, "repeat insert should not store a second envelope")
+}
+
+func TestTestDatabase_InsertIdempotent_Expired(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	_, err := db.InsertIdempotent(context.Background(), envelope, "key-1", time.Now().UTC().Add(-time.Minute))
+	assert.NoError(t, err)
+
+	next := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	id, err := db.InsertIdempotent(context.Background(), next, "key-1", time.Now().UTC().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, next.ID, id, "an expired key should be claimable again")
+	assert.Len(t, db.Items(), 2)
+}
+
+func TestTestDatabase_InsertBatch(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	envelopes := []*typesend_schemas.TypeSendEnvelope{
+		createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC()),
+		createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC()),
+	}
+
+	errs := db.InsertBatch(context.Background(), envelopes)
+	assert.Len(t, errs, 2, "expected one error slot per envelope")
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Len(t, db.Items(), 2)
+}
+
+func TestTestDatabase_ConsumeRateLimit(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	window := time.Now().UTC().Truncate(time.Minute)
+
+	for i := 0; i < 2; i++ {
+		ok, err := db.ConsumeRateLimit(context.Background(), "tenant#a", window, time.Minute, 2)
+		assert.NoError(t, err)
+		assert.True(t, ok, "slots under the limit should be granted")
+	}
+
+	ok, err := db.ConsumeRateLimit(context.Background(), "tenant#a", window, time.Minute, 2)
+	assert.NoError(t, err)
+	assert.False(t, ok, "slots over the limit should be refused")
+
+	ok, err = db.ConsumeRateLimit(context.Background(), "tenant#a", window.Add(time.Minute), time.Minute, 2)
+	assert.NoError(t, err)
+	assert.True(t, ok, "a new window should start fresh")
+
+	ok, err = db.ConsumeRateLimit(context.Background(), "tenant#b", window, time.Minute, 2)
+	assert.NoError(t, err)
+	assert.True(t, ok, "keys should be counted independently")
+}
+
+func TestTestDatabase_GetMessagesReadyToSendByPriority(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	now := time.Now().UTC()
+	priorities := []typesend_schemas.TypeSendPriority{
+		typesend_schemas.TypeSendPriority_DEFAULT,
+		typesend_schemas.TypeSendPriority_HIGH,
+		typesend_schemas.TypeSendPriority_NORMAL,
+		typesend_schemas.TypeSendPriority_LOW,
+	}
+	for _, priority := range priorities {
+		envelope := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, now.Add(-time.Minute))
+		envelope.Priority = priority
+		_ = db.Insert(envelope)
+	}
+
+	count := func(priority typesend_schemas.TypeSendPriority) int {
+		ch, err := db.GetMessagesReadyToSendByPriority(context.Background(), now, priority)
+		assert.NoError(t, err)
+		n := 0
+		for range ch {
+			n++
+		}
+		return n
+	}
+
+	assert.Equal(t, 1, count(typesend_schemas.TypeSendPriority_HIGH))
+	assert.Equal(t, 2, count(typesend_schemas.TypeSendPriority_NORMAL), "NORMAL should include envelopes without a priority")
+	assert.Equal(t, 1, count(typesend_schemas.TypeSendPriority_LOW))
+}
+
+func TestTestDatabase_LinkEnvelopesToDigest(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	unsent := createTestEnvelope(typesend_schemas.TypeSendStatus_UNSENT, time.Now().UTC())
+	delivering := createTestEnvelope(typesend_schemas.TypeSendStatus_DELIVERING, time.Now().UTC())
+	_ = db.Insert(unsent)
+	_ = db.Insert(delivering)
+
+	linked, err := db.LinkEnvelopesToDigest(context.Background(), "digest-id", []string{unsent.ID, delivering.ID, "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{unsent.ID}, linked, "only UNSENT envelopes should be linked")
+
+	got, _ := db.GetEnvelopeByID(context.Background(), unsent.ID)
+	assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, got.Status)
+	assert.Equal(t, "digest-id", got.DigestID)
+
+	got, _ = db.GetEnvelopeByID(context.Background(), delivering.ID)
+	assert.Empty(t, got.DigestID)
+}
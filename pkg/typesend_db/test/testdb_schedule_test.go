@@ -0,0 +1,89 @@
+package typesend_db_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+// helper to create a test schedule
+func createTestSchedule(nextRunAt time.Time) *typesend_schemas.TypeSendSchedule {
+	return &typesend_schemas.TypeSendSchedule{
+		ID:         uuid.NewString(),
+		AppID:      "test",
+		TenantID:   "base",
+		TemplateID: uuid.NewString(),
+		ToAddress:  "test@example.com",
+		Recurrence: typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * *"},
+		State:      typesend_schemas.TypeSendScheduleState_ACTIVE,
+		NextRunAt:  nextRunAt,
+	}
+}
+
+func TestTestDatabase_GetSchedulesDue(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	now := time.Now().UTC()
+	due := createTestSchedule(now.Add(-time.Minute))
+	future := createTestSchedule(now.Add(time.Hour))
+	paused := createTestSchedule(now.Add(-time.Minute))
+	paused.State = typesend_schemas.TypeSendScheduleState_PAUSED
+
+	for _, schedule := range []*typesend_schemas.TypeSendSchedule{due, future, paused} {
+		assert.NoError(t, db.InsertSchedule(context.Background(), schedule))
+	}
+
+	ch, err := db.GetSchedulesDue(context.Background(), now)
+	assert.NoError(t, err)
+
+	var found []string
+	for schedule := range ch {
+		found = append(found, schedule.ID)
+	}
+	assert.Equal(t, []string{due.ID}, found, "only due, active schedules should be returned")
+}
+
+func TestTestDatabase_AdvanceSchedule(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	runAt := time.Now().UTC().Add(-time.Minute)
+	schedule := createTestSchedule(runAt)
+	assert.NoError(t, db.InsertSchedule(context.Background(), schedule))
+
+	next := runAt.Add(24 * time.Hour)
+	ok, err := db.AdvanceSchedule(context.Background(), schedule.ID, runAt, next)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = db.AdvanceSchedule(context.Background(), schedule.ID, runAt, next)
+	assert.NoError(t, err)
+	assert.False(t, ok, "a schedule can only be advanced from its current run")
+
+	ok, err = db.AdvanceSchedule(context.Background(), schedule.ID, next, time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	got, err := db.GetScheduleByID(context.Background(), schedule.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, typesend_schemas.TypeSendScheduleState_COMPLETED, got.State, "advancing to zero should complete the schedule")
+}
+
+func TestTestDatabase_DeleteSchedule(t *testing.T) {
+	db := &typesend_db.TestDatabase{}
+	_ = db.Connect(context.Background())
+
+	schedule := createTestSchedule(time.Now().UTC())
+	assert.NoError(t, db.InsertSchedule(context.Background(), schedule))
+	assert.NoError(t, db.DeleteSchedule(context.Background(), schedule.ID))
+
+	got, err := db.GetScheduleByID(context.Background(), schedule.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
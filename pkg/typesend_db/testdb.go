@@ -3,6 +3,9 @@ package typesend_db
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,6 +19,19 @@ type TestDatabase struct {
 	items     []*typesend_schemas.TypeSendEnvelope
 	templates []*typesend_schemas.TypeSendTemplate
 
+	idempotencyKeys map[string]*idempotencyRecord
+	rateLimits      map[string]*testRateLimitWindow
+	schedules       map[string]*typesend_schemas.TypeSendSchedule
+	tombstones      map[string]*typesend_schemas.TypeSendTombstone
+	suppressions    map[string]*typesend_schemas.TypeSendSuppression
+	categories      map[string][]typesend_schemas.TypeSendCategory
+	preferences     map[string]*typesend_schemas.TypeSendPreferences
+	// Keyed by eventKey.
+	events map[string]*typesend_schemas.TypeSendEvent
+	// Keyed by rollupKey.
+	rollups map[string]*typesend_schemas.TypeSendRollup
+
+	// Optional; signalled without blocking on every insert.
 	LiveModeChan chan *typesend_schemas.TypeSendEnvelope
 }
 
@@ -27,9 +43,26 @@ func (db *TestDatabase) Connect(ctx context.Context) error {
 	db.connected = true
 	db.items = make([]*typesend_schemas.TypeSendEnvelope, 0)
 	db.templates = make([]*typesend_schemas.TypeSendTemplate, 0)
+	db.idempotencyKeys = make(map[string]*idempotencyRecord)
+	db.rateLimits = make(map[string]*testRateLimitWindow)
+	db.schedules = make(map[string]*typesend_schemas.TypeSendSchedule)
+	db.tombstones = make(map[string]*typesend_schemas.TypeSendTombstone)
+	db.suppressions = make(map[string]*typesend_schemas.TypeSendSuppression)
+	db.categories = make(map[string][]typesend_schemas.TypeSendCategory)
+	db.preferences = make(map[string]*typesend_schemas.TypeSendPreferences)
+	db.events = make(map[string]*typesend_schemas.TypeSendEvent)
+	db.rollups = make(map[string]*typesend_schemas.TypeSendRollup)
 	return nil
 }
 
+// SetLiveModeChan implements LiveModeDatabase.
+func (db *TestDatabase) SetLiveModeChan(ch chan *typesend_schemas.TypeSendEnvelope) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.LiveModeChan = ch
+}
+
 func (db *TestDatabase) Items() []*typesend_schemas.TypeSendEnvelope {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -45,6 +78,9 @@ func (db *TestDatabase) Templates() []*typesend_schemas.TypeSendTemplate {
 }
 
 func (db *TestDatabase) GetEnvelopeByID(_ context.Context, id string) (*typesend_schemas.TypeSendEnvelope, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	for _, item := range db.items {
 		if item.ID == id {
 			return item, nil
@@ -61,14 +97,88 @@ func (db *TestDatabase) Insert(envelope *typesend_schemas.TypeSendEnvelope) erro
 		return fmt.Errorf("database not connected")
 	}
 
+	db.insertLocked(envelope)
+	return nil
+}
+
+func (db *TestDatabase) InsertIdempotent(_ context.Context, envelope *typesend_schemas.TypeSendEnvelope, idempotencyKey string, expiresAt time.Time) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.connected {
+		return "", fmt.Errorf("database not connected")
+	}
+
+	key := scopedIdempotencyKey(envelope, idempotencyKey)
+	if existing, ok := db.idempotencyKeys[key]; ok && existing.ExpiresAt > time.Now().UTC().Unix() {
+		return existing.EnvelopeID, nil
+	}
+
+	db.idempotencyKeys[key] = &idempotencyRecord{
+		ID:         key,
+		EnvelopeID: envelope.ID,
+		ExpiresAt:  expiresAt.Unix(),
+	}
+	db.insertLocked(envelope)
+	return envelope.ID, nil
+}
+
+func (db *TestDatabase) InsertBatch(_ context.Context, envelopes []*typesend_schemas.TypeSendEnvelope) []error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	errs := make([]error, len(envelopes))
+	for i, envelope := range envelopes {
+		if !db.connected {
+			errs[i] = fmt.Errorf("database not connected")
+			continue
+		}
+		db.insertLocked(envelope)
+	}
+	return errs
+}
+
+// insertLocked must be called while holding db.mu.
+func (db *TestDatabase) insertLocked(envelope *typesend_schemas.TypeSendEnvelope) {
 	db.items = append(db.items, envelope)
 	if db.LiveModeChan != nil {
-		db.LiveModeChan <- envelope
+		// Only a wake-up signal for the live mode dispatcher. It must not
+		// block, as the dispatcher itself inserts schedule occurrences.
+		select {
+		case db.LiveModeChan <- envelope:
+		default:
+		}
 	}
-	return nil
 }
 
 func (db *TestDatabase) GetMessagesReadyToSend(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	return db.messagesReadyToSend(ctx, timestamp, func(*typesend_schemas.TypeSendEnvelope) bool {
+		return true
+	})
+}
+
+func (db *TestDatabase) GetMessagesReadyToSendByPriority(ctx context.Context, timestamp time.Time, priority typesend_schemas.TypeSendPriority) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	return db.messagesReadyToSend(ctx, timestamp, func(envelope *typesend_schemas.TypeSendEnvelope) bool {
+		return envelope.Priority.Effective() == priority.Effective()
+	})
+}
+
+func (db *TestDatabase) messagesReadyToSend(ctx context.Context, timestamp time.Time, include func(*typesend_schemas.TypeSendEnvelope) bool) (chan *typesend_schemas.TypeSendEnvelope, error) {
+	// Matched up front, as the dispatcher updates
+	// statuses while the results are still streaming.
+	db.mu.Lock()
+	ready := make([]*typesend_schemas.TypeSendEnvelope, 0)
+	for _, envelope := range db.items {
+		if envelope.Status == typesend_schemas.TypeSendStatus_UNSENT && !envelope.ScheduledFor.After(timestamp) && include(envelope) {
+			ready = append(ready, envelope)
+		}
+	}
+	db.mu.Unlock()
+
+	sort.SliceStable(ready, func(i, j int) bool {
+		return ready[i].ScheduledFor.Before(ready[j].ScheduledFor)
+	})
+
 	ch := make(chan *typesend_schemas.TypeSendEnvelope)
 	go func() {
 		defer close(ch)
@@ -77,13 +187,11 @@ func (db *TestDatabase) GetMessagesReadyToSend(ctx context.Context, timestamp ti
 			return
 		default:
 		}
-		for _, envelope := range db.Items() {
-			if envelope.Status == typesend_schemas.TypeSendStatus_UNSENT && !envelope.ScheduledFor.After(timestamp) {
-				select {
-				case <-ctx.Done():
-					return
-				case ch <- envelope:
-				}
+		for _, envelope := range ready {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- envelope:
 			}
 		}
 	}()
@@ -106,21 +214,642 @@ func (db *TestDatabase) UpdateEnvelopeStatus(ctx context.Context, envelopeID str
 	return fmt.Errorf("envelope with ID %s not found", envelopeID)
 }
 
-func (db *TestDatabase) GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
-	// Iterate over the items to find the envelope with the matching ID.
-	for _, template := range db.templates {
-		if template.TemplateID == templateID && template.TenantID == tenantID {
-			return template, nil
+func (db *TestDatabase) UpdateEnvelopeStatuses(ctx context.Context, envelopeIDs []string, toStatus typesend_schemas.TypeSendStatus) []error {
+	errs := make([]error, len(envelopeIDs))
+	for i, envelopeID := range envelopeIDs {
+		errs[i] = db.UpdateEnvelopeStatus(ctx, envelopeID, toStatus)
+	}
+	return errs
+}
+
+func (db *TestDatabase) ClaimEnvelopes(ctx context.Context, envelopeIDs []string) []error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	errs := make([]error, len(envelopeIDs))
+	for i, envelopeID := range envelopeIDs {
+		errs[i] = fmt.Errorf("envelope with ID %s not found", envelopeID)
+		for _, envelope := range db.items {
+			if envelope.ID != envelopeID {
+				continue
+			}
+			errs[i] = nil
+			if envelope.Status != typesend_schemas.TypeSendStatus_UNSENT {
+				errs[i] = ErrNotUnsent
+				break
+			}
+			envelope.Status = typesend_schemas.TypeSendStatus_DELIVERING
+			break
+		}
+	}
+	return errs
+}
+
+func (db *TestDatabase) DeferEnvelope(_ context.Context, envelope *typesend_schemas.TypeSendEnvelope, until time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	deferred := *envelope
+	deferred.Defer(until)
+
+	for _, stored := range db.items {
+		if stored.ID != envelope.ID {
+			continue
+		}
+		if stored.Status != typesend_schemas.TypeSendStatus_UNSENT {
+			return fmt.Errorf("envelope with ID %s is no longer UNSENT", envelope.ID)
+		}
+		stored.OriginalScheduledFor = deferred.OriginalScheduledFor
+		stored.ScheduledFor = deferred.ScheduledFor
+		stored.ContentExpiresAt = deferred.ContentExpiresAt
+		stored.ExpiresAt = deferred.ExpiresAt
+		return nil
+	}
+
+	return fmt.Errorf("envelope with ID %s not found", envelope.ID)
+}
+
+func (db *TestDatabase) LinkEnvelopesToDigest(_ context.Context, digestID string, envelopeIDs []string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	linked := make([]string, 0, len(envelopeIDs))
+	for _, envelopeID := range envelopeIDs {
+		for _, envelope := range db.items {
+			if envelope.ID != envelopeID || envelope.Status != typesend_schemas.TypeSendStatus_UNSENT {
+				continue
+			}
+			envelope.Status = typesend_schemas.TypeSendStatus_SENT
+			envelope.DigestID = digestID
+			linked = append(linked, envelopeID)
 		}
 	}
+	return linked, nil
+}
+
+type testRateLimitWindow struct {
+	count     int
+	expiresAt time.Time
+}
+
+func (db *TestDatabase) ConsumeRateLimit(_ context.Context, key string, windowStart time.Time, window time.Duration, limit int) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	windowKey := rateLimitWindowKey(key, windowStart)
+	counter, ok := db.rateLimits[windowKey]
+	if !ok {
+		counter = &testRateLimitWindow{expiresAt: windowStart.Add(window + rateLimitGracePeriod)}
+		db.rateLimits[windowKey] = counter
+	}
+	if counter.count >= limit {
+		return false, nil
+	}
+
+	counter.count++
+	return true, nil
+}
+
+func (db *TestDatabase) ReleaseRateLimit(_ context.Context, key string, windowStart time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if counter, ok := db.rateLimits[rateLimitWindowKey(key, windowStart)]; ok && counter.count > 0 {
+		counter.count--
+	}
+	return nil
+}
+
+func (db *TestDatabase) PurgeExpiredData(_ context.Context, now time.Time) (PurgeResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var result PurgeResult
+
+	kept := make([]*typesend_schemas.TypeSendEnvelope, 0, len(db.items))
+	for _, envelope := range db.items {
+		if purgeable(envelope) && retentionExpired(envelope.ExpiresAt, now) {
+			result.Deleted++
+			continue
+		}
+		if purgeable(envelope) && retentionExpired(envelope.ContentExpiresAt, now) {
+			envelope.StripContent()
+			result.Stripped++
+		}
+		kept = append(kept, envelope)
+	}
+	db.items = kept
+
+	for key, record := range db.idempotencyKeys {
+		if record.ExpiresAt <= now.Unix() {
+			delete(db.idempotencyKeys, key)
+		}
+	}
+
+	for key, counter := range db.rateLimits {
+		if !counter.expiresAt.After(now) {
+			delete(db.rateLimits, key)
+		}
+	}
+
+	return result, nil
+}
+
+// ExportRecipientData returns copies, so a later erasure
+// does not change the archive.
+func (db *TestDatabase) ExportRecipientData(_ context.Context, recipient typesend_schemas.TypeSendRecipient) (*typesend_schemas.TypeSendRecipientExport, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	export := &typesend_schemas.TypeSendRecipientExport{
+		Recipient:    recipient,
+		ExportedAt:   time.Now().UTC(),
+		Envelopes:    []*typesend_schemas.TypeSendEnvelope{},
+		Events:       []*typesend_schemas.TypeSendEvent{},
+		Schedules:    []*typesend_schemas.TypeSendSchedule{},
+		Suppressions: []*typesend_schemas.TypeSendSuppression{},
+		Preferences:  []*typesend_schemas.TypeSendPreferences{},
+		Tombstones:   []*typesend_schemas.TypeSendTombstone{},
+	}
+	addresses := []string{recipient.ToAddress}
+
+	envelopeIDs := map[string]bool{}
+	for _, envelope := range db.items {
+		if recipient.Matches(envelope.ToAddress, envelope.ToInternalID) {
+			found := *envelope
+			export.Envelopes = append(export.Envelopes, &found)
+			addresses = append(addresses, envelope.ToAddress)
+			envelopeIDs[envelope.ID] = true
+		}
+	}
+
+	for _, event := range db.events {
+		if envelopeIDs[event.EnvelopeID] {
+			found := *event
+			found.Details = maps.Clone(event.Details)
+			export.Events = append(export.Events, &found)
+		}
+	}
+	sortEvents(export.Events)
+
+	for _, schedule := range db.schedules {
+		if recipient.Matches(schedule.ToAddress, schedule.ToInternalID) {
+			found := *schedule
+			export.Schedules = append(export.Schedules, &found)
+			addresses = append(addresses, schedule.ToAddress)
+		}
+	}
+
+	for _, suppression := range db.addressSuppressions(recipientAddresses(addresses...)) {
+		found := *suppression
+		export.Suppressions = append(export.Suppressions, &found)
+	}
+
+	for _, preferences := range db.addressPreferences(recipientAddresses(addresses...)) {
+		found := *preferences
+		found.OptedOut = slices.Clone(preferences.OptedOut)
+		export.Preferences = append(export.Preferences, &found)
+	}
+
+	for _, hash := range recipient.Hashes() {
+		if tombstone, ok := db.tombstones[hash]; ok {
+			found := *tombstone
+			export.Tombstones = append(export.Tombstones, &found)
+		}
+	}
+
+	return export, nil
+}
+
+func (db *TestDatabase) EraseRecipient(_ context.Context, recipient typesend_schemas.TypeSendRecipient, erasedAt time.Time) (*typesend_schemas.TypeSendErasure, error) {
+	if err := recipient.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	erasure := &typesend_schemas.TypeSendErasure{}
+	erased := []string{recipient.ToAddress, recipient.ToInternalID}
+	addresses := []string{recipient.ToAddress}
+
+	envelopeIDs := map[string]bool{}
+	for _, envelope := range db.items {
+		if !recipient.Matches(envelope.ToAddress, envelope.ToInternalID) {
+			continue
+		}
+		erased = append(erased, envelope.ToAddress, envelope.ToInternalID)
+		addresses = append(addresses, envelope.ToAddress)
+		envelopeIDs[envelope.ID] = true
+		envelope.Erase()
+		erasure.Envelopes++
+	}
+
+	for _, event := range db.events {
+		if envelopeIDs[event.EnvelopeID] && len(event.Details) > 0 {
+			event.Erase()
+			erasure.Events++
+		}
+	}
+
+	for id, schedule := range db.schedules {
+		if !recipient.Matches(schedule.ToAddress, schedule.ToInternalID) {
+			continue
+		}
+		erased = append(erased, schedule.ToAddress, schedule.ToInternalID)
+		addresses = append(addresses, schedule.ToAddress)
+		delete(db.schedules, id)
+		erasure.Schedules++
+	}
+
+	for _, suppression := range db.addressSuppressions(recipientAddresses(addresses...)) {
+		delete(db.suppressions, suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address))
+		suppression.Erase()
+		db.suppressions[suppressionKey(suppression.AppID, suppression.TenantID, suppression.Address)] = suppression
+		erasure.Suppressions++
+	}
+
+	for _, preferences := range db.addressPreferences(recipientAddresses(addresses...)) {
+		delete(db.preferences, preferencesKey(preferences.AppID, preferences.TenantID, preferences.Address))
+		erasure.Preferences++
+	}
+
+	erasure.Tombstones = typesend_schemas.NewTombstones(erasedAt, erased...)
+	for _, tombstone := range erasure.Tombstones {
+		stored := *tombstone
+		db.tombstones[tombstone.Hash] = &stored
+	}
+
+	return erasure, nil
+}
+
+func (db *TestDatabase) GetTombstone(_ context.Context, hash string) (*typesend_schemas.TypeSendTombstone, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tombstone, ok := db.tombstones[hash]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *tombstone
+	return &found, nil
+}
+
+// addressSuppressions returns the stored suppressions for any of
+// the normalized addresses. The caller must hold db.mu.
+func (db *TestDatabase) addressSuppressions(addresses []string) []*typesend_schemas.TypeSendSuppression {
+	var found []*typesend_schemas.TypeSendSuppression
+	for _, suppression := range db.suppressions {
+		if slices.Contains(addresses, suppression.Address) {
+			found = append(found, suppression)
+		}
+	}
+	return found
+}
+
+func (db *TestDatabase) PutSuppression(_ context.Context, suppression *typesend_schemas.TypeSendSuppression) error {
+	stored, err := storedSuppression(suppression)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.suppressions[suppressionKey(stored.AppID, stored.TenantID, stored.Address)] = stored
+	return nil
+}
+
+func (db *TestDatabase) GetSuppression(_ context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendSuppression, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	suppression, ok := db.suppressions[suppressionKey(appID, tenantID, address)]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *suppression
+	return &found, nil
+}
+
+func (db *TestDatabase) DeleteSuppression(_ context.Context, appID string, tenantID string, address string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.suppressions, suppressionKey(appID, tenantID, address))
+	return nil
+}
+
+func (db *TestDatabase) PutCategories(_ context.Context, appID string, categories []*typesend_schemas.TypeSendCategory) error {
+	stored, err := storedCategories(appID, categories)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.categories[appID] = stored
+	return nil
+}
+
+func (db *TestDatabase) GetCategories(_ context.Context, appID string) ([]*typesend_schemas.TypeSendCategory, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return loadedCategories(db.categories[appID]), nil
+}
+
+// addressPreferences returns the stored preferences for any of
+// the normalized addresses. The caller must hold db.mu.
+func (db *TestDatabase) addressPreferences(addresses []string) []*typesend_schemas.TypeSendPreferences {
+	var found []*typesend_schemas.TypeSendPreferences
+	for _, preferences := range db.preferences {
+		if slices.Contains(addresses, preferences.Address) {
+			found = append(found, preferences)
+		}
+	}
+	return found
+}
+
+func (db *TestDatabase) PutPreferences(_ context.Context, preferences *typesend_schemas.TypeSendPreferences) error {
+	stored, err := storedPreferences(preferences)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.preferences[preferencesKey(stored.AppID, stored.TenantID, stored.Address)] = stored
+	return nil
+}
+
+func (db *TestDatabase) GetPreferences(_ context.Context, appID string, tenantID string, address string) (*typesend_schemas.TypeSendPreferences, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	preferences, ok := db.preferences[preferencesKey(appID, tenantID, address)]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *preferences
+	found.OptedOut = slices.Clone(preferences.OptedOut)
+	return &found, nil
+}
+
+func (db *TestDatabase) GetRecipientStates(_ context.Context, keys []RecipientKey) ([]RecipientState, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return recipientStates(keys, db.suppressions, db.preferences, db.tombstones), nil
+}
+
+func (db *TestDatabase) AppendEvents(_ context.Context, events []*typesend_schemas.TypeSendEvent) error {
+	stored, err := storedEvents(events)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	// Appended to as envelopes move through TypeSend,
+	// so also works before Connect.
+	if db.events == nil {
+		db.events = make(map[string]*typesend_schemas.TypeSendEvent)
+	}
+	for _, event := range stored {
+		key := eventKey(event.EnvelopeID, event.ID)
+		if _, ok := db.events[key]; !ok {
+			db.events[key] = event
+		}
+	}
+	return nil
+}
+
+func (db *TestDatabase) GetEventByProviderMessageID(_ context.Context, provider string, messageID string) (*typesend_schemas.TypeSendEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []*typesend_schemas.TypeSendEvent
+	for _, event := range db.events {
+		if event.Provider == provider && event.ProviderMessageID == messageID && messageID != "" {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	sortEvents(events)
+
+	found := *events[0]
+	found.Details = maps.Clone(events[0].Details)
+	return &found, nil
+}
+
+func (db *TestDatabase) GetEnvelopeTimeline(_ context.Context, envelopeID string) ([]*typesend_schemas.TypeSendEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []*typesend_schemas.TypeSendEvent
+	for _, event := range db.events {
+		if event.EnvelopeID != envelopeID {
+			continue
+		}
+		found := *event
+		found.Details = maps.Clone(event.Details)
+		events = append(events, &found)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (db *TestDatabase) GetEventsByDay(_ context.Context, day time.Time) ([]*typesend_schemas.TypeSendEvent, error) {
+	start, end := eventDayBounds(day)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var events []*typesend_schemas.TypeSendEvent
+	for _, event := range db.events {
+		if event.OccurredAt.Before(start) || !event.OccurredAt.Before(end) {
+			continue
+		}
+		found := *event
+		found.Details = maps.Clone(event.Details)
+		events = append(events, &found)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+func (db *TestDatabase) PutRollups(_ context.Context, rollups []*typesend_schemas.TypeSendRollup) error {
+	stored, err := storedRollups(rollups)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.rollups == nil {
+		db.rollups = make(map[string]*typesend_schemas.TypeSendRollup)
+	}
+	for _, rollup := range stored {
+		db.rollups[rollupKey(rollup)] = rollup
+	}
+	return nil
+}
+
+func (db *TestDatabase) GetRollups(_ context.Context, query typesend_schemas.TypeSendRollupQuery) ([]*typesend_schemas.TypeSendRollup, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var rollups []*typesend_schemas.TypeSendRollup
+	for _, rollup := range db.rollups {
+		if !query.Matches(rollup) {
+			continue
+		}
+		found := *rollup
+		rollups = append(rollups, &found)
+	}
+	sortRollups(rollups)
+	return rollups, nil
+}
+
+func (db *TestDatabase) InsertSchedule(_ context.Context, schedule *typesend_schemas.TypeSendSchedule) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if !db.connected {
+		return fmt.Errorf("database not connected")
+	}
+
+	stored := *schedule
+	db.schedules[schedule.ID] = &stored
+	return nil
+}
+
+// GetScheduleByID returns a copy, so callers cannot
+// change the stored schedule without going through the database.
+func (db *TestDatabase) GetScheduleByID(_ context.Context, scheduleID string) (*typesend_schemas.TypeSendSchedule, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	schedule, ok := db.schedules[scheduleID]
+	if !ok {
+		return nil, nil
+	}
+
+	found := *schedule
+	return &found, nil
+}
+
+func (db *TestDatabase) UpdateScheduleState(_ context.Context, scheduleID string, state typesend_schemas.TypeSendScheduleState, nextRunAt time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	schedule, ok := db.schedules[scheduleID]
+	if !ok {
+		return fmt.Errorf("schedule with ID %s not found", scheduleID)
+	}
+
+	schedule.State = state
+	if !nextRunAt.IsZero() {
+		schedule.NextRunAt = nextRunAt
+	}
+	return nil
+}
+
+func (db *TestDatabase) DeleteSchedule(_ context.Context, scheduleID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.schedules, scheduleID)
+	return nil
+}
+
+func (db *TestDatabase) GetSchedulesDue(ctx context.Context, timestamp time.Time) (chan *typesend_schemas.TypeSendSchedule, error) {
+	db.mu.Lock()
+	due := make([]*typesend_schemas.TypeSendSchedule, 0)
+	for _, schedule := range db.schedules {
+		if schedule.State == typesend_schemas.TypeSendScheduleState_ACTIVE && !schedule.NextRunAt.After(timestamp) {
+			found := *schedule
+			due = append(due, &found)
+		}
+	}
+	db.mu.Unlock()
+
+	ch := make(chan *typesend_schemas.TypeSendSchedule)
+	go func() {
+		defer close(ch)
+		for _, schedule := range due {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- schedule:
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (db *TestDatabase) AdvanceSchedule(_ context.Context, scheduleID string, from time.Time, next time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	schedule, ok := db.schedules[scheduleID]
+	if !ok || schedule.State != typesend_schemas.TypeSendScheduleState_ACTIVE || !schedule.NextRunAt.Equal(from) {
+		return false, nil
+	}
+
+	if next.IsZero() {
+		schedule.State = typesend_schemas.TypeSendScheduleState_COMPLETED
+		return true, nil
+	}
+
+	schedule.NextRunAt = next
+	return true, nil
+}
+
+func (db *TestDatabase) GetTemplateByID(ctx context.Context, templateID string, tenantID string) (*typesend_schemas.TypeSendTemplate, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if template := db.findTemplateLocked(templateID, tenantID); template != nil {
+		return template, nil
+	}
 
 	if tenantID != "base" {
-		return db.GetTemplateByID(ctx, templateID, "base")
+		return db.findTemplateLocked(templateID, "base"), nil
 	}
 
 	return nil, nil
 }
 
+// findTemplateLocked must be called while holding db.mu.
+func (db *TestDatabase) findTemplateLocked(templateID string, tenantID string) *typesend_schemas.TypeSendTemplate {
+	for _, template := range db.templates {
+		if template.TemplateID == templateID && template.TenantID == tenantID {
+			return template
+		}
+	}
+	return nil
+}
+
 func (db *TestDatabase) InsertTemplate(_ context.Context, template *typesend_schemas.TypeSendTemplate) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -0,0 +1,81 @@
+package typesend_events
+
+import (
+	"context"
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Received is an event a provider reported, with what
+// it means for the recipient.
+type Received struct {
+	Event *typesend_schemas.TypeSendEvent
+	// Who the event is about. It is used for suppression,
+	// and not stored in the event log.
+	Address string
+	// Optional; suppresses Address for this reason,
+	// e.g. after a permanent bounce.
+	Suppress typesend_schemas.TypeSendSuppressionReason
+	// Optional; stored with the suppression.
+	Note string
+}
+
+// Recorder appends the events providers report to envelope
+// event logs, and suppresses recipients who bounce or complain.
+type Recorder struct {
+	Database typesend_db.TypeSendDatabase
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+// Record stores every event, then applies their suppressions. It is
+// safe to record the same events again, such as on a webhook retry.
+func (r *Recorder) Record(ctx context.Context, received []Received) error {
+	events := make([]*typesend_schemas.TypeSendEvent, len(received))
+	for i := range received {
+		events[i] = received[i].Event
+	}
+	if err := r.Database.AppendEvents(ctx, events); err != nil {
+		return err
+	}
+
+	for _, event := range received {
+		if event.Suppress == 0 {
+			continue
+		}
+		if event.Event.AppID == "" || event.Event.TenantID == "" || event.Address == "" {
+			internal.ProtectedWarnLogger(r.Logger, "typesend: can't suppress the recipient of envelope %s without its app, tenant and address", event.Event.EnvelopeID)
+			continue
+		}
+		if err := r.suppress(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// suppress only replaces an unsubscribe, as bounces and complaints
+// also block transactional mail. An earlier bounce or complaint is kept.
+func (r *Recorder) suppress(ctx context.Context, event Received) error {
+	existing, err := r.Database.GetSuppression(ctx, event.Event.AppID, event.Event.TenantID, event.Address)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Reason != typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED {
+		return nil
+	}
+
+	internal.ProtectedInfoLogger(r.Logger, "typesend: suppressing the recipient of envelope %s (%s)", event.Event.EnvelopeID, event.Suppress)
+	return r.Database.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+		AppID:     event.Event.AppID,
+		TenantID:  event.Event.TenantID,
+		Address:   event.Address,
+		Reason:    event.Suppress,
+		Note:      event.Note,
+		CreatedAt: time.Now().UTC(),
+	})
+}
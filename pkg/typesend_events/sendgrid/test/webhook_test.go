@@ -0,0 +1,261 @@
+package typesend_events_sendgrid_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	typesend_events_sendgrid "github.com/kvizdos/typesend/pkg/typesend_events/sendgrid"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/sendgrid/sendgrid-go/helpers/eventwebhook"
+	"github.com/stretchr/testify/assert"
+)
+
+const batch = `[
+	{"email":"test@example.com","timestamp":1700000000,"event":"delivered","sg_event_id":"e1","sg_message_id":"m1","response":"250 OK","X-Using-TypeSend":"true","X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Template":"welcome","X-TypeSend-Envelope":"envelope"},
+	{"email":"test@example.com","timestamp":1700000060,"event":"open","sg_event_id":"e2","sg_message_id":"m1","sg_machine_open":true,"X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Envelope":"envelope"},
+	{"email":"test@example.com","timestamp":1700000120,"event":"click","sg_event_id":"e3","sg_message_id":"m1","url":"https://example.com","X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Envelope":"envelope"},
+	{"email":"other@example.com","timestamp":1700000000,"event":"delivered","sg_event_id":"e4","sg_message_id":"m2"},
+	{"email":"test@example.com","timestamp":1700000000,"event":"processed","sg_event_id":"e5","sg_message_id":"m1","X-TypeSend-Envelope":"envelope"},
+	{"email":"test@example.com","timestamp":"not a number","event":"delivered","sg_event_id":"e6","X-TypeSend-Envelope":"envelope"}
+]`
+
+func newHandler(t *testing.T) (*typesend_events_sendgrid.Handler, *typesend_db.TestDatabase, *ecdsa.PrivateKey) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	return &typesend_events_sendgrid.Handler{
+		Recorder:  &typesend_events.Recorder{Database: db},
+		PublicKey: &key.PublicKey,
+	}, db, key
+}
+
+func signedRequest(t *testing.T, key *ecdsa.PrivateKey, body string) *http.Request {
+	return signedRequestAt(t, key, body, time.Now())
+}
+
+func signedRequestAt(t *testing.T, key *ecdsa.PrivateKey, body string, at time.Time) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	digest := sha256.Sum256([]byte(timestamp + body))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set(eventwebhook.VerificationHTTPHeader, base64.StdEncoding.EncodeToString(signature))
+	r.Header.Set(eventwebhook.TimestampHTTPHeader, timestamp)
+	return r
+}
+
+func envelopeEvents(t *testing.T, db *typesend_db.TestDatabase) []*typesend_schemas.TypeSendEvent {
+	events, err := db.GetEnvelopeTimeline(context.Background(), "envelope")
+	assert.NoError(t, err)
+	return events
+}
+
+func suppression(t *testing.T, db *typesend_db.TestDatabase) *typesend_schemas.TypeSendSuppression {
+	suppression, err := db.GetSuppression(context.Background(), "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	return suppression
+}
+
+func TestWebhookRecordsEvents(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, batch))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 3, "only recorded types of TypeSend emails are kept") {
+		assert.Equal(t, &typesend_schemas.TypeSendEvent{
+			EnvelopeID:        "envelope",
+			ID:                "e1",
+			AppID:             "app",
+			TenantID:          "base",
+			TemplateID:        "welcome",
+			Type:              typesend_schemas.TypeSendEventType_DELIVERED,
+			Provider:          "SendGrid",
+			ProviderMessageID: "m1",
+			OccurredAt:        time.Unix(1700000000, 0).UTC(),
+			Details:           map[string]string{"response": "250 OK"},
+		}, events[0])
+		assert.Equal(t, typesend_schemas.TypeSendEventType_OPENED, events[1].Type)
+		assert.Equal(t, map[string]string{"machineOpen": "true"}, events[1].Details)
+		assert.Equal(t, typesend_schemas.TypeSendEventType_CLICKED, events[2].Type)
+		assert.Equal(t, map[string]string{"url": "https://example.com"}, events[2].Details)
+	}
+	assert.Nil(t, suppression(t, db))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, batch))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Len(t, envelopeEvents(t, db), 3, "retries must not duplicate events")
+}
+
+func TestWebhookBounceSuppresses(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	body := `[{"email":"Test@Example.com","timestamp":1700000000,"event":"bounce","sg_event_id":"e1","type":"bounce","reason":"550 no such user","status":"5.1.1","X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Envelope":"envelope"}]`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, body))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_BOUNCED, events[0].Type)
+		assert.Equal(t, map[string]string{"reason": "550 no such user", "status": "5.1.1", "type": "bounce"}, events[0].Details)
+	}
+	if s := suppression(t, db); assert.NotNil(t, s) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, s.Reason)
+		assert.Equal(t, "550 no such user", s.Note)
+	}
+}
+
+func TestWebhookBlockedBounceDoesNotSuppress(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	body := `[{"email":"test@example.com","timestamp":1700000000,"event":"bounce","sg_event_id":"e1","type":"blocked","reason":"try again later","X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Envelope":"envelope"}]`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, body))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.Len(t, envelopeEvents(t, db), 1)
+	assert.Nil(t, suppression(t, db))
+}
+
+func TestWebhookSpamReportSuppresses(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	body := `[{"email":"test@example.com","timestamp":1700000000,"event":"spamreport","sg_event_id":"e1","X-TypeSend-App":"app","X-TypeSend-Tenant":"base","X-TypeSend-Envelope":"envelope"}]`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, body))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_COMPLAINED, events[0].Type)
+	}
+	if s := suppression(t, db); assert.NotNil(t, s) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, s.Reason)
+	}
+}
+
+func TestWebhookRejectsBadSignature(t *testing.T) {
+	handler, db, _ := newHandler(t)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, other, batch))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(batch))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "unsigned requests are rejected")
+
+	assert.Empty(t, envelopeEvents(t, db))
+}
+
+func TestWebhookRejectsStaleTimestamp(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequestAt(t, key, batch, time.Now().Add(-time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "replayed requests are rejected")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequestAt(t, key, batch, time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "requests from the future are rejected")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequestAt(t, key, batch, time.Now().Add(-5*time.Minute)))
+	assert.Equal(t, http.StatusNoContent, w.Code, "delayed requests within the tolerance are accepted")
+
+	assert.Len(t, envelopeEvents(t, db), 3)
+}
+
+func TestWebhookRejectsTamperedBody(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	r := signedRequest(t, key, batch)
+	r.Body = http.NoBody
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, envelopeEvents(t, db))
+}
+
+func TestWebhookRejectsNonArray(t *testing.T) {
+	handler, _, key := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, signedRequest(t, key, `{"event":"delivered"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebhookRejectsGet(t *testing.T) {
+	handler, _, _ := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestWebhookFunctionURL(t *testing.T) {
+	handler, db, key := newHandler(t)
+
+	signed := signedRequest(t, key, batch)
+	response, err := handler.HandleFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath: "/",
+		Headers: map[string]string{
+			strings.ToLower(eventwebhook.VerificationHTTPHeader): signed.Header.Get(eventwebhook.VerificationHTTPHeader),
+			strings.ToLower(eventwebhook.TimestampHTTPHeader):    signed.Header.Get(eventwebhook.TimestampHTTPHeader),
+		},
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodPost},
+		},
+		Body: batch,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, response.StatusCode)
+	assert.Len(t, envelopeEvents(t, db), 3)
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+
+	parsed, err := typesend_events_sendgrid.ParsePublicKey(base64.StdEncoding.EncodeToString(der))
+	assert.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(parsed))
+
+	_, err = typesend_events_sendgrid.ParsePublicKey("not base64!")
+	assert.Error(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.NoError(t, err)
+	_, err = typesend_events_sendgrid.ParsePublicKey(base64.StdEncoding.EncodeToString(der))
+	assert.Error(t, err, "only ECDSA keys are accepted")
+}
@@ -0,0 +1,219 @@
+package typesend_events_sendgrid
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/internal/function_url"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/sendgrid/sendgrid-go/helpers/eventwebhook"
+)
+
+// ProviderName is the Provider of every event the Handler records.
+const ProviderName = "SendGrid"
+
+// Larger batches are rejected. SendGrid batches by size or
+// time, and stays well under this.
+const MaxBodySize = 10 << 20
+
+// Signed requests whose timestamp is further than this from now are
+// rejected, so a captured request can't be replayed later.
+const TimestampTolerance = 10 * time.Minute
+
+// Handler receives SendGrid's Event Webhook. It verifies the
+// webhook's ECDSA signature, then records the events of every email
+// TypeSend sent (those carrying X-TypeSend-Envelope), suppressing
+// recipients on a bounce or spam report.
+//
+// SendGrid retries a batch until it gets a 2xx. Recording is
+// idempotent per sg_event_id, so retries are harmless.
+type Handler struct {
+	Recorder *typesend_events.Recorder
+	// The "Verification Key" of the webhook's signed event
+	// settings; see ParsePublicKey.
+	PublicKey *ecdsa.PublicKey
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+// ParsePublicKey reads the base64 verification key SendGrid shows.
+func ParsePublicKey(encoded string) (*ecdsa.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid SendGrid verification key: %w", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid SendGrid verification key: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("typesend: SendGrid verification key is not an ECDSA key")
+	}
+	return key, nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	timestamp := r.Header.Get(eventwebhook.TimestampHTTPHeader)
+	verified, err := eventwebhook.VerifySignature(h.PublicKey, body,
+		r.Header.Get(eventwebhook.VerificationHTTPHeader), timestamp)
+	if err != nil || !verified {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if !fresh(timestamp, time.Now()) {
+		http.Error(w, "stale timestamp", http.StatusUnauthorized)
+		return
+	}
+
+	// Decoded one at a time, so one odd event doesn't fail the batch.
+	var batch []json.RawMessage
+	if err := json.Unmarshal(body, &batch); err != nil {
+		http.Error(w, "expected a JSON array of events", http.StatusBadRequest)
+		return
+	}
+
+	received := make([]typesend_events.Received, 0, len(batch))
+	for _, raw := range batch {
+		var event sendGridEvent
+		if err := json.Unmarshal(raw, &event); err != nil {
+			internal.ProtectedWarnLogger(h.Logger, "typesend: skipping malformed SendGrid event: %s", err.Error())
+			continue
+		}
+		if converted, ok := event.received(); ok {
+			received = append(received, converted)
+		}
+	}
+
+	if err := h.Recorder.Record(r.Context(), received); err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to record SendGrid events: %s", err.Error())
+		http.Error(w, "failed to record events", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// fresh reports whether the Unix timestamp is within TimestampTolerance of now.
+func fresh(timestamp string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	return age <= TimestampTolerance && age >= -TimestampTolerance
+}
+
+// HandleFunctionURL serves a Lambda function URL request with the Handler.
+func (h *Handler) HandleFunctionURL(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return function_url.Serve(ctx, h, request)
+}
+
+// sendGridEvent holds the fields of an Event Webhook event that are
+// recorded. Custom args, such as X-TypeSend-Envelope, are top level.
+type sendGridEvent struct {
+	Event     string `json:"event"`
+	EventID   string `json:"sg_event_id"`
+	MessageID string `json:"sg_message_id"`
+	Email     string `json:"email"`
+	Timestamp int64  `json:"timestamp"`
+
+	Reason   string `json:"reason"`
+	Status   string `json:"status"`
+	Response string `json:"response"`
+	// A bounce's classification: "bounce", or "blocked" when
+	// the receiving server refused it for now.
+	Type        string `json:"type"`
+	URL         string `json:"url"`
+	MachineOpen bool   `json:"sg_machine_open"`
+
+	EnvelopeID string `json:"X-TypeSend-Envelope"`
+	AppID      string `json:"X-TypeSend-App"`
+	TenantID   string `json:"X-TypeSend-Tenant"`
+	TemplateID string `json:"X-TypeSend-Template"`
+}
+
+// received converts the event, reporting false for event types
+// that aren't recorded and emails TypeSend didn't send.
+func (e *sendGridEvent) received() (typesend_events.Received, bool) {
+	if e.EnvelopeID == "" || e.EventID == "" {
+		return typesend_events.Received{}, false
+	}
+
+	event := &typesend_schemas.TypeSendEvent{
+		EnvelopeID:        e.EnvelopeID,
+		ID:                e.EventID,
+		AppID:             e.AppID,
+		TenantID:          e.TenantID,
+		TemplateID:        e.TemplateID,
+		Provider:          ProviderName,
+		ProviderMessageID: e.MessageID,
+		OccurredAt:        time.Unix(e.Timestamp, 0).UTC(),
+		Details:           map[string]string{},
+	}
+	received := typesend_events.Received{Event: event, Address: e.Email}
+
+	switch e.Event {
+	case "delivered":
+		event.Type = typesend_schemas.TypeSendEventType_DELIVERED
+		setDetail(event, "response", e.Response)
+	case "bounce":
+		event.Type = typesend_schemas.TypeSendEventType_BOUNCED
+		setDetail(event, "reason", e.Reason)
+		setDetail(event, "status", e.Status)
+		setDetail(event, "type", e.Type)
+		if e.Type != "blocked" {
+			received.Suppress = typesend_schemas.TypeSendSuppressionReason_BOUNCED
+			received.Note = e.Reason
+		}
+	case "dropped":
+		event.Type = typesend_schemas.TypeSendEventType_DROPPED
+		setDetail(event, "reason", e.Reason)
+	case "spamreport":
+		event.Type = typesend_schemas.TypeSendEventType_COMPLAINED
+		received.Suppress = typesend_schemas.TypeSendSuppressionReason_COMPLAINED
+		received.Note = "spam report"
+	case "open":
+		event.Type = typesend_schemas.TypeSendEventType_OPENED
+		if e.MachineOpen {
+			setDetail(event, "machineOpen", "true")
+		}
+	case "click":
+		event.Type = typesend_schemas.TypeSendEventType_CLICKED
+		setDetail(event, "url", e.URL)
+	default:
+		return typesend_events.Received{}, false
+	}
+
+	return received, true
+}
+
+func setDetail(event *typesend_schemas.TypeSendEvent, key string, value string) {
+	if value != "" {
+		event.Details[key] = value
+	}
+}
@@ -0,0 +1,189 @@
+package typesend_events_ses
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	snsTypeNotification             = "Notification"
+	snsTypeSubscriptionConfirmation = "SubscriptionConfirmation"
+	snsTypeUnsubscribeConfirmation  = "UnsubscribeConfirmation"
+)
+
+// Only SNS itself serves signing certificates and subscription URLs.
+var snsHost = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// snsMessage is the body SNS posts to an HTTP(S) subscription.
+type snsMessage struct {
+	Type             string `json:"Type"`
+	MessageID        string `json:"MessageId"`
+	Token            string `json:"Token"`
+	TopicARN         string `json:"TopicArn"`
+	Subject          string `json:"Subject"`
+	Message          string `json:"Message"`
+	Timestamp        string `json:"Timestamp"`
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	SubscribeURL     string `json:"SubscribeURL"`
+}
+
+// stringToSign builds what SNS signs, which differs by message type.
+func (m *snsMessage) stringToSign() (string, error) {
+	var fields [][2]string
+	switch m.Type {
+	case snsTypeNotification:
+		fields = append(fields, [2]string{"Message", m.Message}, [2]string{"MessageId", m.MessageID})
+		if m.Subject != "" {
+			fields = append(fields, [2]string{"Subject", m.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", m.Timestamp}, [2]string{"TopicArn", m.TopicARN}, [2]string{"Type", m.Type})
+	case snsTypeSubscriptionConfirmation, snsTypeUnsubscribeConfirmation:
+		fields = [][2]string{
+			{"Message", m.Message},
+			{"MessageId", m.MessageID},
+			{"SubscribeURL", m.SubscribeURL},
+			{"Timestamp", m.Timestamp},
+			{"Token", m.Token},
+			{"TopicArn", m.TopicARN},
+			{"Type", m.Type},
+		}
+	default:
+		return "", fmt.Errorf("typesend: unknown SNS message type %q", m.Type)
+	}
+
+	var b strings.Builder
+	for _, field := range fields {
+		b.WriteString(field[0])
+		b.WriteString("\n")
+		b.WriteString(field[1])
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// snsURL checks that raw is an HTTPS URL served by SNS.
+func snsURL(raw string) (*url.URL, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid SNS URL: %w", err)
+	}
+	if parsed.Scheme != "https" || !snsHost.MatchString(parsed.Hostname()) {
+		return nil, fmt.Errorf("typesend: %q is not an SNS URL", raw)
+	}
+	return parsed, nil
+}
+
+// snsVerifier checks SNS message signatures, caching
+// the signing certificates it downloads.
+type snsVerifier struct {
+	mu    sync.Mutex
+	certs map[string]*rsa.PublicKey
+}
+
+func (v *snsVerifier) verify(ctx context.Context, client *http.Client, message *snsMessage) error {
+	var hash crypto.Hash
+	switch message.SignatureVersion {
+	case "1":
+		hash = crypto.SHA1
+	case "2":
+		hash = crypto.SHA256
+	default:
+		return fmt.Errorf("typesend: unsupported SNS signature version %q", message.SignatureVersion)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return fmt.Errorf("typesend: invalid SNS signature: %w", err)
+	}
+	signed, err := message.stringToSign()
+	if err != nil {
+		return err
+	}
+	key, err := v.publicKey(ctx, client, message.SigningCertURL)
+	if err != nil {
+		return err
+	}
+
+	var digest []byte
+	if hash == crypto.SHA1 {
+		sum := sha1.Sum([]byte(signed))
+		digest = sum[:]
+	} else {
+		sum := sha256.Sum256([]byte(signed))
+		digest = sum[:]
+	}
+	if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+		return fmt.Errorf("typesend: invalid SNS signature: %w", err)
+	}
+	return nil
+}
+
+func (v *snsVerifier) publicKey(ctx context.Context, client *http.Client, certURL string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.certs[certURL]
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	parsed, err := snsURL(certURL)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(parsed.Path, ".pem") {
+		return nil, fmt.Errorf("typesend: %q is not an SNS signing certificate", certURL)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to fetch SNS signing certificate: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("typesend: failed to fetch SNS signing certificate: status %d", response.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("typesend: failed to fetch SNS signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, fmt.Errorf("typesend: SNS signing certificate is not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid SNS signing certificate: %w", err)
+	}
+	key, ok = cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("typesend: SNS signing certificate is not an RSA key")
+	}
+
+	v.mu.Lock()
+	if v.certs == nil {
+		v.certs = make(map[string]*rsa.PublicKey)
+	}
+	v.certs[certURL] = key
+	v.mu.Unlock()
+	return key, nil
+}
@@ -0,0 +1,401 @@
+package typesend_events_ses_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	typesend_events_ses "github.com/kvizdos/typesend/pkg/typesend_events/ses"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	topic   = "arn:aws:sns:us-east-1:123456789012:typesend"
+	certURL = "https://sns.us-east-1.amazonaws.com/SimpleNotificationService-abc.pem"
+)
+
+// fakeSNS serves the signing certificate, and records visited URLs.
+type fakeSNS struct {
+	mu      sync.Mutex
+	cert    []byte
+	visited []string
+}
+
+func (f *fakeSNS) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	f.visited = append(f.visited, r.URL.String())
+	f.mu.Unlock()
+
+	body := "<ConfirmSubscriptionResponse/>"
+	if r.URL.String() == certURL {
+		body = string(f.cert)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}}, nil
+}
+
+func (f *fakeSNS) visits(url string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for _, visited := range f.visited {
+		if visited == url {
+			count++
+		}
+	}
+	return count
+}
+
+func newHandler(t *testing.T) (*typesend_events_ses.Handler, *typesend_db.TestDatabase, *rsa.PrivateKey, *fakeSNS) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	sns := &fakeSNS{cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+	return &typesend_events_ses.Handler{
+		Recorder:   &typesend_events.Recorder{Database: db},
+		TopicARNs:  []string{topic},
+		HTTPClient: &http.Client{Transport: sns},
+	}, db, key, sns
+}
+
+// sign fills in the message's SignatureVersion 2 signature.
+func sign(t *testing.T, key *rsa.PrivateKey, message map[string]string) {
+	var fields []string
+	if message["Type"] == "Notification" {
+		fields = []string{"Message", "MessageId", "Subject", "Timestamp", "TopicArn", "Type"}
+	} else {
+		fields = []string{"Message", "MessageId", "SubscribeURL", "Timestamp", "Token", "TopicArn", "Type"}
+	}
+	var signed strings.Builder
+	for _, field := range fields {
+		if value, ok := message[field]; ok {
+			signed.WriteString(field + "\n" + value + "\n")
+		}
+	}
+
+	digest := sha256.Sum256([]byte(signed.String()))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	assert.NoError(t, err)
+
+	message["SignatureVersion"] = "2"
+	message["Signature"] = base64.StdEncoding.EncodeToString(signature)
+	message["SigningCertURL"] = certURL
+}
+
+func notification(t *testing.T, key *rsa.PrivateKey, id string, ses string) map[string]string {
+	message := map[string]string{
+		"Type":      "Notification",
+		"MessageId": id,
+		"TopicArn":  topic,
+		"Message":   ses,
+		"Timestamp": "2024-01-01T00:00:00.000Z",
+	}
+	sign(t, key, message)
+	return message
+}
+
+func post(handler http.Handler, message map[string]string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(message)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body))))
+	return w
+}
+
+const mail = `"mail":{"timestamp":"2024-01-01T00:00:00.000Z","messageId":"ses-1","tags":{"typesend-envelope":["envelope"],"typesend-app":["app"],"typesend-tenant":["base"],"typesend-template":["welcome"]}}`
+
+func envelopeEvents(t *testing.T, db *typesend_db.TestDatabase) []*typesend_schemas.TypeSendEvent {
+	events, err := db.GetEnvelopeTimeline(context.Background(), "envelope")
+	assert.NoError(t, err)
+	return events
+}
+
+func suppression(t *testing.T, db *typesend_db.TestDatabase) *typesend_schemas.TypeSendSuppression {
+	suppression, err := db.GetSuppression(context.Background(), "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	return suppression
+}
+
+func TestPermanentBounceSuppresses(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Bounce",` + mail + `,"bounce":{"bounceType":"Permanent","bounceSubType":"General","timestamp":"2024-01-01T00:01:00.000Z","bouncedRecipients":[{"emailAddress":"Test@Example.com","status":"5.1.1","diagnosticCode":"smtp; 550 no such user"}]}}`
+	w := post(handler, notification(t, key, "sns-1", ses))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, &typesend_schemas.TypeSendEvent{
+			EnvelopeID:        "envelope",
+			ID:                "sns-1",
+			AppID:             "app",
+			TenantID:          "base",
+			TemplateID:        "welcome",
+			Type:              typesend_schemas.TypeSendEventType_BOUNCED,
+			Provider:          "SES",
+			ProviderMessageID: "ses-1",
+			OccurredAt:        time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC),
+			Details: map[string]string{
+				"type":    "Permanent",
+				"subType": "General",
+				"status":  "5.1.1",
+				"reason":  "smtp; 550 no such user",
+			},
+		}, events[0])
+	}
+	if s := suppression(t, db); assert.NotNil(t, s) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, s.Reason)
+		assert.Equal(t, "smtp; 550 no such user", s.Note)
+	}
+
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+	assert.Len(t, envelopeEvents(t, db), 1, "SNS retries must not duplicate events")
+}
+
+func TestTransientBounceDoesNotSuppress(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Bounce",` + mail + `,"bounce":{"bounceType":"Transient","bounceSubType":"MailboxFull","bouncedRecipients":[{"emailAddress":"test@example.com"}]}}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), events[0].OccurredAt, "defaults to when the mail was sent")
+	}
+	assert.Nil(t, suppression(t, db))
+}
+
+func TestComplaintSuppresses(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	// As sent by configuration set event publishing.
+	ses := `{"eventType":"Complaint",` + mail + `,"complaint":{"complaintFeedbackType":"abuse","timestamp":"2024-01-01T00:01:00.000Z","complainedRecipients":[{"emailAddress":"test@example.com"}]}}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_COMPLAINED, events[0].Type)
+	}
+	if s := suppression(t, db); assert.NotNil(t, s) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, s.Reason)
+	}
+}
+
+func TestDeliveryFromHeaders(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Delivery","mail":{"timestamp":"2024-01-01T00:00:00.000Z","messageId":"ses-1","headers":[{"name":"x-typesend-envelope","value":"envelope"},{"name":"X-TypeSend-App","value":"app"},{"name":"X-TypeSend-Tenant","value":"base"},{"name":"X-TypeSend-Template","value":"welcome"}]},"delivery":{"timestamp":"2024-01-01T00:00:05.000Z","recipients":["test@example.com"],"smtpResponse":"250 ok"}}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_DELIVERED, events[0].Type)
+		assert.Equal(t, "app", events[0].AppID)
+		assert.Equal(t, "welcome", events[0].TemplateID)
+		assert.Equal(t, map[string]string{"response": "250 ok"}, events[0].Details)
+	}
+	assert.Nil(t, suppression(t, db))
+}
+
+// An SES bounce notification as documented, without TypeSend's tags
+// or headers.
+const untaggedBounce = `{
+	"notificationType": "Bounce",
+	"bounce": {
+		"bounceType": "Permanent",
+		"reportingMTA": "dns; email.example.com",
+		"bouncedRecipients": [{
+			"emailAddress": "test@example.com",
+			"status": "5.1.1",
+			"action": "failed",
+			"diagnosticCode": "smtp; 550 5.1.1 <test@example.com>... User"
+		}],
+		"bounceSubType": "General",
+		"timestamp": "2016-01-27T14:59:38.237Z",
+		"feedbackId": "00000138111222aa-33322211-cccc-cccc-cccc-ddddaaaa068a-000000",
+		"remoteMtaIp": "127.0.2.0"
+	},
+	"mail": {
+		"timestamp": "2016-01-27T14:59:38.237Z",
+		"source": "john@example.com",
+		"sourceArn": "arn:aws:ses:us-east-1:888888888888:identity/example.com",
+		"sourceIp": "127.0.3.0",
+		"sendingAccountId": "123456789012",
+		"callerIdentity": "IAM_user_or_role_name",
+		"messageId": "00000138111222aa-33322211-cccc-cccc-cccc-ddddaaaa0680-000000",
+		"destination": ["test@example.com"],
+		"headersTruncated": false,
+		"headers": [
+			{"name": "From", "value": "\"John Doe\" <john@example.com>"},
+			{"name": "To", "value": "<test@example.com>"},
+			{"name": "Message-ID", "value": "custom-message-ID"},
+			{"name": "Subject", "value": "Hello"},
+			{"name": "Content-Type", "value": "text/plain; charset=\"UTF-8\""},
+			{"name": "Date", "value": "Wed, 27 Jan 2016 14:05:45 +0000"}
+		],
+		"commonHeaders": {
+			"from": ["John Doe <john@example.com>"],
+			"date": "Wed, 27 Jan 2016 14:05:45 +0000",
+			"to": ["<test@example.com>"],
+			"messageId": "custom-message-ID",
+			"subject": "Hello"
+		}
+	}
+}`
+
+func TestUntaggedByMessageID(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	// As recorded by DeliverMessage when SES accepted the email.
+	assert.NoError(t, db.AppendEvents(context.Background(), []*typesend_schemas.TypeSendEvent{{
+		EnvelopeID:        "envelope",
+		ID:                "sent",
+		AppID:             "app",
+		TenantID:          "base",
+		TemplateID:        "welcome",
+		Type:              typesend_schemas.TypeSendEventType_SENT,
+		Provider:          "SES",
+		ProviderMessageID: "00000138111222aa-33322211-cccc-cccc-cccc-ddddaaaa0680-000000",
+		OccurredAt:        time.Date(2016, 1, 27, 14, 59, 38, 0, time.UTC),
+	}}))
+
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", untaggedBounce)).Code)
+
+	events := envelopeEvents(t, db)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_BOUNCED, events[1].Type)
+		assert.Equal(t, "sns-1", events[1].ID)
+		assert.Equal(t, "app", events[1].AppID)
+		assert.Equal(t, "base", events[1].TenantID)
+		assert.Equal(t, "welcome", events[1].TemplateID)
+		assert.Equal(t, "00000138111222aa-33322211-cccc-cccc-cccc-ddddaaaa0680-000000", events[1].ProviderMessageID)
+	}
+	if s := suppression(t, db); assert.NotNil(t, s) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, s.Reason)
+	}
+}
+
+func TestSkipsOtherMail(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Delivery","mail":{"messageId":"ses-1"},"delivery":{"recipients":["test@example.com"]}}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+
+	ses = `{"eventType":"Send",` + mail + `}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-2", ses)).Code)
+
+	// Nor is an untagged email another provider sent.
+	assert.NoError(t, db.AppendEvents(context.Background(), []*typesend_schemas.TypeSendEvent{{
+		EnvelopeID:        "envelope",
+		ID:                "sent",
+		Type:              typesend_schemas.TypeSendEventType_SENT,
+		Provider:          "SendGrid",
+		ProviderMessageID: "00000138111222aa-33322211-cccc-cccc-cccc-ddddaaaa0680-000000",
+	}}))
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-3", untaggedBounce)).Code)
+
+	assert.Len(t, envelopeEvents(t, db), 1)
+	assert.Nil(t, suppression(t, db))
+}
+
+func TestRejectsBadSignature(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Delivery",` + mail + `,"delivery":{"recipients":["test@example.com"]}}`
+	message := notification(t, key, "sns-1", ses)
+	message["Message"] = strings.Replace(ses, "Delivery", "Bounce", 1)
+	assert.Equal(t, http.StatusUnauthorized, post(handler, message).Code)
+
+	message = notification(t, key, "sns-1", ses)
+	message["SigningCertURL"] = "https://attacker.example.com/cert.pem"
+	assert.Equal(t, http.StatusUnauthorized, post(handler, message).Code, "certificates only come from SNS")
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, post(handler, notification(t, other, "sns-1", ses)).Code)
+
+	assert.Empty(t, envelopeEvents(t, db))
+}
+
+func TestRejectsUnexpectedTopic(t *testing.T) {
+	handler, db, key, _ := newHandler(t)
+
+	ses := `{"notificationType":"Delivery",` + mail + `,"delivery":{"recipients":["test@example.com"]}}`
+	message := map[string]string{
+		"Type":      "Notification",
+		"MessageId": "sns-1",
+		"TopicArn":  "arn:aws:sns:us-east-1:999999999999:someone-else",
+		"Message":   ses,
+		"Timestamp": "2024-01-01T00:00:00.000Z",
+	}
+	sign(t, key, message)
+	assert.Equal(t, http.StatusForbidden, post(handler, message).Code)
+	assert.Empty(t, envelopeEvents(t, db))
+}
+
+func TestSubscriptionConfirmation(t *testing.T) {
+	handler, _, key, sns := newHandler(t)
+
+	subscribeURL := "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=" + topic + "&Token=token"
+	message := map[string]string{
+		"Type":         "SubscriptionConfirmation",
+		"MessageId":    "sns-1",
+		"Token":        "token",
+		"TopicArn":     topic,
+		"Message":      "You have chosen to subscribe to the topic.",
+		"SubscribeURL": subscribeURL,
+		"Timestamp":    "2024-01-01T00:00:00.000Z",
+	}
+	sign(t, key, message)
+	assert.Equal(t, http.StatusNoContent, post(handler, message).Code)
+	assert.Equal(t, 1, sns.visits(subscribeURL))
+
+	message["SubscribeURL"] = "https://attacker.example.com/"
+	sign(t, key, message)
+	assert.Equal(t, http.StatusInternalServerError, post(handler, message).Code)
+	assert.Equal(t, 0, sns.visits("https://attacker.example.com/"))
+}
+
+func TestCachesCertificate(t *testing.T) {
+	handler, _, key, sns := newHandler(t)
+
+	ses := `{"eventType":"Send",` + mail + `}`
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-1", ses)).Code)
+	assert.Equal(t, http.StatusNoContent, post(handler, notification(t, key, "sns-2", ses)).Code)
+	assert.Equal(t, 1, sns.visits(certURL))
+}
+
+func TestRejectsGet(t *testing.T) {
+	handler, _, _, _ := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
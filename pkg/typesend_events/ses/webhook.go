@@ -0,0 +1,323 @@
+package typesend_events_ses
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/internal/function_url"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// ProviderName is the Provider of every event the Handler records.
+const ProviderName = "SES"
+
+// SNS messages are at most 256KB. The rest leaves room for escaping
+// the message into the JSON SNS wraps it in.
+const MaxBodySize = 256<<10 + 64<<10
+
+// The SES message tags, or failing that the headers, that tie an
+// email back to its envelope. SES only includes the original
+// headers in notifications when the identity is set to, so emails
+// with neither are found by the message ID of their SENT event.
+const (
+	EnvelopeTag = "typesend-envelope"
+	AppTag      = "typesend-app"
+	TenantTag   = "typesend-tenant"
+	TemplateTag = "typesend-template"
+
+	EnvelopeHeader = "X-TypeSend-Envelope"
+	AppHeader      = "X-TypeSend-App"
+	TenantHeader   = "X-TypeSend-Tenant"
+	TemplateHeader = "X-TypeSend-Template"
+)
+
+// Handler receives SES notifications delivered by an SNS HTTPS
+// subscription. It verifies each message's SNS signature, confirms
+// the subscription, and records Bounce, Complaint and Delivery
+// notifications, suppressing recipients on a permanent bounce or
+// a complaint.
+//
+// Both SES feedback notifications and configuration set event
+// publishing are understood.
+type Handler struct {
+	Recorder *typesend_events.Recorder
+	// The SNS topics allowed to post. Required, as anyone
+	// can subscribe the handler to a topic of their own.
+	TopicARNs []string
+
+	// Optional; fetches signing certificates and confirms
+	// subscriptions. Defaults to a client with a short timeout.
+	HTTPClient *http.Client
+	// Optional
+	Logger typesend_schemas.Logger
+
+	verifier snsVerifier
+}
+
+func (h *Handler) client() *http.Client {
+	if h.HTTPClient != nil {
+		return h.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodySize))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var message snsMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		http.Error(w, "expected an SNS message", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verifier.verify(r.Context(), h.client(), &message); err != nil {
+		internal.ProtectedWarnLogger(h.Logger, "typesend: rejecting SNS message: %s", err.Error())
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	if !slices.Contains(h.TopicARNs, message.TopicARN) {
+		internal.ProtectedWarnLogger(h.Logger, "typesend: rejecting SNS message from unexpected topic %s", message.TopicARN)
+		http.Error(w, "unexpected topic", http.StatusForbidden)
+		return
+	}
+
+	switch message.Type {
+	case snsTypeSubscriptionConfirmation:
+		if err := h.confirm(r.Context(), &message); err != nil {
+			internal.ProtectedErrorLogger(h.Logger, "typesend: failed to confirm SNS subscription to %s: %s", message.TopicARN, err.Error())
+			http.Error(w, "failed to confirm subscription", http.StatusInternalServerError)
+			return
+		}
+		internal.ProtectedInfoLogger(h.Logger, "typesend: confirmed SNS subscription to %s", message.TopicARN)
+	case snsTypeUnsubscribeConfirmation:
+		internal.ProtectedWarnLogger(h.Logger, "typesend: unsubscribed from SNS topic %s", message.TopicARN)
+	case snsTypeNotification:
+		var notification sesNotification
+		if err := json.Unmarshal([]byte(message.Message), &notification); err != nil {
+			internal.ProtectedWarnLogger(h.Logger, "typesend: skipping malformed SES notification %s: %s", message.MessageID, err.Error())
+			break
+		}
+		origin, err := h.origin(r.Context(), &notification)
+		if err != nil {
+			internal.ProtectedErrorLogger(h.Logger, "typesend: failed to find the envelope of SES notification %s: %s", message.MessageID, err.Error())
+			http.Error(w, "failed to find envelope", http.StatusInternalServerError)
+			return
+		}
+		if err := h.Recorder.Record(r.Context(), notification.received(origin, message.MessageID)); err != nil {
+			internal.ProtectedErrorLogger(h.Logger, "typesend: failed to record SES notification %s: %s", message.MessageID, err.Error())
+			http.Error(w, "failed to record events", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleFunctionURL serves a Lambda function URL request with the Handler.
+func (h *Handler) HandleFunctionURL(ctx context.Context, request events.LambdaFunctionURLRequest) (events.LambdaFunctionURLResponse, error) {
+	return function_url.Serve(ctx, h, request)
+}
+
+// confirm visits the SubscribeURL, as SNS asks.
+func (h *Handler) confirm(ctx context.Context, message *snsMessage) error {
+	subscribeURL, err := snsURL(message.SubscribeURL)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, subscribeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("typesend: SNS subscription confirmation returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// sesNotification holds the fields of an SES notification that are
+// recorded. Feedback notifications name their type in
+// notificationType, and event publishing in eventType.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	EventType        string `json:"eventType"`
+
+	Mail struct {
+		Timestamp time.Time `json:"timestamp"`
+		MessageID string    `json:"messageId"`
+		Headers   []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Tags map[string][]string `json:"tags"`
+	} `json:"mail"`
+
+	Bounce *struct {
+		// "Permanent", "Transient" or "Undetermined"
+		BounceType        string      `json:"bounceType"`
+		BounceSubType     string      `json:"bounceSubType"`
+		BouncedRecipients []recipient `json:"bouncedRecipients"`
+		Timestamp         time.Time   `json:"timestamp"`
+	} `json:"bounce"`
+	Complaint *struct {
+		ComplainedRecipients []recipient `json:"complainedRecipients"`
+		// e.g. "abuse", or "not-spam"
+		ComplaintFeedbackType string    `json:"complaintFeedbackType"`
+		Timestamp             time.Time `json:"timestamp"`
+	} `json:"complaint"`
+	Delivery *struct {
+		Recipients   []string  `json:"recipients"`
+		SMTPResponse string    `json:"smtpResponse"`
+		Timestamp    time.Time `json:"timestamp"`
+	} `json:"delivery"`
+}
+
+type recipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Status         string `json:"status"`
+	DiagnosticCode string `json:"diagnosticCode"`
+}
+
+// tagged returns the message tag, falling back to the header.
+func (n *sesNotification) tagged(tag string, header string) string {
+	if values := n.Mail.Tags[tag]; len(values) > 0 {
+		return values[0]
+	}
+	for _, h := range n.Mail.Headers {
+		if strings.EqualFold(h.Name, header) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// origin returns an event holding the envelope, App, Tenant and
+// Template the notifications email was sent for, or nil when
+// TypeSend didn't send it.
+func (h *Handler) origin(ctx context.Context, n *sesNotification) (*typesend_schemas.TypeSendEvent, error) {
+	if envelopeID := n.tagged(EnvelopeTag, EnvelopeHeader); envelopeID != "" {
+		return &typesend_schemas.TypeSendEvent{
+			EnvelopeID: envelopeID,
+			AppID:      n.tagged(AppTag, AppHeader),
+			TenantID:   n.tagged(TenantTag, TenantHeader),
+			TemplateID: n.tagged(TemplateTag, TemplateHeader),
+		}, nil
+	}
+	return h.Recorder.Database.GetEventByProviderMessageID(ctx, ProviderName, n.Mail.MessageID)
+}
+
+// received converts the notification, with an event per recipient,
+// onto the origins envelope. It returns nothing for types that
+// aren't recorded and emails TypeSend didn't send.
+func (n *sesNotification) received(origin *typesend_schemas.TypeSendEvent, snsMessageID string) []typesend_events.Received {
+	if origin == nil {
+		return nil
+	}
+
+	kind := n.NotificationType
+	if kind == "" {
+		kind = n.EventType
+	}
+
+	var received []typesend_events.Received
+	add := func(eventType typesend_schemas.TypeSendEventType, occurredAt time.Time, address string, details map[string]string) *typesend_events.Received {
+		if occurredAt.IsZero() {
+			occurredAt = n.Mail.Timestamp
+		}
+		// The SNS message ID is kept across retries.
+		id := snsMessageID
+		if len(received) > 0 {
+			id += "#" + strconv.Itoa(len(received))
+		}
+		for key, value := range details {
+			if value == "" {
+				delete(details, key)
+			}
+		}
+		received = append(received, typesend_events.Received{
+			Event: &typesend_schemas.TypeSendEvent{
+				EnvelopeID:        origin.EnvelopeID,
+				ID:                id,
+				AppID:             origin.AppID,
+				TenantID:          origin.TenantID,
+				TemplateID:        origin.TemplateID,
+				Type:              eventType,
+				Provider:          ProviderName,
+				ProviderMessageID: n.Mail.MessageID,
+				OccurredAt:        occurredAt.UTC(),
+				Details:           details,
+			},
+			Address: address,
+		})
+		return &received[len(received)-1]
+	}
+
+	switch kind {
+	case "Bounce":
+		if n.Bounce == nil {
+			return nil
+		}
+		for _, r := range n.Bounce.BouncedRecipients {
+			event := add(typesend_schemas.TypeSendEventType_BOUNCED, n.Bounce.Timestamp, r.EmailAddress, map[string]string{
+				"type":    n.Bounce.BounceType,
+				"subType": n.Bounce.BounceSubType,
+				"status":  r.Status,
+				"reason":  r.DiagnosticCode,
+			})
+			// Transient bounces, such as a full mailbox, may clear up.
+			if n.Bounce.BounceType == "Permanent" {
+				event.Suppress = typesend_schemas.TypeSendSuppressionReason_BOUNCED
+				event.Note = r.DiagnosticCode
+			}
+		}
+	case "Complaint":
+		if n.Complaint == nil {
+			return nil
+		}
+		for _, r := range n.Complaint.ComplainedRecipients {
+			event := add(typesend_schemas.TypeSendEventType_COMPLAINED, n.Complaint.Timestamp, r.EmailAddress, map[string]string{
+				"feedbackType": n.Complaint.ComplaintFeedbackType,
+			})
+			if n.Complaint.ComplaintFeedbackType != "not-spam" {
+				event.Suppress = typesend_schemas.TypeSendSuppressionReason_COMPLAINED
+				event.Note = "complaint"
+			}
+		}
+	case "Delivery":
+		if n.Delivery == nil {
+			return nil
+		}
+		for _, address := range n.Delivery.Recipients {
+			add(typesend_schemas.TypeSendEventType_DELIVERED, n.Delivery.Timestamp, address, map[string]string{
+				"response": n.Delivery.SMTPResponse,
+			})
+		}
+	}
+
+	return received
+}
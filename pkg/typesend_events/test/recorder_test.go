@@ -0,0 +1,113 @@
+package typesend_events_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRecorder(t *testing.T) (*typesend_events.Recorder, *typesend_db.TestDatabase) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	return &typesend_events.Recorder{Database: db}, db
+}
+
+func received(id string, eventType typesend_schemas.TypeSendEventType, suppress typesend_schemas.TypeSendSuppressionReason) typesend_events.Received {
+	return typesend_events.Received{
+		Event: &typesend_schemas.TypeSendEvent{
+			EnvelopeID: "envelope",
+			ID:         id,
+			AppID:      "app",
+			TenantID:   "base",
+			Type:       eventType,
+			Provider:   "Tester",
+			OccurredAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+		Address:  "Test@Example.com",
+		Suppress: suppress,
+		Note:     "note",
+	}
+}
+
+func TestRecordAppendsEvents(t *testing.T) {
+	recorder, db := newRecorder(t)
+	ctx := context.Background()
+
+	delivered := received("1", typesend_schemas.TypeSendEventType_DELIVERED, 0)
+	assert.NoError(t, recorder.Record(ctx, []typesend_events.Received{delivered}))
+	assert.NoError(t, recorder.Record(ctx, []typesend_events.Received{delivered}), "retries must be harmless")
+
+	events, err := db.GetEnvelopeTimeline(ctx, "envelope")
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	suppression, err := db.GetSuppression(ctx, "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, suppression)
+}
+
+func TestRecordSuppresses(t *testing.T) {
+	recorder, db := newRecorder(t)
+	ctx := context.Background()
+
+	err := recorder.Record(ctx, []typesend_events.Received{
+		received("1", typesend_schemas.TypeSendEventType_BOUNCED, typesend_schemas.TypeSendSuppressionReason_BOUNCED),
+	})
+	assert.NoError(t, err)
+
+	suppression, err := db.GetSuppression(ctx, "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, suppression) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_BOUNCED, suppression.Reason)
+		assert.Equal(t, "note", suppression.Note)
+	}
+}
+
+func TestRecordReplacesOnlyUnsubscribes(t *testing.T) {
+	recorder, db := newRecorder(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+		AppID: "app", TenantID: "base", Address: "test@example.com",
+		Reason: typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED,
+	}))
+
+	assert.NoError(t, recorder.Record(ctx, []typesend_events.Received{
+		received("1", typesend_schemas.TypeSendEventType_COMPLAINED, typesend_schemas.TypeSendSuppressionReason_COMPLAINED),
+	}))
+	suppression, err := db.GetSuppression(ctx, "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, suppression.Reason)
+
+	assert.NoError(t, recorder.Record(ctx, []typesend_events.Received{
+		received("2", typesend_schemas.TypeSendEventType_BOUNCED, typesend_schemas.TypeSendSuppressionReason_BOUNCED),
+	}))
+	suppression, err = db.GetSuppression(ctx, "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, suppression.Reason, "an earlier complaint is kept")
+}
+
+func TestRecordSkipsSuppressionWithoutRecipient(t *testing.T) {
+	recorder, db := newRecorder(t)
+	ctx := context.Background()
+
+	bounce := received("1", typesend_schemas.TypeSendEventType_BOUNCED, typesend_schemas.TypeSendSuppressionReason_BOUNCED)
+	bounce.Event.TenantID = ""
+	assert.NoError(t, recorder.Record(ctx, []typesend_events.Received{bounce}))
+
+	events, err := db.GetEnvelopeTimeline(ctx, "envelope")
+	assert.NoError(t, err)
+	assert.Len(t, events, 1, "the event is still recorded")
+}
+
+func TestRecordRejectsInvalidEvents(t *testing.T) {
+	recorder, _ := newRecorder(t)
+
+	invalid := received("", typesend_schemas.TypeSendEventType_DELIVERED, 0)
+	assert.Error(t, recorder.Record(context.Background(), []typesend_events.Received{invalid}))
+}
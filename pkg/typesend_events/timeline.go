@@ -0,0 +1,38 @@
+package typesend_events
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// NewEvent returns an event TypeSend itself observed about the
+// envelope, such as it being dispatched. Details is optional.
+func NewEvent(envelope *typesend_schemas.TypeSendEnvelope, eventType typesend_schemas.TypeSendEventType, provider string, details map[string]string) *typesend_schemas.TypeSendEvent {
+	return &typesend_schemas.TypeSendEvent{
+		EnvelopeID: envelope.ID,
+		ID:         uuid.NewString(),
+		AppID:      envelope.AppID,
+		TenantID:   envelope.TenantID,
+		TemplateID: envelope.TemplateID,
+		Type:       eventType,
+		Provider:   provider,
+		OccurredAt: time.Now().UTC(),
+		Details:    details,
+	}
+}
+
+// Append adds the events to their envelopes timelines. Failures are
+// only logged, as the timeline must never hold up sending.
+func Append(ctx context.Context, db typesend_db.TypeSendDatabase, logger typesend_schemas.Logger, events ...*typesend_schemas.TypeSendEvent) {
+	if len(events) == 0 {
+		return
+	}
+	if err := db.AppendEvents(ctx, events); err != nil {
+		internal.ProtectedWarnLogger(logger, "typesend: failed to append %d events to envelope timelines: %s", len(events), err.Error())
+	}
+}
@@ -22,7 +22,19 @@ import (
 	"github.com/kvizdos/typesend/pkg/typesend_schemas"
 )
 
+// StartTypeSendLive runs TypeSend in process on an in-memory database,
+// so everything is lost when the process exits.
 func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appID string) (*typesend.TypeSend, *typesend_db.TestDatabase) {
+	db := &typesend_db.TestDatabase{}
+	db.Connect(nil)
+
+	return StartTypeSendLiveWithDatabase(ctx, logger, appID, db), db
+}
+
+// StartTypeSendLiveWithDatabase runs TypeSend in process on an already
+// connected database, such as a BoltTypeSendDB that survives restarts.
+// Envelopes already due in it are dispatched straight away.
+func StartTypeSendLiveWithDatabase(ctx context.Context, logger typesend_schemas.Logger, appID string, db typesend_db.LiveModeDatabase) *typesend.TypeSend {
 	// Demo Sendgrid
 	sgKey := os.Getenv("TYPESEND_SENDGRID_KEY")
 	var provider providers.TypeSendProvider
@@ -38,11 +50,10 @@ func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appI
 
 	provider.SetMetricProvider(loggingMetrics)
 
-	msgsChan := make(chan *typesend_schemas.TypeSendEnvelope)
-	db := &typesend_db.TestDatabase{
-		LiveModeChan: msgsChan,
-	}
-	db.Connect(nil)
+	// Buffered so an insert made while a dispatch is running
+	// still queues up another dispatch afterwards.
+	msgsChan := make(chan *typesend_schemas.TypeSendEnvelope, 1)
+	db.SetLiveModeChan(msgsChan)
 
 	dispatchedChan := make(chan *typesend_schemas.TypeSendEnvelope)
 	dispatcher := &typequeue_mocks.MockDispatcher[*typesend_schemas.TypeSendEnvelope]{
@@ -59,6 +70,7 @@ func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appI
 			Dispatcher:      dispatcher,
 			DB:              db,
 			ContextDeadline: time.Now().UTC().AddDate(1, 0, 0),
+			Metrics:         loggingMetrics,
 		},
 	}
 
@@ -84,8 +96,10 @@ func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appI
 					return
 				}
 				err := dispatchLambda.HandleRequest(context.Background())
-				if err != nil {
+				if err != nil && e != nil {
 					logger.Errorf("Failed to handle dispatchLambda request: %s -- %+v", err.Error(), *e)
+				} else if err != nil {
+					logger.Errorf("Failed to handle dispatchLambda request: %s", err.Error())
 				}
 			}
 		}
@@ -100,9 +114,10 @@ func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appI
 				return
 			case e := <-dispatchedChan:
 				err := consume_messages.DeliverMessage(&consume_messages.DeliverMessageOptions{
-					Logger:   logger,
-					Database: db,
-					Provider: provider,
+					Logger:      logger,
+					Database:    db,
+					Provider:    provider,
+					KeyProvider: ts.KeyProvider,
 				}, e)
 				if err != nil {
 					logger.Errorf("Failed to handle consumeLambda request: %s -- %+v", err.Error(), *e)
@@ -111,7 +126,13 @@ func StartTypeSendLive(ctx context.Context, logger typesend_schemas.Logger, appI
 		}
 	}()
 
-	return ts, db
+	// Picks up anything left from a previous run.
+	select {
+	case msgsChan <- nil:
+	default:
+	}
+
+	return ts
 }
 
 func envelopeToSQSMessage(envelope *typesend_schemas.TypeSendEnvelope) events.SQSMessage {
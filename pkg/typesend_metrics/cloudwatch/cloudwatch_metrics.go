@@ -51,7 +51,7 @@ func (p *CloudWatchProvider) SendEvent(metric *typesend_metrics.Metric) error {
 						Value: aws.String(metric.TenantID),
 					},
 				},
-				Value: aws.Float64(1.0),
+				Value: aws.Float64(float64(metric.Total())),
 				Unit:  aws.String("Count"),
 			},
 		},
@@ -63,11 +63,6 @@ func (p *CloudWatchProvider) SendEvent(metric *typesend_metrics.Metric) error {
 }
 
 func (p *CloudWatchProvider) DeliverEvent(metric *typesend_metrics.Metric) error {
-	status := "Failure"
-	if metric.Success {
-		status = "Success"
-	}
-
 	input := &cloudwatch.PutMetricDataInput{
 		Namespace: aws.String(p.namespace),
 		MetricData: []*cloudwatch.MetricDatum{
@@ -88,10 +83,10 @@ func (p *CloudWatchProvider) DeliverEvent(metric *typesend_metrics.Metric) error
 					},
 					{
 						Name:  aws.String("Status"),
-						Value: aws.String(status),
+						Value: aws.String(metric.Status()),
 					},
 				},
-				Value: aws.Float64(1.0),
+				Value: aws.Float64(float64(metric.Total())),
 				Unit:  aws.String("Count"),
 			},
 		},
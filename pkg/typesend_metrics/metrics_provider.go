@@ -1,13 +1,64 @@
 package typesend_metrics
 
+import "time"
+
 type Metric struct {
 	AppName    string
 	TemplateID string
 	TenantID   string
 	Success    bool
+	// Number of events this metric represents.
+	// Zero is treated as one.
+	Count int
+	// Optional; the provider delivering, e.g. "SendGrid".
+	// Empty for sends, which TypeSend handles itself.
+	Provider string
+	// Optional; how long the provider took to accept
+	// a delivery. Zero when it wasn't measured.
+	Latency time.Duration
+}
+
+// Total returns the number of events this metric represents.
+func (m *Metric) Total() int {
+	if m.Count <= 0 {
+		return 1
+	}
+	return m.Count
+}
+
+// Status returns "Success" or "Failure".
+func (m *Metric) Status() string {
+	if m.Success {
+		return "Success"
+	}
+	return "Failure"
 }
 
 type MetricsProvider interface {
 	SendEvent(metric *Metric) error
 	DeliverEvent(metric *Metric) error
 }
+
+// DispatchMetric summarises a single dispatcher run.
+type DispatchMetric struct {
+	// Envelopes queued for delivery.
+	Dispatched int
+	// Envelopes that failed to queue.
+	Failed int
+	// Envelopes queued but not marked as such.
+	FailedUpdates int
+	// Envelopes left for a later run by a rate limit.
+	RateLimited int
+	// Envelopes gathered into digests.
+	Digested int
+	// Envelopes deferred until after quiet hours.
+	QuietHours int
+	// How long the run took.
+	Duration time.Duration
+}
+
+// DispatchMetricsProvider is optionally implemented alongside
+// MetricsProvider, to report on each dispatcher run.
+type DispatchMetricsProvider interface {
+	DispatchEvent(metric *DispatchMetric) error
+}
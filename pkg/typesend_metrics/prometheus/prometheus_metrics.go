@@ -0,0 +1,113 @@
+package typesend_metrics_prometheus
+
+import (
+	"net/http"
+
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// PrometheusProvider implements the MetricsProvider and
+// DispatchMetricsProvider interfaces with Prometheus collectors.
+// Serve Handler at /metrics for Prometheus to scrape.
+type PrometheusProvider struct {
+	registry *prometheus.Registry
+
+	sends           *prometheus.CounterVec
+	deliveries      *prometheus.CounterVec
+	deliveryLatency *prometheus.HistogramVec
+
+	dispatched         *prometheus.GaugeVec
+	dispatchDuration   prometheus.Gauge
+	dispatchFinishedAt prometheus.Gauge
+}
+
+// Labels on the send and delivery counters.
+var eventLabels = []string{"app", "template", "tenant", "status", "provider"}
+
+// NewPrometheusProvider creates a new instance of PrometheusProvider,
+// naming every metric "<namespace>_...". Its collectors are registered
+// with registry, or with a registry of its own when that is nil.
+func NewPrometheusProvider(namespace string, registry *prometheus.Registry) (*PrometheusProvider, error) {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+
+	p := &PrometheusProvider{
+		registry: registry,
+		sends: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sends_total",
+			Help:      "Envelopes handed to TypeSend to send.",
+		}, eventLabels),
+		deliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "deliveries_total",
+			Help:      "Envelopes handed to a provider to deliver.",
+		}, eventLabels),
+		deliveryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "delivery_latency_seconds",
+			Help:      "How long providers took to accept a delivery.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"status", "provider"}),
+		dispatched: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dispatcher_last_run_envelopes",
+			Help:      "Envelopes the last dispatcher run handled, by what happened to them.",
+		}, []string{"result"}),
+		dispatchDuration: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dispatcher_last_run_duration_seconds",
+			Help:      "How long the last dispatcher run took.",
+		}),
+		dispatchFinishedAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "dispatcher_last_run_timestamp_seconds",
+			Help:      "When the last dispatcher run finished, in Unix seconds.",
+		}),
+	}
+
+	collectors := []prometheus.Collector{p.sends, p.deliveries, p.deliveryLatency, p.dispatched, p.dispatchDuration, p.dispatchFinishedAt}
+	for _, collector := range collectors {
+		if err := registry.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (p *PrometheusProvider) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{Registry: p.registry})
+}
+
+func (p *PrometheusProvider) SendEvent(metric *typesend_metrics.Metric) error {
+	p.sends.WithLabelValues(labelValues(metric)...).Add(float64(metric.Total()))
+	return nil
+}
+
+func (p *PrometheusProvider) DeliverEvent(metric *typesend_metrics.Metric) error {
+	p.deliveries.WithLabelValues(labelValues(metric)...).Add(float64(metric.Total()))
+	if metric.Latency > 0 {
+		p.deliveryLatency.WithLabelValues(metric.Status(), metric.Provider).Observe(metric.Latency.Seconds())
+	}
+	return nil
+}
+
+func (p *PrometheusProvider) DispatchEvent(metric *typesend_metrics.DispatchMetric) error {
+	p.dispatched.WithLabelValues("dispatched").Set(float64(metric.Dispatched))
+	p.dispatched.WithLabelValues("failed").Set(float64(metric.Failed))
+	p.dispatched.WithLabelValues("failed_update").Set(float64(metric.FailedUpdates))
+	p.dispatched.WithLabelValues("rate_limited").Set(float64(metric.RateLimited))
+	p.dispatched.WithLabelValues("digested").Set(float64(metric.Digested))
+	p.dispatched.WithLabelValues("quiet_hours").Set(float64(metric.QuietHours))
+	p.dispatchDuration.Set(metric.Duration.Seconds())
+	p.dispatchFinishedAt.SetToCurrentTime()
+	return nil
+}
+
+func labelValues(metric *typesend_metrics.Metric) []string {
+	return []string{metric.AppName, metric.TemplateID, metric.TenantID, metric.Status(), metric.Provider}
+}
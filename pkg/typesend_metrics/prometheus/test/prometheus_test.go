@@ -0,0 +1,136 @@
+package typesend_metrics_prometheus_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_metrics"
+	typesend_metrics_prometheus "github.com/kvizdos/typesend/pkg/typesend_metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+)
+
+func newProvider(t *testing.T) (*typesend_metrics_prometheus.PrometheusProvider, *httptest.Server) {
+	provider, err := typesend_metrics_prometheus.NewPrometheusProvider("typesend", nil)
+	assert.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", provider.Handler())
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return provider, server
+}
+
+// scrape fetches /metrics as Prometheus would.
+func scrape(t *testing.T, server *httptest.Server) map[string]*dto.MetricFamily {
+	response, err := http.Get(server.URL + "/metrics")
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(response.Body)
+	assert.NoError(t, err)
+	return families
+}
+
+// find returns the metric in the family with exactly the labels.
+func find(families map[string]*dto.MetricFamily, name string, labels map[string]string) *dto.Metric {
+	family, ok := families[name]
+	if !ok {
+		return nil
+	}
+	for _, metric := range family.GetMetric() {
+		found := make(map[string]string)
+		for _, label := range metric.GetLabel() {
+			found[label.GetName()] = label.GetValue()
+		}
+		if len(found) == len(labels) {
+			matches := true
+			for name, value := range labels {
+				if found[name] != value {
+					matches = false
+				}
+			}
+			if matches {
+				return metric
+			}
+		}
+	}
+	return nil
+}
+
+func TestPrometheusProviderCountsSendsAndDeliveries(t *testing.T) {
+	provider, server := newProvider(t)
+
+	assert.NoError(t, provider.SendEvent(&typesend_metrics.Metric{AppName: "app", TemplateID: "welcome", TenantID: "tenant", Success: true}))
+	assert.NoError(t, provider.SendEvent(&typesend_metrics.Metric{AppName: "app", TemplateID: "welcome", TenantID: "tenant", Success: true, Count: 3}))
+	assert.NoError(t, provider.DeliverEvent(&typesend_metrics.Metric{AppName: "app", TemplateID: "welcome", TenantID: "tenant", Success: true, Provider: "SendGrid", Latency: 200 * time.Millisecond}))
+	assert.NoError(t, provider.DeliverEvent(&typesend_metrics.Metric{AppName: "app", TemplateID: "welcome", TenantID: "tenant", Provider: "SendGrid"}))
+
+	families := scrape(t, server)
+
+	sends := find(families, "typesend_sends_total", map[string]string{"app": "app", "template": "welcome", "tenant": "tenant", "status": "Success", "provider": ""})
+	if assert.NotNil(t, sends) {
+		assert.Equal(t, 4.0, sends.GetCounter().GetValue(), "Count should be added up")
+	}
+
+	delivered := find(families, "typesend_deliveries_total", map[string]string{"app": "app", "template": "welcome", "tenant": "tenant", "status": "Success", "provider": "SendGrid"})
+	if assert.NotNil(t, delivered) {
+		assert.Equal(t, 1.0, delivered.GetCounter().GetValue())
+	}
+	failed := find(families, "typesend_deliveries_total", map[string]string{"app": "app", "template": "welcome", "tenant": "tenant", "status": "Failure", "provider": "SendGrid"})
+	if assert.NotNil(t, failed) {
+		assert.Equal(t, 1.0, failed.GetCounter().GetValue())
+	}
+
+	latency := find(families, "typesend_delivery_latency_seconds", map[string]string{"status": "Success", "provider": "SendGrid"})
+	if assert.NotNil(t, latency) {
+		assert.Equal(t, uint64(1), latency.GetHistogram().GetSampleCount())
+		assert.InDelta(t, 0.2, latency.GetHistogram().GetSampleSum(), 0.0001)
+	}
+	assert.Nil(t, find(families, "typesend_delivery_latency_seconds", map[string]string{"status": "Failure", "provider": "SendGrid"}), "unmeasured deliveries aren't observed")
+}
+
+func TestPrometheusProviderDispatcherGauges(t *testing.T) {
+	provider, server := newProvider(t)
+
+	assert.NoError(t, provider.DispatchEvent(&typesend_metrics.DispatchMetric{Dispatched: 10, Failed: 2, RateLimited: 1, Duration: 1500 * time.Millisecond}))
+	assert.NoError(t, provider.DispatchEvent(&typesend_metrics.DispatchMetric{Dispatched: 4, Digested: 3}))
+
+	families := scrape(t, server)
+
+	for result, want := range map[string]float64{"dispatched": 4, "failed": 0, "failed_update": 0, "rate_limited": 0, "digested": 3, "quiet_hours": 0} {
+		gauge := find(families, "typesend_dispatcher_last_run_envelopes", map[string]string{"result": result})
+		if assert.NotNil(t, gauge, result) {
+			assert.Equal(t, want, gauge.GetGauge().GetValue(), "only the last run should be reported for %s", result)
+		}
+	}
+
+	duration := find(families, "typesend_dispatcher_last_run_duration_seconds", map[string]string{})
+	if assert.NotNil(t, duration) {
+		assert.Zero(t, duration.GetGauge().GetValue())
+	}
+	finishedAt := find(families, "typesend_dispatcher_last_run_timestamp_seconds", map[string]string{})
+	if assert.NotNil(t, finishedAt) {
+		assert.InDelta(t, float64(time.Now().Unix()), finishedAt.GetGauge().GetValue(), 60)
+	}
+}
+
+func TestPrometheusProviderSharedRegistry(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	_, err := typesend_metrics_prometheus.NewPrometheusProvider("typesend", registry)
+	assert.NoError(t, err)
+
+	_, err = typesend_metrics_prometheus.NewPrometheusProvider("typesend", registry)
+	assert.Error(t, err, "the same metrics can't be registered twice")
+
+	_, err = typesend_metrics_prometheus.NewPrometheusProvider("other", registry)
+	assert.NoError(t, err, "a different namespace doesn't clash")
+}
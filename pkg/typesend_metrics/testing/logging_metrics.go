@@ -20,18 +20,19 @@ func NewLoggingProvider(namespace, metricName string, logger typesend_schemas.Lo
 }
 
 func (p *LoggingProvider) SendEvent(metric *typesend_metrics.Metric) error {
-	p.logger.Infof("SendEvent = appID=%s templateID=%s tenantID=%s", metric.AppName, metric.TemplateID, metric.TenantID)
+	p.logger.Infof("SendEvent = appID=%s templateID=%s tenantID=%s count=%d", metric.AppName, metric.TemplateID, metric.TenantID, metric.Total())
 
 	return nil
 }
 
 func (p *LoggingProvider) DeliverEvent(metric *typesend_metrics.Metric) error {
-	status := "Failure"
-	if metric.Success {
-		status = "Success"
-	}
+	p.logger.Infof("DeliverEvent = appID=%s templateID=%s tenantID=%s status=%s count=%d", metric.AppName, metric.TemplateID, metric.TenantID, metric.Status(), metric.Total())
 
-	p.logger.Infof("DeliverEvent = appID=%s templateID=%s tenantID=%s status=%s", metric.AppName, metric.TemplateID, metric.TenantID, status)
+	return nil
+}
+
+func (p *LoggingProvider) DispatchEvent(metric *typesend_metrics.DispatchMetric) error {
+	p.logger.Infof("DispatchEvent = dispatched=%d failed=%d failedUpdates=%d rateLimited=%d digested=%d quietHours=%d duration=%s", metric.Dispatched, metric.Failed, metric.FailedUpdates, metric.RateLimited, metric.Digested, metric.QuietHours, metric.Duration)
 
 	return nil
 }
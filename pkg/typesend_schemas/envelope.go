@@ -13,6 +13,9 @@ const (
 	TypeSendStatus_DELIVERING TypeSendStatus = 1
 	TypeSendStatus_SENT       TypeSendStatus = 2
 	TypeSendStatus_FAILED     TypeSendStatus = 3
+	// Not delivered, as the recipient was suppressed by
+	// the time it came to be sent. See TypeSendSuppression.
+	TypeSendStatus_SUPPRESSED TypeSendStatus = 4
 )
 
 type TypeSendTo struct {
@@ -21,6 +24,23 @@ type TypeSendTo struct {
 	ToTenantID     string
 	ToInternalID   string
 	MessageGroupID string
+
+	// Optional; repeat sends with the same key (scoped to the
+	// App and Tenant) return the original envelope ID
+	// instead of inserting a duplicate envelope.
+	IdempotencyKey string
+
+	// Optional; overrides the templates Priority.
+	Priority TypeSendPriority
+
+	// Optional; the recipients IANA time zone (e.g. "America/New_York").
+	// QuietHours are evaluated in it. Defaults to UTC.
+	TimeZone string
+	// Optional; envelopes coming due inside this window are
+	// deferred by the dispatcher until the window ends.
+	QuietHours TypeSendQuietHours
+	// Sends immediately even during QuietHours, for urgent mail.
+	IgnoreQuietHours bool
 }
 
 type TypeSendEnvelope struct {
@@ -54,4 +74,63 @@ type TypeSendEnvelope struct {
 	MessageGroupID string `dynamodbav:"group" json:"group"`
 
 	ReferenceID string `dynamodbav:"ref" json:"ref"`
+
+	Priority TypeSendPriority `dynamodbav:"priority" json:"priority"`
+
+	// Set when the envelope is an occurrence of a TypeSendSchedule.
+	ScheduleID string `dynamodbav:"schedule,omitempty" json:"schedule,omitempty"`
+
+	// Set on digest envelopes; the envelopes gathered into this one.
+	DigestOf []string `dynamodbav:"digestOf,omitempty" json:"digestOf,omitempty"`
+
+	// Set on envelopes that were sent as part of a digest.
+	DigestID string `dynamodbav:"digestId,omitempty" json:"digestId,omitempty"`
+
+	TimeZone string `dynamodbav:"tz,omitempty" json:"tz,omitempty"`
+
+	QuietHours *TypeSendQuietHours `dynamodbav:"quietHours,omitempty" json:"quietHours,omitempty"`
+
+	// Set when the envelope was deferred for quiet hours; the time it was
+	// originally scheduled for. ScheduledFor then holds the effective time.
+	OriginalScheduledFor time.Time `dynamodbav:"originalScheduledFor" json:"originalScheduledFor"`
+
+	// Set from the matching TypeSendRetention; Unix seconds, 0 means never.
+	// Once a SENT or FAILED envelope passes ContentExpiresAt, StripContent
+	// is applied, and once it passes ExpiresAt it is deleted. ExpiresAt is
+	// the DynamoDB TTL attribute.
+	ContentExpiresAt int64 `dynamodbav:"contentExpiresAt,omitempty" json:"contentExpiresAt,omitempty"`
+	ExpiresAt        int64 `dynamodbav:"expiresAt,omitempty" json:"expiresAt,omitempty"`
+
+	// Set when Variables (and optionally ToName) are encrypted at rest;
+	// both are then empty until typesend_crypto.OpenEnvelope restores them.
+	Sealed *TypeSendSealed `dynamodbav:"sealed,omitempty" json:"sealed,omitempty"`
+}
+
+// StripContent drops the heavy fields past their retention,
+// leaving a slim record of who was sent what, and when.
+func (e *TypeSendEnvelope) StripContent() {
+	e.Variables = nil
+	e.ToName = ""
+	e.Sealed = nil
+	e.DigestOf = nil
+	e.QuietHours = nil
+	e.ContentExpiresAt = 0
+}
+
+// Defer moves the envelope to be sent at until, keeping the time it was
+// first scheduled for in OriginalScheduledFor. Retention runs from
+// ScheduledFor, so its expiry times move by as much as it was deferred.
+func (e *TypeSendEnvelope) Defer(until time.Time) {
+	if e.OriginalScheduledFor.IsZero() {
+		e.OriginalScheduledFor = e.ScheduledFor
+	}
+
+	shift := int64(until.Sub(e.ScheduledFor).Seconds())
+	if e.ContentExpiresAt > 0 {
+		e.ContentExpiresAt += shift
+	}
+	if e.ExpiresAt > 0 {
+		e.ExpiresAt += shift
+	}
+	e.ScheduledFor = until
 }
@@ -0,0 +1,99 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"time"
+)
+
+// TypeSendEventType is what happened to an envelope.
+type TypeSendEventType int
+
+const (
+	TypeSendEventType_DELIVERED TypeSendEventType = 1
+	TypeSendEventType_BOUNCED   TypeSendEventType = 2
+	// Rejected by the provider without an attempt,
+	// e.g. for an address it already knows bounces.
+	TypeSendEventType_DROPPED TypeSendEventType = 3
+	// Marked as spam by the recipient.
+	TypeSendEventType_COMPLAINED TypeSendEventType = 4
+	TypeSendEventType_OPENED     TypeSendEventType = 5
+	TypeSendEventType_CLICKED    TypeSendEventType = 6
+
+	// Recorded by TypeSend itself, as the envelope moves through it.
+	TypeSendEventType_QUEUED     TypeSendEventType = 7
+	TypeSendEventType_DISPATCHED TypeSendEventType = 8
+	// Handed to the provider.
+	TypeSendEventType_SENT   TypeSendEventType = 9
+	TypeSendEventType_FAILED TypeSendEventType = 10
+	// Skipped at delivery, as the recipient was suppressed
+	// or opted out of the templates category.
+	TypeSendEventType_SUPPRESSED TypeSendEventType = 11
+)
+
+func (t TypeSendEventType) Validate() error {
+	switch t {
+	case TypeSendEventType_DELIVERED, TypeSendEventType_BOUNCED, TypeSendEventType_DROPPED,
+		TypeSendEventType_COMPLAINED, TypeSendEventType_OPENED, TypeSendEventType_CLICKED,
+		TypeSendEventType_QUEUED, TypeSendEventType_DISPATCHED, TypeSendEventType_SENT,
+		TypeSendEventType_FAILED, TypeSendEventType_SUPPRESSED:
+		return nil
+	}
+	return fmt.Errorf("typesend: unknown event type %d", t)
+}
+
+func (t TypeSendEventType) String() string {
+	switch t {
+	case TypeSendEventType_DELIVERED:
+		return "delivered"
+	case TypeSendEventType_BOUNCED:
+		return "bounced"
+	case TypeSendEventType_DROPPED:
+		return "dropped"
+	case TypeSendEventType_COMPLAINED:
+		return "complained"
+	case TypeSendEventType_OPENED:
+		return "opened"
+	case TypeSendEventType_CLICKED:
+		return "clicked"
+	case TypeSendEventType_QUEUED:
+		return "queued"
+	case TypeSendEventType_DISPATCHED:
+		return "dispatched"
+	case TypeSendEventType_SENT:
+		return "sent"
+	case TypeSendEventType_FAILED:
+		return "failed"
+	case TypeSendEventType_SUPPRESSED:
+		return "suppressed"
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+// TypeSendEvent is an entry in an envelopes event log.
+type TypeSendEvent struct {
+	EnvelopeID string `dynamodbav:"eventEnvelope" json:"envelope"`
+	// Unique within the envelope, e.g. the providers event ID, so
+	// an event reported twice (such as a webhook retry) is kept once.
+	ID       string `dynamodbav:"eventId" json:"id"`
+	AppID    string `dynamodbav:"app" json:"app"`
+	TenantID string `dynamodbav:"tenant" json:"tenant"`
+	// Optional; the envelopes template, so analytics
+	// can count events without loading the envelope.
+	TemplateID string            `dynamodbav:"template,omitempty" json:"template,omitempty"`
+	Type       TypeSendEventType `dynamodbav:"type" json:"type"`
+	// e.g. "SendGrid"; empty for events TypeSend records itself,
+	// such as it being queued or a tracked open.
+	Provider string `dynamodbav:"provider" json:"provider"`
+	// Optional; the providers ID for the email.
+	ProviderMessageID string    `dynamodbav:"providerMessageId,omitempty" json:"providerMessageId,omitempty"`
+	OccurredAt        time.Time `dynamodbav:"occurredAt" json:"occurredAt"`
+	// Optional; e.g. the bounce reason, or the URL clicked.
+	Details map[string]string `dynamodbav:"details,omitempty" json:"details,omitempty"`
+}
+
+func (e *TypeSendEvent) Validate() error {
+	if e.EnvelopeID == "" || e.ID == "" {
+		return fmt.Errorf("typesend: event needs an EnvelopeID and ID")
+	}
+	return e.Type.Validate()
+}
@@ -1 +1,24 @@
 package typesend_schemas
+
+import "strings"
+
+const (
+	// RFC 2369
+	HeaderListUnsubscribe = "List-Unsubscribe"
+	// RFC 8058; tells mail clients the URL supports one-click POSTs.
+	HeaderListUnsubscribePost = "List-Unsubscribe-Post"
+)
+
+// ListUnsubscribeHeaders returns the headers offering the https URL
+// (and the mailto address, when set) for unsubscribing.
+func ListUnsubscribeHeaders(url string, mailto string) map[string]string {
+	links := []string{"<" + url + ">"}
+	if mailto != "" {
+		links = append(links, "<"+mailto+">")
+	}
+
+	return map[string]string{
+		HeaderListUnsubscribe:     strings.Join(links, ", "),
+		HeaderListUnsubscribePost: "List-Unsubscribe=One-Click",
+	}
+}
@@ -0,0 +1,70 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TypeSendCategory is a kind of mail an App sends, such as product
+// updates or billing, that recipients can opt out of.
+type TypeSendCategory struct {
+	// e.g. "product-updates"; what TypeSendTemplate.Category refers to.
+	ID          string `dynamodbav:"id" json:"id"`
+	Name        string `dynamodbav:"name" json:"name"`
+	Description string `dynamodbav:"description,omitempty" json:"description,omitempty"`
+	// Mandatory categories (e.g. security alerts) always send,
+	// and can't be opted out of.
+	Mandatory bool `dynamodbav:"mandatory" json:"mandatory"`
+}
+
+func (c *TypeSendCategory) Validate() error {
+	if c.ID == "" || c.Name == "" {
+		return fmt.Errorf("typesend: category needs an ID and Name")
+	}
+	return nil
+}
+
+// FindCategory returns the category with the ID, or nil.
+func FindCategory(categories []*TypeSendCategory, id string) *TypeSendCategory {
+	for _, category := range categories {
+		if category.ID == id {
+			return category
+		}
+	}
+	return nil
+}
+
+// TypeSendPreferences are the categories an address has opted out
+// of with an App and Tenant. There is at most one per address.
+type TypeSendPreferences struct {
+	AppID    string `dynamodbav:"app" json:"app"`
+	TenantID string `dynamodbav:"tenant" json:"tenant"`
+	// Stored as NormalizeAddress returns it.
+	Address string `dynamodbav:"address" json:"address"`
+	// Category IDs, sorted.
+	OptedOut  []string  `dynamodbav:"optedOut" json:"optedOut"`
+	UpdatedAt time.Time `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+func (p *TypeSendPreferences) Validate() error {
+	if p.AppID == "" || p.TenantID == "" || p.Address == "" {
+		return fmt.Errorf("typesend: preferences need an AppID, TenantID and Address")
+	}
+	return nil
+}
+
+func (p *TypeSendPreferences) OptedOutOf(category string) bool {
+	return slices.Contains(p.OptedOut, category)
+}
+
+// Blocks reports whether the preferences stop a send in the category.
+// Uncategorized mail and mandatory categories are never blocked;
+// a category that isn't registered is treated as optional.
+func (p *TypeSendPreferences) Blocks(category string, categories []*TypeSendCategory) bool {
+	if category == "" || !p.OptedOutOf(category) {
+		return false
+	}
+	registered := FindCategory(categories, category)
+	return registered == nil || !registered.Mandatory
+}
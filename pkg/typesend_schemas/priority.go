@@ -0,0 +1,52 @@
+package typesend_schemas
+
+import "fmt"
+
+// TypeSendPriority decides which lane the dispatcher drains an
+// envelope from, and which queue it is routed to. Lanes are
+// drained HIGH first, then NORMAL, then LOW.
+type TypeSendPriority int
+
+const (
+	// Unset; falls back to the templates priority, then NORMAL.
+	// Envelopes stored before priorities existed read as DEFAULT.
+	TypeSendPriority_DEFAULT TypeSendPriority = 0
+	TypeSendPriority_HIGH    TypeSendPriority = 1
+	TypeSendPriority_NORMAL  TypeSendPriority = 2
+	TypeSendPriority_LOW     TypeSendPriority = 3
+)
+
+// TypeSendPriorities lists every lane in the order it is drained.
+var TypeSendPriorities = []TypeSendPriority{
+	TypeSendPriority_HIGH,
+	TypeSendPriority_NORMAL,
+	TypeSendPriority_LOW,
+}
+
+// Effective resolves DEFAULT to NORMAL.
+func (p TypeSendPriority) Effective() TypeSendPriority {
+	if p == TypeSendPriority_DEFAULT {
+		return TypeSendPriority_NORMAL
+	}
+	return p
+}
+
+func (p TypeSendPriority) Validate() error {
+	switch p {
+	case TypeSendPriority_DEFAULT, TypeSendPriority_HIGH, TypeSendPriority_NORMAL, TypeSendPriority_LOW:
+		return nil
+	}
+	return fmt.Errorf("typesend: unknown priority %d", p)
+}
+
+func (p TypeSendPriority) String() string {
+	switch p.Effective() {
+	case TypeSendPriority_HIGH:
+		return "high"
+	case TypeSendPriority_NORMAL:
+		return "normal"
+	case TypeSendPriority_LOW:
+		return "low"
+	}
+	return fmt.Sprintf("priority(%d)", int(p))
+}
@@ -0,0 +1,85 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"time"
+)
+
+// TypeSendQuietHours is a daily window, in the recipients local time,
+// during which non-urgent mail is held back. Start and End are wall
+// clock times such as "22:00" and "07:30"; a window may cross midnight.
+type TypeSendQuietHours struct {
+	Start string `dynamodbav:"start" json:"start"`
+	End   string `dynamodbav:"end" json:"end"`
+}
+
+func (q TypeSendQuietHours) IsZero() bool {
+	return q.Start == "" && q.End == ""
+}
+
+func (q TypeSendQuietHours) Validate() error {
+	if _, err := parseClock(q.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(q.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+// NextAllowed returns t itself when it falls outside quiet hours in
+// loc, otherwise the moment the current quiet window ends, in UTC.
+func (q TypeSendQuietHours) NextAllowed(t time.Time, loc *time.Location) (time.Time, error) {
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, err
+	}
+	end, err := parseClock(q.End)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+
+	var quiet bool
+	switch {
+	case start < end:
+		quiet = minute >= start && minute < end
+	case start > end:
+		// Crosses midnight.
+		quiet = minute >= start || minute < end
+	}
+
+	if !quiet {
+		return t, nil
+	}
+
+	allowed := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !allowed.After(local) {
+		allowed = time.Date(local.Year(), local.Month(), local.Day()+1, end/60, end%60, 0, 0, loc)
+	}
+	return allowed.UTC(), nil
+}
+
+// parseClock returns the minutes since midnight of a "15:04" time.
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("typesend: invalid quiet hours time %q", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// LoadTimeZone loads an IANA time zone, treating an empty name as UTC.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid time zone: %w", err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,88 @@
+package typesend_schemas
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type TypeSendRateLimitScope string
+
+const (
+	TypeSendRateLimitScope_APP      TypeSendRateLimitScope = "app"
+	TypeSendRateLimitScope_TENANT   TypeSendRateLimitScope = "tenant"
+	TypeSendRateLimitScope_TEMPLATE TypeSendRateLimitScope = "template"
+	TypeSendRateLimitScope_PROVIDER TypeSendRateLimitScope = "provider"
+)
+
+// TypeSendRateLimit caps how many envelopes the dispatcher
+// hands off per Window for everything within a Scope.
+// Envelopes over the limit stay UNSENT for a later run.
+type TypeSendRateLimit struct {
+	Scope TypeSendRateLimitScope `json:"scope"`
+
+	// Optional; only applies the limit to this value of the
+	// Scope (e.g. a single tenant ID). When empty, every value
+	// gets its own independent limit.
+	Match string `json:"match"`
+
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+}
+
+// UnmarshalJSON accepts Window as a duration string
+// (e.g. "1h") so limits can be configured from the environment.
+func (r *TypeSendRateLimit) UnmarshalJSON(data []byte) error {
+	type alias TypeSendRateLimit
+	raw := struct {
+		*alias
+		Window string `json:"window"`
+	}{
+		alias: (*alias)(r),
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	window, err := time.ParseDuration(raw.Window)
+	if err != nil {
+		return fmt.Errorf("typesend: invalid rate limit window: %w", err)
+	}
+	r.Window = window
+
+	return r.Validate()
+}
+
+func (r *TypeSendRateLimit) Validate() error {
+	switch r.Scope {
+	case TypeSendRateLimitScope_APP, TypeSendRateLimitScope_TENANT, TypeSendRateLimitScope_TEMPLATE, TypeSendRateLimitScope_PROVIDER:
+	default:
+		return fmt.Errorf("typesend: unknown rate limit scope %q", r.Scope)
+	}
+
+	if r.Limit <= 0 {
+		return fmt.Errorf("typesend: rate limit must be positive")
+	}
+
+	if r.Window <= 0 {
+		return fmt.Errorf("typesend: rate limit window must be positive")
+	}
+
+	return nil
+}
+
+// ParseRateLimits reads a JSON array of rate limits,
+// such as the TYPESEND_RATE_LIMITS environment variable.
+func ParseRateLimits(raw string) ([]TypeSendRateLimit, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var limits []TypeSendRateLimit
+	if err := json.Unmarshal([]byte(raw), &limits); err != nil {
+		return nil, err
+	}
+
+	return limits, nil
+}
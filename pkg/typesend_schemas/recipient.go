@@ -0,0 +1,140 @@
+package typesend_schemas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TypeSendRecipient identifies a person for a data export or erasure.
+// Envelopes and schedules match on either field.
+type TypeSendRecipient struct {
+	ToAddress    string `json:"to,omitempty"`
+	ToInternalID string `json:"toInternal,omitempty"`
+}
+
+func (r TypeSendRecipient) Validate() error {
+	if r.ToAddress == "" && r.ToInternalID == "" {
+		return fmt.Errorf("typesend: recipient needs a ToAddress or ToInternalID")
+	}
+	return nil
+}
+
+// Matches reports whether an envelope or schedule sent to
+// toAddress / toInternalID belongs to the recipient.
+func (r TypeSendRecipient) Matches(toAddress string, toInternalID string) bool {
+	return (r.ToAddress != "" && r.ToAddress == toAddress) ||
+		(r.ToInternalID != "" && r.ToInternalID == toInternalID)
+}
+
+// Hashes returns the HashRecipient of each field that is set.
+func (r TypeSendRecipient) Hashes() []string {
+	hashes := []string{}
+	for _, value := range []string{r.ToAddress, r.ToInternalID} {
+		if value != "" {
+			hashes = append(hashes, HashRecipient(value))
+		}
+	}
+	return hashes
+}
+
+// HashRecipient pseudonymizes an address or internal ID. Values are
+// trimmed and lowercased first, so differently cased sends to the
+// same address share a tombstone.
+func HashRecipient(value string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(sum[:])
+}
+
+// ErasedAddress is the pseudonym an erased address is replaced with.
+// It is stable per address and can never be delivered to.
+func ErasedAddress(address string) string {
+	return "erased+" + HashRecipient(address)[:32] + "@erased.invalid"
+}
+
+// TypeSendTombstone records that a recipient was erased. Only the
+// hash is kept, so they can still be recognised (e.g. to suppress
+// further sends) without holding their address.
+type TypeSendTombstone struct {
+	Hash     string    `dynamodbav:"hash" json:"hash"`
+	ErasedAt time.Time `dynamodbav:"erasedAt" json:"erasedAt"`
+}
+
+// TypeSendRecipientExport is everything held about a recipient.
+type TypeSendRecipientExport struct {
+	Recipient  TypeSendRecipient   `json:"recipient"`
+	ExportedAt time.Time           `json:"exportedAt"`
+	Envelopes  []*TypeSendEnvelope `json:"envelopes"`
+	// Logged for the envelopes.
+	Events    []*TypeSendEvent    `json:"events"`
+	Schedules []*TypeSendSchedule `json:"schedules"`
+	// Held with any App or Tenant for the recipients addresses,
+	// including those only their internal ID was sent to.
+	Suppressions []*TypeSendSuppression `json:"suppressions"`
+	// Likewise held for any of the recipients addresses.
+	Preferences []*TypeSendPreferences `json:"preferences"`
+	Tombstones  []*TypeSendTombstone   `json:"tombstones"`
+}
+
+// TypeSendErasure summarises an erasure.
+type TypeSendErasure struct {
+	// Envelopes pseudonymized.
+	Envelopes int `json:"envelopes"`
+	// Events of those envelopes that had their details dropped.
+	Events int `json:"events"`
+	// Schedules deleted.
+	Schedules int `json:"schedules"`
+	// Suppressions replaced with pseudonymized copies.
+	Suppressions int `json:"suppressions"`
+	// Preferences deleted.
+	Preferences int `json:"preferences"`
+	// One per distinct address and internal ID erased.
+	Tombstones []*TypeSendTombstone `json:"tombstones"`
+}
+
+// Erase pseudonymizes the recipient and drops everything else personal.
+// Envelopes not yet sent are FAILED, so they are never delivered.
+func (e *TypeSendEnvelope) Erase() {
+	e.ToAddress = ErasedAddress(e.ToAddress)
+	if e.ToInternalID != "" {
+		e.ToInternalID = "erased:" + HashRecipient(e.ToInternalID)[:32]
+	}
+	e.StripContent()
+	e.TimeZone = ""
+	if e.Status == TypeSendStatus_UNSENT {
+		e.Status = TypeSendStatus_FAILED
+	}
+}
+
+// Erase pseudonymizes the address and drops the note, which may quote
+// it (e.g. a bounce message). The reason is kept for the audit trail.
+func (s *TypeSendSuppression) Erase() {
+	s.Address = ErasedAddress(s.Address)
+	s.Note = ""
+}
+
+// Erase drops the details, which may hold the address or a providers
+// diagnostics quoting it. The rest is kept for analytics.
+func (e *TypeSendEvent) Erase() {
+	e.Details = nil
+}
+
+// NewTombstones returns a tombstone for each distinct, non-empty value.
+func NewTombstones(erasedAt time.Time, values ...string) []*TypeSendTombstone {
+	seen := map[string]bool{}
+	tombstones := []*TypeSendTombstone{}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		hash := HashRecipient(value)
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+		tombstones = append(tombstones, &TypeSendTombstone{Hash: hash, ErasedAt: erasedAt.UTC()})
+	}
+	return tombstones
+}
@@ -0,0 +1,146 @@
+package typesend_schemas
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TypeSendRetention controls how long envelopes are kept once
+// they have been sent (or have failed). Both durations are counted
+// from the envelopes ScheduledFor.
+type TypeSendRetention struct {
+	// Optional; only applies the policy to this App.
+	// When empty, it applies to every App.
+	AppID string `json:"app"`
+	// Optional; only applies the policy to this Tenant.
+	// When empty, it applies to every Tenant.
+	TenantID string `json:"tenant"`
+
+	// How long the heavy fields (Variables, ToName, DigestOf and
+	// QuietHours) are kept, leaving a slim audit record behind.
+	// Zero keeps them for as long as the envelope.
+	Content time.Duration `json:"content"`
+	// How long the envelope is kept at all. Zero keeps it forever.
+	// DynamoDB's TTL deletes envelopes whatever their status, so keep
+	// it well beyond any delay before delivery.
+	Record time.Duration `json:"record"`
+}
+
+// UnmarshalJSON accepts Content and Record as duration strings
+// (e.g. "720h") so policies can be configured from the environment.
+func (r *TypeSendRetention) UnmarshalJSON(data []byte) error {
+	type alias TypeSendRetention
+	raw := struct {
+		*alias
+		Content string `json:"content"`
+		Record  string `json:"record"`
+	}{
+		alias: (*alias)(r),
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	for _, field := range []struct {
+		raw  string
+		into *time.Duration
+	}{
+		{raw.Content, &r.Content},
+		{raw.Record, &r.Record},
+	} {
+		if field.raw == "" {
+			*field.into = 0
+			continue
+		}
+		duration, err := time.ParseDuration(field.raw)
+		if err != nil {
+			return fmt.Errorf("typesend: invalid retention duration: %w", err)
+		}
+		*field.into = duration
+	}
+
+	return r.Validate()
+}
+
+func (r *TypeSendRetention) Validate() error {
+	if r.Content < 0 || r.Record < 0 {
+		return fmt.Errorf("typesend: retention durations must not be negative")
+	}
+
+	if r.Content == 0 && r.Record == 0 {
+		return fmt.Errorf("typesend: retention policy keeps everything forever")
+	}
+
+	if r.Content > 0 && r.Record > 0 && r.Content > r.Record {
+		return fmt.Errorf("typesend: retention content must not outlive the record")
+	}
+
+	return nil
+}
+
+func (r *TypeSendRetention) matches(appID string, tenantID string) bool {
+	return (r.AppID == "" || r.AppID == appID) && (r.TenantID == "" || r.TenantID == tenantID)
+}
+
+// specificity ranks policies naming a Tenant above those naming
+// only an App, and both above catch-all policies.
+func (r *TypeSendRetention) specificity() int {
+	score := 0
+	if r.TenantID != "" {
+		score += 2
+	}
+	if r.AppID != "" {
+		score++
+	}
+	return score
+}
+
+// ResolveRetention returns the most specific policy matching the
+// App and Tenant, or nil to keep envelopes forever. Ties go to
+// whichever policy is listed first.
+func ResolveRetention(policies []TypeSendRetention, appID string, tenantID string) *TypeSendRetention {
+	var best *TypeSendRetention
+	for i := range policies {
+		policy := &policies[i]
+		if !policy.matches(appID, tenantID) {
+			continue
+		}
+		if best == nil || policy.specificity() > best.specificity() {
+			best = policy
+		}
+	}
+	return best
+}
+
+// ApplyRetention stamps the envelope with the expiry times of the
+// policy matching its App and Tenant. Call it once ScheduledFor is set.
+func ApplyRetention(policies []TypeSendRetention, envelope *TypeSendEnvelope) {
+	policy := ResolveRetention(policies, envelope.AppID, envelope.TenantID)
+	if policy == nil {
+		return
+	}
+
+	if policy.Content > 0 {
+		envelope.ContentExpiresAt = envelope.ScheduledFor.Add(policy.Content).Unix()
+	}
+	if policy.Record > 0 {
+		envelope.ExpiresAt = envelope.ScheduledFor.Add(policy.Record).Unix()
+	}
+}
+
+// ParseRetention reads a JSON array of retention policies,
+// such as the TYPESEND_RETENTION environment variable.
+func ParseRetention(raw string) ([]TypeSendRetention, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var policies []TypeSendRetention
+	if err := json.Unmarshal([]byte(raw), &policies); err != nil {
+		return nil, err
+	}
+
+	return policies, nil
+}
@@ -0,0 +1,82 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"time"
+)
+
+// RollupDay returns the start of the UTC day containing t,
+// which is the Day of any rollup counting an event at t.
+func RollupDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// TypeSendRollup counts an Apps events for one Tenant,
+// Template and UTC day. There is at most one per day.
+type TypeSendRollup struct {
+	AppID      string `dynamodbav:"app" json:"app"`
+	TenantID   string `dynamodbav:"tenant" json:"tenant"`
+	TemplateID string `dynamodbav:"template" json:"template"`
+	// Midnight UTC.
+	Day time.Time `dynamodbav:"day" json:"day"`
+
+	Sent      int64 `dynamodbav:"sent" json:"sent"`
+	Delivered int64 `dynamodbav:"delivered" json:"delivered"`
+	Bounced   int64 `dynamodbav:"bounced" json:"bounced"`
+	Opened    int64 `dynamodbav:"opened" json:"opened"`
+	// Envelopes opened at least once that day.
+	UniqueOpens int64 `dynamodbav:"uniqueOpens" json:"uniqueOpens"`
+	Clicked     int64 `dynamodbav:"clicked" json:"clicked"`
+	Complained  int64 `dynamodbav:"complained" json:"complained"`
+
+	UpdatedAt time.Time `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+func (r *TypeSendRollup) Validate() error {
+	if r.AppID == "" {
+		return fmt.Errorf("typesend: rollup needs an AppID")
+	}
+	if r.Day.IsZero() || !r.Day.Equal(RollupDay(r.Day)) {
+		return fmt.Errorf("typesend: rollup Day must be midnight UTC")
+	}
+	return nil
+}
+
+// TypeSendRollupQuery selects an Apps rollups between two days.
+type TypeSendRollupQuery struct {
+	AppID string
+	// Optional; empty matches every Tenant.
+	TenantID string
+	// Optional; empty matches every Template.
+	TemplateID string
+	// Inclusive; any time within the first and last day.
+	From time.Time
+	To   time.Time
+}
+
+func (q TypeSendRollupQuery) Validate() error {
+	if q.AppID == "" {
+		return fmt.Errorf("typesend: rollup query needs an AppID")
+	}
+	if q.From.IsZero() || q.To.IsZero() {
+		return fmt.Errorf("typesend: rollup query needs a From and To")
+	}
+	if q.To.Before(q.From) {
+		return fmt.Errorf("typesend: rollup query To is before From")
+	}
+	return nil
+}
+
+// Matches reports whether the rollup is one the query selects.
+func (q TypeSendRollupQuery) Matches(rollup *TypeSendRollup) bool {
+	if rollup.AppID != q.AppID {
+		return false
+	}
+	if q.TenantID != "" && rollup.TenantID != q.TenantID {
+		return false
+	}
+	if q.TemplateID != "" && rollup.TemplateID != q.TemplateID {
+		return false
+	}
+	return !rollup.Day.Before(RollupDay(q.From)) && !rollup.Day.After(RollupDay(q.To))
+}
@@ -0,0 +1,158 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/teambition/rrule-go"
+)
+
+type TypeSendScheduleState int
+
+const (
+	TypeSendScheduleState_ACTIVE TypeSendScheduleState = 0
+	TypeSendScheduleState_PAUSED TypeSendScheduleState = 1
+	// The recurrence has no further occurrences (e.g. an RRULE COUNT was reached).
+	TypeSendScheduleState_COMPLETED TypeSendScheduleState = 2
+)
+
+// TypeSendRecurrence describes when a schedule repeats.
+// Exactly one of Cron or RRule must be set.
+type TypeSendRecurrence struct {
+	// Standard 5 field cron expression, e.g. "0 9 * * MON".
+	Cron string `dynamodbav:"cron" json:"cron"`
+
+	// RFC 5545 recurrence rule, e.g. "FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=9".
+	// A DTSTART within the rule is ignored in favor of Start.
+	RRule string `dynamodbav:"rrule" json:"rrule"`
+
+	// IANA time zone both Cron and RRule are evaluated in.
+	// Defaults to UTC.
+	TimeZone string `dynamodbav:"tz" json:"tz"`
+
+	// Anchors the RRule; fields the rule does not specify
+	// (such as the minute) are taken from Start.
+	// Defaults to when the schedule is created.
+	Start time.Time `dynamodbav:"start" json:"start"`
+}
+
+func (r TypeSendRecurrence) Validate() error {
+	if (r.Cron == "") == (r.RRule == "") {
+		return fmt.Errorf("typesend: exactly one of Cron or RRule must be set")
+	}
+
+	if _, err := r.location(); err != nil {
+		return err
+	}
+
+	if r.Cron != "" {
+		if _, err := cron.ParseStandard(r.Cron); err != nil {
+			return fmt.Errorf("typesend: invalid cron expression: %w", err)
+		}
+		return nil
+	}
+
+	if _, err := rrule.StrToROption(r.RRule); err != nil {
+		return fmt.Errorf("typesend: invalid rrule: %w", err)
+	}
+
+	return nil
+}
+
+// Next returns the first occurrence strictly after the given time,
+// in UTC. It returns the zero time once there are no occurrences left.
+func (r TypeSendRecurrence) Next(after time.Time) (time.Time, error) {
+	loc, err := r.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if r.Cron != "" {
+		schedule, err := cron.ParseStandard(r.Cron)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("typesend: invalid cron expression: %w", err)
+		}
+		return schedule.Next(after.In(loc)).UTC(), nil
+	}
+
+	opt, err := rrule.StrToROption(r.RRule)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("typesend: invalid rrule: %w", err)
+	}
+	opt.Dtstart = r.Start.In(loc)
+
+	rule, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("typesend: invalid rrule: %w", err)
+	}
+
+	next := rule.After(after.In(loc), false)
+	if next.IsZero() {
+		return time.Time{}, nil
+	}
+	return next.UTC(), nil
+}
+
+func (r TypeSendRecurrence) location() (*time.Location, error) {
+	return LoadTimeZone(r.TimeZone)
+}
+
+// TypeSendSchedule is a recurring send. Each run, the dispatcher
+// expands schedules whose NextRunAt has passed into envelopes.
+type TypeSendSchedule struct {
+	ID string `dynamodbav:"id" json:"id"`
+
+	AppID string `dynamodbav:"app" json:"app"`
+
+	TenantID string `dynamodbav:"tenant" json:"tenant"`
+
+	TemplateID string `dynamodbav:"tid" json:"tid"`
+
+	ToAddress string `dynamodbav:"to" json:"to"`
+
+	ToName string `dynamodbav:"to_name" json:"to_name"`
+
+	ToInternalID string `dynamodbav:"toInternal" json:"toInternal"`
+
+	MessageGroupID string `dynamodbav:"group" json:"group"`
+
+	Variables map[string]interface{} `dynamodbav:"variables" json:"variables"`
+
+	// Copied onto each occurrence; see TypeSendEnvelope.Sealed.
+	Sealed *TypeSendSealed `dynamodbav:"sealed,omitempty" json:"sealed,omitempty"`
+
+	Priority TypeSendPriority `dynamodbav:"priority" json:"priority"`
+
+	TimeZone string `dynamodbav:"tz,omitempty" json:"tz,omitempty"`
+
+	QuietHours *TypeSendQuietHours `dynamodbav:"quietHours,omitempty" json:"quietHours,omitempty"`
+
+	Recurrence TypeSendRecurrence `dynamodbav:"recurrence" json:"recurrence"`
+
+	State TypeSendScheduleState `dynamodbav:"state" json:"state"`
+
+	NextRunAt time.Time `dynamodbav:"nextRunAt" json:"nextRunAt"`
+}
+
+// Envelope creates the envelope for the occurrence at runAt.
+func (s *TypeSendSchedule) Envelope(envelopeID string, runAt time.Time) *TypeSendEnvelope {
+	return &TypeSendEnvelope{
+		ID:             envelopeID,
+		ScheduleID:     s.ID,
+		ScheduledFor:   runAt.UTC(),
+		AppID:          s.AppID,
+		TenantID:       s.TenantID,
+		TemplateID:     s.TemplateID,
+		ToAddress:      s.ToAddress,
+		ToName:         s.ToName,
+		ToInternalID:   s.ToInternalID,
+		MessageGroupID: s.MessageGroupID,
+		Variables:      s.Variables,
+		Sealed:         s.Sealed,
+		Priority:       s.Priority,
+		TimeZone:       s.TimeZone,
+		QuietHours:     s.QuietHours,
+		Status:         TypeSendStatus_UNSENT,
+	}
+}
@@ -0,0 +1,14 @@
+package typesend_schemas
+
+// TypeSendSealed is content encrypted with its own random data key,
+// which is itself encrypted ("wrapped") by a key provider. Rotating
+// the provider's key only means rewrapping DataKey.
+type TypeSendSealed struct {
+	// Identifies the key DataKey was wrapped with, as
+	// understood by the key provider that wrapped it.
+	KeyID   string `dynamodbav:"kid" json:"kid"`
+	DataKey []byte `dynamodbav:"key" json:"key"`
+
+	Nonce      []byte `dynamodbav:"nonce" json:"nonce"`
+	Ciphertext []byte `dynamodbav:"data" json:"data"`
+}
@@ -0,0 +1,76 @@
+package typesend_schemas
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TypeSendSuppressionReason is why a recipient must not be emailed.
+type TypeSendSuppressionReason int
+
+const (
+	TypeSendSuppressionReason_UNSUBSCRIBED TypeSendSuppressionReason = 1
+	TypeSendSuppressionReason_BOUNCED      TypeSendSuppressionReason = 2
+	// Marked as spam by the recipient.
+	TypeSendSuppressionReason_COMPLAINED TypeSendSuppressionReason = 3
+	// Added by an operator.
+	TypeSendSuppressionReason_MANUAL TypeSendSuppressionReason = 4
+)
+
+func (r TypeSendSuppressionReason) Validate() error {
+	switch r {
+	case TypeSendSuppressionReason_UNSUBSCRIBED, TypeSendSuppressionReason_BOUNCED,
+		TypeSendSuppressionReason_COMPLAINED, TypeSendSuppressionReason_MANUAL:
+		return nil
+	}
+	return fmt.Errorf("typesend: unknown suppression reason %d", r)
+}
+
+func (r TypeSendSuppressionReason) String() string {
+	switch r {
+	case TypeSendSuppressionReason_UNSUBSCRIBED:
+		return "unsubscribed"
+	case TypeSendSuppressionReason_BOUNCED:
+		return "bounced"
+	case TypeSendSuppressionReason_COMPLAINED:
+		return "complained"
+	case TypeSendSuppressionReason_MANUAL:
+		return "manual"
+	}
+	return fmt.Sprintf("unknown(%d)", int(r))
+}
+
+// TypeSendSuppression stops an address being emailed by an App
+// and Tenant. There is at most one per address; a later one
+// replaces the earlier.
+type TypeSendSuppression struct {
+	AppID    string `dynamodbav:"app" json:"app"`
+	TenantID string `dynamodbav:"tenant" json:"tenant"`
+	// Stored as NormalizeAddress returns it.
+	Address string                    `dynamodbav:"address" json:"address"`
+	Reason  TypeSendSuppressionReason `dynamodbav:"reason" json:"reason"`
+	// Optional; e.g. the bounce message, or who added it.
+	Note      string    `dynamodbav:"note,omitempty" json:"note,omitempty"`
+	CreatedAt time.Time `dynamodbav:"createdAt" json:"createdAt"`
+}
+
+func (s *TypeSendSuppression) Validate() error {
+	if s.AppID == "" || s.TenantID == "" || s.Address == "" {
+		return fmt.Errorf("typesend: suppression needs an AppID, TenantID and Address")
+	}
+	return s.Reason.Validate()
+}
+
+// Blocks reports whether the suppression stops a send. Transactional
+// templates (receipts, password resets) still reach recipients who
+// only unsubscribed, but never addresses that bounced or complained.
+func (s *TypeSendSuppression) Blocks(transactional bool) bool {
+	return !transactional || s.Reason != TypeSendSuppressionReason_UNSUBSCRIBED
+}
+
+// NormalizeAddress trims and lowercases an address, so differently
+// cased sends to the same address share a suppression.
+func NormalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
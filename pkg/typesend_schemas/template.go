@@ -3,6 +3,7 @@ package typesend_schemas
 import (
 	"bytes"
 	"html/template"
+	"time"
 
 	"github.com/Masterminds/sprig/v3"
 )
@@ -16,6 +17,64 @@ type TypeSendTemplate struct {
 	Subject     string `dynamodbav:"subject" json:"subject"`
 	FromAddress string `dynamodbav:"from" json:"from"`
 	FromName    string `dynamodbav:"from_name" json:"from_name"`
+
+	// Transactional templates (password resets, receipts, etc.)
+	// are exempt from dispatcher rate limits.
+	Transactional bool `dynamodbav:"transactional" json:"transactional"`
+
+	// Transactional templates may also send without List-Unsubscribe
+	// headers or an UnsubscribeURL. Ignored for any other template,
+	// as bulk senders must offer them.
+	OmitListUnsubscribe bool `dynamodbav:"omitListUnsubscribe" json:"omitListUnsubscribe"`
+
+	// Optional; the TypeSendCategory ID recipients can opt out of
+	// to stop receiving this template.
+	Category string `dynamodbav:"category,omitempty" json:"category,omitempty"`
+
+	// Sensitive templates (password resets, sign in links, etc.) are
+	// never tracked, as rewriting their links would send the secrets
+	// they carry through the tracker.
+	Sensitive bool `dynamodbav:"sensitive" json:"sensitive"`
+	// Transactional templates are only tracked when EnableTracking
+	// is set, as their recipients haven't opted in to marketing.
+	// Ignored for any other template, which is tracked by default.
+	EnableTracking bool `dynamodbav:"enableTracking" json:"enableTracking"`
+	// Opt the template out of open or click tracking,
+	// when delivery has tracking set up.
+	DisableOpenTracking  bool `dynamodbav:"disableOpenTracking" json:"disableOpenTracking"`
+	DisableClickTracking bool `dynamodbav:"disableClickTracking" json:"disableClickTracking"`
+
+	// Default Priority for envelopes sent with this template.
+	Priority TypeSendPriority `dynamodbav:"priority" json:"priority"`
+
+	// Optional; when set, envelopes to the same recipient are held
+	// for up to this long and then sent as a single digest email.
+	// The template can range over each envelopes Variables with
+	// {{ range .Digest }}.
+	DigestWindow time.Duration `dynamodbav:"digestWindow" json:"digestWindow"`
+
+	// Extra email headers, set on the filled template at delivery
+	// (e.g. List-Unsubscribe). Providers add them to the email.
+	Headers map[string]string `dynamodbav:"-" json:"-"`
+}
+
+// WantsListUnsubscribe reports whether emails sent with the
+// template should carry unsubscribe headers.
+func (t *TypeSendTemplate) WantsListUnsubscribe() bool {
+	return !(t.Transactional && t.OmitListUnsubscribe)
+}
+
+// tracked reports whether the template may be tracked at all.
+func (t *TypeSendTemplate) tracked() bool {
+	return !t.Sensitive && (!t.Transactional || t.EnableTracking)
+}
+
+func (t *TypeSendTemplate) TracksOpens() bool {
+	return t.tracked() && !t.DisableOpenTracking
+}
+
+func (t *TypeSendTemplate) TracksClicks() bool {
+	return t.tracked() && !t.DisableClickTracking
 }
 
 func (t *TypeSendTemplate) Fill(vars map[string]interface{}) error {
@@ -0,0 +1,24 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListUnsubscribeHeaders(t *testing.T) {
+	headers := typesend_schemas.ListUnsubscribeHeaders("https://example.com/u?token=abc", "mailto:unsubscribe@example.com?subject=abc")
+	assert.Equal(t, "<https://example.com/u?token=abc>, <mailto:unsubscribe@example.com?subject=abc>", headers[typesend_schemas.HeaderListUnsubscribe])
+	assert.Equal(t, "List-Unsubscribe=One-Click", headers[typesend_schemas.HeaderListUnsubscribePost])
+
+	headers = typesend_schemas.ListUnsubscribeHeaders("https://example.com/u?token=abc", "")
+	assert.Equal(t, "<https://example.com/u?token=abc>", headers[typesend_schemas.HeaderListUnsubscribe])
+}
+
+func TestTemplateWantsListUnsubscribe(t *testing.T) {
+	assert.True(t, (&typesend_schemas.TypeSendTemplate{}).WantsListUnsubscribe())
+	assert.True(t, (&typesend_schemas.TypeSendTemplate{OmitListUnsubscribe: true}).WantsListUnsubscribe(), "only transactional templates may opt out")
+	assert.True(t, (&typesend_schemas.TypeSendTemplate{Transactional: true}).WantsListUnsubscribe())
+	assert.False(t, (&typesend_schemas.TypeSendTemplate{Transactional: true, OmitListUnsubscribe: true}).WantsListUnsubscribe())
+}
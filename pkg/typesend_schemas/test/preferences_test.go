@@ -0,0 +1,31 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryValidate(t *testing.T) {
+	category := &typesend_schemas.TypeSendCategory{ID: "billing", Name: "Billing"}
+	assert.NoError(t, category.Validate())
+
+	category.Name = ""
+	assert.Error(t, category.Validate(), "a name is required")
+}
+
+func TestPreferencesBlocks(t *testing.T) {
+	categories := []*typesend_schemas.TypeSendCategory{
+		{ID: "newsletter", Name: "Newsletter"},
+		{ID: "billing", Name: "Billing"},
+		{ID: "security", Name: "Security alerts", Mandatory: true},
+	}
+	preferences := &typesend_schemas.TypeSendPreferences{OptedOut: []string{"newsletter", "security", "retired"}}
+
+	assert.True(t, preferences.Blocks("newsletter", categories))
+	assert.False(t, preferences.Blocks("billing", categories), "not opted out")
+	assert.False(t, preferences.Blocks("security", categories), "mandatory categories always send")
+	assert.False(t, preferences.Blocks("", categories), "uncategorized mail always sends")
+	assert.True(t, preferences.Blocks("retired", categories), "unregistered categories are optional")
+}
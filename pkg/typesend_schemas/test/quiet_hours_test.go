@@ -0,0 +1,59 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuietHoursValidate(t *testing.T) {
+	assert.NoError(t, typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:30"}.Validate())
+	assert.Error(t, typesend_schemas.TypeSendQuietHours{Start: "10pm", End: "07:30"}.Validate())
+	assert.Error(t, typesend_schemas.TypeSendQuietHours{Start: "22:00"}.Validate())
+}
+
+func TestQuietHoursNextAllowed(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	overnight := typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:30"}
+
+	// 23:15 in New York (EST, UTC-5) is inside the window and ends at 07:30 the next day.
+	at := time.Date(2024, 1, 10, 4, 15, 0, 0, time.UTC)
+	allowed, err := overnight.NextAllowed(at, newYork)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC), allowed)
+
+	// 03:00 local is still inside the window, which ends later the same day.
+	at = time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+	allowed, err = overnight.NextAllowed(at, newYork)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 10, 12, 30, 0, 0, time.UTC), allowed)
+
+	// 12:00 local is outside the window.
+	at = time.Date(2024, 1, 10, 17, 0, 0, 0, time.UTC)
+	allowed, err = overnight.NextAllowed(at, newYork)
+	assert.NoError(t, err)
+	assert.Equal(t, at, allowed)
+
+	// Same day windows.
+	lunch := typesend_schemas.TypeSendQuietHours{Start: "12:00", End: "13:00"}
+	allowed, err = lunch.NextAllowed(time.Date(2024, 1, 10, 12, 59, 0, 0, time.UTC), time.UTC)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 10, 13, 0, 0, 0, time.UTC), allowed)
+}
+
+func TestQuietHoursNextAllowedAcrossDST(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	overnight := typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"}
+
+	// 23:00 EST on March 9th 2024; clocks spring forward overnight,
+	// so 07:00 the next morning is EDT (UTC-4).
+	allowed, err := overnight.NextAllowed(time.Date(2024, 3, 10, 4, 0, 0, 0, time.UTC), newYork)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC), allowed)
+}
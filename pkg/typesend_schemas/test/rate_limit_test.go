@@ -0,0 +1,42 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	limits, err := typesend_schemas.ParseRateLimits(`[
+		{"scope": "tenant", "limit": 1000, "window": "1h"},
+		{"scope": "template", "match": "weekly-digest", "limit": 50, "window": "1m"}
+	]`)
+	assert.NoError(t, err)
+	assert.Len(t, limits, 2)
+
+	assert.Equal(t, typesend_schemas.TypeSendRateLimitScope_TENANT, limits[0].Scope)
+	assert.Equal(t, 1000, limits[0].Limit)
+	assert.Equal(t, time.Hour, limits[0].Window)
+
+	assert.Equal(t, "weekly-digest", limits[1].Match)
+	assert.Equal(t, time.Minute, limits[1].Window)
+}
+
+func TestParseRateLimitsEmpty(t *testing.T) {
+	limits, err := typesend_schemas.ParseRateLimits("")
+	assert.NoError(t, err)
+	assert.Nil(t, limits)
+}
+
+func TestParseRateLimitsInvalid(t *testing.T) {
+	_, err := typesend_schemas.ParseRateLimits(`[{"scope": "planet", "limit": 1, "window": "1m"}]`)
+	assert.Error(t, err, "unknown scopes should be rejected")
+
+	_, err = typesend_schemas.ParseRateLimits(`[{"scope": "app", "limit": 0, "window": "1m"}]`)
+	assert.Error(t, err, "limits must be positive")
+
+	_, err = typesend_schemas.ParseRateLimits(`[{"scope": "app", "limit": 1, "window": "soon"}]`)
+	assert.Error(t, err, "windows must be durations")
+}
@@ -0,0 +1,100 @@
+package typesend_schemas_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecipientValidate(t *testing.T) {
+	assert.Error(t, typesend_schemas.TypeSendRecipient{}.Validate())
+	assert.NoError(t, typesend_schemas.TypeSendRecipient{ToAddress: "test@example.com"}.Validate())
+	assert.NoError(t, typesend_schemas.TypeSendRecipient{ToInternalID: "123"}.Validate())
+}
+
+func TestRecipientMatches(t *testing.T) {
+	recipient := typesend_schemas.TypeSendRecipient{ToAddress: "test@example.com", ToInternalID: "123"}
+	assert.True(t, recipient.Matches("test@example.com", "other"))
+	assert.True(t, recipient.Matches("other@example.com", "123"))
+	assert.False(t, recipient.Matches("other@example.com", "other"))
+
+	byAddress := typesend_schemas.TypeSendRecipient{ToAddress: "test@example.com"}
+	assert.False(t, byAddress.Matches("other@example.com", ""), "an unset field should not match empty values")
+}
+
+func TestHashRecipient(t *testing.T) {
+	hash := typesend_schemas.HashRecipient("test@example.com")
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, typesend_schemas.HashRecipient(" Test@Example.com "), "hashes should ignore case and spacing")
+	assert.NotEqual(t, hash, typesend_schemas.HashRecipient("other@example.com"))
+	assert.NotContains(t, hash, "test")
+}
+
+func TestErasedAddress(t *testing.T) {
+	address := typesend_schemas.ErasedAddress("test@example.com")
+	assert.Equal(t, address, typesend_schemas.ErasedAddress("test@example.com"), "pseudonyms should be stable")
+	assert.True(t, strings.HasSuffix(address, "@erased.invalid"))
+	assert.NotContains(t, address, "test@example.com")
+}
+
+func TestEnvelopeErase(t *testing.T) {
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ID:               "id",
+		ToAddress:        "test@example.com",
+		ToName:           "Test",
+		ToInternalID:     "123",
+		Variables:        map[string]interface{}{"Name": "Test"},
+		TimeZone:         "America/New_York",
+		QuietHours:       &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"},
+		ContentExpiresAt: 1,
+		ExpiresAt:        2,
+		Status:           typesend_schemas.TypeSendStatus_UNSENT,
+	}
+	envelope.Erase()
+
+	assert.Equal(t, typesend_schemas.ErasedAddress("test@example.com"), envelope.ToAddress)
+	assert.NotEmpty(t, envelope.ToInternalID)
+	assert.NotContains(t, envelope.ToInternalID, "123")
+	assert.Empty(t, envelope.ToName)
+	assert.Nil(t, envelope.Variables)
+	assert.Empty(t, envelope.TimeZone)
+	assert.Nil(t, envelope.QuietHours)
+	assert.Zero(t, envelope.ContentExpiresAt)
+	assert.Equal(t, int64(2), envelope.ExpiresAt)
+	assert.Equal(t, typesend_schemas.TypeSendStatus_FAILED, envelope.Status, "erased envelopes must never be sent")
+
+	sent := &typesend_schemas.TypeSendEnvelope{ToAddress: "test@example.com", Status: typesend_schemas.TypeSendStatus_SENT}
+	sent.Erase()
+	assert.Equal(t, typesend_schemas.TypeSendStatus_SENT, sent.Status)
+	assert.Empty(t, sent.ToInternalID, "an empty internal ID should stay empty")
+}
+
+func TestNewTombstones(t *testing.T) {
+	erasedAt := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tombstones := typesend_schemas.NewTombstones(erasedAt, "test@example.com", "", "TEST@example.com", "123")
+	if assert.Len(t, tombstones, 2, "empty and repeated values should be skipped") {
+		assert.Equal(t, typesend_schemas.HashRecipient("test@example.com"), tombstones[0].Hash)
+		assert.Equal(t, typesend_schemas.HashRecipient("123"), tombstones[1].Hash)
+		assert.Equal(t, erasedAt, tombstones[0].ErasedAt)
+	}
+}
+
+func TestRecipientExportJSON(t *testing.T) {
+	export := &typesend_schemas.TypeSendRecipientExport{
+		Recipient: typesend_schemas.TypeSendRecipient{ToAddress: "test@example.com"},
+		Envelopes: []*typesend_schemas.TypeSendEnvelope{{ID: "id", ToAddress: "test@example.com"}},
+	}
+
+	encoded, err := json.Marshal(export)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "test@example.com", decoded["recipient"].(map[string]interface{})["to"])
+	assert.Len(t, decoded["envelopes"], 1)
+}
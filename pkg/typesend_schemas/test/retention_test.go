@@ -0,0 +1,125 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetention(t *testing.T) {
+	policies, err := typesend_schemas.ParseRetention(`[
+		{"content": "720h", "record": "8760h"},
+		{"app": "billing", "tenant": "acme", "record": "24h"}
+	]`)
+	assert.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	assert.Equal(t, 720*time.Hour, policies[0].Content)
+	assert.Equal(t, 8760*time.Hour, policies[0].Record)
+
+	assert.Equal(t, "billing", policies[1].AppID)
+	assert.Equal(t, "acme", policies[1].TenantID)
+	assert.Equal(t, time.Duration(0), policies[1].Content)
+	assert.Equal(t, 24*time.Hour, policies[1].Record)
+}
+
+func TestParseRetentionEmpty(t *testing.T) {
+	policies, err := typesend_schemas.ParseRetention("")
+	assert.NoError(t, err)
+	assert.Nil(t, policies)
+}
+
+func TestParseRetentionInvalid(t *testing.T) {
+	_, err := typesend_schemas.ParseRetention(`[{"content": "soon"}]`)
+	assert.Error(t, err, "durations should be validated")
+
+	_, err = typesend_schemas.ParseRetention(`[{"app": "billing"}]`)
+	assert.Error(t, err, "a policy must expire something")
+
+	_, err = typesend_schemas.ParseRetention(`[{"content": "48h", "record": "24h"}]`)
+	assert.Error(t, err, "content must not outlive the record")
+
+	_, err = typesend_schemas.ParseRetention(`[{"record": "-1h"}]`)
+	assert.Error(t, err, "durations must not be negative")
+}
+
+func TestResolveRetention(t *testing.T) {
+	policies := []typesend_schemas.TypeSendRetention{
+		{Record: time.Hour},
+		{TenantID: "acme", Record: 2 * time.Hour},
+		{AppID: "billing", Record: 3 * time.Hour},
+		{AppID: "billing", TenantID: "acme", Record: 4 * time.Hour},
+	}
+
+	assert.Equal(t, time.Hour, typesend_schemas.ResolveRetention(policies, "other", "other").Record)
+	assert.Equal(t, 2*time.Hour, typesend_schemas.ResolveRetention(policies, "other", "acme").Record, "tenant policies beat app policies")
+	assert.Equal(t, 3*time.Hour, typesend_schemas.ResolveRetention(policies, "billing", "other").Record)
+	assert.Equal(t, 4*time.Hour, typesend_schemas.ResolveRetention(policies, "billing", "acme").Record)
+
+	assert.Nil(t, typesend_schemas.ResolveRetention(policies[1:], "other", "other"), "no match keeps envelopes forever")
+}
+
+func TestApplyRetention(t *testing.T) {
+	scheduledFor := time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	envelope := &typesend_schemas.TypeSendEnvelope{AppID: "billing", ScheduledFor: scheduledFor}
+	typesend_schemas.ApplyRetention([]typesend_schemas.TypeSendRetention{
+		{AppID: "billing", Content: 24 * time.Hour, Record: 48 * time.Hour},
+	}, envelope)
+	assert.Equal(t, scheduledFor.Add(24*time.Hour).Unix(), envelope.ContentExpiresAt)
+	assert.Equal(t, scheduledFor.Add(48*time.Hour).Unix(), envelope.ExpiresAt)
+
+	kept := &typesend_schemas.TypeSendEnvelope{AppID: "other", ScheduledFor: scheduledFor}
+	typesend_schemas.ApplyRetention([]typesend_schemas.TypeSendRetention{
+		{AppID: "billing", Record: time.Hour},
+	}, kept)
+	assert.Zero(t, kept.ContentExpiresAt)
+	assert.Zero(t, kept.ExpiresAt)
+}
+
+func TestStripContent(t *testing.T) {
+	envelope := &typesend_schemas.TypeSendEnvelope{
+		ID:               "id",
+		ToAddress:        "test@example.com",
+		ToName:           "Test",
+		Variables:        map[string]interface{}{"Name": "Test"},
+		DigestOf:         []string{"a"},
+		QuietHours:       &typesend_schemas.TypeSendQuietHours{Start: "22:00", End: "07:00"},
+		ContentExpiresAt: 1,
+		ExpiresAt:        2,
+	}
+	envelope.StripContent()
+
+	assert.Nil(t, envelope.Variables)
+	assert.Empty(t, envelope.ToName)
+	assert.Nil(t, envelope.DigestOf)
+	assert.Nil(t, envelope.QuietHours)
+	assert.Zero(t, envelope.ContentExpiresAt)
+	assert.Equal(t, int64(2), envelope.ExpiresAt, "the record itself should still expire")
+	assert.Equal(t, "test@example.com", envelope.ToAddress, "the audit record should remain")
+}
+
+func TestDeferReappliesRetention(t *testing.T) {
+	policies := []typesend_schemas.TypeSendRetention{{Content: time.Hour, Record: 24 * time.Hour}}
+	scheduledFor := time.Date(2025, 1, 1, 22, 0, 0, 0, time.UTC)
+	until := scheduledFor.Add(10 * time.Hour)
+
+	envelope := &typesend_schemas.TypeSendEnvelope{ScheduledFor: scheduledFor}
+	typesend_schemas.ApplyRetention(policies, envelope)
+	envelope.Defer(until)
+
+	expected := &typesend_schemas.TypeSendEnvelope{ScheduledFor: until}
+	typesend_schemas.ApplyRetention(policies, expected)
+
+	assert.Equal(t, until, envelope.ScheduledFor)
+	assert.Equal(t, scheduledFor, envelope.OriginalScheduledFor)
+	assert.Equal(t, expected.ContentExpiresAt, envelope.ContentExpiresAt, "expiry times should run from the new time")
+	assert.Equal(t, expected.ExpiresAt, envelope.ExpiresAt)
+
+	unretained := &typesend_schemas.TypeSendEnvelope{ScheduledFor: scheduledFor}
+	unretained.Defer(until)
+	assert.Zero(t, unretained.ContentExpiresAt, "envelopes without retention should still never expire")
+	assert.Zero(t, unretained.ExpiresAt)
+}
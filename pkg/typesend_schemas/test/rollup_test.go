@@ -0,0 +1,57 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRollupDay(t *testing.T) {
+	eastern := time.FixedZone("EST", -5*60*60)
+	at := time.Date(2024, 3, 1, 21, 30, 0, 0, eastern)
+
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), typesend_schemas.RollupDay(at), "days are in UTC")
+}
+
+func TestRollupValidate(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	rollup := &typesend_schemas.TypeSendRollup{AppID: "app", Day: day}
+	assert.NoError(t, rollup.Validate())
+
+	rollup.Day = day.Add(time.Hour)
+	assert.Error(t, rollup.Validate(), "the day must be midnight")
+
+	rollup.Day = day
+	rollup.AppID = ""
+	assert.Error(t, rollup.Validate(), "an app is required")
+}
+
+func TestRollupQueryMatches(t *testing.T) {
+	from := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	query := typesend_schemas.TypeSendRollupQuery{AppID: "app", TenantID: "tenant", From: from, To: from.AddDate(0, 0, 1)}
+	assert.NoError(t, query.Validate())
+
+	rollup := &typesend_schemas.TypeSendRollup{AppID: "app", TenantID: "tenant", TemplateID: "welcome", Day: typesend_schemas.RollupDay(from)}
+	assert.True(t, query.Matches(rollup), "From is any time in the first day")
+
+	rollup.Day = rollup.Day.AddDate(0, 0, 1)
+	assert.True(t, query.Matches(rollup), "To is inclusive")
+
+	rollup.Day = rollup.Day.AddDate(0, 0, 1)
+	assert.False(t, query.Matches(rollup))
+
+	rollup.Day = typesend_schemas.RollupDay(from)
+	rollup.TenantID = "other"
+	assert.False(t, query.Matches(rollup))
+
+	query.TenantID = ""
+	assert.True(t, query.Matches(rollup), "an empty tenant matches every tenant")
+
+	query.TemplateID = "reset"
+	assert.False(t, query.Matches(rollup))
+
+	query.To = from.AddDate(0, 0, -1)
+	assert.Error(t, query.Validate(), "To must not be before From")
+}
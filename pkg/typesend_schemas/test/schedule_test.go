@@ -0,0 +1,55 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurrenceValidate(t *testing.T) {
+	assert.Error(t, typesend_schemas.TypeSendRecurrence{}.Validate(), "a recurrence needs a rule")
+	assert.Error(t, typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * *", RRule: "FREQ=DAILY"}.Validate(), "only one rule may be set")
+	assert.Error(t, typesend_schemas.TypeSendRecurrence{Cron: "every tuesday"}.Validate())
+	assert.Error(t, typesend_schemas.TypeSendRecurrence{RRule: "FREQ=SOMETIMES"}.Validate())
+	assert.Error(t, typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * *", TimeZone: "Mars/Olympus"}.Validate())
+
+	assert.NoError(t, typesend_schemas.TypeSendRecurrence{Cron: "0 9 * * MON", TimeZone: "America/New_York"}.Validate())
+	assert.NoError(t, typesend_schemas.TypeSendRecurrence{RRule: "FREQ=MONTHLY;BYMONTHDAY=1"}.Validate())
+}
+
+func TestRecurrenceNextCronTimeZone(t *testing.T) {
+	recurrence := typesend_schemas.TypeSendRecurrence{
+		Cron:     "0 9 * * MON",
+		TimeZone: "America/New_York",
+	}
+
+	// Wednesday, January 3rd 2024.
+	next, err := recurrence.Next(time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC))
+	assert.NoError(t, err)
+	// 9am EST on Monday is 14:00 UTC.
+	assert.Equal(t, time.Date(2024, 1, 8, 14, 0, 0, 0, time.UTC), next)
+	assert.Equal(t, time.UTC, next.Location())
+}
+
+func TestRecurrenceNextRRule(t *testing.T) {
+	recurrence := typesend_schemas.TypeSendRecurrence{
+		RRule:    "FREQ=MONTHLY;BYMONTHDAY=1;BYHOUR=8;BYMINUTE=0;BYSECOND=0;COUNT=2",
+		TimeZone: "Europe/London",
+		Start:    time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	next, err := recurrence.Next(recurrence.Start)
+	assert.NoError(t, err)
+	// 8am BST is 07:00 UTC.
+	assert.Equal(t, time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC), next)
+
+	next, err = recurrence.Next(next)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 7, 1, 7, 0, 0, 0, time.UTC), next)
+
+	next, err = recurrence.Next(next)
+	assert.NoError(t, err)
+	assert.True(t, next.IsZero(), "no occurrences should remain after COUNT")
+}
@@ -0,0 +1,54 @@
+package typesend_schemas_test
+
+import (
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressionValidate(t *testing.T) {
+	suppression := &typesend_schemas.TypeSendSuppression{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		Reason:   typesend_schemas.TypeSendSuppressionReason_MANUAL,
+	}
+	assert.NoError(t, suppression.Validate())
+
+	suppression.Reason = 0
+	assert.Error(t, suppression.Validate(), "a reason is required")
+
+	suppression.Reason = typesend_schemas.TypeSendSuppressionReason_MANUAL
+	suppression.Address = ""
+	assert.Error(t, suppression.Validate())
+}
+
+func TestSuppressionBlocks(t *testing.T) {
+	for _, test := range []struct {
+		reason        typesend_schemas.TypeSendSuppressionReason
+		transactional bool
+	}{
+		{typesend_schemas.TypeSendSuppressionReason_BOUNCED, true},
+		{typesend_schemas.TypeSendSuppressionReason_COMPLAINED, true},
+		{typesend_schemas.TypeSendSuppressionReason_MANUAL, true},
+	} {
+		suppression := &typesend_schemas.TypeSendSuppression{Reason: test.reason}
+		assert.True(t, suppression.Blocks(false), "%s should block marketing", test.reason)
+		assert.Equal(t, test.transactional, suppression.Blocks(true), "%s transactional", test.reason)
+	}
+
+	unsubscribed := &typesend_schemas.TypeSendSuppression{Reason: typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED}
+	assert.True(t, unsubscribed.Blocks(false))
+	assert.False(t, unsubscribed.Blocks(true), "transactional mail should still reach unsubscribed recipients")
+}
+
+func TestSuppressionReasonString(t *testing.T) {
+	assert.Equal(t, "unsubscribed", typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED.String())
+	assert.Equal(t, "complained", typesend_schemas.TypeSendSuppressionReason_COMPLAINED.String())
+	assert.Equal(t, "unknown(9)", typesend_schemas.TypeSendSuppressionReason(9).String())
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	assert.Equal(t, "test@example.com", typesend_schemas.NormalizeAddress(" Test@Example.COM "))
+}
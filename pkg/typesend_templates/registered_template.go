@@ -15,6 +15,26 @@ type RegisteredTemplate struct {
 
 	BootstrapBody    string
 	BootstrapSubject string
+
+	// Marks the bootstrapped template as transactional.
+	Transactional bool
+	// Drops List-Unsubscribe from the bootstrapped template; only
+	// honoured when Transactional is set.
+	OmitListUnsubscribe bool
+	// Optional category of the bootstrapped template.
+	Category string
+	// Marks the bootstrapped template as sensitive, so it is never tracked.
+	Sensitive bool
+	// Tracks the bootstrapped template; only needed when
+	// Transactional is set, as they aren't tracked by default.
+	EnableTracking bool
+	// Opt the bootstrapped template out of open or click tracking.
+	DisableOpenTracking  bool
+	DisableClickTracking bool
+	// Default priority of the bootstrapped template.
+	Priority typesend_schemas.TypeSendPriority
+	// Default digest window of the bootstrapped template.
+	DigestWindow time.Duration
 }
 
 var registeredTemplates = make(map[string]*RegisteredTemplate)
@@ -35,12 +55,21 @@ func RegisterTemplate(db typesend_db.TypeSendDatabase, UIGroup string, t *Regist
 
 	if template == nil {
 		baseTemplate := &typesend_schemas.TypeSendTemplate{
-			TemplateID:  t.Variables.GetTemplateID(),
-			TenantID:    "base",
-			Content:     t.BootstrapBody,
-			Subject:     t.BootstrapSubject,
-			FromAddress: t.FromAddress,
-			FromName:    t.FromName,
+			TemplateID:           t.Variables.GetTemplateID(),
+			TenantID:             "base",
+			Content:              t.BootstrapBody,
+			Subject:              t.BootstrapSubject,
+			FromAddress:          t.FromAddress,
+			FromName:             t.FromName,
+			Transactional:        t.Transactional,
+			OmitListUnsubscribe:  t.OmitListUnsubscribe,
+			Category:             t.Category,
+			Sensitive:            t.Sensitive,
+			EnableTracking:       t.EnableTracking,
+			DisableOpenTracking:  t.DisableOpenTracking,
+			DisableClickTracking: t.DisableClickTracking,
+			Priority:             t.Priority,
+			DigestWindow:         t.DigestWindow,
 		}
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
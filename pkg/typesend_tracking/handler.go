@@ -0,0 +1,77 @@
+package typesend_tracking
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_events"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// A transparent 1x1 GIF.
+var pixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff\x21\xf9\x04\x01\x00\x00\x00\x00\x2c\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02\x44\x01\x00\x3b")
+
+// Handler serves tracking links, which carry a signed token in their
+// "token" query parameter. Opens are served a transparent pixel and
+// clicks are redirected to the tokens URL, once the event is added
+// to the envelopes timeline. Failing to record never breaks a link.
+//
+// It is an http.Handler, so can be mounted in any mux; see
+// HandleFunctionURL to run it as a Lambda function URL.
+type Handler struct {
+	Database typesend_db.TypeSendDatabase
+	Signer   *Signer
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Tokens are in the URL, so must not leak into caches or referrers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token, err := h.Signer.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "invalid link", http.StatusBadRequest)
+		return
+	}
+
+	// HEAD requests come from link checkers, not recipients.
+	if r.Method == http.MethodGet {
+		h.record(r, token)
+	}
+
+	if token.URL != "" {
+		http.Redirect(w, r, token.URL, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Write(pixel)
+}
+
+func (h *Handler) record(r *http.Request, token *Token) {
+	event := &typesend_schemas.TypeSendEvent{
+		EnvelopeID: token.EnvelopeID,
+		ID:         uuid.NewString(),
+		AppID:      token.AppID,
+		TenantID:   token.TenantID,
+		TemplateID: token.TemplateID,
+		Type:       typesend_schemas.TypeSendEventType_OPENED,
+		OccurredAt: time.Now().UTC(),
+	}
+	if token.URL != "" {
+		event.Type = typesend_schemas.TypeSendEventType_CLICKED
+		event.Details = map[string]string{"url": token.URL}
+	}
+	typesend_events.Append(r.Context(), h.Database, h.Logger, event)
+}
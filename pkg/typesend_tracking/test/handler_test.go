@@ -0,0 +1,129 @@
+package typesend_tracking_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"image/gif"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHandler(t *testing.T) (*typesend_tracking.Handler, *typesend_db.TestDatabase) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+	return &typesend_tracking.Handler{Database: db, Signer: newSigner(t)}, db
+}
+
+func signedQuery(t *testing.T, target string) string {
+	signed, err := newSigner(t).Sign(typesend_tracking.Token{AppID: "app", TenantID: "base", EnvelopeID: "envelope", TemplateID: "welcome", URL: target})
+	assert.NoError(t, err)
+	return "/?token=" + url.QueryEscape(signed)
+}
+
+func timeline(t *testing.T, db *typesend_db.TestDatabase) []*typesend_schemas.TypeSendEvent {
+	events, err := db.GetEnvelopeTimeline(context.Background(), "envelope")
+	assert.NoError(t, err)
+	return events
+}
+
+func TestHandlerOpen(t *testing.T) {
+	handler, db := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, signedQuery(t, ""), nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/gif", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	_, err := gif.Decode(bytes.NewReader(w.Body.Bytes()))
+	assert.NoError(t, err)
+
+	events := timeline(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_OPENED, events[0].Type)
+		assert.Equal(t, "app", events[0].AppID)
+		assert.Equal(t, "base", events[0].TenantID)
+		assert.Equal(t, "welcome", events[0].TemplateID)
+	}
+}
+
+func TestHandlerClick(t *testing.T) {
+	handler, db := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, signedQuery(t, "https://example.com/?a=1&b=2"), nil))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/?a=1&b=2", w.Header().Get("Location"))
+
+	events := timeline(t, db)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, typesend_schemas.TypeSendEventType_CLICKED, events[0].Type)
+		assert.Equal(t, map[string]string{"url": "https://example.com/?a=1&b=2"}, events[0].Details)
+	}
+
+	// Every click is recorded.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, signedQuery(t, "https://example.com/"), nil))
+	assert.Len(t, timeline(t, db), 2)
+}
+
+func TestHandlerHeadDoesNotRecord(t *testing.T) {
+	handler, db := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodHead, signedQuery(t, "https://example.com/"), nil))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Empty(t, timeline(t, db))
+}
+
+func TestHandlerRejectsInvalidTokens(t *testing.T) {
+	handler, db := newHandler(t)
+
+	other, err := typesend_tracking.NewSigner(secret("b"))
+	assert.NoError(t, err)
+	forged, err := other.Sign(typesend_tracking.Token{AppID: "app", TenantID: "base", EnvelopeID: "envelope", URL: "https://attacker.example.com/"})
+	assert.NoError(t, err)
+
+	for _, target := range []string{"/", "/?token=garbage", "/?token=" + url.QueryEscape(forged)} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.Empty(t, w.Header().Get("Location"), "only signed URLs are redirected to")
+	}
+	assert.Empty(t, timeline(t, db))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, signedQuery(t, ""), nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestHandlerFunctionURL(t *testing.T) {
+	handler, _ := newHandler(t)
+
+	query := signedQuery(t, "")
+	response, err := handler.HandleFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath:        "/",
+		RawQueryString: query[2:],
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodGet},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.True(t, response.IsBase64Encoded, "the pixel is binary")
+
+	decoded, err := base64.StdEncoding.DecodeString(response.Body)
+	assert.NoError(t, err)
+	_, err = gif.Decode(bytes.NewReader(decoded))
+	assert.NoError(t, err)
+}
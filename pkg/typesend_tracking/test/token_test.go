@@ -0,0 +1,56 @@
+package typesend_tracking_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/stretchr/testify/assert"
+)
+
+func secret(fill string) []byte {
+	return []byte(strings.Repeat(fill, typesend_tracking.MinSecretSize))
+}
+
+func newSigner(t *testing.T) *typesend_tracking.Signer {
+	signer, err := typesend_tracking.NewSigner(secret("a"))
+	assert.NoError(t, err)
+	return signer
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := newSigner(t)
+
+	token := typesend_tracking.Token{AppID: "app", TenantID: "base", EnvelopeID: "envelope", URL: "https://example.com/?a=1&b=2"}
+	signed, err := signer.Sign(token)
+	assert.NoError(t, err)
+
+	verified, err := signer.Verify(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, &token, verified)
+
+	other, err := typesend_tracking.NewSigner(secret("b"))
+	assert.NoError(t, err)
+	_, err = other.Verify(signed)
+	assert.Error(t, err, "tokens should only verify with the secret that signed them")
+}
+
+func TestSignRejectsInvalidTokens(t *testing.T) {
+	signer := newSigner(t)
+
+	_, err := signer.Sign(typesend_tracking.Token{AppID: "app", TenantID: "base"})
+	assert.Error(t, err, "an envelope is required")
+
+	for _, target := range []string{"javascript:alert(1)", "mailto:test@example.com", "/relative"} {
+		_, err = signer.Sign(typesend_tracking.Token{AppID: "app", TenantID: "base", EnvelopeID: "envelope", URL: target})
+		assert.Error(t, err, target)
+	}
+}
+
+func TestNewSignerRejectsShortSecrets(t *testing.T) {
+	_, err := typesend_tracking.NewSigner([]byte("short"))
+	assert.Error(t, err)
+
+	_, err = typesend_tracking.ParseSecrets("")
+	assert.Error(t, err)
+}
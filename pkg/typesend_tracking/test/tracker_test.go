@@ -0,0 +1,129 @@
+package typesend_tracking_test
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_tracking"
+	"github.com/stretchr/testify/assert"
+)
+
+const trackingURL = "https://track.example.com/"
+
+var hrefs = regexp.MustCompile(`(?i)(?:href|src)="([^"]*)"`)
+
+func newTracker(t *testing.T) *typesend_tracking.Tracker {
+	tracker, err := typesend_tracking.NewTracker(newSigner(t), trackingURL)
+	assert.NoError(t, err)
+	return tracker
+}
+
+func testEnvelope() *typesend_schemas.TypeSendEnvelope {
+	return &typesend_schemas.TypeSendEnvelope{ID: "envelope", AppID: "app", TenantID: "base", TemplateID: "welcome", ToAddress: "test@example.com"}
+}
+
+// tokens returns the token of every tracking link in content.
+func tokens(t *testing.T, content string) []*typesend_tracking.Token {
+	var found []*typesend_tracking.Token
+	for _, match := range hrefs.FindAllStringSubmatch(content, -1) {
+		link, err := url.Parse(html.UnescapeString(match[1]))
+		assert.NoError(t, err)
+		if link.Host != "track.example.com" {
+			continue
+		}
+		token, err := newSigner(t).Verify(link.Query().Get("token"))
+		assert.NoError(t, err)
+		found = append(found, token)
+	}
+	return found
+}
+
+func TestNewTrackerRequiresHTTPS(t *testing.T) {
+	_, err := typesend_tracking.NewTracker(newSigner(t), "http://track.example.com/")
+	assert.Error(t, err)
+	_, err = typesend_tracking.NewTracker(newSigner(t), "/track")
+	assert.Error(t, err)
+}
+
+func TestApplyTracksLinksAndOpens(t *testing.T) {
+	template := &typesend_schemas.TypeSendTemplate{
+		Content: `<html><body>` +
+			`<a href="https://example.com/?a=1&amp;b=2">One</a>` +
+			`<A class="button" HREF='http://example.com/two'>Two</A>` +
+			`<a href="mailto:help@example.com">Mail</a>` +
+			`<a href="#top">Top</a>` +
+			`<a href="https://unsubscribe.example.com/?token=x">Unsubscribe</a>` +
+			`</body></html>`,
+	}
+
+	assert.NoError(t, newTracker(t).Apply(testEnvelope(), template, "https://unsubscribe.example.com/"))
+
+	found := tokens(t, template.Content)
+	if assert.Len(t, found, 3) {
+		assert.Equal(t, "https://example.com/?a=1&b=2", found[0].URL, "escaped links should be unescaped")
+		assert.Equal(t, "http://example.com/two", found[1].URL)
+		assert.Equal(t, "", found[2].URL, "the pixel should be last")
+		for _, token := range found {
+			assert.Equal(t, "envelope", token.EnvelopeID)
+			assert.Equal(t, "app", token.AppID)
+			assert.Equal(t, "base", token.TenantID)
+			assert.Equal(t, "welcome", token.TemplateID)
+		}
+	}
+
+	assert.Contains(t, template.Content, `class="button"`, "other attributes are kept")
+	assert.Contains(t, template.Content, `href="mailto:help@example.com"`)
+	assert.Contains(t, template.Content, `href="#top"`)
+	assert.Contains(t, template.Content, `href="https://unsubscribe.example.com/?token=x"`, "untracked links are left alone")
+	assert.Regexp(t, `<img [^>]*/></body></html>$`, template.Content, "the pixel goes at the end of the body")
+}
+
+func TestApplyWithoutBody(t *testing.T) {
+	template := &typesend_schemas.TypeSendTemplate{Content: `Hello`}
+
+	assert.NoError(t, newTracker(t).Apply(testEnvelope(), template))
+	assert.Regexp(t, `^Hello<img `, template.Content)
+	assert.Len(t, tokens(t, template.Content), 1)
+}
+
+func TestApplyHonoursTemplate(t *testing.T) {
+	content := `<body><a href="https://example.com/reset?token=secret">Reset</a></body>`
+
+	for _, test := range []struct {
+		name   string
+		tmpl   typesend_schemas.TypeSendTemplate
+		links  int
+		pixels int
+	}{
+		{"Sensitive", typesend_schemas.TypeSendTemplate{Sensitive: true}, 0, 0},
+		{"NoOpens", typesend_schemas.TypeSendTemplate{DisableOpenTracking: true}, 1, 0},
+		{"NoClicks", typesend_schemas.TypeSendTemplate{DisableClickTracking: true}, 0, 1},
+		{"Transactional", typesend_schemas.TypeSendTemplate{Transactional: true}, 0, 0},
+		{"TransactionalEnabled", typesend_schemas.TypeSendTemplate{Transactional: true, EnableTracking: true}, 1, 1},
+		{"TransactionalNoOpens", typesend_schemas.TypeSendTemplate{Transactional: true, EnableTracking: true, DisableOpenTracking: true}, 1, 0},
+		{"SensitiveEnabled", typesend_schemas.TypeSendTemplate{Transactional: true, EnableTracking: true, Sensitive: true}, 0, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			template := test.tmpl
+			template.Content = content
+			assert.NoError(t, newTracker(t).Apply(testEnvelope(), &template))
+
+			links, pixels := 0, 0
+			for _, token := range tokens(t, template.Content) {
+				if token.URL == "" {
+					pixels++
+				} else {
+					links++
+				}
+			}
+			assert.Equal(t, test.links, links)
+			assert.Equal(t, test.pixels, pixels)
+			if test.links == 0 {
+				assert.Contains(t, template.Content, `href="https://example.com/reset?token=secret"`)
+			}
+		})
+	}
+}
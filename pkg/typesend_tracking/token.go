@@ -0,0 +1,87 @@
+package typesend_tracking
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/kvizdos/typesend/internal/signing"
+)
+
+// Token is what a tracking link carries. A token with a URL is a
+// click, redirecting there; one without is an open.
+type Token struct {
+	AppID      string `json:"app"`
+	TenantID   string `json:"tenant"`
+	EnvelopeID string `json:"envelope"`
+	// Optional; carried through to the events for analytics.
+	TemplateID string `json:"template,omitempty"`
+	// Optional; where the click goes.
+	URL string `json:"url,omitempty"`
+}
+
+func (t *Token) Validate() error {
+	if t.AppID == "" || t.TenantID == "" || t.EnvelopeID == "" {
+		return fmt.Errorf("typesend: tracking token needs an AppID, TenantID and EnvelopeID")
+	}
+	if t.URL != "" && !trackableURL(t.URL) {
+		return fmt.Errorf("typesend: tracking token URL must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+func trackableURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// Secrets shorter than this are rejected.
+const MinSecretSize = signing.MinSecretSize
+
+// Signer signs and verifies tokens with HMAC-SHA256. Its secrets
+// should differ from the unsubscribe secrets.
+type Signer struct {
+	// Secrets[0] signs; all of them verify, so a secret can be
+	// rotated without breaking links already sent.
+	Secrets [][]byte
+}
+
+func NewSigner(secrets ...[]byte) (*Signer, error) {
+	if err := signing.CheckSecrets("tracking", secrets); err != nil {
+		return nil, err
+	}
+	return &Signer{Secrets: secrets}, nil
+}
+
+// ParseSecrets reads a comma separated list of base64 secrets,
+// newest first, such as TYPESEND_TRACKING_SECRETS.
+func ParseSecrets(raw string) (*Signer, error) {
+	secrets, err := signing.ParseSecrets("tracking", raw)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(secrets...)
+}
+
+// Sign returns the token as "<payload>.<signature>", both URL safe
+// base64, ready to be put in a query string.
+func (s *Signer) Sign(token Token) (string, error) {
+	if err := token.Validate(); err != nil {
+		return "", err
+	}
+	return signing.Sign(s.Secrets[0], "tracking token", token)
+}
+
+// Verify returns the token Sign signed, if any of the Secrets signed it.
+func (s *Signer) Verify(signed string) (*Token, error) {
+	var token Token
+	if err := signing.Verify(s.Secrets, "tracking token", signed, &token); err != nil {
+		return nil, err
+	}
+	if err := token.Validate(); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
@@ -0,0 +1,130 @@
+package typesend_tracking
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+var (
+	anchorTag = regexp.MustCompile(`(?i)<a\s[^>]*>`)
+	hrefAttr  = regexp.MustCompile(`(?i)(\shref\s*=\s*)("[^"]*"|'[^']*')`)
+)
+
+// Tracker adds open and click tracking to filled templates.
+type Tracker struct {
+	Signer *Signer
+	// Where the Handler is served, e.g. "https://track.example.com/".
+	BaseURL *url.URL
+}
+
+// NewTracker requires an absolute https baseURL.
+func NewTracker(signer *Signer, baseURL string) (*Tracker, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid tracking URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("typesend: tracking URL must be an absolute https URL")
+	}
+
+	return &Tracker{Signer: signer, BaseURL: parsed}, nil
+}
+
+// Apply tracks the filled templates Content, as far as the template
+// allows: http(s) links are rewritten to redirect through the Handler,
+// and a pixel is added to record opens. Links starting with any of the
+// untracked prefixes, such as the unsubscribe page, are left as is.
+func (t *Tracker) Apply(envelope *typesend_schemas.TypeSendEnvelope, template *typesend_schemas.TypeSendTemplate, untracked ...string) error {
+	untracked = append(untracked, t.BaseURL.String())
+
+	if template.TracksClicks() {
+		content, err := t.rewriteLinks(envelope, template.Content, untracked)
+		if err != nil {
+			return err
+		}
+		template.Content = content
+	}
+
+	if template.TracksOpens() {
+		pixel, err := t.url(envelope, "")
+		if err != nil {
+			return err
+		}
+		template.Content = addPixel(template.Content, pixel)
+	}
+
+	return nil
+}
+
+func (t *Tracker) rewriteLinks(envelope *typesend_schemas.TypeSendEnvelope, content string, untracked []string) (string, error) {
+	var err error
+	rewritten := anchorTag.ReplaceAllStringFunc(content, func(tag string) string {
+		return hrefAttr.ReplaceAllStringFunc(tag, func(attr string) string {
+			if err != nil {
+				return attr
+			}
+
+			parts := hrefAttr.FindStringSubmatch(attr)
+			// Values are HTML escaped, such as & as &amp;.
+			target := strings.TrimSpace(html.UnescapeString(parts[2][1 : len(parts[2])-1]))
+			if !trackableURL(target) || hasAnyPrefix(target, untracked) {
+				return attr
+			}
+
+			var tracked string
+			tracked, err = t.url(envelope, target)
+			return parts[1] + `"` + html.EscapeString(tracked) + `"`
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return rewritten, nil
+}
+
+// url returns the envelopes tracking link, for
+// a click when target is set or else the pixel.
+func (t *Tracker) url(envelope *typesend_schemas.TypeSendEnvelope, target string) (string, error) {
+	signed, err := t.Signer.Sign(Token{
+		AppID:      envelope.AppID,
+		TenantID:   envelope.TenantID,
+		EnvelopeID: envelope.ID,
+		TemplateID: envelope.TemplateID,
+		URL:        target,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	link := *t.BaseURL
+	query := link.Query()
+	query.Set("token", signed)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// addPixel puts the pixel at the end of the body, where
+// it is fetched once the rest of the email has loaded.
+func addPixel(content string, pixel string) string {
+	img := `<img src="` + html.EscapeString(pixel) + `" width="1" height="1" alt="" style="display:block;width:1px;height:1px;border:0;" />`
+
+	end := strings.LastIndex(strings.ToLower(content), "</body")
+	if end == -1 {
+		return content + img
+	}
+	return content[:end] + img + content[end:]
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if prefix != "" && strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,393 @@
+package typesend_unsubscribe
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/kvizdos/typesend/internal"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// Handler serves unsubscribe links, which carry a signed token in
+// their "token" query parameter. GET shows a confirmation page, so
+// link scanners can't unsubscribe anyone, and POST unsubscribes.
+// Mail clients supporting RFC 8058 POST "List-Unsubscribe=One-Click"
+// to the same URL.
+//
+// A token naming one of the Apps categories unsubscribes from just
+// that category, unless it is mandatory. Links with the
+// PreferencesParameter show the preference center instead, where
+// every category can be managed.
+//
+// It is an http.Handler, so can be mounted in any mux; see
+// HandleFunctionURL to run it as a Lambda function URL.
+type Handler struct {
+	Database typesend_db.TypeSendDatabase
+	Signer   *Signer
+
+	// Optional
+	Logger typesend_schemas.Logger
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Tokens are in the URL, so must not leak into caches or referrers.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+
+	preferences := r.URL.Query().Has(PreferencesParameter)
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if preferences {
+			h.showPreferences(w, r)
+		} else {
+			h.confirm(w, r)
+		}
+	case http.MethodPost:
+		if preferences {
+			h.savePreferences(w, r)
+		} else {
+			h.unsubscribe(w, r)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// unsubscribePage is what the confirm and done pages show.
+type unsubscribePage struct {
+	Token *Token
+	// The category being unsubscribed from, or nil for everything.
+	Category *typesend_schemas.TypeSendCategory
+	// Set when the App has categories to manage.
+	PreferencesURL string
+}
+
+func (h *Handler) confirm(w http.ResponseWriter, r *http.Request) {
+	token, err := h.Signer.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		render(w, http.StatusBadRequest, invalidPage, nil)
+		return
+	}
+
+	page, err := h.unsubscribePage(r, token)
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to get categories for envelope %s: %s", token.EnvelopeID, err.Error())
+		http.Error(w, "something went wrong, please try again", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, http.StatusOK, confirmPage, page)
+}
+
+func (h *Handler) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	oneClick := r.PostFormValue("List-Unsubscribe") == "One-Click"
+
+	token, err := h.Signer.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		if oneClick {
+			http.Error(w, "invalid unsubscribe link", http.StatusBadRequest)
+		} else {
+			render(w, http.StatusBadRequest, invalidPage, nil)
+		}
+		return
+	}
+
+	page, err := h.unsubscribePage(r, token)
+	if err == nil {
+		if page.Category != nil {
+			err = h.optOut(r, token, page.Category.ID)
+		} else {
+			err = h.suppress(r, token)
+		}
+	}
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to unsubscribe from envelope %s: %s", token.EnvelopeID, err.Error())
+		http.Error(w, "failed to unsubscribe, please try again", http.StatusInternalServerError)
+		return
+	}
+
+	if oneClick {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("unsubscribed"))
+		return
+	}
+	render(w, http.StatusOK, donePage, page)
+}
+
+// unsubscribePage resolves the tokens category. Categories the App
+// doesn't have, and mandatory ones, unsubscribe from everything.
+func (h *Handler) unsubscribePage(r *http.Request, token *Token) (*unsubscribePage, error) {
+	categories, err := h.Database.GetCategories(r.Context(), token.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &unsubscribePage{Token: token}
+	if category := typesend_schemas.FindCategory(categories, token.Category); category != nil && !category.Mandatory {
+		page.Category = category
+	}
+	if len(categories) > 0 {
+		query := r.URL.Query()
+		query.Set(PreferencesParameter, "1")
+		page.PreferencesURL = "?" + query.Encode()
+	}
+	return page, nil
+}
+
+// suppress leaves any existing suppression in place, so an
+// unsubscribe never replaces a bounce or complaint.
+func (h *Handler) suppress(r *http.Request, token *Token) error {
+	existing, err := h.Database.GetSuppression(r.Context(), token.AppID, token.TenantID, token.ToAddress)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	return h.Database.PutSuppression(r.Context(), &typesend_schemas.TypeSendSuppression{
+		AppID:     token.AppID,
+		TenantID:  token.TenantID,
+		Address:   token.ToAddress,
+		Reason:    typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED,
+		Note:      "unsubscribed from envelope " + token.EnvelopeID,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// optOut adds the category to the recipients preferences.
+func (h *Handler) optOut(r *http.Request, token *Token, category string) error {
+	preferences, err := h.preferences(r, token)
+	if err != nil {
+		return err
+	}
+	if preferences.OptedOutOf(category) {
+		return nil
+	}
+
+	preferences.OptedOut = append(preferences.OptedOut, category)
+	preferences.UpdatedAt = time.Now().UTC()
+	return h.Database.PutPreferences(r.Context(), preferences)
+}
+
+// preferences returns the recipients stored preferences,
+// or empty ones when they have none.
+func (h *Handler) preferences(r *http.Request, token *Token) (*typesend_schemas.TypeSendPreferences, error) {
+	preferences, err := h.Database.GetPreferences(r.Context(), token.AppID, token.TenantID, token.ToAddress)
+	if err != nil {
+		return nil, err
+	}
+	if preferences == nil {
+		preferences = &typesend_schemas.TypeSendPreferences{
+			AppID:    token.AppID,
+			TenantID: token.TenantID,
+			Address:  token.ToAddress,
+		}
+	}
+	return preferences, nil
+}
+
+// preferencesPage is what the preference center shows.
+type preferencesPage struct {
+	Token      *Token
+	Categories []preferencesRow
+	// Unsubscribed from everything; saving resubscribes.
+	Unsubscribed bool
+	// Bounced or complained, which only an operator can lift.
+	Blocked bool
+	Saved   bool
+}
+
+type preferencesRow struct {
+	*typesend_schemas.TypeSendCategory
+	Subscribed bool
+}
+
+func (h *Handler) showPreferences(w http.ResponseWriter, r *http.Request) {
+	token, err := h.Signer.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		render(w, http.StatusBadRequest, invalidPage, nil)
+		return
+	}
+
+	page, err := h.preferencesPage(r, token)
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to get preferences for envelope %s: %s", token.EnvelopeID, err.Error())
+		http.Error(w, "something went wrong, please try again", http.StatusInternalServerError)
+		return
+	}
+
+	render(w, http.StatusOK, preferencesCenterPage, page)
+}
+
+// savePreferences opts out of every optional category not ticked,
+// and lifts an unsubscribe from everything. Submitting "all"
+// unsubscribes from everything instead.
+func (h *Handler) savePreferences(w http.ResponseWriter, r *http.Request) {
+	token, err := h.Signer.Verify(r.URL.Query().Get("token"))
+	if err != nil {
+		render(w, http.StatusBadRequest, invalidPage, nil)
+		return
+	}
+
+	if r.PostFormValue("all") != "" {
+		err = h.suppress(r, token)
+	} else {
+		err = h.updatePreferences(r, token)
+	}
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to save preferences for envelope %s: %s", token.EnvelopeID, err.Error())
+		http.Error(w, "failed to save preferences, please try again", http.StatusInternalServerError)
+		return
+	}
+
+	page, err := h.preferencesPage(r, token)
+	if err != nil {
+		internal.ProtectedErrorLogger(h.Logger, "typesend: failed to get preferences for envelope %s: %s", token.EnvelopeID, err.Error())
+		http.Error(w, "something went wrong, please try again", http.StatusInternalServerError)
+		return
+	}
+	page.Saved = true
+
+	render(w, http.StatusOK, preferencesCenterPage, page)
+}
+
+func (h *Handler) updatePreferences(r *http.Request, token *Token) error {
+	categories, err := h.Database.GetCategories(r.Context(), token.AppID)
+	if err != nil {
+		return err
+	}
+	preferences, err := h.preferences(r, token)
+	if err != nil {
+		return err
+	}
+
+	ticked := r.PostForm["category"]
+
+	// Opt outs of categories the App no longer has are kept,
+	// as they weren't shown.
+	var optedOut []string
+	for _, category := range preferences.OptedOut {
+		if typesend_schemas.FindCategory(categories, category) == nil {
+			optedOut = append(optedOut, category)
+		}
+	}
+	for _, category := range categories {
+		if !category.Mandatory && !slices.Contains(ticked, category.ID) {
+			optedOut = append(optedOut, category.ID)
+		}
+	}
+
+	preferences.OptedOut = optedOut
+	preferences.UpdatedAt = time.Now().UTC()
+	if err := h.Database.PutPreferences(r.Context(), preferences); err != nil {
+		return err
+	}
+
+	suppression, err := h.Database.GetSuppression(r.Context(), token.AppID, token.TenantID, token.ToAddress)
+	if err != nil {
+		return err
+	}
+	if suppression != nil && suppression.Reason == typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED {
+		return h.Database.DeleteSuppression(r.Context(), token.AppID, token.TenantID, token.ToAddress)
+	}
+	return nil
+}
+
+func (h *Handler) preferencesPage(r *http.Request, token *Token) (*preferencesPage, error) {
+	categories, err := h.Database.GetCategories(r.Context(), token.AppID)
+	if err != nil {
+		return nil, err
+	}
+	preferences, err := h.preferences(r, token)
+	if err != nil {
+		return nil, err
+	}
+	suppression, err := h.Database.GetSuppression(r.Context(), token.AppID, token.TenantID, token.ToAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &preferencesPage{Token: token}
+	if suppression != nil {
+		page.Unsubscribed = suppression.Reason == typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED
+		page.Blocked = !page.Unsubscribed
+	}
+	for _, category := range categories {
+		page.Categories = append(page.Categories, preferencesRow{
+			TypeSendCategory: category,
+			Subscribed:       category.Mandatory || !preferences.OptedOutOf(category.ID),
+		})
+	}
+	return page, nil
+}
+
+func render(w http.ResponseWriter, status int, page *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	page.Execute(w, data)
+}
+
+const pageLayout = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{ block "title" . }}Unsubscribe{{ end }}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f5f5f5; color: #222; margin: 0; }
+main { max-width: 28rem; margin: 4rem auto; padding: 2rem; background: #fff; border-radius: 8px; }
+button { font-size: 1rem; padding: .6rem 1.2rem; border: 0; border-radius: 4px; background: #222; color: #fff; cursor: pointer; }
+button.secondary { background: none; color: #222; text-decoration: underline; padding: 0; }
+label { display: block; margin: 1rem 0; }
+label small { display: block; color: #666; margin-left: 1.6rem; }
+</style>
+</head>
+<body><main>{{ template "content" . }}</main></body>
+</html>`
+
+var (
+	confirmPage = template.Must(template.Must(template.New("confirm").Parse(pageLayout)).Parse(`{{ define "content" }}
+<h1>Unsubscribe?</h1>
+<p>{{ .Token.ToAddress }} will no longer receive {{ with .Category }}{{ .Name }} emails{{ else }}these emails{{ end }}.</p>
+<form method="post"><button type="submit">Unsubscribe</button></form>
+{{ with .PreferencesURL }}<p><a href="{{ . }}">Manage all email preferences</a></p>{{ end }}
+{{ end }}`))
+
+	donePage = template.Must(template.Must(template.New("done").Parse(pageLayout)).Parse(`{{ define "content" }}
+<h1>You're unsubscribed</h1>
+<p>{{ .Token.ToAddress }} will no longer receive {{ with .Category }}{{ .Name }} emails{{ else }}these emails{{ end }}.</p>
+{{ with .PreferencesURL }}<p><a href="{{ . }}">Manage all email preferences</a></p>{{ end }}
+{{ end }}`))
+
+	preferencesCenterPage = template.Must(template.Must(template.New("preferences").Parse(pageLayout)).Parse(`{{ define "title" }}Email preferences{{ end }}
+{{ define "content" }}
+<h1>Email preferences</h1>
+{{ if .Saved }}<p><strong>Your preferences have been saved.</strong></p>{{ end }}
+{{ if .Blocked }}
+<p>We can't send emails to {{ .Token.ToAddress }} right now. Please contact support to start receiving them again.</p>
+{{ else }}
+{{ if .Unsubscribed }}<p>{{ .Token.ToAddress }} is unsubscribed from all emails. Saving your preferences will resubscribe you to those ticked.</p>{{ end }}
+{{ if .Categories }}
+<form method="post">
+<p>Choose which emails {{ .Token.ToAddress }} receives.</p>
+{{ range .Categories }}<label><input type="checkbox" name="category" value="{{ .ID }}"{{ if .Subscribed }} checked{{ end }}{{ if .Mandatory }} disabled{{ end }}> {{ .Name }}{{ if .Mandatory }} (always sent){{ end }}{{ with .Description }}<small>{{ . }}</small>{{ end }}</label>
+{{ end }}<button type="submit">Save preferences</button>
+</form>
+{{ end }}
+{{ if not .Unsubscribed }}<form method="post"><input type="hidden" name="all" value="1"><p><button class="secondary" type="submit">Unsubscribe from all emails</button></p></form>{{ end }}
+{{ end }}
+{{ end }}`))
+
+	invalidPage = template.Must(template.Must(template.New("invalid").Parse(pageLayout)).Parse(`{{ define "content" }}
+<h1>This link isn't valid</h1>
+<p>Please use the unsubscribe link from a recent email.</p>
+{{ end }}`))
+)
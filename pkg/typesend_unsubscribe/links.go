@@ -0,0 +1,99 @@
+package typesend_unsubscribe
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+)
+
+// URLVariable is the template variable holding the envelopes
+// unsubscribe URL, as in <a href="{{ .UnsubscribeURL }}">.
+const URLVariable = "UnsubscribeURL"
+
+// PreferencesURLVariable is the template variable holding
+// the envelopes preference center URL.
+const PreferencesURLVariable = "PreferencesURL"
+
+// PreferencesParameter is the query parameter that
+// sends a link to the preference center.
+const PreferencesParameter = "preferences"
+
+// Links builds the signed unsubscribe links for each envelope.
+type Links struct {
+	Signer *Signer
+	// Where the Handler is served, e.g. "https://unsubscribe.example.com/".
+	BaseURL *url.URL
+	// Optional; an address that unsubscribes whoever emails it,
+	// with the signed token as the subject. Receiving and acting on
+	// those emails is left to the operator.
+	Mailto string
+}
+
+// NewLinks requires an https baseURL, as RFC 8058 does.
+func NewLinks(signer *Signer, baseURL string, mailto string) (*Links, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("typesend: invalid unsubscribe URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("typesend: unsubscribe URL must be an absolute https URL")
+	}
+
+	return &Links{Signer: signer, BaseURL: parsed, Mailto: mailto}, nil
+}
+
+func envelopeToken(envelope *typesend_schemas.TypeSendEnvelope, category string) Token {
+	return Token{
+		AppID:      envelope.AppID,
+		TenantID:   envelope.TenantID,
+		EnvelopeID: envelope.ID,
+		ToAddress:  envelope.ToAddress,
+		Category:   category,
+	}
+}
+
+// URL returns the envelopes unsubscribe page. With a category,
+// it unsubscribes from just that category.
+func (l *Links) URL(envelope *typesend_schemas.TypeSendEnvelope, category string) (string, error) {
+	signed, err := l.Signer.Sign(envelopeToken(envelope, category))
+	if err != nil {
+		return "", err
+	}
+	return l.url(signed, false), nil
+}
+
+// PreferencesURL returns the envelopes preference center.
+func (l *Links) PreferencesURL(envelope *typesend_schemas.TypeSendEnvelope) (string, error) {
+	signed, err := l.Signer.Sign(envelopeToken(envelope, ""))
+	if err != nil {
+		return "", err
+	}
+	return l.url(signed, true), nil
+}
+
+// Headers returns the List-Unsubscribe headers for the envelope,
+// unsubscribing from the category as URL does.
+func (l *Links) Headers(envelope *typesend_schemas.TypeSendEnvelope, category string) (map[string]string, error) {
+	signed, err := l.Signer.Sign(envelopeToken(envelope, category))
+	if err != nil {
+		return nil, err
+	}
+
+	mailto := ""
+	if l.Mailto != "" {
+		mailto = "mailto:" + l.Mailto + "?subject=" + signed
+	}
+	return typesend_schemas.ListUnsubscribeHeaders(l.url(signed, false), mailto), nil
+}
+
+func (l *Links) url(signed string, preferences bool) string {
+	link := *l.BaseURL
+	query := link.Query()
+	query.Set("token", signed)
+	if preferences {
+		query.Set(PreferencesParameter, "1")
+	}
+	link.RawQuery = query.Encode()
+	return link.String()
+}
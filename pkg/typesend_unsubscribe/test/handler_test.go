@@ -0,0 +1,152 @@
+package typesend_unsubscribe_test
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHandler(t *testing.T) (*typesend_unsubscribe.Handler, *typesend_db.TestDatabase, string) {
+	db := &typesend_db.TestDatabase{}
+	assert.NoError(t, db.Connect(context.Background()))
+
+	signer, err := typesend_unsubscribe.NewSigner(secret("a"))
+	assert.NoError(t, err)
+	signed, err := signer.Sign(testToken())
+	assert.NoError(t, err)
+
+	return &typesend_unsubscribe.Handler{Database: db, Signer: signer}, db, signed
+}
+
+func suppression(t *testing.T, db *typesend_db.TestDatabase) *typesend_schemas.TypeSendSuppression {
+	suppression, err := db.GetSuppression(context.Background(), "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	return suppression
+}
+
+func TestHandlerConfirmationPage(t *testing.T) {
+	handler, db, signed := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?token="+signed, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "test@example.com")
+	assert.Contains(t, w.Body.String(), `<form method="post">`)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Nil(t, suppression(t, db), "viewing the page must not unsubscribe, as link scanners follow it")
+}
+
+func TestHandlerOneClick(t *testing.T) {
+	handler, db, signed := newHandler(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/?token="+signed, strings.NewReader("List-Unsubscribe=One-Click"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "unsubscribed", w.Body.String())
+
+	got := suppression(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED, got.Reason)
+		assert.Contains(t, got.Note, "envelope")
+	}
+}
+
+func TestHandlerConfirmationForm(t *testing.T) {
+	handler, db, signed := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?token="+signed, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "unsubscribed")
+	assert.NotNil(t, suppression(t, db))
+}
+
+func TestHandlerKeepsExistingSuppression(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	assert.NoError(t, db.PutSuppression(context.Background(), &typesend_schemas.TypeSendSuppression{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		Reason:   typesend_schemas.TypeSendSuppressionReason_COMPLAINED,
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/?token="+signed, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	got := suppression(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, got.Reason, "an unsubscribe should not replace a complaint")
+	}
+}
+
+func TestHandlerInvalidToken(t *testing.T) {
+	handler, db, signed := newHandler(t)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/?token="+url.QueryEscape(signed+"x"), nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, method)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	assert.Nil(t, suppression(t, db))
+}
+
+func TestHandlerMethodNotAllowed(t *testing.T) {
+	handler, _, signed := newHandler(t)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/?token="+signed, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Contains(t, w.Header().Get("Allow"), "POST")
+}
+
+func TestHandleFunctionURL(t *testing.T) {
+	handler, db, signed := newHandler(t)
+
+	response, err := handler.HandleFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath:        "/",
+		RawQueryString: "token=" + signed,
+		Headers:        map[string]string{"content-type": "application/x-www-form-urlencoded"},
+		Body:           base64.StdEncoding.EncodeToString([]byte("List-Unsubscribe=One-Click")),
+		// Function URLs base64 encode form bodies.
+		IsBase64Encoded: true,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodPost},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "unsubscribed", response.Body)
+	assert.NotNil(t, suppression(t, db))
+
+	response, err = handler.HandleFunctionURL(context.Background(), events.LambdaFunctionURLRequest{
+		RawPath:        "/",
+		RawQueryString: "token=" + signed,
+		RequestContext: events.LambdaFunctionURLRequestContext{
+			HTTP: events.LambdaFunctionURLRequestContextHTTPDescription{Method: http.MethodGet},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, response.Headers["Content-Type"], "text/html")
+}
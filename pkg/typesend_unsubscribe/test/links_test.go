@@ -0,0 +1,87 @@
+package typesend_unsubscribe_test
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
+	"github.com/stretchr/testify/assert"
+)
+
+func testEnvelope() *typesend_schemas.TypeSendEnvelope {
+	return &typesend_schemas.TypeSendEnvelope{
+		ID:        "envelope",
+		AppID:     "app",
+		TenantID:  "base",
+		ToAddress: "test@example.com",
+	}
+}
+
+func TestNewLinksRequiresHTTPS(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+
+	for _, invalid := range []string{"http://example.com/", "/unsubscribe", "://"} {
+		_, err := typesend_unsubscribe.NewLinks(signer, invalid, "")
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestLinksURL(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	links, err := typesend_unsubscribe.NewLinks(signer, "https://example.com/unsubscribe?lang=en", "")
+	assert.NoError(t, err)
+
+	link, err := links.URL(testEnvelope(), "billing")
+	assert.NoError(t, err)
+
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", parsed.Host)
+	assert.Equal(t, "/unsubscribe", parsed.Path)
+	assert.Equal(t, "en", parsed.Query().Get("lang"), "the base URLs own query should be kept")
+
+	token, err := signer.Verify(parsed.Query().Get("token"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, token) {
+		assert.Equal(t, "envelope", token.EnvelopeID)
+		assert.Equal(t, "test@example.com", token.ToAddress)
+		assert.Equal(t, "app", token.AppID)
+		assert.Equal(t, "base", token.TenantID)
+		assert.Equal(t, "billing", token.Category)
+	}
+	assert.False(t, parsed.Query().Has(typesend_unsubscribe.PreferencesParameter))
+}
+
+func TestLinksPreferencesURL(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	links, _ := typesend_unsubscribe.NewLinks(signer, "https://example.com/unsubscribe", "")
+
+	link, err := links.PreferencesURL(testEnvelope())
+	assert.NoError(t, err)
+
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	assert.True(t, parsed.Query().Has(typesend_unsubscribe.PreferencesParameter))
+
+	token, err := signer.Verify(parsed.Query().Get("token"))
+	assert.NoError(t, err)
+	if assert.NotNil(t, token) {
+		assert.Equal(t, "test@example.com", token.ToAddress)
+		assert.Empty(t, token.Category)
+	}
+}
+
+func TestLinksHeaders(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	links, _ := typesend_unsubscribe.NewLinks(signer, "https://example.com/", "unsubscribe@example.com")
+
+	headers, err := links.Headers(testEnvelope(), "billing")
+	assert.NoError(t, err)
+
+	link, _ := links.URL(testEnvelope(), "billing")
+	listUnsubscribe := headers[typesend_schemas.HeaderListUnsubscribe]
+	assert.True(t, strings.HasPrefix(listUnsubscribe, "<"+link+">, <mailto:unsubscribe@example.com?subject="), listUnsubscribe)
+	assert.Equal(t, "List-Unsubscribe=One-Click", headers[typesend_schemas.HeaderListUnsubscribePost])
+}
@@ -0,0 +1,176 @@
+package typesend_unsubscribe_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_db"
+	"github.com/kvizdos/typesend/pkg/typesend_schemas"
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
+	"github.com/stretchr/testify/assert"
+)
+
+func putCategories(t *testing.T, db *typesend_db.TestDatabase) {
+	assert.NoError(t, db.PutCategories(context.Background(), "app", []*typesend_schemas.TypeSendCategory{
+		{ID: "newsletter", Name: "Newsletter", Description: "Monthly product news"},
+		{ID: "billing", Name: "Billing"},
+		{ID: "security", Name: "Security alerts", Mandatory: true},
+	}))
+}
+
+func preferences(t *testing.T, db *typesend_db.TestDatabase) *typesend_schemas.TypeSendPreferences {
+	preferences, err := db.GetPreferences(context.Background(), "app", "base", "test@example.com")
+	assert.NoError(t, err)
+	return preferences
+}
+
+func postForm(handler http.Handler, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerCategoryConfirmationPage(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?token="+signed, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Newsletter emails")
+	assert.Contains(t, w.Body.String(), typesend_unsubscribe.PreferencesParameter+"=1")
+}
+
+func TestHandlerOneClickCategory(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+
+	w := postForm(handler, "/?token="+signed, url.Values{"List-Unsubscribe": {"One-Click"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Nil(t, suppression(t, db), "only the category should be unsubscribed from")
+	got := preferences(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, []string{"newsletter"}, got.OptedOut)
+	}
+
+	w = postForm(handler, "/?token="+signed, url.Values{"List-Unsubscribe": {"One-Click"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"newsletter"}, preferences(t, db).OptedOut, "unsubscribing twice should be harmless")
+}
+
+func TestHandlerMandatoryCategory(t *testing.T) {
+	handler, db, _ := newHandler(t)
+	putCategories(t, db)
+
+	token := testToken()
+	token.Category = "security"
+	signed, err := handler.Signer.Sign(token)
+	assert.NoError(t, err)
+
+	w := postForm(handler, "/?token="+signed, url.Values{"List-Unsubscribe": {"One-Click"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.NotNil(t, suppression(t, db), "mandatory categories can't be opted out of, so everything is")
+	assert.Nil(t, preferences(t, db))
+}
+
+func TestHandlerPreferenceCenter(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+	assert.NoError(t, db.PutPreferences(context.Background(), &typesend_schemas.TypeSendPreferences{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		OptedOut: []string{"billing"},
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?preferences=1&token="+signed, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "Email preferences")
+	assert.Contains(t, body, `value="newsletter" checked>`)
+	assert.Contains(t, body, `value="billing">`)
+	assert.Contains(t, body, `value="security" checked disabled>`)
+	assert.Contains(t, body, "Monthly product news")
+}
+
+func TestHandlerSavePreferences(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+	ctx := context.Background()
+	assert.NoError(t, db.PutPreferences(ctx, &typesend_schemas.TypeSendPreferences{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		OptedOut: []string{"billing", "retired"},
+	}))
+	assert.NoError(t, db.PutSuppression(ctx, &typesend_schemas.TypeSendSuppression{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		Reason:   typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED,
+	}))
+
+	w := postForm(handler, "/?preferences=1&token="+signed, url.Values{"category": {"billing", "unknown"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "saved")
+
+	got := preferences(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, []string{"newsletter", "retired"}, got.OptedOut, "opt outs of categories not shown should be kept")
+	}
+	assert.Nil(t, suppression(t, db), "saving preferences should lift an unsubscribe from everything")
+}
+
+func TestHandlerSavePreferencesKeepsComplaint(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+	assert.NoError(t, db.PutSuppression(context.Background(), &typesend_schemas.TypeSendSuppression{
+		AppID:    "app",
+		TenantID: "base",
+		Address:  "test@example.com",
+		Reason:   typesend_schemas.TypeSendSuppressionReason_COMPLAINED,
+	}))
+
+	w := postForm(handler, "/?preferences=1&token="+signed, url.Values{"category": {"newsletter", "billing"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	got := suppression(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_COMPLAINED, got.Reason)
+	}
+}
+
+func TestHandlerPreferencesUnsubscribeAll(t *testing.T) {
+	handler, db, signed := newHandler(t)
+	putCategories(t, db)
+
+	w := postForm(handler, "/?preferences=1&token="+signed, url.Values{"all": {"1"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "unsubscribed from all emails")
+
+	got := suppression(t, db)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, typesend_schemas.TypeSendSuppressionReason_UNSUBSCRIBED, got.Reason)
+	}
+}
+
+func TestHandlerPreferencesInvalidToken(t *testing.T) {
+	handler, _, signed := newHandler(t)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/?preferences=1&token="+url.QueryEscape(signed+"x"), nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, method)
+	}
+}
@@ -0,0 +1,105 @@
+package typesend_unsubscribe_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/kvizdos/typesend/pkg/typesend_unsubscribe"
+	"github.com/stretchr/testify/assert"
+)
+
+func secret(fill string) []byte {
+	return []byte(strings.Repeat(fill, typesend_unsubscribe.MinSecretSize))
+}
+
+func testToken() typesend_unsubscribe.Token {
+	return typesend_unsubscribe.Token{
+		AppID:      "app",
+		TenantID:   "base",
+		EnvelopeID: "envelope",
+		ToAddress:  "test@example.com",
+		Category:   "newsletter",
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer, err := typesend_unsubscribe.NewSigner(secret("a"))
+	assert.NoError(t, err)
+
+	signed, err := signer.Sign(testToken())
+	assert.NoError(t, err)
+	assert.NotContains(t, signed, "+", "tokens should be URL safe")
+	assert.NotContains(t, signed, "/")
+
+	token, err := signer.Verify(signed)
+	assert.NoError(t, err)
+	if assert.NotNil(t, token) {
+		assert.Equal(t, testToken(), *token)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	signed, _ := signer.Sign(testToken())
+	_, signature, _ := strings.Cut(signed, ".")
+
+	other := testToken()
+	other.ToAddress = "victim@example.com"
+	otherSigned, _ := signer.Sign(other)
+	otherPayload, _, _ := strings.Cut(otherSigned, ".")
+
+	_, err := signer.Verify(otherPayload + "." + signature)
+	assert.Error(t, err, "a signature should only verify its own payload")
+
+	for _, malformed := range []string{"", "payload", "payload.", "!!.!!", signed + "x"} {
+		_, err := signer.Verify(malformed)
+		assert.Error(t, err, malformed)
+	}
+
+	stranger, _ := typesend_unsubscribe.NewSigner(secret("b"))
+	_, err = stranger.Verify(signed)
+	assert.Error(t, err, "tokens should only verify with the secret that signed them")
+}
+
+func TestSignerRotation(t *testing.T) {
+	old, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	signed, _ := old.Sign(testToken())
+
+	rotated, err := typesend_unsubscribe.NewSigner(secret("b"), secret("a"))
+	assert.NoError(t, err)
+
+	_, err = rotated.Verify(signed)
+	assert.NoError(t, err, "links signed before a rotation should keep working")
+
+	fresh, _ := rotated.Sign(testToken())
+	_, err = old.Verify(fresh)
+	assert.Error(t, err, "new links should be signed with the newest secret")
+}
+
+func TestSignRequiresRecipient(t *testing.T) {
+	signer, _ := typesend_unsubscribe.NewSigner(secret("a"))
+	token := testToken()
+	token.ToAddress = ""
+	_, err := signer.Sign(token)
+	assert.Error(t, err)
+}
+
+func TestParseSecrets(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(secret("a"))
+	signer, err := typesend_unsubscribe.ParseSecrets(encoded + ", " + base64.StdEncoding.EncodeToString(secret("b")))
+	assert.NoError(t, err)
+	if assert.NotNil(t, signer) {
+		assert.Len(t, signer.Secrets, 2)
+		assert.Equal(t, secret("a"), signer.Secrets[0])
+	}
+
+	_, err = typesend_unsubscribe.ParseSecrets("")
+	assert.Error(t, err)
+
+	_, err = typesend_unsubscribe.ParseSecrets(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+
+	_, err = typesend_unsubscribe.ParseSecrets("not base64!")
+	assert.Error(t, err)
+}
@@ -0,0 +1,73 @@
+package typesend_unsubscribe
+
+import (
+	"fmt"
+
+	"github.com/kvizdos/typesend/internal/signing"
+)
+
+// Token is what an unsubscribe link carries. It is signed rather than
+// encrypted, so holds nothing the recipient doesn't already know.
+type Token struct {
+	AppID      string `json:"app"`
+	TenantID   string `json:"tenant"`
+	EnvelopeID string `json:"envelope"`
+	ToAddress  string `json:"to"`
+	// Optional; the category of mail the envelope belongs to.
+	Category string `json:"category,omitempty"`
+}
+
+func (t *Token) Validate() error {
+	if t.AppID == "" || t.TenantID == "" || t.ToAddress == "" {
+		return fmt.Errorf("typesend: unsubscribe token needs an AppID, TenantID and ToAddress")
+	}
+	return nil
+}
+
+// Secrets shorter than this are rejected.
+const MinSecretSize = signing.MinSecretSize
+
+// Signer signs and verifies tokens with HMAC-SHA256.
+type Signer struct {
+	// Secrets[0] signs; all of them verify, so a secret can be
+	// rotated without breaking links already sent.
+	Secrets [][]byte
+}
+
+func NewSigner(secrets ...[]byte) (*Signer, error) {
+	if err := signing.CheckSecrets("unsubscribe", secrets); err != nil {
+		return nil, err
+	}
+	return &Signer{Secrets: secrets}, nil
+}
+
+// ParseSecrets reads a comma separated list of base64 secrets,
+// newest first, such as TYPESEND_UNSUBSCRIBE_SECRETS.
+func ParseSecrets(raw string) (*Signer, error) {
+	secrets, err := signing.ParseSecrets("unsubscribe", raw)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigner(secrets...)
+}
+
+// Sign returns the token as "<payload>.<signature>", both URL safe
+// base64, ready to be put in a query string.
+func (s *Signer) Sign(token Token) (string, error) {
+	if err := token.Validate(); err != nil {
+		return "", err
+	}
+	return signing.Sign(s.Secrets[0], "unsubscribe token", token)
+}
+
+// Verify returns the token Sign signed, if any of the Secrets signed it.
+func (s *Signer) Verify(signed string) (*Token, error) {
+	var token Token
+	if err := signing.Verify(s.Secrets, "unsubscribe token", signed, &token); err != nil {
+		return nil, err
+	}
+	if err := token.Validate(); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
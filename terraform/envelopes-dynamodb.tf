@@ -29,11 +29,94 @@ resource "aws_dynamodb_table" "typesend_envelopes" {
     type = "S"
   }
 
+  attribute {
+    name = "address"
+    type = "S"
+  }
+
   attribute {
     name = "ref"
     type = "S"
   }
 
+  attribute {
+    name = "eventEnvelope"
+    type = "S"
+  }
+
+  attribute {
+    name = "occurredAt"
+    type = "S"
+  }
+
+  attribute {
+    name = "eventDay"
+    type = "S"
+  }
+
+  attribute {
+    name = "providerMessageId"
+    type = "S"
+  }
+
+  attribute {
+    name = "rollupApp"
+    type = "S"
+  }
+
+  attribute {
+    name = "rollupKey"
+    type = "S"
+  }
+
+  # Retention expiry times, Unix seconds. Only set when retained.
+  attribute {
+    name = "contentExpiresAt"
+    type = "N"
+  }
+
+  attribute {
+    name = "expiresAt"
+    type = "N"
+  }
+
+  # "<status>#<priority>", only set while an envelope is UNSENT.
+  attribute {
+    name = "statusPriority"
+    type = "S"
+  }
+
+  # Expires idempotency keys, rate limit windows and, with a
+  # retention policy, envelopes. Unix seconds.
+  ttl {
+    attribute_name = "expiresAt"
+    enabled        = true
+  }
+
+  # One partition per priority lane of the ready backlog.
+  global_secondary_index {
+    name            = "statusPriority-scheduledFor-index"
+    hash_key        = "statusPriority"
+    range_key       = "scheduledFor"
+    projection_type = "ALL"
+  }
+
+  # Finished envelopes due for PurgeExpiredData. KEYS_ONLY
+  # projects the range key, which is all it reads.
+  global_secondary_index {
+    name            = "status-contentExpiresAt-index"
+    hash_key        = "status"
+    range_key       = "contentExpiresAt"
+    projection_type = "KEYS_ONLY"
+  }
+
+  global_secondary_index {
+    name            = "status-expiresAt-index"
+    hash_key        = "status"
+    range_key       = "expiresAt"
+    projection_type = "KEYS_ONLY"
+  }
+
   global_secondary_index {
     name            = "status-scheduledFor-index"
     hash_key        = "status"
@@ -52,4 +135,42 @@ resource "aws_dynamodb_table" "typesend_envelopes" {
     hash_key        = "toInternal"
     projection_type = "ALL"
   }
+
+  # Sparse; only suppression and preferences items have address.
+  global_secondary_index {
+    name            = "address-index"
+    hash_key        = "address"
+    projection_type = "ALL"
+  }
+
+  # Sparse; only event log items have eventEnvelope.
+  global_secondary_index {
+    name            = "eventEnvelope-occurredAt-index"
+    hash_key        = "eventEnvelope"
+    range_key       = "occurredAt"
+    projection_type = "ALL"
+  }
+
+  # Sparse; also only on event log items, to aggregate a day.
+  global_secondary_index {
+    name            = "eventDay-occurredAt-index"
+    hash_key        = "eventDay"
+    range_key       = "occurredAt"
+    projection_type = "ALL"
+  }
+
+  # Sparse; only on events a provider reported a message ID for.
+  global_secondary_index {
+    name            = "providerMessageId-index"
+    hash_key        = "providerMessageId"
+    projection_type = "ALL"
+  }
+
+  # Sparse; only analytics rollups have rollupApp.
+  global_secondary_index {
+    name            = "rollupApp-rollupKey-index"
+    hash_key        = "rollupApp"
+    range_key       = "rollupKey"
+    projection_type = "ALL"
+  }
 }
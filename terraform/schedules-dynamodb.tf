@@ -0,0 +1,28 @@
+resource "aws_dynamodb_table" "typesend_schedules" {
+  name         = "${vars.project}_typesend_schedules"
+  billing_mode = "PAY_PER_REQUEST"
+  hash_key     = "id"
+
+  attribute {
+    name = "id"
+    type = "S"
+  }
+
+  # Used by the dispatcher to find schedules that are due.
+  attribute {
+    name = "state"
+    type = "N"
+  }
+
+  attribute {
+    name = "nextRunAt"
+    type = "S"
+  }
+
+  global_secondary_index {
+    name            = "state-nextRunAt-index"
+    hash_key        = "state"
+    range_key       = "nextRunAt"
+    projection_type = "ALL"
+  }
+}